@@ -0,0 +1,200 @@
+"""Chapter markers from sidecar files.
+
+Podcast and audiobook tooling often writes chapters next to the audio
+rather than into it. A sibling <name>.chapters.json or <name>.ffmetadata is
+read, checked against the audio's duration and handed to FFmpeg as an
+ffmetadata input, from which the output's chapters are mapped.
+
+The JSON sidecar is a list of chapters (or {"chapters": [...]}), each with
+a start in seconds, an optional end and an optional title:
+
+    [{"start": 0, "title": "Intro"}, {"start": 95.5, "title": "Interview"}]
+
+A chapter without an end runs until the next one starts, the last one until
+the end of the audio.
+"""
+
+import json
+from dataclasses import dataclass
+from fractions import Fraction
+from pathlib import Path
+from typing import Any, Dict, List, Optional
+
+from src.storage.extensions import base_name
+
+# Sidecar suffixes, in order of preference
+CHAPTER_SIDECAR_SUFFIXES = (".chapters.json", ".ffmetadata")
+
+FFMETADATA_HEADER = ";FFMETADATA1"
+
+
+class ChapterError(Exception):
+    """Raised when a chapter sidecar is malformed or does not fit the audio."""
+
+
+@dataclass
+class Chapter:
+    """One chapter, with times in seconds."""
+
+    start: float
+    end: Optional[float] = None
+    title: str = ""
+
+
+def find_chapter_sidecar(input_path: Path) -> Optional[Path]:
+    """Find the chapter sidecar next to an audio file.
+
+    Args:
+        input_path: The audio file
+
+    Returns:
+        Path of <name>.chapters.json or <name>.ffmetadata, or None
+    """
+    for suffix in CHAPTER_SIDECAR_SUFFIXES:
+        sidecar = input_path.with_name(base_name(input_path) + suffix)
+        if sidecar.is_file():
+            return sidecar
+    return None
+
+
+def load_chapters(sidecar: Path) -> List[Chapter]:
+    """Read chapters from a JSON or ffmetadata sidecar.
+
+    Args:
+        sidecar: Path to the sidecar file
+
+    Returns:
+        Chapters in file order
+
+    Raises:
+        ChapterError: If the sidecar cannot be read or parsed
+    """
+    try:
+        text = sidecar.read_text(encoding="utf-8")
+    except (OSError, UnicodeDecodeError) as e:
+        raise ChapterError(f"Cannot read chapter sidecar {sidecar}: {e}")
+    if sidecar.name.lower().endswith(".json"):
+        return _parse_json(text, sidecar)
+    return _parse_ffmetadata(text, sidecar)
+
+
+def _parse_json(text: str, sidecar: Path) -> List[Chapter]:
+    try:
+        data = json.loads(text)
+    except json.JSONDecodeError as e:
+        raise ChapterError(f"Invalid chapter sidecar {sidecar}: {e}")
+    if isinstance(data, dict):
+        data = data.get("chapters")
+    if not isinstance(data, list):
+        raise ChapterError(f"Chapter sidecar {sidecar} holds no chapter list")
+
+    chapters = []
+    for entry in data:
+        try:
+            chapters.append(_chapter_from_dict(entry))
+        except (KeyError, TypeError, ValueError) as e:
+            raise ChapterError(f"Invalid chapter {entry!r} in {sidecar}: {e}")
+    return chapters
+
+
+def _chapter_from_dict(entry: Dict[str, Any]) -> Chapter:
+    end = entry.get("end")
+    return Chapter(
+        start=float(entry["start"]),
+        end=float(end) if end is not None else None,
+        title=str(entry.get("title") or ""),
+    )
+
+
+def _parse_ffmetadata(text: str, sidecar: Path) -> List[Chapter]:
+    lines = text.splitlines()
+    if not lines or lines[0].strip() != FFMETADATA_HEADER:
+        raise ChapterError(f"{sidecar} is not an ffmetadata file")
+
+    sections: List[Dict[str, str]] = []
+    current: Optional[Dict[str, str]] = None
+    for line in lines[1:]:
+        line = line.strip()
+        if not line or line.startswith((";", "#")):
+            continue
+        if line.startswith("["):
+            current = {} if line.upper() == "[CHAPTER]" else None
+            if current is not None:
+                sections.append(current)
+        elif current is not None and "=" in line:
+            key, value = line.split("=", 1)
+            current[key.strip().upper()] = value
+
+    chapters = []
+    for section in sections:
+        try:
+            timebase = Fraction(section.get("TIMEBASE", "1/1000"))
+            start = float(int(section["START"]) * timebase)
+            end = float(int(section["END"]) * timebase) if "END" in section else None
+        except (KeyError, ValueError, ZeroDivisionError) as e:
+            raise ChapterError(f"Invalid chapter in {sidecar}: {e}")
+        chapters.append(Chapter(start=start, end=end, title=section.get("TITLE", "")))
+    return chapters
+
+
+def validate_chapters(chapters: List[Chapter], duration_s: float) -> List[Chapter]:
+    """Check chapters against the audio and fill in missing ends.
+
+    Args:
+        chapters: Chapters as read from the sidecar
+        duration_s: Duration of the audio in seconds
+
+    Returns:
+        The chapters, each with an end
+
+    Raises:
+        ChapterError: If a chapter starts before 0 or outside the audio, ends
+            after it or before its start, or chapters are out of order
+    """
+    resolved = []
+    for index, chapter in enumerate(chapters):
+        label = f"Chapter {index + 1} ({chapter.title or 'untitled'})"
+        if chapter.start < 0 or chapter.start >= duration_s:
+            raise ChapterError(
+                f"{label} starts at {chapter.start:g}s, outside the "
+                f"{duration_s:g}s of audio"
+            )
+        if resolved and chapter.start < resolved[-1].end:
+            raise ChapterError(f"{label} starts before the previous chapter ends")
+
+        end = chapter.end
+        if end is None:
+            following = chapters[index + 1] if index + 1 < len(chapters) else None
+            end = following.start if following else duration_s
+        if end <= chapter.start:
+            raise ChapterError(f"{label} ends at {end:g}s, before it starts")
+        if end > duration_s:
+            raise ChapterError(
+                f"{label} ends at {end:g}s, after the {duration_s:g}s of audio"
+            )
+        resolved.append(Chapter(start=chapter.start, end=end, title=chapter.title))
+    return resolved
+
+
+def _escape(value: str) -> str:
+    """Escape a value for an ffmetadata file."""
+    for special in ("\\", "=", ";", "#", "\n"):
+        value = value.replace(special, "\\" + special)
+    return value
+
+
+def ffmetadata(chapters: List[Chapter]) -> str:
+    """Render validated chapters as an ffmetadata file, in milliseconds."""
+    lines = [FFMETADATA_HEADER]
+    for chapter in chapters:
+        lines.extend(
+            [
+                "[CHAPTER]",
+                "TIMEBASE=1/1000",
+                f"START={round(chapter.start * 1000)}",
+                f"END={round(chapter.end * 1000)}",
+            ]
+        )
+        if chapter.title:
+            lines.append(f"title={_escape(chapter.title)}")
+    return "\n".join(lines) + "\n"
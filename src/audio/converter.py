@@ -6,12 +6,36 @@ structured logging.
 """
 
 import asyncio
-import hashlib
 import json
+import os
+import re
+import shutil
 import structlog
+import tempfile
+import time
 from dataclasses import dataclass
 from pathlib import Path
-from typing import List, Optional, Tuple
+from typing import Any, BinaryIO, Dict, List, Optional, Tuple
+
+from src.audio.chapters import (
+    ChapterError,
+    ffmetadata,
+    find_chapter_sidecar,
+    load_chapters,
+    validate_chapters,
+)
+from src.audio.format_detector import (
+    AudioFormatDetector,
+    CorruptedAudioFileError,
+    UnsupportedAudioFormatError,
+)
+from src.integrations.artwork import image_type
+from src.processor.filters import compose_filters, validate_filters
+from src.processor.priority import niceness_preexec, validate_priority, with_io_class
+from src.storage.checksum import CHECKSUM_ALGORITHMS, compute_checksum
+from src.storage.extensions import base_name, normalized_extension
+from src.state.state import FileState, StateManager
+from src.storage.storage import atomic_replace, fsync_file
 
 
 @dataclass
@@ -24,6 +48,14 @@ class AudioConversionResult:
     duration_ms: float
     size_bytes: int
     error_message: Optional[str] = None
+    checksum_algorithm: str = "sha256"
+    # FLAC compression level the output was encoded at (None for other formats)
+    compression_level: Optional[int] = None
+    # Set when the state showed the output already converted and intact
+    skipped: bool = False
+    skip_reason: Optional[str] = None
+    # Set when a recorded output was missing, changed or stale and was redone
+    reprocessed: bool = False
 
 
 @dataclass
@@ -35,6 +67,25 @@ class AudioProperties:
     is_lossless: bool
     channels: Optional[int] = None
     bit_depth: Optional[int] = None
+    bit_rate: Optional[int] = None
+
+
+@dataclass
+class AudioOutputPlan:
+    """Planned output of a conversion, worked out without encoding."""
+
+    input_path: Path
+    output_path: Path
+    codec: str
+    sample_rate: Optional[int]
+    channels: Optional[int]
+    bitrate: int  # Estimated output bitrate in bits/s
+    duration_ms: float
+    estimated_size_bytes: int
+    command: List[str]
+    # Probed source codec and bitrate (bits/s), None if the probe failed
+    source_codec: Optional[str] = None
+    source_bitrate: Optional[int] = None
 
 
 class FFmpegError(Exception):
@@ -46,6 +97,145 @@ class FFmpegError(Exception):
         self.stderr = stderr
 
 
+class EncodeTimeoutError(FFmpegError):
+    """Raised when an FFmpeg encode runs longer than the encode timeout."""
+
+
+class StreamNotSeekableError(FFmpegError):
+    """Raised when a streamed input needs a seekable file to be decoded."""
+
+
+class OutputValidationError(Exception):
+    """Raised when FFmpeg reports success but the output file is unusable."""
+
+
+def parse_bitrate(bitrate: str) -> int:
+    """Convert an FFmpeg bitrate such as "128k" or "1.5M" to bits/s."""
+    multipliers = {"k": 1000, "m": 1000000}
+    suffix = bitrate[-1:].lower()
+    if suffix in multipliers:
+        return int(float(bitrate[:-1]) * multipliers[suffix])
+    return int(bitrate)
+
+
+# Non-fatal FFmpeg messages that can point at a quality problem in the output
+FFMPEG_WARNING_PATTERNS = [
+    re.compile(pattern, re.IGNORECASE)
+    for pattern in (
+        r"frames? duplicated",
+        r"frames? dropped",
+        r"non-monotonic dts",
+        r"non monotonically increasing dts",
+        r"error while decoding",
+        r"invalid data found",
+        r"header missing",
+        r"corrupt",
+        r"past duration .* too large",
+        r"queue input is backward in time",
+        r"clipping",
+    )
+]
+
+
+# Bytes of FFmpeg output kept in error messages; failures can print megabytes
+# of repeated warnings, and the cause is at the end
+DEFAULT_ERROR_OUTPUT_LIMIT = 4096
+
+
+def tail_output(output: str, limit: Optional[int]) -> str:
+    """Keep the last limit bytes of FFmpeg output for an error message.
+
+    Args:
+        output: FFmpeg's output
+        limit: Most bytes to keep (None or 0 = keep everything)
+
+    Returns:
+        The output, or its tail after a note of how much was cut
+    """
+    data = output.encode("utf-8")
+    if not limit or len(data) <= limit:
+        return output
+    tail = data[-limit:].decode("utf-8", errors="ignore")
+    return f"[... {len(data) - limit} bytes truncated ...]\n{tail}"
+
+
+# EBU R128 loudnorm settings besides the integrated target: true peak in
+# dBTP and loudness range in LU
+LOUDNESS_TRUE_PEAK = -1.5
+LOUDNESS_RANGE = 11
+
+# Integrated loudness targets loudnorm accepts, in LUFS
+LOUDNESS_TARGET_RANGE = (-70.0, -5.0)
+
+
+# ID3/FLAC picture type of a front cover, as FFmpeg names it
+FRONT_COVER = "Cover (front)"
+
+
+def parse_ffmpeg_warnings(stderr: str) -> List[str]:
+    """Pick the notable warnings out of FFmpeg's stderr.
+
+    The banner, stream listing and progress lines are ignored; each
+    distinct warning is returned once, in the order it first appeared.
+
+    Args:
+        stderr: FFmpeg's standard error output
+
+    Returns:
+        The notable warning lines, stripped
+    """
+    warnings: Dict[str, None] = {}
+    # Progress updates overwrite each other with carriage returns
+    for line in re.split(r"[\r\n]+", stderr or ""):
+        line = line.strip()
+        if line and any(p.search(line) for p in FFMPEG_WARNING_PATTERNS):
+            warnings[line] = None
+    return list(warnings)
+
+
+# Sibling image names (lower-case stems) and the picture type each is
+# embedded as; FFmpeg's FLAC and MP3 muxers read the type from the picture
+# stream's "comment" tag
+SIBLING_ARTWORK = {
+    "cover": FRONT_COVER,
+    "front": FRONT_COVER,
+    "folder": FRONT_COVER,
+    "back": "Cover (back)",
+    "disc": "Media",
+    "cd": "Media",
+}
+
+ARTWORK_EXTENSIONS = {".jpg", ".jpeg", ".png"}
+
+
+def find_sibling_artwork(input_path: Path) -> List[Tuple[Path, str]]:
+    """Find artwork images next to an audio file.
+
+    Args:
+        input_path: The audio file
+
+    Returns:
+        (image path, picture type) pairs, at most one per picture type, with
+        the front cover first
+    """
+    try:
+        siblings = sorted(input_path.parent.iterdir())
+    except OSError:
+        return []
+
+    found: Dict[str, Path] = {}
+    for name, picture_type in SIBLING_ARTWORK.items():
+        for path in siblings:
+            if (
+                picture_type not in found
+                and path.stem.lower() == name
+                and path.suffix.lower() in ARTWORK_EXTENSIONS
+                and path.is_file()
+            ):
+                found[picture_type] = path
+    return [(path, picture_type) for picture_type, path in found.items()]
+
+
 class AudioConverter:
     """
     Handles audio file conversion tasks using FFmpeg.
@@ -62,9 +252,23 @@ class AudioConverter:
         ".m4a",
         ".ogg",
         ".wav",
+        ".aiff",
+        ".aif",
         ".opus",
+        ".dsf",
+        ".dff",
+    }
+
+    # DSD containers are decoded to PCM; ffmpeg cannot encode them, so they
+    # are accepted as input only
+    DSD_FORMATS = {
+        "dsf",
+        "dff",
     }
 
+    # DSD64 bit rate (64 x 44.1kHz); higher DSD rates are multiples of this
+    DSD64_RATE = 2822400
+
     # Lossless audio formats
     # Note: OPUS is technically a lossy codec, but included here for high-quality
     # encoding settings as it provides near-transparent quality at high bitrates
@@ -73,14 +277,95 @@ class AudioConverter:
         "wav",
         "alac",
         "ape",
+        "dsd_lsbf",
+        "dsd_msbf",
+        "dsd_lsbf_planar",
+        "dsd_msbf_planar",
+    }
+
+    # Uncompressed PCM codecs (WAV, AIFF) are probed as e.g. pcm_s16le
+    LOSSLESS_CODEC_PREFIXES = ("pcm_",)
+
+    # Containers detected from content that only ever hold lossless audio
+    LOSSLESS_CONTAINERS = {"flac", "wav", "aiff", "dsf", "dff"}
+
+    # Typical output bitrates (bits/s) of lossy encoders with no target set
+    DEFAULT_LOSSY_BITRATES = {
+        "mp3": 128000,
+        "aac": 128000,
+        "ogg": 112000,
+        "opus": 96000,
     }
 
+    # FFmpeg encoders by output format; other formats are passed as named
+    OUTPUT_CODECS = {
+        "flac": "flac",
+        "mp3": "libmp3lame",
+        "aac": "aac",
+        "ogg": "libvorbis",
+        "opus": "libopus",
+        "wav": "pcm_s16le",
+    }
+
+    # PCM encoders for WAV output by bit depth
+    PCM_CODECS = {16: "pcm_s16le", 24: "pcm_s24le"}
+
+    # The only sample rates libopus encodes at
+    OPUS_SAMPLE_RATES = {8000, 12000, 16000, 24000, 48000}
+
+    # FFmpeg muxers/demuxers for formats named differently from their format
+    STREAM_MUXERS = {"aac": "adts"}
+    STREAM_DEMUXERS = {"opus": "ogg", "dff": "iff"}
+
+    # Inputs whose index may sit at the end of the file, so they cannot be
+    # decoded from a pipe
+    SEEKABLE_INPUT_FORMATS = {"m4a", "mp4", "mov"}
+
+    # FFmpeg errors that mean the input needed seeking
+    NOT_SEEKABLE_PATTERNS = ("moov atom not found", "illegal seek", "not seekable")
+
+    # Output formats whose containers carry embedded cover art
+    ARTWORK_FORMATS = {"flac", "mp3"}
+
+    # Output formats whose containers carry chapters
+    CHAPTER_FORMATS = {"flac", "mp3", "ogg", "opus"}
+
+    # FLAC typically stores music at around 60% of the PCM size
+    FLAC_SIZE_RATIO = 0.6
+
+    # Checksum algorithms for converted files; crc32 and md5 are offered for
+    # compatibility with external verification tools
+    CHECKSUM_ALGORITHMS = CHECKSUM_ALGORITHMS
+
     def __init__(
         self,
         output_format: str = "flac",
         sample_rate: Optional[int] = None,
         bit_depth: Optional[int] = None,
         compression_level: int = 5,
+        adaptive_compression: bool = True,
+        bitrate: Optional[str] = None,
+        verify_decodable: bool = False,
+        niceness: int = 0,
+        io_class: Optional[str] = None,
+        checksum_algorithm: str = "sha256",
+        checksum_sidecar: bool = False,
+        encode_timeout: Optional[float] = None,
+        audio_filters: Optional[List[str]] = None,
+        log_ffmpeg_warnings: bool = False,
+        no_upscale_bitrate: bool = False,
+        force_bit_depth: bool = False,
+        keepalive_interval: Optional[float] = None,
+        embed_sibling_artwork: bool = False,
+        trim_silence: bool = False,
+        silence_threshold: str = "-60dB",
+        silence_keep: float = 0.5,
+        error_output_limit: Optional[int] = DEFAULT_ERROR_OUTPUT_LIMIT,
+        loudness_target: Optional[float] = None,
+        work_dir: Optional[Path] = None,
+        keep_work_files: bool = False,
+        state_manager: Optional[StateManager] = None,
+        extra_args: Optional[List[str]] = None,
     ):
         """Initialize AudioConverter.
 
@@ -89,13 +374,114 @@ class AudioConverter:
             sample_rate: Target sample rate in Hz (None = preserve original)
             bit_depth: Target bit depth (None = preserve original)
             compression_level: Compression level for FLAC (0-8, default: 5)
+            adaptive_compression: Encode FLAC from lossless sources at the
+                maximum level (8); lossy sources use compression_level
+            bitrate: Target bitrate for lossy formats, e.g. "128k"
+                (None = encoder default)
+            verify_decodable: Fully decode every output after conversion and
+                fail the conversion on any decode error
+            niceness: CPU niceness for FFmpeg processes (-20 to 19, Linux only)
+            io_class: ionice class for FFmpeg processes: realtime, best-effort
+                or idle (None = inherit; Linux only)
+            checksum_algorithm: Output checksum algorithm: sha256, md5 or crc32
+            checksum_sidecar: Write the checksum to <output>.<algorithm>
+            encode_timeout: Seconds the FFmpeg encode may run before it is
+                killed (None = no limit). Probes and checks are not counted.
+            audio_filters: FFmpeg audio filters applied after any built-in
+                ones, e.g. ["highpass=f=40"]
+            log_ffmpeg_warnings: Log notable FFmpeg warnings (e.g. dropped
+                frames, non-monotonic DTS) even when the encode succeeds
+            no_upscale_bitrate: For lossy sources, cap the target bitrate at
+                the source's, since encoding above it adds size but no quality
+            force_bit_depth: Use bit_depth for FLAC output even when it is
+                above the source's; by default it is clamped to the source,
+                since the extra bits would only be zero padding
+            keepalive_interval: Log an "encode_in_progress" line with the
+                elapsed time every this many seconds while FFmpeg runs, so
+                long encodes don't look hung (None = no keepalive)
+            embed_sibling_artwork: Embed images found next to the input
+                (cover.jpg, back.jpg, disc.jpg; see SIBLING_ARTWORK) with
+                their picture types, instead of the source's own pictures
+            trim_silence: Trim leading and trailing silence (e.g. the long
+                tails of some downloads); audio between them is untouched.
+                The trailing trim reverses the track, so it is held in memory.
+            silence_threshold: Level below which audio counts as silence,
+                e.g. "-60dB"
+            silence_keep: Seconds of silence left at each trimmed end
+            error_output_limit: Most bytes of FFmpeg output kept in error
+                messages, counted from the end (None or 0 = no limit)
+            loudness_target: Normalize loudness (EBU R128 loudnorm) to this
+                integrated level in LUFS, e.g. -16 (None = no normalization)
+            work_dir: Directory for temporary FFmpeg inputs such as artwork
+                and chapter files (default: the system temp directory)
+            keep_work_files: Leave those temporary files behind for debugging
+            state_manager: Skip inputs whose recorded output is still intact
+                and record each new output's checksum (None = always convert)
+            extra_args: FFmpeg output options added after all others, just
+                before the output path, e.g. ["-ac", "1"]
+
+        Raises:
+            ValueError: If output_format is an input-only format (DSD), the
+                checksum algorithm is unknown, the priority settings are out
+                of range, a filter is invalid, the silence settings are
+                malformed or the loudness target is out of range
         """
+        if output_format.lower() in self.DSD_FORMATS:
+            raise ValueError(f"Unsupported output format: {output_format}")
+        if checksum_algorithm not in self.CHECKSUM_ALGORITHMS:
+            raise ValueError(
+                f"Checksum algorithm must be one of "
+                f"{sorted(self.CHECKSUM_ALGORITHMS)}, got {checksum_algorithm!r}"
+            )
+
         self.output_format = output_format
         self.sample_rate = sample_rate
         self.bit_depth = bit_depth
+        self.force_bit_depth = force_bit_depth
         self.compression_level = compression_level
+        self.adaptive_compression = adaptive_compression
+        self.format_detector = AudioFormatDetector()
+        self.bitrate = bitrate
+        self.verify_decodable = verify_decodable
+        validate_priority(niceness, io_class)
+        self.niceness = niceness
+        self.io_class = io_class
+        self.audio_filters = validate_filters(audio_filters or [])
+        self.log_ffmpeg_warnings = log_ffmpeg_warnings
+        self.no_upscale_bitrate = no_upscale_bitrate
+        self.checksum_algorithm = checksum_algorithm
+        self.checksum_sidecar = checksum_sidecar
+        self.encode_timeout = encode_timeout
+        self.keepalive_interval = keepalive_interval
+        self.embed_sibling_artwork = embed_sibling_artwork
+        if not re.fullmatch(r"-?\d+(\.\d+)?(dB)?", str(silence_threshold)):
+            raise ValueError(
+                "Silence threshold must be a level like -60dB, "
+                f"got {silence_threshold!r}"
+            )
+        if silence_keep < 0:
+            raise ValueError(f"Silence to keep must not be negative: {silence_keep}")
+        self.trim_silence = trim_silence
+        self.silence_threshold = str(silence_threshold)
+        self.silence_keep = silence_keep
+        self.error_output_limit = error_output_limit
+        low, high = LOUDNESS_TARGET_RANGE
+        if loudness_target is not None and not low <= loudness_target <= high:
+            raise ValueError(
+                f"Loudness target must be between {low:g} and {high:g} LUFS, "
+                f"got {loudness_target}"
+            )
+        self.loudness_target = loudness_target
+        self.work_dir = work_dir
+        self.keep_work_files = keep_work_files
+        self.state_manager = state_manager
+        self.extra_args = list(extra_args or [])
         self.logger = structlog.get_logger(__name__)
 
+    def _error_output(self, output: str) -> str:
+        """FFmpeg output trimmed to error_output_limit for an error message."""
+        return tail_output(output, self.error_output_limit)
+
     async def _execute_ffprobe(self, file_path: Path) -> dict:
         """Execute FFprobe to get audio file properties.
 
@@ -128,10 +514,11 @@ class AudioConverter:
             stdout, stderr = await process.communicate()
 
             if process.returncode != 0:
+                error_output = self._error_output(stderr.decode())
                 raise FFmpegError(
-                    f"FFprobe failed: {stderr.decode()}",
+                    f"FFprobe failed: {error_output}",
                     command=command,
-                    stderr=stderr.decode(),
+                    stderr=error_output,
                 )
 
             return json.loads(stdout.decode())
@@ -168,14 +555,32 @@ class AudioConverter:
             sample_rate = int(stream.get("sample_rate", 44100))
             channels = int(stream.get("channels", 2))
 
-            # Determine if codec is lossless
-            is_lossless = codec_name.lower() in self.LOSSLESS_FORMATS
+            # Determine if codec is lossless; an m4a holds either lossless
+            # ALAC or lossy AAC, told apart only by the codec
+            is_lossless = self.is_lossless_codec(codec_name)
+
+            try:
+                bit_rate = int(stream.get("bit_rate")) or None
+            except (TypeError, ValueError):
+                bit_rate = None
+
+            # FLAC reports its depth as bits_per_raw_sample, PCM as
+            # bits_per_sample; lossy codecs have neither
+            try:
+                bit_depth = int(
+                    stream.get("bits_per_raw_sample")
+                    or stream.get("bits_per_sample")
+                ) or None
+            except (TypeError, ValueError):
+                bit_depth = None
 
             return AudioProperties(
                 sample_rate=sample_rate,
                 codec_name=codec_name,
                 is_lossless=is_lossless,
                 channels=channels,
+                bit_rate=bit_rate,
+                bit_depth=bit_depth,
             )
 
         except Exception as e:
@@ -188,7 +593,8 @@ class AudioConverter:
         Lossless sources (FLAC, WAV, etc.) should use maximum compression (8)
         to save space since compression is lossless and won't degrade quality.
         Lossy sources (MP3, AAC) use default compression since they're already
-        compressed.
+        compressed. With adaptive_compression off, every source uses the
+        configured compression_level.
 
         Args:
             source_format: Source audio format/codec name
@@ -196,18 +602,128 @@ class AudioConverter:
         Returns:
             Compression level (0-8)
         """
+        if not self.adaptive_compression:
+            return self.compression_level
         # Check if source is lossless
-        if source_format.lower() in self.LOSSLESS_FORMATS:
+        if self.is_lossless_codec(source_format) or (
+            source_format.lower() in self.LOSSLESS_CONTAINERS
+        ):
             return 8  # Maximum compression for lossless sources
         else:
             return self.compression_level  # Default compression for lossy sources
 
+    def compression_level_for(self, source_format: str) -> int:
+        """FLAC compression level this converter uses for a source format.
+
+        Args:
+            source_format: Source audio format/codec name, e.g. "flac"
+
+        Returns:
+            Compression level (0-8), as chosen for conversions
+        """
+        return self._determine_optimal_compression(source_format)
+
+    def _source_compression_level(
+        self, input_file: Path, audio_props: Optional[AudioProperties]
+    ) -> int:
+        """FLAC compression level for a source, probed or detected.
+
+        The probed codec decides; when the probe failed, the container is
+        detected from the file's content instead. M4A holds either ALAC or
+        AAC, so without a probe it gets the lossy level.
+
+        Args:
+            input_file: Path to the input audio file
+            audio_props: Probed source properties, or None
+
+        Returns:
+            Compression level (0-8)
+        """
+        if audio_props:
+            return self._determine_optimal_compression(audio_props.codec_name)
+        try:
+            detected = self.format_detector.detect_from_content(input_file)
+        except (OSError, CorruptedAudioFileError, UnsupportedAudioFormatError):
+            return self.compression_level
+        return self._determine_optimal_compression(detected.value.lower())
+
+    def is_lossless_codec(self, codec_name: str) -> bool:
+        """Check whether a probed codec (or format name) is lossless.
+
+        Args:
+            codec_name: Codec name as reported by FFprobe, e.g. "alac"
+
+        Returns:
+            True for lossless codecs, including uncompressed PCM
+        """
+        codec_name = codec_name.lower()
+        return codec_name in self.LOSSLESS_FORMATS or codec_name.startswith(
+            self.LOSSLESS_CODEC_PREFIXES
+        )
+
+    @classmethod
+    def supports_output(cls, output_format: str) -> bool:
+        """Check whether a format can be written (it has an OUTPUT_CODECS encoder).
+
+        Input-only formats such as DSD, M4A and AIFF have no encoder mapping,
+        so FFmpeg would be asked for a codec of that name and fail mid-encode.
+
+        Args:
+            output_format: Output format name, e.g. "flac"
+
+        Returns:
+            True if the converter can encode to the format
+        """
+        return output_format.lower() in cls.OUTPUT_CODECS
+
+    def is_dsd_input(self, input_path: Path) -> bool:
+        """Check whether the input file is a DSD stream (DSF/DFF).
+
+        Args:
+            input_path: Path to input audio file
+
+        Returns:
+            True if the file extension is a DSD container
+        """
+        return normalized_extension(input_path).lstrip(".") in self.DSD_FORMATS
+
+    def _dsd_pcm_sample_rate(self, source_sample_rate: Optional[int]) -> int:
+        """Determine the PCM sample rate to decode a DSD stream to.
+
+        DSD64 maps to 88.2kHz and DSD128 (and above) to 176.4kHz, which keeps
+        the ultrasonic DSD noise out of the audible band without producing
+        needlessly large files.
+
+        Args:
+            source_sample_rate: Sample rate reported for the source; either the
+                raw DSD rate or FFmpeg's decoded rate (DSD rate / 8)
+
+        Returns:
+            Target PCM sample rate in Hz
+        """
+        if not source_sample_rate:
+            return 88200
+
+        dsd_rate = source_sample_rate
+        if dsd_rate < self.DSD64_RATE:
+            # FFmpeg's DSD decoder reports the rate after 8:1 decimation
+            dsd_rate *= 8
+
+        multiple = max(1, round(dsd_rate / self.DSD64_RATE))
+        return min(88200 * multiple, 176400)
+
     def build_ffmpeg_command(
         self,
         input_path: Path,
         output_path: Path,
         preserve_metadata: bool = True,
         compression_level: Optional[int] = None,
+        source_sample_rate: Optional[int] = None,
+        metadata_tags: Optional[Dict[str, str]] = None,
+        source_bitrate: Optional[int] = None,
+        artwork: Optional[List[Tuple[Path, str]]] = None,
+        source_bit_depth: Optional[int] = None,
+        chapters: Optional[Path] = None,
     ) -> List[str]:
         """Build FFmpeg command for audio conversion.
 
@@ -216,6 +732,19 @@ class AudioConverter:
             output_path: Path to output audio file
             preserve_metadata: Whether to preserve metadata tags
             compression_level: Override default compression level
+            source_sample_rate: Probed source sample rate (used for DSD input)
+            metadata_tags: Tags to set on the output, overriding copied ones
+            source_bitrate: Probed bitrate of a lossy source in bits/s; with
+                no_upscale_bitrate, the target bitrate is capped at it
+            artwork: (image path, picture type) pairs to embed in place of
+                the source's pictures; without any, every picture in the
+                source is kept. Ignored for output formats that cannot carry
+                pictures (see ARTWORK_FORMATS).
+            source_bit_depth: Probed bit depth of the source; FLAC output is
+                never padded above it unless force_bit_depth is set
+            chapters: ffmetadata file whose chapters replace the source's.
+                Ignored for output formats that cannot carry chapters (see
+                CHAPTER_FORMATS).
 
         Returns:
             List of command arguments for FFmpeg
@@ -227,21 +756,35 @@ class AudioConverter:
             str(input_path),
         ]
 
+        # Inputs must precede the picture mappings, so chapters are input 1
+        # and any pictures follow
+        chapters = chapters if self.output_format in self.CHAPTER_FORMATS else None
+        if chapters:
+            command.extend(["-f", "ffmetadata", "-i", str(chapters)])
+
+        if self.output_format in self.ARTWORK_FORMATS:
+            command.extend(
+                self._picture_args(artwork or [], first_input=2 if chapters else 1)
+            )
+
+        if chapters:
+            command.extend(["-map_chapters", "1"])
+
         # Preserve metadata if requested
         if preserve_metadata:
             command.extend(["-map_metadata", "0"])
+        for key, value in (metadata_tags or {}).items():
+            command.extend(["-metadata", f"{key}={value}"])
+
+        audio_filter = compose_filters(
+            self._builtin_audio_filters(), self.audio_filters
+        )
+        if audio_filter:
+            command.extend(["-af", audio_filter])
 
-        # Set audio codec based on output format
-        codec_map = {
-            "flac": "flac",
-            "mp3": "libmp3lame",
-            "aac": "aac",
-            "ogg": "libvorbis",
-            "opus": "libopus",
-            "wav": "pcm_s16le",
-        }
-
-        codec = codec_map.get(self.output_format, self.output_format)
+        codec = self.OUTPUT_CODECS.get(self.output_format, self.output_format)
+        if self.output_format == "wav":
+            codec = self.PCM_CODECS.get(self.bit_depth, codec)
         command.extend(["-c:a", codec])
 
         # Add format-specific options
@@ -249,27 +792,186 @@ class AudioConverter:
             comp_level = compression_level or self.compression_level
             command.extend(["-compression_level", str(comp_level)])
 
+        # Bitrate only applies to lossy encoders
+        if self.bitrate and self.output_format not in self.LOSSLESS_FORMATS:
+            bitrate = self.bitrate
+            if (
+                self.no_upscale_bitrate
+                and source_bitrate
+                and parse_bitrate(bitrate) > source_bitrate
+            ):
+                bitrate = f"{source_bitrate // 1000}k"
+                self.logger.info(
+                    "bitrate_capped_at_source",
+                    input_file=str(input_path),
+                    target_bitrate=self.bitrate,
+                    bitrate=bitrate,
+                )
+            command.extend(["-b:a", bitrate])
+
         # Set sample rate if specified
+        sample_rate = None
         if self.sample_rate:
-            command.extend(["-ar", str(self.sample_rate)])
+            sample_rate = self.sample_rate
+        elif self.is_dsd_input(input_path):
+            # DSD decodes to a very high PCM rate; resample to a sane high-res rate
+            sample_rate = self._dsd_pcm_sample_rate(source_sample_rate)
+        elif self.loudness_target is not None and source_sample_rate:
+            # loudnorm resamples to 192 kHz internally; keep the source rate
+            sample_rate = source_sample_rate
+        if (
+            sample_rate
+            and self.output_format == "opus"
+            and sample_rate not in self.OPUS_SAMPLE_RATES
+        ):
+            self.logger.info(
+                "sample_rate_unsupported_by_opus",
+                input_file=str(input_path),
+                sample_rate=sample_rate,
+            )
+            sample_rate = 48000
+        if sample_rate:
+            command.extend(["-ar", str(sample_rate)])
+
+        # DSD decodes to float samples; store as 24-bit for FLAC
+        if (
+            self.is_dsd_input(input_path)
+            and self.output_format == "flac"
+            and not self.bit_depth
+        ):
+            command.extend(["-sample_fmt", "s32"])
 
         # Set bit depth if specified (for PCM formats)
-        if self.bit_depth and self.output_format in ["wav", "flac"]:
-            if self.bit_depth == 16:
+        bit_depth = self.bit_depth
+        if (
+            bit_depth
+            and self.output_format == "flac"
+            and not self.force_bit_depth
+            and source_bit_depth
+            and bit_depth > source_bit_depth
+        ):
+            bit_depth = source_bit_depth
+            self.logger.info(
+                "bit_depth_clamped_to_source",
+                input_file=str(input_path),
+                target_bit_depth=self.bit_depth,
+                bit_depth=bit_depth,
+            )
+        # WAV takes its bit depth from the PCM encoder instead
+        if bit_depth and self.output_format == "flac":
+            if bit_depth == 16:
                 command.extend(["-sample_fmt", "s16"])
-            elif self.bit_depth == 24:
+            elif bit_depth == 24:
                 command.extend(["-sample_fmt", "s24"])
 
+        command.extend(self.extra_args)
+
         # Explicitly specify output format if output path has .tmp extension
         # This is needed for atomic file operations
         if str(output_path).endswith(".tmp"):
-            command.extend(["-f", self.output_format])
+            muxer = self.STREAM_MUXERS.get(self.output_format, self.output_format)
+            command.extend(["-f", muxer])
 
         # Add output path
         command.append(str(output_path))
 
         return command
 
+    async def plan_conversion(
+        self, input_file: Path, output_dir: Path, output_name: Optional[str] = None
+    ) -> AudioOutputPlan:
+        """Work out what a conversion would produce, without encoding.
+
+        Probes the source, builds the FFmpeg command convert() would run and
+        estimates the output size from the target bitrate and duration.
+
+        Args:
+            input_file: Path to the input audio file
+            output_dir: Directory the converted file would be saved in
+            output_name: Output path relative to output_dir, without an
+                extension (default: the input file's base name)
+
+        Returns:
+            AudioOutputPlan describing the planned output
+        """
+        audio_props = await self.detect_audio_properties(input_file)
+        duration_ms = await self._get_audio_duration(input_file)
+        output_file = self.get_output_path(input_file, output_dir, output_name)
+
+        compression_level = self.compression_level
+        if self.output_format == "flac":
+            compression_level = self._source_compression_level(
+                input_file, audio_props
+            )
+
+        command = self.build_ffmpeg_command(
+            input_file,
+            output_file,
+            preserve_metadata=True,
+            compression_level=compression_level,
+            source_sample_rate=audio_props.sample_rate if audio_props else None,
+            source_bitrate=self._lossy_source_bitrate(audio_props),
+            source_bit_depth=self._source_bit_depth(audio_props),
+        )
+
+        sample_rate = audio_props.sample_rate if audio_props else None
+        if "-ar" in command:
+            sample_rate = int(command[command.index("-ar") + 1])
+        channels = audio_props.channels if audio_props else None
+
+        bitrate = self._estimate_bitrate(command, sample_rate, channels)
+        return AudioOutputPlan(
+            input_path=input_file,
+            output_path=output_file,
+            codec=command[command.index("-c:a") + 1],
+            sample_rate=sample_rate,
+            channels=channels,
+            bitrate=bitrate,
+            duration_ms=duration_ms,
+            estimated_size_bytes=int(bitrate * duration_ms / 1000 / 8),
+            command=command,
+            source_codec=audio_props.codec_name if audio_props else None,
+            source_bitrate=audio_props.bit_rate if audio_props else None,
+        )
+
+    def _lossy_source_bitrate(
+        self, audio_props: Optional[AudioProperties]
+    ) -> Optional[int]:
+        """Source bitrate to cap lossy targets at; None when not capping."""
+        if not self.no_upscale_bitrate or audio_props is None:
+            return None
+        if audio_props.is_lossless:
+            return None
+        return audio_props.bit_rate
+
+    def _source_bit_depth(
+        self, audio_props: Optional[AudioProperties]
+    ) -> Optional[int]:
+        """Source bit depth to clamp FLAC output to; None when not clamping."""
+        if not self.bit_depth or self.force_bit_depth or audio_props is None:
+            return None
+        return audio_props.bit_depth
+
+    def _estimate_bitrate(
+        self, command: List[str], sample_rate: Optional[int], channels: Optional[int]
+    ) -> int:
+        """Estimate the output bitrate in bits/s for a planned command."""
+        if "-b:a" in command:
+            return parse_bitrate(command[command.index("-b:a") + 1])
+
+        if self.output_format in self.DEFAULT_LOSSY_BITRATES:
+            return self.DEFAULT_LOSSY_BITRATES[self.output_format]
+
+        bit_depth = self.bit_depth or 16
+        if "-sample_fmt" in command:
+            sample_fmt = command[command.index("-sample_fmt") + 1]
+            bit_depth = 16 if sample_fmt == "s16" else 24
+        pcm_bitrate = (sample_rate or 44100) * (channels or 2) * bit_depth
+
+        if self.output_format == "flac":
+            return int(pcm_bitrate * self.FLAC_SIZE_RATIO)
+        return pcm_bitrate
+
     async def _execute_ffmpeg(self, command: List[str]) -> Tuple[int, str, str]:
         """Execute FFmpeg command asynchronously.
 
@@ -282,6 +984,7 @@ class AudioConverter:
         Raises:
             FFmpegError: If FFmpeg execution fails
         """
+        command = with_io_class(command, self.io_class)
         self.logger.debug("executing_ffmpeg", command=" ".join(command))
 
         try:
@@ -289,9 +992,16 @@ class AudioConverter:
                 *command,
                 stdout=asyncio.subprocess.DEVNULL,  # Don't capture stdout
                 stderr=asyncio.subprocess.PIPE,
+                preexec_fn=niceness_preexec(self.niceness),
             )
 
-            stdout, stderr = await process.communicate()
+            try:
+                stdout, stderr = await process.communicate()
+            except asyncio.CancelledError:
+                # Don't leave FFmpeg running (and writing) after a timeout
+                process.kill()
+                await process.wait()
+                raise
 
             stdout_str = ""  # Not captured
             stderr_str = stderr.decode("utf-8", errors="replace") if stderr else ""
@@ -303,33 +1013,325 @@ class AudioConverter:
                 f"Failed to execute FFmpeg: {e}", command=command, stderr=str(e)
             )
 
-    def calculate_checksum(self, file_path: Path) -> str:
-        """Calculate SHA256 checksum of a file.
+    async def _execute_encode(self, command: List[str]) -> Tuple[int, str, str]:
+        """Run the encode command, enforcing encode_timeout.
+
+        Args:
+            command: FFmpeg command as list of arguments
+
+        Returns:
+            Tuple of (return_code, stdout, stderr)
+
+        Raises:
+            EncodeTimeoutError: If the encode exceeds encode_timeout
+            FFmpegError: If FFmpeg execution fails
+        """
+        keepalive = None
+        if self.keepalive_interval:
+            keepalive = asyncio.create_task(self._log_keepalive(command[-1]))
+        try:
+            return await asyncio.wait_for(
+                self._execute_ffmpeg(command), timeout=self.encode_timeout
+            )
+        except asyncio.TimeoutError:
+            raise EncodeTimeoutError(
+                f"Encode timed out after {self.encode_timeout}s",
+                command=command,
+                stderr="",
+            )
+        finally:
+            if keepalive:
+                keepalive.cancel()
+                await asyncio.gather(keepalive, return_exceptions=True)
+
+    async def _log_keepalive(self, output_file: str) -> None:
+        """Log the elapsed encode time every keepalive_interval seconds."""
+        started = time.monotonic()
+        while True:
+            await asyncio.sleep(self.keepalive_interval)
+            self.logger.info(
+                "encode_in_progress",
+                output_file=output_file,
+                elapsed_s=round(time.monotonic() - started, 1),
+            )
+
+    def _builtin_audio_filters(self) -> List[str]:
+        """Filters the converter applies itself, ahead of user filters."""
+        filters = []
+        if self.trim_silence:
+            # One period from the start only, so silence inside the track stays
+            trim = (
+                "silenceremove=start_periods=1"
+                f":start_threshold={self.silence_threshold}"
+                f":start_silence={self.silence_keep}"
+            )
+            # silenceremove trims the start; reversing around it trims the end
+            filters += [trim, "areverse", trim, "areverse"]
+        if self.loudness_target is not None:
+            # Measured after trimming, so removed silence does not skew it
+            filters.append(
+                f"loudnorm=I={self.loudness_target:g}"
+                f":TP={LOUDNESS_TRUE_PEAK:g}:LRA={LOUDNESS_RANGE:g}"
+            )
+        return filters
+
+    @staticmethod
+    def _picture_args(
+        artwork: List[Tuple[Path, str]], first_input: int = 1
+    ) -> List[str]:
+        """Inputs and mappings that carry pictures into the output.
+
+        FFmpeg maps only one video stream by default, so extra pictures
+        (e.g. a back cover) would be dropped without explicit mapping.
+        first_input is the FFmpeg input index the first picture gets.
+        """
+        if not artwork:
+            # Keep every picture of the source (optional: it may have none)
+            return ["-map", "0:a", "-map", "0:v?", "-c:v", "copy"]
+
+        args: List[str] = []
+        for path, _ in artwork:
+            args.extend(["-i", str(path)])
+        args.extend(["-map", "0:a"])
+        for index, (_, picture_type) in enumerate(artwork):
+            args.extend(["-map", f"{first_input + index}:v"])
+            args.extend([f"-metadata:s:v:{index}", f"comment={picture_type}"])
+        args.extend(["-c:v", "copy", "-disposition:v", "attached_pic"])
+        return args
+
+    def build_stream_command(self, input_format: Optional[str] = None) -> List[str]:
+        """Build the FFmpeg command for a stdin to stdout conversion.
+
+        Args:
+            input_format: Format of the input (e.g. "wav"); None lets FFmpeg
+                detect it from the data
+
+        Returns:
+            List of command arguments for FFmpeg
+        """
+        command = self.build_ffmpeg_command(Path("pipe:0"), Path("pipe:1"))
+        # A pipe has no extension to pick the muxer from
+        muxer = self.STREAM_MUXERS.get(self.output_format, self.output_format)
+        command[-1:-1] = ["-f", muxer]
+        if input_format:
+            demuxer = self.STREAM_DEMUXERS.get(input_format, input_format)
+            command[2:2] = ["-f", demuxer]
+        return command
+
+    async def convert_stream(
+        self, stdin: BinaryIO, stdout: BinaryIO, input_format: Optional[str] = None
+    ) -> None:
+        """
+        Converts audio read from stdin, writing the encoded output to stdout.
+
+        There are no paths, so output naming, output validation, checksums
+        and state are skipped. Formats that need a seekable input (MP4/M4A
+        with the index at the end) fail with StreamNotSeekableError.
+
+        Args:
+            stdin: Binary stream (with a file descriptor) to read from
+            stdout: Binary stream (with a file descriptor) to write to
+            input_format: Format of the input (e.g. "wav"); None lets FFmpeg
+                detect it
+
+        Raises:
+            StreamNotSeekableError: If the input format cannot be streamed
+            FFmpegError: If the conversion fails
+        """
+        input_format = (input_format or "").lower().lstrip(".") or None
+        if input_format in self.SEEKABLE_INPUT_FORMATS:
+            raise StreamNotSeekableError(
+                f"{input_format} input needs a seekable file and cannot be "
+                "streamed; convert it from a file instead",
+                command=[],
+                stderr="",
+            )
+
+        command = with_io_class(self.build_stream_command(input_format), self.io_class)
+        self.logger.debug("executing_ffmpeg_stream", command=" ".join(command))
+
+        try:
+            process = await asyncio.create_subprocess_exec(
+                *command,
+                stdin=stdin,
+                stdout=stdout,
+                stderr=asyncio.subprocess.PIPE,
+                preexec_fn=niceness_preexec(self.niceness),
+            )
+            _, stderr = await process.communicate()
+        except OSError as e:
+            raise FFmpegError(
+                f"Failed to execute FFmpeg: {e}", command=command, stderr=str(e)
+            )
+
+        stderr_str = stderr.decode("utf-8", errors="replace") if stderr else ""
+        if process.returncode != 0:
+            lowered = stderr_str.lower()
+            stderr_str = self._error_output(stderr_str)
+            if any(pattern in lowered for pattern in self.NOT_SEEKABLE_PATTERNS):
+                raise StreamNotSeekableError(
+                    "Input needs a seekable file and cannot be streamed; "
+                    "convert it from a file instead",
+                    command=command,
+                    stderr=stderr_str,
+                )
+            raise FFmpegError(
+                f"FFmpeg conversion failed: {stderr_str}",
+                command=command,
+                stderr=stderr_str,
+            )
+
+    async def validate_output(self, output_file: Path) -> None:
+        """Validate a freshly written output file.
+
+        FFmpeg can exit 0 yet leave an empty or truncated file (e.g. when the
+        disk fills near the end), so the output is checked for a non-zero
+        size and, when FFprobe is available, for a readable audio stream.
+        With verify_decodable, it is then decoded in full.
+
+        Args:
+            output_file: Path to the converted file
+
+        Raises:
+            OutputValidationError: If the output is empty or fails to probe
+        """
+        if output_file.stat().st_size == 0:
+            raise OutputValidationError(f"Output file is empty: {output_file}")
+
+        command = [
+            "ffprobe",
+            "-v",
+            "error",
+            "-show_entries",
+            "stream=codec_type",
+            "-of",
+            "json",
+            str(output_file),
+        ]
+
+        try:
+            process = await asyncio.create_subprocess_exec(
+                *command,
+                stdout=asyncio.subprocess.PIPE,
+                stderr=asyncio.subprocess.PIPE,
+            )
+        except FileNotFoundError:
+            self.logger.debug("output_probe_skipped", reason="ffprobe_not_found")
+            # Decoding needs only FFmpeg; in-place replacement relies on it
+            if self.verify_decodable:
+                await self.verify_output_decodes(output_file)
+            return
+
+        stdout, stderr = await process.communicate()
+
+        if process.returncode != 0:
+            raise OutputValidationError(
+                "Output file failed probe: "
+                + self._error_output(stderr.decode().strip())
+            )
+
+        try:
+            streams = json.loads(stdout.decode() or "{}").get("streams", [])
+        except json.JSONDecodeError:
+            streams = []
+
+        if not any(s.get("codec_type") == "audio" for s in streams):
+            raise OutputValidationError(
+                f"Output file has no audio stream: {output_file}"
+            )
+
+        if self.verify_decodable:
+            await self.verify_output_decodes(output_file)
+
+    async def verify_output_decodes(self, output_file: Path) -> None:
+        """Decode the whole output to null, the equivalent of ``flac -t``.
+
+        Args:
+            output_file: Path to the converted file
+
+        Raises:
+            OutputValidationError: If FFmpeg reports any decode error
+        """
+        command = ["ffmpeg", "-v", "error", "-i", str(output_file), "-f", "null", "-"]
+        returncode, _, stderr = await self._execute_ffmpeg(command)
+
+        if returncode != 0 or stderr.strip():
+            raise OutputValidationError(
+                "File failed decode verification: "
+                + self._error_output(stderr.strip())
+            )
+
+        self.logger.debug("output_decode_verified", output_file=str(output_file))
+
+    def calculate_checksum(
+        self, file_path: Path, algorithm: Optional[str] = None
+    ) -> str:
+        """Calculate the checksum of a file.
 
         Args:
             file_path: Path to file
+            algorithm: sha256, md5 or crc32 (default: checksum_algorithm)
 
         Returns:
-            Hexadecimal SHA256 checksum
+            Hexadecimal checksum (8 characters for crc32)
 
         Raises:
             FileNotFoundError: If file doesn't exist
         """
-        if not file_path.exists():
-            raise FileNotFoundError(f"File not found: {file_path}")
+        return compute_checksum(file_path, algorithm or self.checksum_algorithm)
+
+    def write_checksum_sidecar(self, file_path: Path, checksum: str) -> Path:
+        """Write a checksum next to a file, as <file>.<algorithm>.
+
+        The sidecar uses the "<checksum>  <name>" layout read by md5sum -c
+        and sha256sum -c.
+
+        Args:
+            file_path: File the checksum belongs to
+            checksum: Checksum computed with checksum_algorithm
+
+        Returns:
+            Path of the sidecar file
+        """
+        sidecar = file_path.with_name(f"{file_path.name}.{self.checksum_algorithm}")
+        sidecar.write_text(f"{checksum}  {file_path.name}\n")
+        return sidecar
+
+    def get_output_path(
+        self, input_file: Path, output_dir: Path, output_name: Optional[str] = None
+    ) -> Path:
+        """Get the output path a conversion of input_file will produce.
+
+        Args:
+            input_file: Path to the input audio file
+            output_dir: Directory where the converted file will be saved
+            output_name: Output path relative to output_dir, without an
+                extension (default: the input file's base name)
 
-        sha256_hash = hashlib.sha256()
+        Returns:
+            Output path with the target format extension
+        """
+        name = output_name or base_name(input_file)
+        return output_dir / f"{name}.{self.output_format}"
 
-        with open(file_path, "rb") as f:
-            # Read in chunks to handle large files
-            for byte_block in iter(lambda: f.read(4096), b""):
-                sha256_hash.update(byte_block)
+    @staticmethod
+    def is_same_file(input_file: Path, output_file: Path) -> bool:
+        """Whether output_file names the existing input_file.
 
-        return sha256_hash.hexdigest()
+        Compares the files themselves, so symlinks, relative paths and case
+        differences on case-insensitive filesystems are all detected.
+        """
+        try:
+            return os.path.samefile(input_file, output_file)
+        except OSError:
+            return False
 
     def get_temp_path(self, output_path: Path) -> Path:
         """Get temporary path for atomic file operations.
 
+        FFmpeg encodes here and the file is renamed over output_path only
+        once it validates, so output_path never holds a partial encode.
+
         Args:
             output_path: Final output path
 
@@ -377,17 +1379,30 @@ class AudioConverter:
         return 0.0
 
     async def convert(
-        self, input_file: Path, output_dir: Path
+        self,
+        input_file: Path,
+        output_dir: Path,
+        metadata_tags: Optional[Dict[str, str]] = None,
+        output_name: Optional[str] = None,
+        artwork: Optional[bytes] = None,
     ) -> AudioConversionResult:
         """
         Converts an audio file to the specified format.
 
         Uses atomic file operations (write to .tmp, then rename) and
-        calculates checksum of the output file.
+        calculates checksum of the output file. With a state_manager, an
+        input whose recorded output is intact and not older than the input
+        is skipped without running FFmpeg.
 
         Args:
             input_file: Path to the input audio file
             output_dir: Directory where the converted file will be saved
+            metadata_tags: Tags to set on the output, overriding copied ones
+            output_name: Output path relative to output_dir, without an
+                extension (default: the input file's base name)
+            artwork: Front cover image (JPEG or PNG) to embed in the output;
+                a sibling front cover takes precedence when
+                embed_sibling_artwork is set
 
         Returns:
             AudioConversionResult with success status and metadata
@@ -400,12 +1415,9 @@ class AudioConverter:
         if not input_file.exists():
             raise FileNotFoundError(f"Input file not found: {input_file}")
 
-        # Create output directory if it doesn't exist
-        output_dir.mkdir(parents=True, exist_ok=True)
-
-        # Determine output path
-        output_file = output_dir / f"{input_file.stem}.{self.output_format}"
-        temp_file = self.get_temp_path(output_file)
+        # Determine output path and create its directory if it doesn't exist
+        output_file = self.get_output_path(input_file, output_dir, output_name)
+        output_file.parent.mkdir(parents=True, exist_ok=True)
 
         log = self.logger.bind(
             input_file=str(input_file),
@@ -413,41 +1425,78 @@ class AudioConverter:
             format=self.output_format,
         )
 
+        reprocessed = False
+        recorded = self.state_manager.get(output_file) if self.state_manager else None
+        if recorded is not None:
+            intact = self.state_manager.verify(output_file)
+            skipped = self._already_converted(input_file, output_file, recorded, intact)
+            if skipped:
+                log.info("conversion_skipped", reason="already_converted")
+                return skipped
+            reprocessed = True
+            if not intact and output_file.exists():
+                # Edited or damaged since it was converted; keep that copy
+                backup = self.backup_output(output_file)
+                log.warning("output_checksum_mismatch", backup_file=str(backup))
+
+        # Encode beside the output and rename once validated, so neither a
+        # reader nor an encode onto the file being read (e.g. FLAC to FLAC
+        # with overlapping input and output dirs) sees a partial file
+        temp_file = self.get_temp_path(output_file)
+        in_place = self.is_same_file(input_file, output_file)
+        if in_place:
+            log.info("converting_in_place", temp_file=str(temp_file))
+
         log.info("starting_conversion")
 
+        pictures: List[Tuple[Path, str]] = []
+        if self.embed_sibling_artwork:
+            pictures = find_sibling_artwork(input_file)
+        # Kept out of output_dir, where a stray file could be mistaken for
+        # the encoder's output
+        artwork_file = None
+        if artwork and not any(kind == FRONT_COVER for _, kind in pictures):
+            artwork_file = self._write_artwork(artwork, base_name(input_file))
+            pictures.insert(0, (artwork_file, FRONT_COVER))
+
+        chapters_file = None
         try:
             # Detect audio properties for intelligent conversion
             audio_props = await self.detect_audio_properties(input_file)
+            chapters_file = await self._chapters_file(input_file, log)
             
             # Determine optimal compression level if converting to FLAC
             compression_level = self.compression_level
-            if self.output_format == "flac" and audio_props:
-                compression_level = self._determine_optimal_compression(
-                    audio_props.codec_name
+            if self.output_format == "flac":
+                compression_level = self._source_compression_level(
+                    input_file, audio_props
                 )
                 log.debug(
                     "adaptive_compression",
-                    source_codec=audio_props.codec_name,
-                    is_lossless=audio_props.is_lossless,
+                    source_codec=audio_props.codec_name if audio_props else None,
+                    adaptive=self.adaptive_compression,
                     compression_level=compression_level,
                 )
             
-            # Build FFmpeg command; write directly to final output path
-            # (some environments behave inconsistently with .tmp files)
             command = self.build_ffmpeg_command(
-                input_file, output_file, preserve_metadata=True,
-                compression_level=compression_level
+                input_file, temp_file, preserve_metadata=True,
+                compression_level=compression_level,
+                source_sample_rate=audio_props.sample_rate if audio_props else None,
+                metadata_tags=metadata_tags,
+                source_bitrate=self._lossy_source_bitrate(audio_props),
+                artwork=pictures,
+                source_bit_depth=self._source_bit_depth(audio_props),
+                chapters=chapters_file,
             )
 
-            # Execute FFmpeg
-            returncode, stdout, stderr = await self._execute_ffmpeg(command)
+            returncode, stdout, stderr = await self._execute_encode(command)
 
             # Wait briefly for filesystem to reflect ffmpeg output (race in some environments)
             total_wait = 0.0
             wait_interval = 0.05
             max_wait = 1.0
             while total_wait < max_wait:
-                if temp_file.exists() or output_file.exists():
+                if temp_file.exists():
                     break
                 await asyncio.sleep(wait_interval)
                 total_wait += wait_interval
@@ -460,69 +1509,54 @@ class AudioConverter:
             )
 
             if returncode != 0:
+                error_output = self._error_output(stderr)
                 raise FFmpegError(
-                    f"FFmpeg conversion failed: {stderr}",
+                    f"FFmpeg conversion failed: {error_output}",
                     command=command,
-                    stderr=stderr,
+                    stderr=error_output,
                 )
 
-            # Determine where ffmpeg wrote output: prefer final output
-            if output_file.exists():
-                log.debug("output_written_directly", output_file=str(output_file))
-            else:
-                # Fallback: sometimes ffmpeg writes a file with a different name
-                # or there is a brief race. Find the most recently-modified file
-                # in the output directory that was created after we started.
-                try:
-                    candidates = list(output_dir.iterdir())
-                except Exception:
-                    candidates = []
-
-                recent_candidate = None
-                if candidates:
-                    # Pick the newest file by mtime
-                    candidates = [p for p in candidates if p.is_file()]
-                    if candidates:
-                        recent_candidate = max(
-                            candidates, key=lambda p: p.stat().st_mtime
-                        )
-
-                if recent_candidate:
-                    log.warning(
-                        "using_recent_output_candidate",
-                        candidate=str(recent_candidate),
-                        mtime=recent_candidate.stat().st_mtime,
-                    )
-
-                    # If it's not already the expected final path, try moving it
-                    try:
-                        if recent_candidate.resolve() != output_file.resolve():
-                            recent_candidate.rename(output_file)
-                        else:
-                            # already the expected path
-                            pass
-                    except Exception as e:
-                        log.error("failed_to_move_candidate", error=str(e))
-                else:
-                    # Log more details for debugging
-                    log.error(
-                        "temp_file_not_found",
-                        temp_file=str(temp_file),
-                        cwd=str(Path.cwd()),
-                        output_dir_exists=output_dir.exists(),
-                        output_dir_files=(
-                            list(output_dir.glob("*")) if output_dir.exists() else []
-                        ),
-                        ffmpeg_stderr=stderr[:500] if stderr else "",
-                    )
-                    raise FFmpegError(
-                        f"FFmpeg succeeded but output file not found: {temp_file}. Stderr: {stderr[:500]}",
-                        command=command,
-                        stderr=stderr,
-                    )
-
-            # Calculate checksum
-            checksum = self.calculate_checksum(output_file)
+            if self.log_ffmpeg_warnings:
+                ffmpeg_warnings = parse_ffmpeg_warnings(stderr)
+                if ffmpeg_warnings:
+                    log.warning("ffmpeg_warnings", warnings=ffmpeg_warnings)
+
+            if not temp_file.exists():
+                # Never adopt some other file in its place: in a shared output
+                # directory it could be another worker's encode
+                log.error(
+                    "temp_file_not_found",
+                    temp_file=str(temp_file),
+                    ffmpeg_stderr=stderr[:500] if stderr else "",
+                )
+                raise FFmpegError(
+                    f"FFmpeg succeeded but output file not found: {temp_file}",
+                    command=command,
+                    stderr=self._error_output(stderr),
+                )
+
+            await self.validate_output(temp_file)
+
+            # Checksum before the rename, so an unreadable output never
+            # replaces anything (for an in-place encode, the original)
+            checksum = self.calculate_checksum(temp_file)
+            fsync_file(temp_file)
+            atomic_replace(temp_file, output_file)
+            if in_place:
+                log.info("replaced_in_place", checksum=checksum)
+            if self.checksum_sidecar:
+                self.write_checksum_sidecar(output_file, checksum)
+
+            if self.state_manager:
+                self.state_manager.record(
+                    output_file,
+                    input_file,
+                    checksum,
+                    self.checksum_algorithm,
+                    compression_level=(
+                        compression_level if self.output_format == "flac" else None
+                    ),
+                )
 
             # Get file size
             size_bytes = output_file.stat().st_size
@@ -543,12 +1577,20 @@ class AudioConverter:
                 checksum=checksum,
                 duration_ms=duration_ms,
                 size_bytes=size_bytes,
+                checksum_algorithm=self.checksum_algorithm,
+                compression_level=(
+                    compression_level if self.output_format == "flac" else None
+                ),
+                reprocessed=reprocessed,
             )
 
+        except asyncio.CancelledError:
+            # Cancelled mid-encode (file timeout, fail-fast): FFmpeg has been
+            # killed, so drop what it wrote
+            temp_file.unlink(missing_ok=True)
+            raise
         except Exception as e:
-            # Clean up temp file if it exists
-            if temp_file.exists():
-                temp_file.unlink()
+            temp_file.unlink(missing_ok=True)
 
             log.error("conversion_failed", error=str(e))
 
@@ -560,6 +1602,100 @@ class AudioConverter:
                 size_bytes=0,
                 error_message=str(e),
             )
+        finally:
+            for work_file in (artwork_file, chapters_file):
+                if work_file and not self.keep_work_files:
+                    work_file.unlink(missing_ok=True)
+
+    def _already_converted(
+        self, input_file: Path, output_file: Path, state: FileState, intact: bool
+    ) -> Optional[AudioConversionResult]:
+        """The skip result for an input whose recorded output is still good.
+
+        The output must match its recorded checksum and be at least as new
+        as the input; a source edited since its conversion is redone.
+
+        Args:
+            input_file: Path to the input audio file
+            output_file: Its output path
+            state: The output's recorded state
+            intact: Whether the output matches the recorded checksum
+
+        Returns:
+            A skipped AudioConversionResult, or None to convert
+        """
+        if not intact or state.input_path != str(input_file):
+            return None
+        if input_file.stat().st_mtime > output_file.stat().st_mtime:
+            return None
+        return AudioConversionResult(
+            success=True,
+            output_path=output_file,
+            checksum=state.checksum,
+            duration_ms=0.0,
+            size_bytes=output_file.stat().st_size,
+            checksum_algorithm=state.checksum_algorithm,
+            compression_level=state.compression_level,
+            skipped=True,
+            skip_reason="already_converted",
+        )
+
+    @staticmethod
+    def backup_output(output_file: Path) -> Path:
+        """Copy an existing output to <output>.bak, replacing an older backup.
+
+        Args:
+            output_file: The output about to be converted again
+
+        Returns:
+            Path of the backup
+        """
+        backup = output_file.with_name(f"{output_file.name}.bak")
+        shutil.copy2(output_file, backup)
+        return backup
+
+    async def _chapters_file(self, input_file: Path, log: Any) -> Optional[Path]:
+        """Chapters of the input's sidecar as a temporary ffmetadata file.
+
+        A sidecar that cannot be parsed, or whose chapters do not fit within
+        the input's duration, is logged and ignored; the file is converted
+        without it.
+
+        Returns:
+            Path of the ffmetadata file, or None without a usable sidecar
+        """
+        if self.output_format not in self.CHAPTER_FORMATS:
+            return None
+        sidecar = find_chapter_sidecar(input_file)
+        if sidecar is None:
+            return None
+        try:
+            duration_ms = await self._get_audio_duration(input_file)
+            if not duration_ms:
+                raise ChapterError("Input duration is unknown")
+            chapters = validate_chapters(load_chapters(sidecar), duration_ms / 1000)
+        except ChapterError as e:
+            log.warning("chapter_sidecar_ignored", sidecar=str(sidecar), error=str(e))
+            return None
+        fd, path = tempfile.mkstemp(
+            prefix=f"{base_name(input_file)}.chapters-",
+            suffix=".txt",
+            dir=self.work_dir,
+        )
+        with os.fdopen(fd, "w", encoding="utf-8") as f:
+            f.write(ffmetadata(chapters))
+        log.info("chapters_injected", sidecar=str(sidecar), chapters=len(chapters))
+        return Path(path)
+
+    def _write_artwork(self, artwork: bytes, name: str) -> Path:
+        """Write artwork to a temporary file FFmpeg can read as an input."""
+        suffix = ".png" if image_type(artwork) == "image/png" else ".jpg"
+        fd, path = tempfile.mkstemp(
+            prefix=f"{name}.artwork-", suffix=suffix, dir=self.work_dir
+        )
+        with os.fdopen(fd, "wb") as f:
+            f.write(artwork)
+        return Path(path)
 
     def validate_input_file(self, input_file: Path) -> bool:
         """
@@ -575,7 +1711,7 @@ class AudioConverter:
             self.logger.debug("validation_failed", reason="file_not_found")
             return False
 
-        if input_file.suffix.lower() not in self.SUPPORTED_FORMATS:
+        if normalized_extension(input_file) not in self.SUPPORTED_FORMATS:
             self.logger.debug(
                 "validation_failed",
                 reason="unsupported_format",
@@ -20,8 +20,11 @@ class AudioFormat(str, Enum):
     M4A = "M4A"
     OGG = "OGG"
     WAV = "WAV"
+    AIFF = "AIFF"
     OPUS = "OPUS"
     FLAC = "FLAC"
+    DSF = "DSF"
+    DFF = "DFF"
 
 
 class UnsupportedAudioFormatError(Exception):
@@ -54,6 +57,8 @@ class AudioFormatDetector:
         AudioFormat.OGG: [b"OggS"],
         # WAV - RIFF container with WAVE format
         AudioFormat.WAV: [b"RIFF"],  # Check for WAVE later
+        # AIFF - IFF container with AIFF (or compressed AIFC) form type
+        AudioFormat.AIFF: [b"FORM"],  # Check for AIFF/AIFC later
         # M4A/AAC - ISO Base Media File Format (ftyp box)
         AudioFormat.M4A: [
             b"\x00\x00\x00\x20ftypM4A ",
@@ -68,6 +73,10 @@ class AudioFormatDetector:
         ],
         # OPUS - in OGG container
         AudioFormat.OPUS: [b"OggS"],  # Requires deeper inspection
+        # DSF - Sony DSD Stream File
+        AudioFormat.DSF: [b"DSD "],
+        # DFF - Philips DSDIFF (IFF container with DSD form type)
+        AudioFormat.DFF: [b"FRM8"],  # Check for DSD form type later
     }
 
     # Minimum file size to read for magic number detection (in bytes)
@@ -138,10 +147,15 @@ class AudioFormatDetector:
             if header.startswith(magic):
                 return AudioFormat.FLAC
 
-        # Check WAV (RIFF + WAVE)
-        if header.startswith(b"RIFF") and b"WAVE" in header[:16]:
+        # Check WAV (RIFF + WAVE form type at offset 8). Other RIFF
+        # containers such as AVI ("AVI ") must not be classified as WAV.
+        if header.startswith(b"RIFF") and header[8:12] == b"WAVE":
             return AudioFormat.WAV
 
+        # Check AIFF (FORM + AIFF/AIFC form type at offset 8)
+        if header.startswith(b"FORM") and header[8:12] in (b"AIFF", b"AIFC"):
+            return AudioFormat.AIFF
+
         # Check M4A/AAC container formats
         for magic in self.MAGIC_NUMBERS[AudioFormat.M4A]:
             if magic in header:
@@ -152,6 +166,15 @@ class AudioFormatDetector:
             if header.startswith(magic):
                 return AudioFormat.AAC
 
+        # Check DSF
+        for magic in self.MAGIC_NUMBERS[AudioFormat.DSF]:
+            if header.startswith(magic):
+                return AudioFormat.DSF
+
+        # Check DFF (FRM8 chunk with DSD form type at offset 12)
+        if header.startswith(b"FRM8") and header[12:16] == b"DSD ":
+            return AudioFormat.DFF
+
         # Check OGG/OPUS (needs deeper inspection to differentiate)
         if header.startswith(b"OggS"):
             # Try to detect if it's Opus by looking for "OpusHead" in first page
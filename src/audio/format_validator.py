@@ -0,0 +1,138 @@
+"""Audio file validation module.
+
+This module checks that an audio file is usable before it is converted. The
+format is detected from content, the container's own size fields are checked
+against the bytes on disk, and FFprobe confirms there is an audio stream, so
+a structurally invalid file can be told apart from a truncated one.
+"""
+
+import struct
+from pathlib import Path
+from typing import Optional
+
+from src.audio.format_detector import (
+    AudioFormat,
+    AudioFormatDetector,
+    CorruptedAudioFileError,
+    UnsupportedAudioFormatError,
+)
+
+
+class InvalidAudioFileError(CorruptedAudioFileError):
+    """Raised when a file's content is not valid audio."""
+
+    pass
+
+
+class IncompleteAudioFileError(CorruptedAudioFileError):
+    """Raised when a file is shorter than its headers say it should be."""
+
+    pass
+
+
+class AudioFormatValidator:
+    """Validates audio files by magic number, container size and FFprobe."""
+
+    # Bytes read to parse container headers
+    HEADER_SIZE = 32
+
+    # "fLaC" followed by the mandatory STREAMINFO block (4 + 34 bytes)
+    MIN_FLAC_SIZE = 42
+
+    def __init__(self, detector: Optional[AudioFormatDetector] = None):
+        """Initialize AudioFormatValidator.
+
+        Args:
+            detector: Format detector to use; a new one by default
+        """
+        self.detector = detector or AudioFormatDetector()
+
+    async def validate_file(self, file_path: Path) -> AudioFormat:
+        """Validate an audio file.
+
+        Args:
+            file_path: Path to the audio file
+
+        Returns:
+            AudioFormat detected from the file's content
+
+        Raises:
+            FileNotFoundError: If file doesn't exist
+            InvalidAudioFileError: If the content is not a recognized audio
+                format or FFprobe finds no audio stream in it
+            IncompleteAudioFileError: If the file is empty or truncated
+        """
+        try:
+            audio_format = self.detector.detect_from_content(file_path)
+        except UnsupportedAudioFormatError:
+            raise InvalidAudioFileError(
+                f"Invalid audio file, unrecognized format: {file_path}"
+            )
+        except CorruptedAudioFileError as e:
+            raise IncompleteAudioFileError(f"Incomplete audio file: {e}")
+
+        self._check_size(file_path, audio_format)
+
+        try:
+            is_valid = await self.detector.validate_with_ffprobe(file_path)
+        except FileNotFoundError:
+            # ffprobe not available, rely on the structural checks only
+            return audio_format
+        if not is_valid:
+            raise InvalidAudioFileError(
+                f"Invalid audio file, FFprobe found no audio stream: {file_path}"
+            )
+        return audio_format
+
+    def _check_size(self, file_path: Path, audio_format: AudioFormat) -> None:
+        """Compare the size a container declares with the size on disk.
+
+        Args:
+            file_path: Path to the audio file
+            audio_format: Format detected from its content
+
+        Raises:
+            IncompleteAudioFileError: If the file is shorter than declared
+        """
+        actual = file_path.stat().st_size
+        with open(file_path, "rb") as f:
+            header = f.read(self.HEADER_SIZE)
+
+        expected = self._declared_size(header, audio_format)
+        if expected is not None and expected > actual:
+            raise IncompleteAudioFileError(
+                f"Incomplete {audio_format.value} file, header declares "
+                f"{expected} bytes but only {actual} are present: {file_path}"
+            )
+
+    def _declared_size(self, header: bytes, audio_format: AudioFormat) -> Optional[int]:
+        """Total file size implied by a container header.
+
+        Args:
+            header: First bytes of the file
+            audio_format: Format detected from the header
+
+        Returns:
+            Minimum size in bytes, or None if the header does not say
+        """
+        if audio_format == AudioFormat.WAV and len(header) >= 8:
+            # RIFF chunk size counts everything after the 8-byte chunk header
+            return struct.unpack("<I", header[4:8])[0] + 8
+        if audio_format == AudioFormat.AIFF and len(header) >= 8:
+            return struct.unpack(">I", header[4:8])[0] + 8
+        if audio_format == AudioFormat.DFF and len(header) >= 12:
+            return struct.unpack(">Q", header[4:12])[0] + 12
+        if audio_format == AudioFormat.DSF and len(header) >= 20:
+            # Total file size is stored in the DSD chunk at offset 12
+            return struct.unpack("<Q", header[12:20])[0]
+        if audio_format == AudioFormat.FLAC:
+            return self.MIN_FLAC_SIZE
+        if audio_format == AudioFormat.MP3 and header.startswith(b"ID3"):
+            if len(header) < 10:
+                return 10
+            # ID3v2 tag size is a 28-bit syncsafe integer after a 10-byte header
+            size = 0
+            for byte in header[6:10]:
+                size = (size << 7) | (byte & 0x7F)
+            return size + 10
+        return None
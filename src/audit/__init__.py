@@ -0,0 +1 @@
+# Marker file to make this a package
@@ -0,0 +1,155 @@
+"""Per-file audit log module.
+
+This module provides an append-only JSONL sink recording every decision made
+about an input file (processed, skipped or failed). Unlike the run summary,
+which is aggregate, the audit log holds one record per file. Writes are
+buffered and flushed at most once per flush interval so that large batches
+don't turn into one disk write per file.
+"""
+
+import json
+import threading
+import time
+from datetime import datetime, timezone
+from pathlib import Path
+from typing import Any, Dict, Iterable, List, Optional
+
+from src.storage.storage import atomic_replace
+
+ACTION_PROCESSED = "processed"
+ACTION_SKIPPED = "skipped"
+ACTION_FAILED = "failed"
+
+
+def _read_records(path: Path) -> List[Dict[str, Any]]:
+    records = []
+    with open(path) as f:
+        for line in f:
+            try:
+                record = json.loads(line)
+            except ValueError:
+                # A torn final line from an interrupted write
+                continue
+            if isinstance(record, dict) and record.get("input"):
+                records.append(record)
+    return records
+
+
+def read_failed_inputs(path: Path) -> List[Path]:
+    """List the inputs of the failed records in a JSONL log, in log order.
+
+    Both audit logs and plain dead-letter lists of {"input": ...} records are
+    accepted; a record without an action counts as failed. An input that
+    failed more than once is listed once.
+
+    Args:
+        path: The JSONL log to read
+
+    Returns:
+        Paths of the failed inputs
+
+    Raises:
+        OSError: If the log cannot be read
+    """
+    inputs: Dict[str, None] = {}
+    for record in _read_records(path):
+        if record.get("action", ACTION_FAILED) == ACTION_FAILED:
+            inputs[record["input"]] = None
+    return [Path(entry) for entry in inputs]
+
+
+def remove_inputs(path: Path, inputs: Iterable[Path]) -> None:
+    """Rewrite a JSONL log without the records for the given inputs.
+
+    Args:
+        path: The JSONL log to rewrite
+        inputs: Inputs whose records are dropped, e.g. files that now succeed
+    """
+    drop = {str(entry) for entry in inputs}
+    if not drop:
+        return
+    kept = [record for record in _read_records(path) if record["input"] not in drop]
+    temp = path.with_name(path.name + ".tmp")
+    with open(temp, "w") as f:
+        for record in kept:
+            f.write(json.dumps(record) + "\n")
+    atomic_replace(temp, path)
+
+
+class AuditLog:
+    """Buffered, thread-safe JSONL writer for per-file decisions."""
+
+    def __init__(
+        self, path: Path, flush_interval: float = 1.0, max_buffer: int = 100
+    ):
+        """Initialize AuditLog.
+
+        Args:
+            path: File the JSONL records are appended to
+            flush_interval: Minimum seconds between disk writes
+            max_buffer: Flush immediately once this many records are pending
+        """
+        self.path = path
+        self.flush_interval = flush_interval
+        self.max_buffer = max_buffer
+        self._buffer: List[Dict[str, Any]] = []
+        self._lock = threading.Lock()
+        self._last_flush = time.monotonic()
+
+    def record(
+        self,
+        action: str,
+        input_path: Path,
+        output_path: Optional[Path] = None,
+        checksum: str = "",
+        reason: Optional[str] = None,
+        error: Optional[str] = None,
+        duration_ms: float = 0.0,
+    ) -> None:
+        """Record a decision about a single file.
+
+        Args:
+            action: One of "processed", "skipped" or "failed"
+            input_path: The input file the decision is about
+            output_path: The output file, if one was (or would be) produced
+            checksum: Checksum of the output file
+            reason: Why the file was skipped
+            error: Why the file failed
+            duration_ms: Time spent on the file in milliseconds
+        """
+        entry = {
+            "timestamp": datetime.now(timezone.utc).isoformat(),
+            "action": action,
+            "input": str(input_path),
+            "output": str(output_path) if output_path else None,
+            "checksum": checksum,
+            "reason": reason,
+            "error": error,
+            "duration_ms": round(duration_ms, 3),
+        }
+
+        with self._lock:
+            self._buffer.append(entry)
+            elapsed = time.monotonic() - self._last_flush
+            if len(self._buffer) >= self.max_buffer or elapsed >= self.flush_interval:
+                self._flush_locked()
+
+    def flush(self) -> None:
+        """Write all pending records to disk."""
+        with self._lock:
+            self._flush_locked()
+
+    def close(self) -> None:
+        """Flush pending records; call once the run is complete."""
+        self.flush()
+
+    def _flush_locked(self) -> None:
+        self._last_flush = time.monotonic()
+        if not self._buffer:
+            return
+
+        self.path.parent.mkdir(parents=True, exist_ok=True)
+        with open(self.path, "a") as f:
+            for entry in self._buffer:
+                f.write(json.dumps(entry) + "\n")
+        self._buffer.clear()
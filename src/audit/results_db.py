@@ -0,0 +1,144 @@
+"""SQLite conversion history.
+
+This module provides a result sink that records every converted or failed
+file in an SQLite database, one row per file and run, so conversion history
+can be queried with SQL rather than by scanning JSONL manifests. Rows are
+committed as each file finishes, so an interrupted run keeps what it did.
+"""
+
+import sqlite3
+import threading
+from dataclasses import dataclass
+from datetime import datetime, timezone
+from pathlib import Path
+from typing import Any, Dict, List, Optional
+
+STATUS_PROCESSED = "processed"
+STATUS_FAILED = "failed"
+
+SCHEMA = """
+CREATE TABLE IF NOT EXISTS conversions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    input TEXT NOT NULL,
+    output TEXT,
+    input_format TEXT,
+    output_format TEXT,
+    input_bytes INTEGER,
+    output_bytes INTEGER,
+    checksum TEXT,
+    checksum_algorithm TEXT,
+    duration_ms REAL,
+    status TEXT NOT NULL,
+    error TEXT,
+    recorded_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS conversions_input ON conversions (input);
+"""
+
+COLUMNS = (
+    "input",
+    "output",
+    "input_format",
+    "output_format",
+    "input_bytes",
+    "output_bytes",
+    "checksum",
+    "checksum_algorithm",
+    "duration_ms",
+    "status",
+    "error",
+    "recorded_at",
+)
+
+
+@dataclass
+class ConversionRecord:
+    """One row of the conversion history."""
+
+    input: str
+    status: str
+    output: Optional[str] = None
+    input_format: str = ""
+    output_format: str = ""
+    input_bytes: Optional[int] = None
+    output_bytes: Optional[int] = None
+    checksum: str = ""
+    checksum_algorithm: str = ""
+    duration_ms: float = 0.0
+    error: Optional[str] = None
+    recorded_at: str = ""
+
+
+class ResultsDatabase:
+    """Thread-safe SQLite writer for per-file conversion results."""
+
+    def __init__(self, path: Path):
+        """Initialize ResultsDatabase, creating the file and table if needed.
+
+        Args:
+            path: SQLite database file
+        """
+        self.path = path
+        self._lock = threading.Lock()
+        self._connection: Optional[sqlite3.Connection] = None
+        with self._lock:
+            self._connect()
+
+    def _connect(self) -> sqlite3.Connection:
+        """The open connection, (re)opened after close(); call with the lock."""
+        if self._connection is None:
+            self.path.parent.mkdir(parents=True, exist_ok=True)
+            # Shared across the worker threads; the lock serializes its use
+            connection = sqlite3.connect(str(self.path), check_same_thread=False)
+            # Lets other processes query the history while a run writes to it
+            connection.execute("PRAGMA journal_mode=WAL")
+            connection.executescript(SCHEMA)
+            connection.commit()
+            self._connection = connection
+        return self._connection
+
+    def record(self, record: ConversionRecord) -> None:
+        """Insert one result and commit it.
+
+        Args:
+            record: The result; recorded_at defaults to now (UTC)
+        """
+        values = dict(vars(record))
+        values["recorded_at"] = (
+            record.recorded_at or datetime.now(timezone.utc).isoformat()
+        )
+        placeholders = ", ".join(f":{column}" for column in COLUMNS)
+        with self._lock:
+            connection = self._connect()
+            connection.execute(
+                f"INSERT INTO conversions ({', '.join(COLUMNS)}) "
+                f"VALUES ({placeholders})",
+                values,
+            )
+            connection.commit()
+
+    def rows(self, where: str = "", params: tuple = ()) -> List[Dict[str, Any]]:
+        """Read rows back, oldest first.
+
+        Args:
+            where: Optional SQL condition, e.g. "status = ?"
+            params: Values for the condition's placeholders
+
+        Returns:
+            Rows as dicts keyed by column name (including id)
+        """
+        query = "SELECT * FROM conversions"
+        if where:
+            query += f" WHERE {where}"
+        query += " ORDER BY id"
+        with self._lock:
+            cursor = self._connect().execute(query, params)
+            names = [description[0] for description in cursor.description]
+            return [dict(zip(names, row)) for row in cursor.fetchall()]
+
+    def close(self) -> None:
+        """Close the connection; call once the run is complete."""
+        with self._lock:
+            if self._connection is not None:
+                self._connection.close()
+                self._connection = None
@@ -0,0 +1,440 @@
+"""Command-line entry point for batch audio processing.
+
+Usage:
+    python -m src.cli --version [--json]
+    python -m src.cli --selftest [--config config.yaml]
+    python -m src.cli --stream [--input-format wav] < in.wav > out.flac
+    python -m src.cli [--config config.yaml] [--config-dir conf.d] [--dry-run]
+        [--in-place] [--yes] [--file-list list.m3u] [--retry-failed failed.jsonl]
+        [--file song.mp3 --file https://host/song.mp3]
+        [--shard-index 0 --shard-count 4]
+        [--verify | --analyze | --diff library | --export-state state.csv]
+
+Exit codes: 0 success, 1 configuration error (or failed self-test), 2 some
+files failed, 3 every file failed, 130 interrupted.
+"""
+
+import argparse
+import asyncio
+import json
+import sys
+from pathlib import Path
+from typing import Any, Dict, List, NoReturn, Optional, Tuple
+
+from src.audio.converter import AudioConverter, AudioOutputPlan, FFmpegError
+from src.config.config import ConfigLoader, merge_configs
+from src.config.log_setup import LoggingConfig, configure_logging
+from src.integrations.integration_manager import IntegrationManager
+from src.notifications.notifier import notifiers_from_config
+from src.processor.batch_processor import BatchConfig, BatchProcessor, LibraryDiff
+from src.processor.selftest import MIN_FFMPEG_VERSION, SelfTest
+from src.state.state import StateManager
+from src.version import build_info
+
+# Exit codes scripts can rely on; see EXIT_CODES_HELP
+EXIT_OK = 0
+EXIT_CONFIG_ERROR = 1
+EXIT_PARTIAL_FAILURE = 2
+EXIT_ALL_FAILED = 3
+EXIT_INTERRUPTED = 130
+
+EXIT_CODES_HELP = f"""exit codes:
+  {EXIT_OK}    success: every file converted (or verified intact)
+  {EXIT_CONFIG_ERROR}    configuration error: bad arguments or settings, or a failed
+       self-test
+  {EXIT_PARTIAL_FAILURE}    partial failure: some files failed or are corrupt
+  {EXIT_ALL_FAILED}    all failed: every file failed or is corrupt
+  {EXIT_INTERRUPTED}  interrupted (Ctrl-C)"""
+
+
+def exit_code(succeeded: int, failed: int) -> int:
+    """Map a run's outcome to its exit code.
+
+    Args:
+        succeeded: Files converted or verified intact
+        failed: Files that failed or are corrupt
+
+    Returns:
+        EXIT_OK if nothing failed, EXIT_ALL_FAILED if nothing succeeded,
+        otherwise EXIT_PARTIAL_FAILURE
+    """
+    if not failed:
+        return EXIT_OK
+    if not succeeded:
+        return EXIT_ALL_FAILED
+    return EXIT_PARTIAL_FAILURE
+
+
+class _ArgumentParser(argparse.ArgumentParser):
+    """Argument parser exiting with EXIT_CONFIG_ERROR on bad arguments."""
+
+    def error(self, message: str) -> NoReturn:
+        self.print_usage(sys.stderr)
+        self.exit(EXIT_CONFIG_ERROR, f"{self.prog}: error: {message}\n")
+
+
+def build_parser() -> argparse.ArgumentParser:
+    """Build the command-line argument parser."""
+    parser = _ArgumentParser(
+        description="Media Refinery batch processor",
+        epilog=EXIT_CODES_HELP,
+        formatter_class=argparse.RawDescriptionHelpFormatter,
+    )
+    parser.add_argument(
+        "--version", action="store_true", help="Print build information and exit"
+    )
+    parser.add_argument(
+        "--json", action="store_true", help="With --version, print it as JSON"
+    )
+    parser.add_argument(
+        "--config", type=Path, help="Configuration file (default: config.yaml)"
+    )
+    parser.add_argument(
+        "--config-dir",
+        type=Path,
+        help="Directory of *.yaml fragments merged in lexical order, after --config",
+    )
+    parser.add_argument("--input-dir", type=Path, help="Override input_dir")
+    parser.add_argument("--output-dir", type=Path, help="Override output_dir")
+    parser.add_argument(
+        "--file-list",
+        "--playlist",
+        dest="file_list",
+        type=Path,
+        help="Process only the files named in this list or M3U playlist",
+    )
+    parser.add_argument(
+        "--file",
+        dest="files",
+        action="append",
+        metavar="PATH_OR_URL",
+        help="Process only this file or http(s) URL (repeatable)",
+    )
+    parser.add_argument(
+        "--retry-failed",
+        type=Path,
+        metavar="FAILED_JSONL",
+        help="Process only the failed files in a prior run's audit log; "
+        "files that now succeed are removed from it",
+    )
+    parser.add_argument(
+        "--shard-index",
+        type=int,
+        help="Process only this shard of the input files (0-based, see --shard-count)",
+    )
+    parser.add_argument(
+        "--shard-count",
+        type=int,
+        help="Split the input files into this many shards, one per node",
+    )
+    parser.add_argument(
+        "--dry-run", action="store_true", help="Report planned work without writing"
+    )
+    parser.add_argument(
+        "--fail-fast",
+        action="store_true",
+        help="Stop at the first failed file, cancelling encodes in progress",
+    )
+    parser.add_argument(
+        "--in-place",
+        action="store_true",
+        help="Write outputs into input_dir, replacing each input only once its "
+        "output is verified",
+    )
+    parser.add_argument(
+        "--yes",
+        action="store_true",
+        help="Confirm settings that replace or move input files (e.g. in_place)",
+    )
+    mode = parser.add_mutually_exclusive_group()
+    mode.add_argument(
+        "--verify",
+        action="store_true",
+        help="Only scan input_dir for corrupt files; nothing is converted",
+    )
+    mode.add_argument(
+        "--analyze",
+        action="store_true",
+        help="Report the planned codec, bitrate and size per file; nothing is encoded",
+    )
+    mode.add_argument(
+        "--diff",
+        type=Path,
+        metavar="LIBRARY",
+        help="Compare planned output paths against an existing organized library",
+    )
+    mode.add_argument(
+        "--export-state",
+        type=Path,
+        metavar="CSV",
+        help="Write every recorded output state to a CSV file; nothing is converted",
+    )
+    mode.add_argument(
+        "--selftest",
+        action="store_true",
+        help="Check FFmpeg, each output format and the integrations, then exit",
+    )
+    mode.add_argument(
+        "--stream",
+        action="store_true",
+        help="Convert audio from stdin to stdout in the configured output format",
+    )
+    parser.add_argument(
+        "--input-format",
+        help="With --stream, the input's format (e.g. wav); detected if omitted",
+    )
+    return parser
+
+
+def format_plan(plan: AudioOutputPlan) -> str:
+    """Describe a planned conversion on one line."""
+    seconds = int(plan.duration_ms / 1000)
+    codec = plan.codec
+    if plan.source_codec:
+        codec = f"{plan.source_codec} to {plan.codec}"
+    parts = [codec, f"{plan.bitrate // 1000} kb/s"]
+    if plan.sample_rate:
+        parts.append(f"{plan.sample_rate} Hz")
+    parts.append(f"{seconds // 60}:{seconds % 60:02d}")
+    parts.append(f"~{plan.estimated_size_bytes / 1_000_000:.1f} MB")
+    return f"{plan.input_path} -> {plan.output_path.name}: {', '.join(parts)}"
+
+
+def format_diff(diff: LibraryDiff) -> List[str]:
+    """Describe a library comparison, one line per file."""
+    lines = []
+    for input_path, relative in diff.matches.items():
+        lines.append(f"match    {input_path} -> {relative}")
+    for input_path, (current, planned) in diff.moves.items():
+        lines.append(f"move     {input_path}: {current} -> {planned}")
+    for relative, inputs in diff.collisions.items():
+        sources = ", ".join(str(path) for path in inputs)
+        lines.append(f"collide  {relative} <- {sources}")
+    for input_path, relative in diff.new.items():
+        lines.append(f"new      {input_path} -> {relative}")
+    return lines
+
+
+def load_config_data(args: argparse.Namespace) -> Dict[str, Any]:
+    """Load the configuration file and apply command-line overrides."""
+    data: Dict[str, Any] = {}
+    if args.config or not args.config_dir:
+        data = ConfigLoader(args.config or Path("config.yaml")).load_config() or {}
+    if args.config_dir:
+        data = merge_configs(data, ConfigLoader.load_directory(args.config_dir))
+    if args.input_dir:
+        data["input_dir"] = str(args.input_dir)
+    if args.output_dir:
+        data["output_dir"] = str(args.output_dir)
+    if args.file_list:
+        data["file_list"] = str(args.file_list)
+    if args.files:
+        data["files"] = list(args.files)
+    if args.retry_failed:
+        data["retry_failed"] = str(args.retry_failed)
+    if args.shard_index is not None:
+        data["shard_index"] = args.shard_index
+    if args.shard_count is not None:
+        data["shard_count"] = args.shard_count
+    if args.dry_run:
+        data["dry_run"] = True
+    if args.fail_fast:
+        data["fail_fast"] = True
+    if args.in_place:
+        data["in_place"] = True
+    if args.yes:
+        data["confirm_destructive"] = True
+    return data
+
+
+def load_batch_config(
+    args: argparse.Namespace,
+) -> Tuple[Dict[str, Any], BatchConfig]:
+    """Load the configuration file and apply command-line overrides.
+
+    Returns:
+        Tuple of (raw configuration dict, BatchConfig)
+    """
+    data = load_config_data(args)
+    return data, BatchConfig.from_dict(data)
+
+
+def stream(args: argparse.Namespace) -> int:
+    """Convert stdin to stdout with the configured audio settings.
+
+    stdout carries the audio, so errors go to stderr, and the default
+    config.yaml is only read if it exists.
+
+    Returns:
+        Process exit code: EXIT_OK on success, EXIT_ALL_FAILED if the
+        conversion failed
+    """
+    data: Dict[str, Any] = {}
+    if args.config or args.config_dir or Path("config.yaml").exists():
+        data = load_config_data(args)
+    configure_logging(LoggingConfig.from_dict(data.get("logging") or {}))
+
+    audio = data.get("audio") or {}
+    converter = AudioConverter(
+        output_format=audio.get("output_format", "flac"),
+        niceness=int(data.get("encode_niceness", 0)),
+        io_class=data.get("encode_io_class") or None,
+        audio_filters=[str(f) for f in audio.get("audio_filters") or []],
+    )
+    try:
+        asyncio.run(
+            converter.convert_stream(
+                sys.stdin.buffer, sys.stdout.buffer, args.input_format
+            )
+        )
+    except FFmpegError as e:
+        print(f"error: {e}", file=sys.stderr)
+        return EXIT_ALL_FAILED
+    return EXIT_OK
+
+
+def selftest(
+    data: Dict[str, Any], processor: BatchProcessor, integrations: IntegrationManager
+) -> bool:
+    """Run the self-test and print its summary.
+
+    Args:
+        data: The configuration, for its selftest section
+        processor: Batch processor whose output formats are tested
+        integrations: The enabled integrations
+
+    Returns:
+        Whether every check passed
+
+    Raises:
+        ValueError: If selftest.min_ffmpeg_version is not a version
+    """
+    settings = data.get("selftest") or {}
+    test = SelfTest(
+        processor.output_converters(),
+        integrations,
+        min_version=str(settings.get("min_ffmpeg_version") or MIN_FFMPEG_VERSION),
+    )
+    report = asyncio.run(test.run())
+    print(report.summary(color=sys.stdout.isatty()))
+    return report.ok
+
+
+def main(argv: Optional[List[str]] = None) -> int:
+    """Run the batch processor.
+
+    Args:
+        argv: Command-line arguments (default: sys.argv[1:])
+
+    Returns:
+        Process exit code (see EXIT_CODES_HELP): settings that replace or
+        move inputs without confirmation are a configuration error, and a
+        run's files decide between success and (partial) failure
+    """
+    try:
+        return _main(argv)
+    except KeyboardInterrupt:
+        print("Interrupted", file=sys.stderr)
+        return EXIT_INTERRUPTED
+
+
+def _main(argv: Optional[List[str]]) -> int:
+    """main, without the handling of interruptions."""
+    parser = build_parser()
+    args = parser.parse_args(argv)
+    if args.version:
+        info = build_info()
+        print(json.dumps(info.to_dict()) if args.json else info)
+        return EXIT_OK
+    if args.stream:
+        return stream(args)
+
+    try:
+        data, config = load_batch_config(args)
+    except KeyError as e:
+        parser.error(f"missing required setting {e}")
+    except ValueError as e:
+        parser.error(str(e))
+
+    configure_logging(LoggingConfig.from_dict(data.get("logging") or {}))
+
+    converting = not (
+        args.verify or args.analyze or args.diff or args.export_state or args.selftest
+    )
+    confirmed = config.dry_run or config.confirm_destructive
+    destructive = config.destructive_operations()
+    if converting and destructive and not confirmed:
+        print(
+            "Refusing to start: these settings replace or move input files:",
+            file=sys.stderr,
+        )
+        for operation in destructive:
+            print(f"  {operation}", file=sys.stderr)
+        print(
+            "Confirm with --yes or confirm_destructive: true, "
+            "or preview with --dry-run",
+            file=sys.stderr,
+        )
+        return EXIT_CONFIG_ERROR
+
+    if args.export_state:
+        if not config.state_dir:
+            parser.error("--export-state needs state.dir in the configuration")
+        state = StateManager(config.state_dir, backend=config.state_backend)
+        count = state.export_csv(args.export_state)
+        print(f"Exported {count} records to {args.export_state}")
+        return EXIT_OK
+
+    integrations = IntegrationManager.from_config(data)
+    processor = BatchProcessor(
+        config, integrations=integrations, notifiers=notifiers_from_config(data)
+    )
+
+    startup_selftest = (data.get("selftest") or {}).get("on_startup", False)
+    try:
+        if args.selftest:
+            passed = selftest(data, processor, integrations)
+            return EXIT_OK if passed else EXIT_CONFIG_ERROR
+        if converting and startup_selftest and not config.dry_run:
+            if not selftest(data, processor, integrations):
+                print("Refusing to start: the self-test failed", file=sys.stderr)
+                return EXIT_CONFIG_ERROR
+    except ValueError as e:
+        parser.error(str(e))
+
+    if args.verify:
+        verify_result = asyncio.run(processor.verify_all())
+        print(verify_result.summary)
+        for path, problem in verify_result.suspect_files.items():
+            print(f"  {path}: {problem}")
+        suspect = len(verify_result.suspect_files)
+        return exit_code(verify_result.total_files - suspect, suspect)
+
+    if args.analyze:
+        plans = asyncio.run(processor.analyze_all())
+        for plan in plans:
+            print(format_plan(plan))
+        total_bytes = sum(plan.estimated_size_bytes for plan in plans)
+        print(f"{len(plans)} files, ~{total_bytes / 1_000_000:.1f} MB estimated")
+        return EXIT_OK
+
+    if args.diff:
+        diff = asyncio.run(processor.diff_against(args.diff))
+        for line in format_diff(diff):
+            print(line)
+        print(diff.summary)
+        return EXIT_OK
+
+    result = asyncio.run(processor.process_all())
+    if config.dry_run:
+        for file_result in result.files:
+            if file_result.plan:
+                print(format_plan(file_result.plan))
+    print(result.summary)
+    for path in result.failed_files:
+        print(f"  failed: {path}")
+    return exit_code(result.successful, result.failed)
+
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -1,6 +1,29 @@
 from pathlib import Path
 import yaml
-from typing import Any, Dict
+from typing import Any, Dict, Iterable
+
+
+def merge_configs(base: Dict[str, Any], override: Dict[str, Any]) -> Dict[str, Any]:
+    """
+    Deep-merges two configuration dictionaries.
+
+    Nested sections are merged key by key; any other value in override
+    replaces the one in base.
+
+    Args:
+        base (Dict[str, Any]): The configuration to merge into.
+        override (Dict[str, Any]): The configuration taking precedence.
+
+    Returns:
+        Dict[str, Any]: A new merged dictionary; the inputs are not modified.
+    """
+    merged = dict(base)
+    for key, value in override.items():
+        if isinstance(value, dict) and isinstance(merged.get(key), dict):
+            merged[key] = merge_configs(merged[key], value)
+        else:
+            merged[key] = value
+    return merged
 
 
 class ConfigLoader:
@@ -24,3 +47,33 @@ class ConfigLoader:
         except Exception as e:
             print(f"Failed to load configuration: {e}")
             return {}
+
+    @staticmethod
+    def load_files(config_paths: Iterable[Path]) -> Dict[str, Any]:
+        """
+        Loads several configuration files, later files overriding earlier ones.
+
+        Args:
+            config_paths (Iterable[Path]): The files to load, in merge order.
+
+        Returns:
+            Dict[str, Any]: The merged configuration data.
+        """
+        merged: Dict[str, Any] = {}
+        for config_path in config_paths:
+            data = ConfigLoader(config_path).load_config() or {}
+            merged = merge_configs(merged, data)
+        return merged
+
+    @staticmethod
+    def load_directory(config_dir: Path) -> Dict[str, Any]:
+        """
+        Loads every *.yaml file in a conf.d-style directory in lexical order.
+
+        Args:
+            config_dir (Path): The directory of configuration fragments.
+
+        Returns:
+            Dict[str, Any]: The merged configuration data.
+        """
+        return ConfigLoader.load_files(sorted(config_dir.glob("*.yaml")))
@@ -0,0 +1,144 @@
+"""Cover art fetching.
+
+Downloads the artwork URLs that integrations return (e.g. a Radarr poster or
+a MusicBrainz cover) so they can be embedded in converted files.
+"""
+
+import threading
+import urllib.error
+import urllib.request
+from typing import Any, Dict, Hashable, Optional
+
+import structlog
+
+from src.integrations.http import IntegrationError
+
+# Content types accepted as artwork, keyed to their file signatures
+ARTWORK_SIGNATURES = {
+    "image/jpeg": b"\xff\xd8\xff",
+    "image/png": b"\x89PNG\r\n\x1a\n",
+}
+
+# Artwork cover types preferred from Sonarr/Radarr image lists, best first
+ARTWORK_COVER_TYPES = ("cover", "poster")
+
+# Largest image accepted, in bytes
+MAX_ARTWORK_BYTES = 10 * 1024 * 1024
+
+
+class ArtworkError(IntegrationError):
+    """Raised when artwork cannot be downloaded or is not a usable image."""
+
+
+def artwork_url(document: Optional[Dict[str, Any]]) -> str:
+    """Pick the artwork URL from a Sonarr/Radarr lookup document.
+
+    Args:
+        document: Series or movie document with an ``images`` list
+
+    Returns:
+        Remote URL of the preferred cover type, or "" if there is none
+    """
+    images = (document or {}).get("images") or []
+    urls = {
+        image.get("coverType"): image.get("remoteUrl") or image.get("url")
+        for image in images
+    }
+    for cover_type in ARTWORK_COVER_TYPES:
+        if urls.get(cover_type):
+            return urls[cover_type]
+    return ""
+
+
+def image_type(data: bytes) -> Optional[str]:
+    """Content type of image data, judged by its signature; None if unknown."""
+    for content_type, signature in ARTWORK_SIGNATURES.items():
+        if data.startswith(signature):
+            return content_type
+    return None
+
+
+class ArtworkFetcher:
+    """Downloads artwork, caching each download for the run.
+
+    Callers pass a cache key (usually the album), so every track of an
+    album shares one download. Failed downloads are cached too, so a broken
+    URL is only tried once per album.
+    """
+
+    def __init__(self, timeout: float = 10.0, max_bytes: int = MAX_ARTWORK_BYTES):
+        """Initialize ArtworkFetcher.
+
+        Args:
+            timeout: Download timeout in seconds
+            max_bytes: Largest image accepted
+        """
+        self.timeout = timeout
+        self.max_bytes = max_bytes
+        self._cache: Dict[Hashable, Optional[bytes]] = {}
+        self._locks: Dict[Hashable, threading.Lock] = {}
+        self._cache_lock = threading.Lock()
+        self.logger = structlog.get_logger(__name__)
+
+    def fetch(self, url: str, key: Optional[Hashable] = None) -> Optional[bytes]:
+        """Download artwork once per key.
+
+        Args:
+            url: Artwork URL
+            key: Cache key (default: the URL)
+
+        Returns:
+            The image bytes, or None if the download failed
+        """
+        key = url if key is None else key
+        with self._cache_lock:
+            if key in self._cache:
+                return self._cache[key]
+            key_lock = self._locks.setdefault(key, threading.Lock())
+
+        with key_lock:
+            with self._cache_lock:
+                if key in self._cache:
+                    return self._cache[key]
+
+            try:
+                data = self.download(url)
+            except ArtworkError as e:
+                self.logger.warning("artwork_fetch_failed", url=url, error=str(e))
+                data = None
+
+            with self._cache_lock:
+                self._cache[key] = data
+            return data
+
+    def download(self, url: str) -> bytes:
+        """Download and validate one image.
+
+        Args:
+            url: Artwork URL
+
+        Returns:
+            The image bytes
+
+        Raises:
+            ArtworkError: If the request fails, the image is too large, or it
+                is not a JPEG or PNG
+        """
+        request = urllib.request.Request(url, headers={"Accept": "image/*"})
+        try:
+            with urllib.request.urlopen(request, timeout=self.timeout) as response:
+                header = response.headers.get("Content-Type") or ""
+                content_type = header.split(";")[0].strip().lower()
+                data = response.read(self.max_bytes + 1)
+        except urllib.error.HTTPError as e:
+            raise ArtworkError(f"Artwork request returned HTTP {e.code}") from e
+        except (urllib.error.URLError, OSError, ValueError) as e:
+            raise ArtworkError(f"Artwork request failed: {e}") from e
+
+        if len(data) > self.max_bytes:
+            raise ArtworkError(f"Artwork is larger than {self.max_bytes} bytes")
+        if content_type and content_type not in ARTWORK_SIGNATURES:
+            raise ArtworkError(f"Artwork has unsupported type {content_type}")
+        if image_type(data) is None:
+            raise ArtworkError("Artwork is not a JPEG or PNG image")
+        return data
@@ -0,0 +1,163 @@
+"""Beets integration.
+
+Client for a beets web server, used to import converted audio into the beets
+library so it is catalogued alongside the rest of the collection, and to ask
+whether a track is already in it.
+"""
+
+import json
+import urllib.error
+import urllib.parse
+import urllib.request
+from pathlib import Path
+from typing import Any, Dict, List, Optional, Sequence, Union
+
+import structlog
+
+
+class BeetsError(Exception):
+    """Raised when the beets server rejects or fails a request."""
+
+
+class BeetsClient:
+    """Minimal HTTP client for the beets web API."""
+
+    def __init__(self, url: str, token: str = "", timeout: float = 30.0):
+        """Initialize BeetsClient.
+
+        Args:
+            url: Base URL of the beets server (e.g. http://beets:8337)
+            token: Optional bearer token for authentication
+            timeout: Request timeout in seconds
+        """
+        self.url = url.rstrip("/")
+        self.token = token
+        self.timeout = timeout
+        self.logger = structlog.get_logger(__name__)
+
+    @classmethod
+    def from_config(cls, config: Dict[str, Any]) -> "BeetsClient":
+        """Build a client from the integrations.beets configuration section."""
+        return cls(url=config["url"], token=config.get("token") or "")
+
+    def import_to_beets(
+        self,
+        paths: Sequence[Union[str, Path]],
+        copy: bool = False,
+        move: bool = False,
+        write: bool = True,
+    ) -> Dict[str, Any]:
+        """Ask beets to import the given files.
+
+        Args:
+            paths: Files to import
+            copy: Copy files into the beets library directory
+            move: Move files into the beets library directory
+            write: Write updated tags back to the files
+
+        Returns:
+            Decoded JSON response from the server
+
+        Raises:
+            BeetsError: If the request fails
+        """
+        payload = {
+            "paths": [str(path) for path in paths],
+            "copy": copy,
+            "move": move,
+            "write": write,
+        }
+        return self._request("POST", "/api/import", payload)
+
+    def query_items(self, **fields: str) -> List[Dict[str, Any]]:
+        """Find library items matching every given field.
+
+        Beets matches each field as a case-insensitive substring, e.g.
+        query_items(artist="Nick Drake", title="Road").
+
+        Args:
+            **fields: Beets field names and the values to look for
+
+        Returns:
+            Matching items as returned by beets
+
+        Raises:
+            BeetsError: If the request fails
+        """
+        # Query terms are separated by "/", so slashes in values are escaped
+        terms = [
+            f"{name}:{value}".replace("/", "\\/")
+            for name, value in fields.items()
+            if value
+        ]
+        query = "/".join(urllib.parse.quote(term, safe="") for term in terms)
+        response = self._request("GET", f"/item/query/{query}")
+        return list(response.get("results") or [])
+
+    def find_track(
+        self, artist: str = "", title: str = "", mbid: str = ""
+    ) -> List[Dict[str, Any]]:
+        """Library items that are the given track.
+
+        Looks the track up by MusicBrainz recording ID when there is one,
+        else by artist and title, which must match exactly (ignoring case).
+
+        Args:
+            artist: Track artist
+            title: Track title
+            mbid: MusicBrainz recording ID (beets' mb_trackid)
+
+        Returns:
+            Matching items; empty when there is not enough to look up
+
+        Raises:
+            BeetsError: If the request fails
+        """
+        if mbid:
+            return self.query_items(mb_trackid=mbid)
+        if not (artist and title):
+            return []
+        return [
+            item
+            for item in self.query_items(artist=artist, title=title)
+            if str(item.get("artist", "")).casefold() == artist.casefold()
+            and str(item.get("title", "")).casefold() == title.casefold()
+        ]
+
+    def check_health(self) -> None:
+        """Check that the server is reachable and accepts our token.
+
+        Raises:
+            BeetsError: If the request fails
+        """
+        self._request("GET", "/stats")
+
+    def _request(
+        self, method: str, endpoint: str, payload: Optional[Dict[str, Any]] = None
+    ) -> Dict[str, Any]:
+        """Send a request (with payload as its JSON body) and decode the reply."""
+        headers = {"Content-Type": "application/json"}
+        if self.token:
+            headers["Authorization"] = f"Bearer {self.token}"
+
+        request = urllib.request.Request(
+            self.url + endpoint,
+            data=json.dumps(payload).encode() if payload is not None else None,
+            headers=headers,
+            method=method,
+        )
+
+        try:
+            with urllib.request.urlopen(request, timeout=self.timeout) as response:
+                body = response.read().decode()
+        except urllib.error.HTTPError as e:
+            raise BeetsError(f"Beets returned HTTP {e.code} for {endpoint}") from e
+        except (urllib.error.URLError, OSError) as e:
+            raise BeetsError(f"Beets request to {endpoint} failed: {e}") from e
+
+        return json.loads(body) if body else {}
+
+
+def batch_paths(paths: List[Path], batch_size: int) -> List[List[Path]]:
+    """Split paths into import batches of at most batch_size entries."""
+    return [paths[i : i + batch_size] for i in range(0, len(paths), batch_size)]
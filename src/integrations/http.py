@@ -0,0 +1,96 @@
+"""Shared JSON-over-HTTP plumbing for integration clients."""
+
+import json
+import urllib.error
+import urllib.parse
+import urllib.request
+from typing import Any, Dict, Optional
+
+import structlog
+
+
+class IntegrationError(Exception):
+    """Raised when an integration request fails."""
+
+
+class JSONClient:
+    """Base class for clients of JSON HTTP APIs.
+
+    Subclasses set ``error_class`` and override ``_headers`` to add
+    authentication.
+    """
+
+    error_class = IntegrationError
+    service = "integration"
+    # Cheap authenticated GET that succeeds when the service is usable
+    health_endpoint = "/"
+
+    def __init__(self, url: str, timeout: float = 30.0):
+        """Initialize JSONClient.
+
+        Args:
+            url: Base URL of the service
+            timeout: Request timeout in seconds
+        """
+        self.url = url.rstrip("/")
+        self.timeout = timeout
+        self.logger = structlog.get_logger(__name__)
+
+    def _headers(self) -> Dict[str, str]:
+        """Extra headers sent with every request."""
+        return {}
+
+    def check_health(self) -> None:
+        """Check that the service is reachable and accepts our credentials.
+
+        Raises:
+            IntegrationError: If the health request fails (as error_class)
+        """
+        self._request("GET", self.health_endpoint)
+
+    def _request(
+        self,
+        method: str,
+        endpoint: str,
+        payload: Optional[Dict[str, Any]] = None,
+        params: Optional[Dict[str, Any]] = None,
+    ) -> Any:
+        """Send a request and decode the JSON response.
+
+        Args:
+            method: HTTP method
+            endpoint: Path appended to the base URL
+            payload: JSON body, if any
+            params: Query string parameters, if any
+
+        Returns:
+            Decoded JSON response ({} for an empty body)
+
+        Raises:
+            IntegrationError: If the request fails (as error_class)
+        """
+        url = self.url + endpoint
+        if params:
+            url += "?" + urllib.parse.urlencode(params)
+
+        headers = {"Accept": "application/json", **self._headers()}
+        data = None
+        if payload is not None:
+            headers["Content-Type"] = "application/json"
+            data = json.dumps(payload).encode()
+
+        request = urllib.request.Request(url, data=data, headers=headers, method=method)
+
+        try:
+            with urllib.request.urlopen(request, timeout=self.timeout) as response:
+                body = response.read().decode()
+        except urllib.error.HTTPError as e:
+            raise self.error_class(
+                f"{self.service} returned HTTP {e.code} for {endpoint}"
+            ) from e
+        except (urllib.error.URLError, OSError) as e:
+            raise self.error_class(
+                f"{self.service} request to {endpoint} failed: {e}"
+            ) from e
+
+        return json.loads(body) if body else {}
@@ -1,13 +1,81 @@
-from typing import Dict, Any
+import threading
+from pathlib import Path
+from typing import Callable, Dict, Any, List, Optional, Tuple
+
+from src.integrations.artwork import artwork_url
+from src.integrations.beets import BeetsClient
+from src.integrations.radarr import RadarrClient
+from src.integrations.sonarr import SonarrClient
+from src.integrations.tdarr import TdarrClient
+
+
+def lookup_values(document: Dict[str, Any], series: bool = False) -> Dict[str, str]:
+    """
+    Maps a Sonarr series or Radarr movie document onto Metadata fields.
+
+    Args:
+        document (Dict[str, Any]): The lookup document.
+        series (bool): Whether it is a series, whose title names the show.
+
+    Returns:
+        Dict[str, str]: Field values for merge_metadata; fields the document
+            lacks are empty.
+    """
+    title = str(document.get("title") or "")
+    genres = document.get("genres") or [""]
+    values = {
+        "title": title,
+        "year": str(document.get("year") or ""),
+        "genre": str(genres[0]),
+        "artwork_url": artwork_url(document),
+    }
+    if series:
+        values["show"] = title
+    return values
 
 
 class IntegrationManager:
     """
     Manages integrations with external services.
+
+    Series and movie lookups are cached for the lifetime of the manager (one
+    run), so every episode of a show shares a single upstream lookup.
     """
 
     def __init__(self):
         self.integrations: Dict[str, Any] = {}
+        self._lookup_cache: Dict[Tuple[str, str], Any] = {}
+        self._lookup_locks: Dict[Tuple[str, str], threading.Lock] = {}
+        self._cache_lock = threading.Lock()
+
+    @classmethod
+    def from_config(cls, config: Dict[str, Any]) -> "IntegrationManager":
+        """
+        Creates a manager with every enabled integration registered.
+
+        Args:
+            config (Dict[str, Any]): The parsed configuration file.
+
+        Returns:
+            IntegrationManager: The populated manager.
+        """
+        manager = cls()
+        integrations = config.get("integrations") or {}
+
+        beets = integrations.get("beets") or {}
+        if beets.get("enabled") and beets.get("url"):
+            manager.register_integration("beets", BeetsClient.from_config(beets))
+
+        tdarr = integrations.get("tdarr") or {}
+        if tdarr.get("enabled") and tdarr.get("url"):
+            manager.register_integration("tdarr", TdarrClient.from_config(tdarr))
+
+        for name, client_class in (("sonarr", SonarrClient), ("radarr", RadarrClient)):
+            section = integrations.get(name) or {}
+            if section.get("enabled") and section.get("url"):
+                manager.register_integration(name, client_class.from_config(section))
+
+        return manager
 
     def register_integration(self, name: str, integration: Any) -> None:
         """
@@ -30,3 +98,138 @@ class IntegrationManager:
             Any: The integration instance, or None if not found.
         """
         return self.integrations.get(name)
+
+    def import_to_beets(
+        self,
+        paths: List[Path],
+        copy: bool = False,
+        move: bool = False,
+        write: bool = True,
+    ) -> Any:
+        """
+        Imports files into beets through the registered beets integration.
+
+        Args:
+            paths (List[Path]): The files to import.
+            copy (bool): Whether beets should copy files into its library.
+            move (bool): Whether beets should move files into its library.
+            write (bool): Whether beets should write tags back to the files.
+
+        Returns:
+            Any: The beets server response.
+
+        Raises:
+            KeyError: If no beets integration is registered.
+        """
+        beets = self.get_integration("beets")
+        if beets is None:
+            raise KeyError("beets integration is not registered")
+        return beets.import_to_beets(paths, copy=copy, move=move, write=write)
+
+    def lookup_series(
+        self, title: str, year: Optional[int] = None
+    ) -> Optional[Dict[str, Any]]:
+        """
+        Looks up a TV series through Sonarr, reusing earlier results.
+
+        Args:
+            title (str): The series title.
+            year (Optional[int]): The year parsed from the file name, used
+                to pick between results with similar titles.
+
+        Returns:
+            Optional[Dict[str, Any]]: The series document, or None if not found.
+
+        Raises:
+            KeyError: If no sonarr integration is registered.
+        """
+        return self._cached_lookup(
+            "sonarr",
+            title,
+            lambda client: client.lookup_series(title, year=year),
+            year=year,
+        )
+
+    def lookup_movie(
+        self, title: str, year: Optional[int] = None
+    ) -> Optional[Dict[str, Any]]:
+        """
+        Looks up a movie through Radarr, reusing earlier results.
+
+        Args:
+            title (str): The movie title.
+            year (Optional[int]): The year parsed from the file name, used
+                to pick between results with similar titles.
+
+        Returns:
+            Optional[Dict[str, Any]]: The movie document, or None if not found.
+
+        Raises:
+            KeyError: If no radarr integration is registered.
+        """
+        return self._cached_lookup(
+            "radarr",
+            title,
+            lambda client: client.lookup_movie(title, year=year),
+            year=year,
+        )
+
+    def check_health(self) -> Dict[str, Optional[str]]:
+        """
+        Checks every registered integration's health.
+
+        Returns:
+            Dict[str, Optional[str]]: Each integration's name, mapped to None
+                if it is healthy or to why its health check failed.
+        """
+        health: Dict[str, Optional[str]] = {}
+        for name, client in self.integrations.items():
+            try:
+                client.check_health()
+            except Exception as e:
+                health[name] = str(e) or type(e).__name__
+            else:
+                health[name] = None
+        return health
+
+    def clear_cache(self) -> None:
+        """
+        Forgets all cached lookups.
+        """
+        with self._cache_lock:
+            self._lookup_cache.clear()
+            self._lookup_locks.clear()
+
+    def _cached_lookup(
+        self,
+        name: str,
+        title: str,
+        lookup: Callable[[Any], Any],
+        year: Optional[int] = None,
+    ) -> Any:
+        """
+        Runs a lookup once per integration, normalized title and year.
+
+        Concurrent callers asking for the same title wait for the first
+        lookup instead of issuing their own. Failed lookups are not cached.
+        """
+        client = self.get_integration(name)
+        if client is None:
+            raise KeyError(f"{name} integration is not registered")
+
+        key = (name, title.strip().lower(), year)
+        with self._cache_lock:
+            if key in self._lookup_cache:
+                return self._lookup_cache[key]
+            key_lock = self._lookup_locks.setdefault(key, threading.Lock())
+
+        with key_lock:
+            with self._cache_lock:
+                if key in self._lookup_cache:
+                    return self._lookup_cache[key]
+
+            result = lookup(client)
+
+            with self._cache_lock:
+                self._lookup_cache[key] = result
+            return result
@@ -0,0 +1,52 @@
+"""Choosing the right document from *arr lookup results.
+
+Sonarr and Radarr return every plausible match for a search term, ordered
+by their own relevance, which can put a remake ahead of the original. The
+helpers here pick deterministically: a matching year first, then the most
+similar title, then the service's own order.
+"""
+
+import re
+from difflib import SequenceMatcher
+from typing import Any, Dict, List, Optional
+
+
+def normalize_title(title: str) -> str:
+    """Lower-case a title and reduce punctuation to single spaces."""
+    return " ".join(re.sub(r"[^\w]+", " ", title.lower()).split())
+
+
+def title_similarity(a: str, b: str) -> float:
+    """Similarity of two titles, from 0.0 (unrelated) to 1.0 (identical).
+
+    Case and punctuation are ignored, so "Spider-Man" and "spider man"
+    are identical.
+    """
+    return SequenceMatcher(None, normalize_title(a), normalize_title(b)).ratio()
+
+
+def best_match(
+    results: List[Dict[str, Any]], title: str, year: Optional[int] = None
+) -> Optional[Dict[str, Any]]:
+    """Pick the lookup result that best matches a parsed title and year.
+
+    Args:
+        results: Documents from a series or movie lookup, each with "title"
+            and usually "year"
+        title: Title parsed from the file name
+        year: Year parsed from the file name, if any
+
+    Returns:
+        The best result, or None if there are no results. Ties keep the
+        service's order.
+    """
+
+    def score(indexed):
+        index, result = indexed
+        year_matches = year is not None and result.get("year") == year
+        similarity = title_similarity(title, str(result.get("title") or ""))
+        return (year_matches, similarity, -index)
+
+    if not results:
+        return None
+    return max(enumerate(results), key=score)[1]
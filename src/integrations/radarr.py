@@ -0,0 +1,62 @@
+"""Radarr integration.
+
+Client for the Radarr v3 API, used to look up movie metadata.
+"""
+
+from typing import Any, Dict, Optional
+
+from src.integrations.http import IntegrationError, JSONClient
+from src.integrations.matching import best_match
+
+
+class RadarrError(IntegrationError):
+    """Raised when the Radarr server rejects or fails a request."""
+
+
+class RadarrClient(JSONClient):
+    """Minimal HTTP client for the Radarr API."""
+
+    error_class = RadarrError
+    service = "Radarr"
+    health_endpoint = "/api/v3/system/status"
+
+    def __init__(self, url: str, api_key: str = "", timeout: float = 30.0):
+        """Initialize RadarrClient.
+
+        Args:
+            url: Base URL of the Radarr server (e.g. http://radarr:7878)
+            api_key: API key from Radarr Settings > General
+            timeout: Request timeout in seconds
+        """
+        super().__init__(url, timeout=timeout)
+        self.api_key = api_key
+
+    @classmethod
+    def from_config(cls, config: Dict[str, Any]) -> "RadarrClient":
+        """Build a client from the integrations.radarr configuration section."""
+        return cls(url=config["url"], api_key=config.get("api_key") or "")
+
+    def lookup_movie(
+        self, title: str, year: Optional[int] = None
+    ) -> Optional[Dict[str, Any]]:
+        """Look up a movie by title.
+
+        Of several results, one from the given year is preferred, then the
+        closest title.
+
+        Args:
+            title: Movie title to search for
+            year: Year parsed from the file name, if any
+
+        Returns:
+            Best matching movie document, or None if nothing matched
+
+        Raises:
+            RadarrError: If the request fails
+        """
+        results = self._request("GET", "/api/v3/movie/lookup", params={"term": title})
+        return best_match(results or [], title, year)
+
+    def _headers(self) -> Dict[str, str]:
+        """API key authentication, when a key is configured."""
+        return {"X-Api-Key": self.api_key} if self.api_key else {}
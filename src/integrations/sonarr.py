@@ -0,0 +1,62 @@
+"""Sonarr integration.
+
+Client for the Sonarr v3 API, used to look up TV series metadata.
+"""
+
+from typing import Any, Dict, Optional
+
+from src.integrations.http import IntegrationError, JSONClient
+from src.integrations.matching import best_match
+
+
+class SonarrError(IntegrationError):
+    """Raised when the Sonarr server rejects or fails a request."""
+
+
+class SonarrClient(JSONClient):
+    """Minimal HTTP client for the Sonarr API."""
+
+    error_class = SonarrError
+    service = "Sonarr"
+    health_endpoint = "/api/v3/system/status"
+
+    def __init__(self, url: str, api_key: str = "", timeout: float = 30.0):
+        """Initialize SonarrClient.
+
+        Args:
+            url: Base URL of the Sonarr server (e.g. http://sonarr:8989)
+            api_key: API key from Sonarr Settings > General
+            timeout: Request timeout in seconds
+        """
+        super().__init__(url, timeout=timeout)
+        self.api_key = api_key
+
+    @classmethod
+    def from_config(cls, config: Dict[str, Any]) -> "SonarrClient":
+        """Build a client from the integrations.sonarr configuration section."""
+        return cls(url=config["url"], api_key=config.get("api_key") or "")
+
+    def lookup_series(
+        self, title: str, year: Optional[int] = None
+    ) -> Optional[Dict[str, Any]]:
+        """Look up a series by title.
+
+        Of several results, one from the given year is preferred, then the
+        closest title.
+
+        Args:
+            title: Series title to search for
+            year: Year parsed from the file name, if any
+
+        Returns:
+            Best matching series document, or None if nothing matched
+
+        Raises:
+            SonarrError: If the request fails
+        """
+        results = self._request("GET", "/api/v3/series/lookup", params={"term": title})
+        return best_match(results or [], title, year)
+
+    def _headers(self) -> Dict[str, str]:
+        """API key authentication, when a key is configured."""
+        return {"X-Api-Key": self.api_key} if self.api_key else {}
@@ -0,0 +1,149 @@
+"""Tdarr integration.
+
+Client for the Tdarr server API, used to queue files for transcoding and wait
+for the resulting jobs to finish.
+"""
+
+import asyncio
+import json
+import time
+import urllib.error
+import urllib.request
+from typing import Any, Dict, Optional
+
+import structlog
+
+# Job states after which Tdarr will not change the job any further
+TERMINAL_STATUSES = {"completed", "success", "failed", "error", "cancelled"}
+
+
+class TdarrError(Exception):
+    """Raised when the Tdarr server rejects or fails a request."""
+
+
+class TdarrClient:
+    """Minimal HTTP client for the Tdarr API."""
+
+    def __init__(
+        self,
+        url: str,
+        api_key: str = "",
+        library_id: str = "",
+        poll_interval: float = 5.0,
+        timeout: float = 30.0,
+    ):
+        """Initialize TdarrClient.
+
+        Args:
+            url: Base URL of the Tdarr server (e.g. http://tdarr:8265)
+            api_key: Optional API key sent with every request
+            library_id: Tdarr library that new files are queued into
+            poll_interval: Seconds between job status polls in wait_for_job
+            timeout: Request timeout in seconds
+        """
+        self.url = url.rstrip("/")
+        self.api_key = api_key
+        self.library_id = library_id
+        self.poll_interval = poll_interval
+        self.timeout = timeout
+        self.logger = structlog.get_logger(__name__)
+
+    @classmethod
+    def from_config(cls, config: Dict[str, Any]) -> "TdarrClient":
+        """Build a client from the integrations.tdarr configuration section."""
+        return cls(
+            url=config["url"],
+            api_key=config.get("api_key") or "",
+            library_id=str(config.get("library_id") or ""),
+            poll_interval=float(config.get("poll_interval", 5.0)),
+        )
+
+    def get_job_status(self, job_id: str) -> Dict[str, Any]:
+        """Fetch the current state of a job.
+
+        Args:
+            job_id: Tdarr job identifier
+
+        Returns:
+            Job document; its "status" key holds the job state
+
+        Raises:
+            TdarrError: If the request fails
+        """
+        return self._request("POST", "/api/v2/get-job", {"data": {"jobId": job_id}})
+
+    def check_health(self) -> None:
+        """Check that the server is reachable and accepts our API key.
+
+        Raises:
+            TdarrError: If the request fails
+        """
+        self._request("GET", "/api/v2/status")
+
+    async def wait_for_job(
+        self,
+        job_id: str,
+        timeout: float = 3600.0,
+        poll_interval: Optional[float] = None,
+    ) -> Dict[str, Any]:
+        """Poll a job until it reaches a terminal state.
+
+        The wait is a coroutine so that cancelling the awaiting task (e.g. on
+        pipeline shutdown) interrupts it promptly, even mid-poll.
+
+        Args:
+            job_id: Tdarr job identifier
+            timeout: Maximum seconds to wait before giving up
+            poll_interval: Seconds between polls (default: client setting)
+
+        Returns:
+            Final job document
+
+        Raises:
+            TdarrError: If a poll fails
+            TimeoutError: If the job does not finish within timeout
+            asyncio.CancelledError: If the wait is cancelled
+        """
+        interval = self.poll_interval if poll_interval is None else poll_interval
+        deadline = time.monotonic() + timeout
+
+        while True:
+            job = await asyncio.to_thread(self.get_job_status, job_id)
+            status = str(job.get("status", "")).lower()
+            if status in TERMINAL_STATUSES:
+                self.logger.info("tdarr_job_finished", job_id=job_id, status=status)
+                return job
+
+            remaining = deadline - time.monotonic()
+            if remaining <= 0:
+                raise TimeoutError(
+                    f"Tdarr job {job_id} did not finish within {timeout}s"
+                )
+
+            self.logger.debug("tdarr_job_pending", job_id=job_id, status=status)
+            await asyncio.sleep(min(interval, remaining))
+
+    def _request(
+        self, method: str, endpoint: str, payload: Optional[Dict[str, Any]] = None
+    ) -> Dict[str, Any]:
+        """Send a request (with payload as its JSON body) and decode the reply."""
+        headers = {"Content-Type": "application/json"}
+        if self.api_key:
+            headers["x-api-key"] = self.api_key
+
+        request = urllib.request.Request(
+            self.url + endpoint,
+            data=json.dumps(payload).encode() if payload is not None else None,
+            headers=headers,
+            method=method,
+        )
+
+        try:
+            with urllib.request.urlopen(request, timeout=self.timeout) as response:
+                body = response.read().decode()
+        except urllib.error.HTTPError as e:
+            raise TdarrError(f"Tdarr returned HTTP {e.code} for {endpoint}") from e
+        except (urllib.error.URLError, OSError) as e:
+            raise TdarrError(f"Tdarr request to {endpoint} failed: {e}") from e
+
+        return json.loads(body) if body else {}
@@ -4,11 +4,270 @@ from pathlib import Path
 import logging
 import re
 
+from src.storage.extensions import base_name, normalized_extension
+
 # Initialize logger
 logger = logging.getLogger(__name__)
 logging.basicConfig(level=logging.WARNING)
 
 
+# Placeholder value used by format_path when a field has no value or default
+UNKNOWN = "Unknown"
+
+# Metadata fields that may be given a library-wide default
+DEFAULTABLE_FIELDS = ("artist", "album", "genre")
+
+# Output formats whose tags are Vorbis comments
+VORBIS_COMMENT_FORMATS = ("flac", "ogg", "opus")
+
+# ID3v2 frames FFmpeg leaves under their frame ID (or names without a Vorbis
+# equivalent), and the Vorbis comment fields taggers use for them
+ID3_VORBIS_FIELDS = {
+    "tbpm": "BPM",
+    "tkey": "INITIALKEY",
+    "tmoo": "MOOD",
+    "tsrc": "ISRC",
+    "tit3": "SUBTITLE",
+    "text": "LYRICIST",
+    "tope": "ORIGINALARTIST",
+    "tmed": "MEDIA",
+    "tpe4": "REMIXER",
+    "tdor": "ORIGINALDATE",
+    "tory": "ORIGINALDATE",
+    "tso2": "ALBUMARTISTSORT",
+    "tsoc": "COMPOSERSORT",
+    "compilation": "COMPILATION",
+}
+
+# Tags FFmpeg writes as standard Vorbis comment fields itself
+STANDARD_TAGS = {
+    "title",
+    "artist",
+    "album",
+    "album_artist",
+    "albumartist",
+    "date",
+    "year",
+    "genre",
+    "track",
+    "tracknumber",
+    "tracktotal",
+    "totaltracks",
+    "disc",
+    "discnumber",
+    "disctotal",
+    "totaldiscs",
+    "composer",
+    "comment",
+    "description",
+    "copyright",
+    "publisher",
+    "organization",
+    "encoder",
+    "encoded_by",
+    "language",
+    "lyrics",
+    "performer",
+    "grouping",
+    "album-sort",
+    "artist-sort",
+    "title-sort",
+    "album_artist-sort",
+    "composer-sort",
+    "creation_time",
+    # Container and stream bookkeeping rather than tags about the music
+    "handler_name",
+    "vendor_id",
+    "major_brand",
+    "minor_version",
+    "compatible_brands",
+    "duration",
+}
+
+# Prefixes of custom tags that are de facto standard Vorbis fields
+# (MusicBrainz IDs, ReplayGain, AcoustID) or iTunes encoder data, left as
+# they are
+STANDARD_TAG_PREFIXES = ("musicbrainz", "replaygain_", "acoustid", "itun")
+
+# How tags without a Vorbis equivalent are written: as custom fields of
+# their own, folded into COMMENT, or not at all
+UNKNOWN_TAG_MODES = ("custom", "comment", "drop")
+
+
+def decade(year):
+    """
+    Names the decade of a year, e.g. 2023 -> "2020s".
+
+    Args:
+        year (str): A year or date tag such as "2023" or "2023-05-01".
+
+    Returns:
+        str: The decade, or None if the year is missing or invalid.
+    """
+    match = re.match(r"\s*(\d{4})\b", str(year or ""))
+    if not match or int(match.group(1)) == 0:
+        return None
+    return f"{int(match.group(1)) // 10 * 10}s"
+
+
+def format_path(pattern, meta):
+    """
+    Fills an organization pattern such as "{artist}/{album}/{title}".
+
+    Empty fields become "Unknown"; path separators inside values are
+    replaced so a tag cannot add directory levels. "{decade}" is derived
+    from the year (2023 -> "2020s"); when the year is unknown it renders
+    empty and the directory level it would have named is omitted.
+
+    Args:
+        pattern (str): The organization pattern.
+        meta (Metadata): The metadata to fill it from.
+
+    Returns:
+        str: The formatted relative path.
+    """
+    values = {
+        key: (str(value).replace("/", "-") if value not in ("", None) else UNKNOWN)
+        for key, value in vars(meta).items()
+    }
+    values["decade"] = decade(meta.year) or ""
+    path = pattern.format(**values)
+    if not values["decade"]:
+        path = "/".join(part for part in path.split("/") if part)
+    return path
+
+
+# A featured-artist clause after the artist, up to the end of the tag:
+# "feat. X", "ft X", "featuring X" or "with X", optionally in brackets
+FEATURED_ARTIST = re.compile(
+    r"\s+[(\[]?\s*\b(?:feat\.?|ft\.?|featuring|with)(?:\s|(?<=\.)).*$",
+    re.IGNORECASE,
+)
+
+# Separators of multi-value artist tags: FFprobe joins repeated tags with
+# ";", and some taggers write "A / B" or NUL-separated values
+ARTIST_SEPARATORS = re.compile(r"\s*(?:;|\x00|\s/\s)\s*")
+
+
+def primary_artist(artist, album_artist=""):
+    """
+    Reduces artist tags to the one artist a track is organized under.
+
+    The album artist wins when set, so every track of an album lands in
+    the same folder; otherwise the first of a multi-value artist tag is
+    used. Featured-artist clauses ("feat.", "ft.", "featuring", "with") are
+    dropped either way.
+
+    Args:
+        artist (str): The track's artist tag, e.g. "A feat. B" or "A; B".
+        album_artist (str): The album artist tag, if any.
+
+    Returns:
+        str: The primary artist; empty if both tags are empty.
+    """
+    for value in (album_artist, artist):
+        first = ARTIST_SEPARATORS.split(str(value or "").strip())[0]
+        primary = FEATURED_ARTIST.sub("", first).strip()
+        if primary:
+            return primary
+    return ""
+
+
+def sanitize_relative_path(path):
+    """
+    Reduces an externally supplied path to a safe relative path.
+
+    Leading slashes, "." and ".." components and control characters are
+    dropped so the result always stays inside the output directory.
+
+    Args:
+        path (str): The path to clean, e.g. from a naming command.
+
+    Returns:
+        str: The cleaned relative path; empty if nothing usable remains.
+    """
+    path = re.sub(r"[\x00-\x1f]", "", path.strip().replace("\\", "/"))
+    parts = [
+        part.strip()
+        for part in path.split("/")
+        if part.strip() not in ("", ".", "..")
+    ]
+    return "/".join(parts)
+
+
+def run_naming_command(command, meta, timeout=10.0):
+    """
+    Asks an external command for the output path of a file.
+
+    The command receives the metadata as a JSON object on stdin and prints
+    the desired output path, relative to the output directory and without
+    an extension, on stdout.
+
+    Args:
+        command (List[str]): The command and its arguments.
+        meta (Metadata): The metadata of the file being named.
+        timeout (float): Seconds to wait before giving up on the command.
+
+    Returns:
+        Optional[str]: The sanitized relative path, or None if the command
+        failed, timed out or printed nothing usable.
+    """
+    try:
+        completed = subprocess.run(
+            command,
+            input=json.dumps(vars(meta), default=str),
+            capture_output=True,
+            text=True,
+            timeout=timeout,
+        )
+    except (subprocess.TimeoutExpired, OSError) as e:
+        logger.warning(
+            "naming command failed", extra={"error": str(e), "path": meta.file_path}
+        )
+        return None
+
+    if completed.returncode != 0:
+        logger.warning(
+            "naming command failed",
+            extra={"returncode": completed.returncode, "path": meta.file_path},
+        )
+        return None
+
+    lines = completed.stdout.strip().splitlines()
+    path = sanitize_relative_path(lines[0]) if lines else ""
+    return path or None
+
+
+def parse_number_total(value):
+    """
+    Splits a track or disc tag of the form "N/M" into number and total.
+
+    Args:
+        value (str): The tag value, e.g. "3/12", "3" or "".
+
+    Returns:
+        Tuple[str, str]: The number and total; either may be empty.
+    """
+    number, _, total = str(value or "").partition("/")
+    return number.strip(), total.strip()
+
+
+def safe_int(value, default=0):
+    """Parses an ffprobe numeric field, falling back on missing or "N/A"."""
+    try:
+        return int(float(value))
+    except (TypeError, ValueError):
+        return default
+
+
+def safe_float(value, default=0.0):
+    """Parses an ffprobe decimal field, falling back on missing or "N/A"."""
+    try:
+        return float(value)
+    except (TypeError, ValueError):
+        return default
+
+
 class Metadata:
     def __init__(self):
         self.title = ""
@@ -23,11 +282,16 @@ class Metadata:
         self.disc_total = ""
         self.album_artist = ""
         self.composer = ""
+        self.musicbrainz_trackid = ""
         self.show = ""
         self.season = ""
         self.episode = ""
         self.director = ""
         self.actors = []
+        self.artwork_url = ""
+        # Every probed tag, lower-cased, and the ID3 POPM rating (0-255)
+        self.tags = {}
+        self.rating = None
         self.duration = 0.0
         self.bitrate = 0
         self.sample_rate = 0
@@ -35,15 +299,206 @@ class Metadata:
         self.format = ""
         self.file_path = ""
 
+    def numbering_tags(self):
+        """
+        Builds combined track and disc tags for writing to output files.
+
+        Returns:
+            Dict[str, str]: e.g. {"track": "3/12", "disc": "1/2"}; fields
+            without a number are left out.
+        """
+        tags = {}
+        for name, number, total in (
+            ("track", self.track, self.track_total),
+            ("disc", self.disc, self.disc_total),
+        ):
+            if number:
+                tags[name] = f"{number}/{total}" if total else number
+        return tags
+
+
+# Merge precedence: for each field, the broader fields whose value an
+# integration may put there when it lacks the specific one (a series-level
+# Sonarr record has the show name where the episode title belongs). Such a
+# generic value never replaces a probed one.
+GENERIC_VALUE_SOURCES = {
+    "title": ("show", "album"),
+    "album": ("artist", "album_artist"),
+}
+
+
+def _same_value(a, b):
+    return str(a).strip().lower() == str(b).strip().lower()
+
+
+def merge_metadata(meta, values):
+    """
+    Merges integration-provided values into probed metadata.
+
+    Integration values win over probed ones, with two exceptions: empty
+    integration values never replace anything, and a value that merely
+    repeats one of the field's broader fields (see GENERIC_VALUE_SOURCES)
+    does not replace a specific probed value, e.g. an episode title is not
+    replaced by the show name.
+
+    Args:
+        meta (Metadata): The probed metadata, updated in place.
+        values (Dict[str, Any]): Field values from an integration lookup.
+
+    Returns:
+        Metadata: The same metadata object.
+    """
+    for field, value in values.items():
+        if not hasattr(meta, field) or value in ("", None):
+            continue
+        current = getattr(meta, field)
+        if current not in ("", None) and not _same_value(current, value):
+            broader = [
+                values.get(name) or getattr(meta, name, "")
+                for name in GENERIC_VALUE_SOURCES.get(field, ())
+            ]
+            if any(b and _same_value(value, b) for b in broader):
+                logger.debug(
+                    "kept probed value over generic integration value",
+                    extra={"field": field, "kept": current, "ignored": value},
+                )
+                continue
+        setattr(meta, field, value)
+    return meta
+
+
+def _is_standard_tag(key):
+    return key in STANDARD_TAGS or key.startswith(STANDARD_TAG_PREFIXES)
+
+
+def vorbis_tags(tags, rating=None, unknown_tags="custom"):
+    """
+    Maps a source's tags to the Vorbis comments an output should carry.
+
+    FFmpeg copies tags across containers by name, so extended ID3 frames it
+    does not know arrive under their frame ID (e.g. TBPM) and POPM ratings
+    not at all. These become their usual Vorbis fields (BPM, RATING on a
+    0-100 scale, ...). Custom tags (TXXX descriptions and other fields with
+    no Vorbis equivalent) are written as upper-cased fields of their own,
+    folded into COMMENT as "name: value" lines, or dropped, per
+    unknown_tags.
+
+    Args:
+        tags (Dict[str, str]): The source's lower-cased tags (see
+            MetadataExtractor.collect_tags).
+        rating (Optional[int]): The source's POPM rating, 0-255.
+        unknown_tags (str): One of UNKNOWN_TAG_MODES.
+
+    Returns:
+        Dict[str, str]: Tags to set on the output; an empty value removes a
+            tag copied from the source.
+    """
+    mapped = {}
+    folded = []
+    for key, value in tags.items():
+        name = key[len("txxx:"):] if key.startswith("txxx:") else key
+        if key in ID3_VORBIS_FIELDS:
+            field = ID3_VORBIS_FIELDS[key]
+            if field == "COMPILATION":
+                value = "0" if value.strip() in ("", "0") else "1"
+            if key != field.lower():
+                mapped[key] = ""
+            mapped[field] = value
+        elif _is_standard_tag(name):
+            continue
+        elif unknown_tags == "custom":
+            if key != name:
+                mapped[key] = ""
+            mapped[name.upper()] = value
+        else:
+            mapped[key] = ""
+            if unknown_tags == "comment":
+                folded.append(f"{name}: {value}")
+
+    if rating is not None:
+        mapped["RATING"] = str(round(rating * 100 / 255))
+    if folded:
+        comment = tags.get("comment", "")
+        mapped["COMMENT"] = "\n".join(([comment] if comment else []) + folded)
+    return mapped
+
+
+def read_popm_rating(path):
+    """
+    Reads the rating from an MP3's ID3v2.3 or v2.4 POPM (popularimeter) frame.
+
+    Args:
+        path (Path): The MP3 file.
+
+    Returns:
+        Optional[int]: The first POPM rating (0-255), or None if the file has
+            no ID3v2 tag, no POPM frame, or cannot be read.
+    """
+    try:
+        with open(path, "rb") as f:
+            header = f.read(10)
+            if len(header) < 10 or not header.startswith(b"ID3"):
+                return None
+            version, flags = header[3], header[5]
+            tag = f.read(_syncsafe(header[6:10]))
+    except OSError:
+        return None
+    if version not in (3, 4):
+        return None
+
+    offset = 0
+    if flags & 0x40:
+        # Extended header: v2.4 counts its own size, v2.3 does not
+        size_field = tag[0:4]
+        if version == 4:
+            offset = _syncsafe(size_field)
+        else:
+            offset = int.from_bytes(size_field, "big") + 4
+    while offset + 10 <= len(tag):
+        frame_id = tag[offset : offset + 4]
+        size_field = tag[offset + 4 : offset + 8]
+        size = (
+            _syncsafe(size_field)
+            if version == 4
+            else int.from_bytes(size_field, "big")
+        )
+        if not frame_id.strip(b"\x00") or size <= 0:
+            break
+        body = tag[offset + 10 : offset + 10 + size]
+        if frame_id == b"POPM":
+            # Owner e-mail, NUL, then the one-byte rating
+            email_end = body.find(b"\x00")
+            if 0 <= email_end < len(body) - 1:
+                return body[email_end + 1]
+            return None
+        offset += 10 + size
+    return None
+
+
+def _syncsafe(data):
+    """Decode an ID3v2 syncsafe integer (7 bits per byte)."""
+    value = 0
+    for byte in data:
+        value = (value << 7) | (byte & 0x7F)
+    return value
+
+
+class ProbeTimeoutError(Exception):
+    """Raised when ffprobe takes longer than the probe timeout."""
+
 
 class MetadataExtractor:
-    def __init__(self, cleanup_tags=False):
+    def __init__(self, cleanup_tags=False, defaults=None, probe_timeout=30.0):
         self.cleanup_tags = cleanup_tags
+        self.probe_timeout = probe_timeout
+        self.defaults = {
+            field: value for field, value in (defaults or {}).items() if value
+        }
 
     def extract_metadata(self, path):
         meta = Metadata()
         meta.file_path = path
-        meta.format = Path(path).suffix.lstrip(".")
+        meta.format = normalized_extension(path).lstrip(".")
 
         try:
             output = subprocess.check_output(
@@ -58,13 +513,14 @@ class MetadataExtractor:
                     path,
                 ],
                 text=True,
+                timeout=self.probe_timeout,
             )
             result = json.loads(output)
 
-            tags = {
-                k.lower(): v
-                for k, v in result.get("format", {}).get("tags", {}).items()
-            }
+            tags = self.collect_tags(result)
+            meta.tags = tags
+            if meta.format == "mp3":
+                meta.rating = read_popm_rating(path)
 
             meta.title = self.get_tag(tags, "title")
             meta.artist = self.get_tag(tags, "artist")
@@ -72,24 +528,114 @@ class MetadataExtractor:
             meta.album_artist = self.get_tag(tags, "album_artist", "albumartist")
             meta.year = self.get_tag(tags, "year", "date")
             meta.genre = self.get_tag(tags, "genre")
-            meta.track = self.get_tag(tags, "track", "tracknumber")
+            meta.track, meta.track_total = parse_number_total(
+                self.get_tag(tags, "track", "tracknumber")
+            )
+            meta.track_total = meta.track_total or self.get_tag(
+                tags, "tracktotal", "totaltracks"
+            )
+            meta.disc, meta.disc_total = parse_number_total(
+                self.get_tag(tags, "disc", "discnumber")
+            )
+            meta.disc_total = meta.disc_total or self.get_tag(
+                tags, "disctotal", "totaldiscs"
+            )
             meta.composer = self.get_tag(tags, "composer")
+            meta.musicbrainz_trackid = self.get_tag(
+                tags, "musicbrainz_trackid", "musicbrainz track id"
+            )
             meta.comment = self.get_tag(tags, "comment")
+            meta.show = self.get_tag(tags, "show", "tvshow")
+            meta.director = self.get_tag(tags, "director")
+            if not meta.show:
+                self.parse_filename(meta, path)
 
-            meta.duration = float(result.get("format", {}).get("duration", 0))
-            meta.bitrate = int(result.get("format", {}).get("bit_rate", 0))
+            fmt = result.get("format") or {}
+            meta.duration = safe_float(fmt.get("duration"))
+            meta.bitrate = safe_int(fmt.get("bit_rate"))
 
-            for stream in result.get("streams", []):
+            for stream in result.get("streams") or []:
                 if stream.get("codec_type") == "audio":
-                    meta.sample_rate = int(stream.get("sample_rate", 0))
-                    meta.channels = stream.get("channels", 0)
+                    meta.sample_rate = safe_int(stream.get("sample_rate"))
+                    meta.channels = safe_int(stream.get("channels"))
                     break
 
-        except (subprocess.CalledProcessError, json.JSONDecodeError) as e:
+        except subprocess.TimeoutExpired as e:
+            # A file that hangs ffprobe is malformed; falling back would hide it
+            raise ProbeTimeoutError(
+                f"Timed out after {self.probe_timeout}s probing {path}"
+            ) from e
+        except (
+            subprocess.CalledProcessError, json.JSONDecodeError, FileNotFoundError
+        ) as e:
             logger.warning("ffprobe failed", extra={"error": str(e), "path": path})
             self.parse_filename(meta, path)
         return meta
 
+    def apply_defaults(self, meta):
+        """
+        Fills empty artist, album and genre fields with the configured defaults.
+
+        Applied after extraction and enrichment, so only fields nothing else
+        could determine are replaced.
+
+        Args:
+            meta (Metadata): The metadata to update in place.
+
+        Returns:
+            Metadata: The same metadata object.
+        """
+        for field, value in self.defaults.items():
+            if not getattr(meta, field, "").strip():
+                setattr(meta, field, value)
+        return meta
+
+    def collect_tags(self, result):
+        """
+        Gathers tags from the format and every stream of ffprobe output.
+
+        Containers such as MKV keep metadata on the streams rather than the
+        format, so stream tags fill in anything the format does not set.
+        Keys are lower-cased and stripped of the "TAG:" prefix that some
+        ffprobe output formats add.
+
+        Args:
+            result (Dict[str, Any]): Parsed ffprobe JSON.
+
+        Returns:
+            Dict[str, str]: The merged tags, format tags taking precedence.
+        """
+        sources = [(result.get("format") or {}).get("tags")]
+        sources += [stream.get("tags") for stream in result.get("streams") or []]
+
+        tags = {}
+        for source in sources:
+            for key, value in (source or {}).items():
+                key = key.lower()
+                if key.startswith("tag:"):
+                    key = key[len("tag:"):]
+                if value not in (None, "") and key not in tags:
+                    tags[key] = str(value)
+        return tags
+
+    def validate_metadata(self, meta, required_fields):
+        """
+        Lists the required fields that are missing from the metadata.
+
+        Args:
+            meta (Metadata): The extracted metadata.
+            required_fields (List[str]): Metadata attribute names that must be set.
+
+        Returns:
+            List[str]: The missing field names, in the order requested.
+        """
+        missing = []
+        for field in required_fields:
+            value = getattr(meta, field, "")
+            if not (value.strip() if isinstance(value, str) else value):
+                missing.append(field)
+        return missing
+
     def get_tag(self, tags, *keys):
         for key in keys:
             if key in tags:
@@ -97,13 +643,13 @@ class MetadataExtractor:
         return ""
 
     def parse_filename(self, meta, path):
-        basename = Path(path).stem
+        basename = base_name(path)
         match = re.match(r"^(.*)\.S(\d{2})E(\d{2})", basename, re.IGNORECASE)
         if match:
             meta.show = match.group(1).replace(".", " ").strip()
             meta.season = match.group(2)
             meta.episode = match.group(3)
-            meta.title = meta.show
+            meta.title = meta.title or meta.show
 
     def clean_tag(self, tag):
         return tag.strip() if tag else tag
@@ -0,0 +1,114 @@
+"""Email run reports over SMTP."""
+
+import smtplib
+import ssl
+from email.message import EmailMessage
+from typing import TYPE_CHECKING, Any, Dict, List
+
+from src.notifications.notifier import Notifier, report_body
+
+if TYPE_CHECKING:
+    from src.processor.batch_processor import BatchResult
+
+# Connection security: implicit TLS, STARTTLS upgrade, or plain SMTP
+SECURITY_MODES = {"tls", "starttls", "none"}
+
+
+class EmailNotifier(Notifier):
+    """Sends the run report as a plain-text email."""
+
+    name = "email"
+
+    def __init__(
+        self,
+        host: str,
+        sender: str,
+        recipients: List[str],
+        port: int = 587,
+        username: str = "",
+        password: str = "",
+        security: str = "starttls",
+        timeout: float = 30.0,
+    ):
+        """Initialize EmailNotifier.
+
+        Args:
+            host: SMTP server host name
+            sender: From address
+            recipients: To addresses
+            port: SMTP server port
+            username: Login user; no login is attempted when empty
+            password: Login password
+            security: tls (implicit TLS, usually port 465), starttls or none
+            timeout: Connection timeout in seconds
+
+        Raises:
+            ValueError: If security is not a known mode or no recipients are set
+        """
+        super().__init__()
+        if security not in SECURITY_MODES:
+            raise ValueError(
+                f"Email security must be one of {sorted(SECURITY_MODES)}, "
+                f"got {security!r}"
+            )
+        if not recipients:
+            raise ValueError("Email notifier needs at least one recipient")
+        self.host = host
+        self.port = port
+        self.sender = sender
+        self.recipients = recipients
+        self.username = username
+        self.password = password
+        self.security = security
+        self.timeout = timeout
+
+    @classmethod
+    def from_config(cls, config: Dict[str, Any]) -> "EmailNotifier":
+        """Build a notifier from the notifications.email configuration section."""
+        recipients = config.get("to") or []
+        if isinstance(recipients, str):
+            recipients = [recipients]
+        return cls(
+            host=config["smtp_host"],
+            port=int(config.get("smtp_port", 587)),
+            sender=config["from"],
+            recipients=list(recipients),
+            username=config.get("username") or "",
+            password=config.get("password") or "",
+            security=str(config.get("security", "starttls")).lower(),
+        )
+
+    def build_message(self, result: "BatchResult") -> EmailMessage:
+        """Compose the report email for a run."""
+        message = EmailMessage()
+        message["Subject"] = (
+            f"Media Refinery: {result.successful} processed, {result.failed} failed"
+        )
+        message["From"] = self.sender
+        message["To"] = ", ".join(self.recipients)
+        message.set_content(report_body(result))
+        return message
+
+    def send(self, result: "BatchResult") -> None:
+        """Send the report email.
+
+        Raises:
+            smtplib.SMTPException: If the server rejects the message
+            OSError: If the server cannot be reached
+        """
+        message = self.build_message(result)
+        context = ssl.create_default_context()
+
+        if self.security == "tls":
+            smtp = smtplib.SMTP_SSL(
+                self.host, self.port, timeout=self.timeout, context=context
+            )
+        else:
+            smtp = smtplib.SMTP(self.host, self.port, timeout=self.timeout)
+
+        with smtp:
+            if self.security == "starttls":
+                smtp.starttls(context=context)
+            if self.username:
+                smtp.login(self.username, self.password)
+            smtp.send_message(message)
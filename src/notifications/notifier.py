@@ -0,0 +1,78 @@
+"""Run report notifiers.
+
+Notifiers deliver the summary of a finished batch run somewhere a person
+will see it. Delivery is best effort: a notifier that fails logs the error
+and never fails the run.
+"""
+
+from typing import TYPE_CHECKING, Any, Dict, List
+
+import structlog
+
+if TYPE_CHECKING:
+    from src.processor.batch_processor import BatchResult
+
+
+class Notifier:
+    """Base class for run report notifiers."""
+
+    name = "notifier"
+
+    def __init__(self):
+        self.logger = structlog.get_logger(__name__).bind(notifier=self.name)
+
+    def send(self, result: "BatchResult") -> None:
+        """Deliver the run report.
+
+        Args:
+            result: Outcome of the finished run
+
+        Raises:
+            Exception: Any delivery failure
+        """
+        raise NotImplementedError
+
+    def notify(self, result: "BatchResult") -> bool:
+        """Deliver the run report, logging rather than raising on failure.
+
+        Args:
+            result: Outcome of the finished run
+
+        Returns:
+            True if the report was delivered
+        """
+        try:
+            self.send(result)
+        except Exception as e:
+            self.logger.error("notification_failed", error=str(e))
+            return False
+        self.logger.info("notification_sent")
+        return True
+
+
+def report_body(result: "BatchResult") -> str:
+    """Plain-text run report: the summary followed by any failed files."""
+    lines = [result.summary]
+    if result.failed_files:
+        lines += ["", "Failed files:"]
+        lines += [f"  {path}" for path in result.failed_files]
+    return "\n".join(lines) + "\n"
+
+
+def notifiers_from_config(data: Dict[str, Any]) -> List[Notifier]:
+    """Build the notifiers enabled in the notifications configuration section.
+
+    Args:
+        data: Full configuration dictionary
+
+    Returns:
+        Enabled notifiers, possibly empty
+    """
+    from src.notifications.email_notifier import EmailNotifier
+
+    notifications = data.get("notifications") or {}
+    notifiers: List[Notifier] = []
+    email = notifications.get("email") or {}
+    if email.get("enabled"):
+        notifiers.append(EmailNotifier.from_config(email))
+    return notifiers
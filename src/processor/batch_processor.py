@@ -0,0 +1,2674 @@
+"""Batch audio processing module.
+
+This module drives an AudioConverter over the supported audio files in an
+input directory using the worker pool, collecting per-file outcomes into a
+BatchResult and recording them in an optional JSONL manifest.
+"""
+
+import asyncio
+import copy
+import hashlib
+import json
+import os
+import re
+import shlex
+import shutil
+import tempfile
+import time
+from collections import Counter
+import structlog
+import yaml
+from dataclasses import dataclass, field
+from pathlib import Path
+from typing import (
+    Any,
+    Awaitable,
+    Callable,
+    Dict,
+    List,
+    Optional,
+    Set,
+    Tuple,
+    Union,
+)
+
+from src.audio.converter import (
+    DEFAULT_ERROR_OUTPUT_LIMIT,
+    AudioConverter,
+    AudioOutputPlan,
+    OutputValidationError,
+)
+from src.audit.audit_log import (
+    ACTION_FAILED,
+    ACTION_PROCESSED,
+    ACTION_SKIPPED,
+    AuditLog,
+    read_failed_inputs,
+    remove_inputs,
+)
+from src.audit.results_db import (
+    STATUS_FAILED,
+    STATUS_PROCESSED,
+    ConversionRecord,
+    ResultsDatabase,
+)
+from src.integrations.artwork import ArtworkFetcher
+from src.integrations.beets import batch_paths
+from src.integrations.integration_manager import IntegrationManager, lookup_values
+from src.metadata.metadata import (
+    DEFAULTABLE_FIELDS,
+    UNKNOWN_TAG_MODES,
+    VORBIS_COMMENT_FORMATS,
+    Metadata,
+    MetadataExtractor,
+    ProbeTimeoutError,
+    format_path,
+    merge_metadata,
+    primary_artist,
+    run_naming_command,
+    sanitize_relative_path,
+    vorbis_tags,
+)
+from src.notifications.notifier import Notifier
+from src.processor.load_governor import LoadGovernor
+from src.processor.worker_pool import MAX_WORKERS, WorkerPool
+from src.storage.archive import (
+    ArchiveError,
+    extract_archive,
+    is_archive,
+    list_archive,
+)
+from src.storage.checksum import compute_checksum
+from src.storage.extensions import base_name, normalized_extension
+from src.state.state import FileState, StateManager
+from src.storage.file_list import parse_entries, read_file_list, read_remote_entries
+from src.storage.readahead import Readahead
+from src.storage.remote import RemoteFetcher, RemoteInputError, remote_display_path
+from src.storage.storage import Storage
+from src.telemetry.pushgateway import Pushgateway
+from src.telemetry.telemetry import TelemetryProvider
+from src.validator.validator import AMBIGUOUS_EXTENSIONS, MediaType, Validator
+from src.video.converter import Config as VideoConfig
+from src.video.converter import VideoConverter
+
+# Default maximum number of paths sent to beets in a single import request
+BEETS_IMPORT_BATCH_SIZE = 50
+
+# Loudness normalization targets in LUFS, by content type. Speech is mastered
+# quieter than music; -23 is the EBU R128 broadcast level.
+DEFAULT_LOUDNESS_TARGETS = {"music": -16.0, "podcast": -19.0, "audiobook": -23.0}
+
+# Video encodes log their progress each time it passes a multiple of this
+# percentage
+VIDEO_PROGRESS_STEP = 10.0
+
+# Per-file overrides sit beside their input as <input name>.refinery.yaml
+OVERRIDE_SUFFIX = ".refinery.yaml"
+
+# Words in a file's genre or directory names that mark its content type
+CONTENT_TYPE_KEYWORDS = {
+    "audiobook": ("audiobook", "audio book", "spoken word"),
+    "podcast": ("podcast",),
+}
+
+
+def _optional_seconds(value: Any) -> Optional[float]:
+    """Parse a timeout setting; empty or zero means no limit."""
+    return float(value) if value else None
+
+
+def _worker_count(data: Dict[str, Any], key: str, default: int) -> int:
+    """Parse a concurrency setting, rejecting sizes WorkerPool refuses."""
+    count = int(data.get(key, default))
+    if not 1 <= count <= MAX_WORKERS:
+        raise ValueError(f"{key} must be between 1 and {MAX_WORKERS}, got {count}")
+    return count
+
+
+def guess_content_type(relative_path: Path, genre: str = "") -> str:
+    """Content type of a file from its genre tag and directory names.
+
+    Args:
+        relative_path: File path relative to the input directory
+        genre: The file's genre tag, if any
+
+    Returns:
+        "audiobook" or "podcast" when a keyword matches, else "music"
+    """
+    haystacks = [genre.lower()] + [part.lower() for part in relative_path.parts[:-1]]
+    for content_type, keywords in CONTENT_TYPE_KEYWORDS.items():
+        if any(keyword in text for keyword in keywords for text in haystacks):
+            return content_type
+    return "music"
+
+
+def _file_type(path: Path) -> str:
+    """Telemetry file type for a path: its lower-cased extension."""
+    return normalized_extension(path).lstrip(".")
+
+
+def _size(path: Path) -> Optional[int]:
+    """Size of a file in bytes, or None if it cannot be read."""
+    try:
+        return path.stat().st_size
+    except OSError:
+        return None
+
+
+def _stem_key(relative_path: Path) -> str:
+    """A relative path without its extension, lower-cased, for comparisons."""
+    return relative_path.with_suffix("").as_posix().lower()
+
+
+@dataclass
+class FormatRule:
+    """Routes files whose source format is listed to a specific output format."""
+
+    source_formats: List[str]
+    output_format: str
+    quality: Optional[str] = None  # Bitrate for lossy outputs, e.g. "128k"
+
+    @classmethod
+    def from_dict(cls, data: Dict[str, Any]) -> "FormatRule":
+        """Build a FormatRule from a configuration entry."""
+        return cls(
+            source_formats=list(data.get("source_formats") or []),
+            output_format=data["output_format"],
+            quality=data.get("quality"),
+        )
+
+    def matches(self, input_path: Path) -> bool:
+        """Check whether the rule applies to the given input file."""
+        source_format = normalized_extension(input_path).lstrip(".")
+        return source_format in {fmt.lower().lstrip(".") for fmt in self.source_formats}
+
+
+@dataclass
+class Profile:
+    """Output settings for files under one subtree of the input directory."""
+
+    path_prefix: str  # Relative to input_dir, e.g. "Podcasts"
+    output_format: Optional[str] = None
+    quality: Optional[str] = None  # Bitrate for lossy outputs, e.g. "64k"
+    music_pattern: Optional[str] = None  # e.g. "{album}/{title}"
+    content_type: Optional[str] = None  # music, podcast or audiobook
+
+    @classmethod
+    def from_dict(cls, data: Dict[str, Any]) -> "Profile":
+        """Build a Profile from a configuration entry."""
+        audio = data.get("audio") or {}
+        organization = data.get("organization") or {}
+        return cls(
+            path_prefix=str(data["path_prefix"]),
+            output_format=audio.get("output_format"),
+            quality=audio.get("quality"),
+            music_pattern=organization.get("music_pattern"),
+            content_type=audio.get("content_type"),
+        )
+
+    @property
+    def prefix_parts(self) -> Tuple[str, ...]:
+        """The prefix as path components, ignoring surrounding slashes."""
+        return tuple(part for part in self.path_prefix.split("/") if part)
+
+    def matches(self, input_path: Path, input_dir: Path) -> bool:
+        """Check whether the file lies under the profile's prefix."""
+        try:
+            relative = input_path.relative_to(input_dir)
+        except ValueError:
+            return False
+        parts = self.prefix_parts
+        return relative.parts[: len(parts)] == parts
+
+
+@dataclass
+class FileOverride:
+    """Settings pinned for a single input file by its override sidecar."""
+
+    skip: bool = False  # Never convert the file
+    output_format: Optional[str] = None
+    quality: Optional[str] = None  # Bitrate for lossy outputs, e.g. "320k"
+    extra_args: List[str] = field(default_factory=list)  # Extra FFmpeg options
+    error: Optional[str] = None  # Why the sidecar could not be used
+
+    @classmethod
+    def from_dict(cls, data: Dict[str, Any]) -> "FileOverride":
+        """Build a FileOverride from a sidecar, shaped like the config file."""
+        audio = data.get("audio") or {}
+        output_format = audio.get("output_format")
+        if output_format and not AudioConverter.supports_output(str(output_format)):
+            raise ValueError(f"Unsupported output format: {output_format}")
+        extra_args = audio.get("extra_args") or []
+        if isinstance(extra_args, str):
+            extra_args = shlex.split(extra_args)
+        return cls(
+            skip=bool(data.get("skip", False)),
+            output_format=output_format,
+            quality=audio.get("quality"),
+            extra_args=[str(arg) for arg in extra_args],
+        )
+
+    @staticmethod
+    def sidecar_path(input_path: Path) -> Path:
+        """The override sidecar for an input file."""
+        return input_path.with_name(input_path.name + OVERRIDE_SUFFIX)
+
+    @classmethod
+    def load(cls, input_path: Path) -> Optional["FileOverride"]:
+        """Read an input's override sidecar, or None if it has none.
+
+        A sidecar that cannot be read gives an override with only error set,
+        so the file fails rather than being converted without its pins.
+        """
+        path = cls.sidecar_path(input_path)
+        if not path.is_file():
+            return None
+        try:
+            data = yaml.safe_load(path.read_text()) or {}
+            if not isinstance(data, dict):
+                raise ValueError("expected a mapping")
+            return cls.from_dict(data)
+        except (OSError, ValueError, yaml.YAMLError) as e:
+            return cls(error=f"Invalid override {path.name}: {e}")
+
+
+@dataclass
+class BatchConfig:
+    """Configuration for a batch run."""
+
+    input_dir: Path
+    output_dir: Path
+    file_list: Optional[Path] = None
+    files: List[str] = field(default_factory=list)  # Paths or http(s) URLs
+    retry_failed: Optional[Path] = None
+    remote_headers: Dict[str, Dict[str, str]] = field(default_factory=dict)
+    remote_timeout: float = 60.0
+    recursive: bool = True
+    shard_index: int = 0
+    shard_count: int = 1
+    output_format: str = "flac"
+    quality: Optional[str] = None  # Bitrate for lossy outputs, e.g. "192k"
+    compression_level: int = 5
+    adaptive_compression: bool = True
+    format_rules: List[FormatRule] = field(default_factory=list)
+    profiles: List[Profile] = field(default_factory=list)
+    # Video files are converted too when set; the run is audio only otherwise
+    video: Optional[VideoConfig] = None
+    audio_filters: List[str] = field(default_factory=list)
+    trim_silence: bool = False
+    silence_threshold: str = "-60dB"
+    silence_keep: float = 0.5
+    normalize: bool = False
+    loudness_targets: Dict[str, float] = field(
+        default_factory=lambda: dict(DEFAULT_LOUDNESS_TARGETS)
+    )
+    no_upscale_bitrate: bool = False
+    verify_decodable: bool = False
+    encode_niceness: int = 0
+    encode_io_class: Optional[str] = None
+    log_ffmpeg_warnings: bool = False
+    ffmpeg_error_output_limit: Optional[int] = DEFAULT_ERROR_OUTPUT_LIMIT
+    concurrency: int = 4
+    ramp_up: bool = False
+    ramp_interval: float = 5.0
+    max_load_average: Optional[float] = None
+    probe_concurrency: int = 8
+    prefetch: int = 0
+    verify_concurrency: int = 8
+    skip_check_concurrency: int = 16
+    probe_timeout: float = 30.0
+    file_timeout: Optional[float] = None
+    encode_timeout: Optional[float] = None
+    keepalive_interval: Optional[float] = None
+    skip_unstable_files: bool = False
+    stability_window: float = 2.0
+    dry_run: bool = False
+    fail_fast: bool = False
+    in_place: bool = False
+    confirm_destructive: bool = False
+    extract_archives: bool = False
+    work_dir: Optional[Path] = None
+    keep_work_artifacts: bool = False
+    keep_originals: bool = False
+    originals_dir: Optional[Path] = None
+    require_metadata_fields: List[str] = field(default_factory=list)
+    metadata_defaults: Dict[str, str] = field(default_factory=dict)
+    unknown_tags: str = "custom"
+    embed_artwork: bool = False
+    primary_artist_for_path: bool = False
+    naming_command: List[str] = field(default_factory=list)
+    naming_timeout: float = 10.0
+    post_validate_command: List[str] = field(default_factory=list)
+    post_validate_timeout: float = 60.0
+    review_dir: Optional[Path] = None
+    max_failures_before_quarantine: Optional[int] = None
+    quarantine_dir: Optional[Path] = None
+    manifest_path: Optional[Path] = None
+    checksum_algorithm: str = "sha256"
+    checksum_sidecar: bool = False
+    state_dir: Optional[Path] = None
+    state_backend: str = "files"
+    audit_log_path: Optional[Path] = None
+    results_db_path: Optional[Path] = None
+    beets_import_after_run: bool = False
+    beets_import_batch_size: int = BEETS_IMPORT_BATCH_SIZE
+    beets_skip_if_in_library: bool = False
+    pushgateway_url: str = ""
+    pushgateway_job: str = "media_refinery"
+
+    @classmethod
+    def from_dict(cls, data: Dict[str, Any]) -> "BatchConfig":
+        """Build a BatchConfig from a parsed configuration file.
+
+        Args:
+            data: Configuration dictionary as returned by ConfigLoader
+
+        Returns:
+            BatchConfig populated from the matching configuration keys
+        """
+        audio = data.get("audio") or {}
+        organization = data.get("organization") or {}
+        metadata = data.get("metadata") or {}
+        beets = (data.get("integrations") or {}).get("beets") or {}
+        metrics = data.get("metrics") or {}
+
+        originals_dir = organization.get("originals_dir")
+        review_dir = organization.get("review_dir")
+        quarantine_dir = organization.get("quarantine_dir")
+        manifest_path = data.get("manifest_path")
+        audit_log_path = data.get("audit_log_path")
+        results_db_path = data.get("results_db_path")
+        work_dir = data.get("work_dir")
+        # In place, every output replaces its input once fully verified
+        in_place = bool(data.get("in_place", False))
+        output_dir = data["input_dir"] if in_place else data["output_dir"]
+        file_list = data.get("file_list")
+        retry_failed = data.get("retry_failed")
+        remote = data.get("remote_inputs") or {}
+        video = data.get("video") or {}
+        state = data.get("state") or {}
+        naming_command = organization.get("naming_command") or []
+        if isinstance(naming_command, str):
+            naming_command = shlex.split(naming_command)
+        post_validate_command = organization.get("post_validate_command") or []
+        if isinstance(post_validate_command, str):
+            post_validate_command = shlex.split(post_validate_command)
+        shard_index = int(data.get("shard_index", 0))
+        shard_count = int(data.get("shard_count", 1))
+        if shard_count < 1 or not 0 <= shard_index < shard_count:
+            raise ValueError(
+                f"shard_index must be in [0, {shard_count}) and shard_count "
+                f"at least 1, got {shard_index} of {shard_count}"
+            )
+        unknown_tags = str(metadata.get("unknown_tags", "custom")).lower()
+        if unknown_tags not in UNKNOWN_TAG_MODES:
+            raise ValueError(
+                f"metadata.unknown_tags must be one of "
+                f"{', '.join(UNKNOWN_TAG_MODES)}, got {unknown_tags}"
+            )
+
+        return cls(
+            input_dir=Path(data["input_dir"]),
+            output_dir=Path(output_dir),
+            file_list=Path(file_list) if file_list else None,
+            files=[str(entry) for entry in data.get("files") or []],
+            retry_failed=Path(retry_failed) if retry_failed else None,
+            remote_headers={
+                str(host): {str(name): str(value) for name, value in headers.items()}
+                for host, headers in (remote.get("headers") or {}).items()
+            },
+            remote_timeout=float(remote.get("timeout", 60.0)),
+            recursive=bool(data.get("recursive", True)),
+            shard_index=shard_index,
+            shard_count=shard_count,
+            output_format=audio.get("output_format", "flac"),
+            quality=audio.get("quality") or None,
+            compression_level=int(audio.get("compression_level", 5)),
+            adaptive_compression=bool(audio.get("adaptive_compression", True)),
+            format_rules=[
+                FormatRule.from_dict(rule) for rule in audio.get("format_rules") or []
+            ],
+            profiles=[Profile.from_dict(entry) for entry in data.get("profiles") or []],
+            video=(
+                VideoConfig(
+                    input_dir=data["input_dir"],
+                    output_dir=output_dir,
+                    format=video.get("output_format", "mkv"),
+                    preserve_metadata=True,
+                    compression_level=int(video.get("compression_level", 5)),
+                    dry_run=bool(data.get("dry_run", False)),
+                    state_dir=state.get("dir"),
+                    video_codec=video.get("video_codec", "h264"),
+                    quality=video.get("quality", "medium"),
+                    av1_encoder=video.get("av1_encoder", "libsvtav1"),
+                    remux_when_compatible=bool(
+                        video.get("remux_when_compatible", True)
+                    ),
+                    video_filters=video.get("video_filters"),
+                    resolution=video.get("resolution", "keep"),
+                    resolution_mode=video.get("resolution_mode", "max"),
+                    preserve_stream_metadata=bool(
+                        video.get("preserve_stream_metadata", True)
+                    ),
+                    segment_output=video.get("segment_output"),
+                    segment_duration=video.get("segment_duration", 6),
+                    codec_actions=video.get("codec_actions"),
+                )
+                if video.get("enabled")
+                else None
+            ),
+            audio_filters=[str(f) for f in audio.get("audio_filters") or []],
+            trim_silence=bool(audio.get("trim_silence", False)),
+            silence_threshold=str(audio.get("silence_threshold", "-60dB")),
+            silence_keep=float(audio.get("silence_keep", 0.5)),
+            normalize=bool(audio.get("normalize", False)),
+            loudness_targets={
+                **DEFAULT_LOUDNESS_TARGETS,
+                **{
+                    str(content_type): float(target)
+                    for content_type, target in (
+                        audio.get("loudness_targets") or {}
+                    ).items()
+                },
+            },
+            no_upscale_bitrate=bool(audio.get("no_upscale_bitrate", False)),
+            verify_decodable=in_place or bool(audio.get("verify_decodable", False)),
+            encode_niceness=int(data.get("encode_niceness", 0)),
+            encode_io_class=data.get("encode_io_class") or None,
+            log_ffmpeg_warnings=bool(data.get("log_ffmpeg_warnings", False)),
+            ffmpeg_error_output_limit=(
+                int(data.get("ffmpeg_error_output_limit", DEFAULT_ERROR_OUTPUT_LIMIT))
+                or None
+            ),
+            concurrency=_worker_count(data, "concurrency", 4),
+            ramp_up=bool(data.get("ramp_up", False)),
+            ramp_interval=float(data.get("ramp_interval", 5.0)),
+            max_load_average=(
+                float(data["max_load_average"])
+                if data.get("max_load_average")
+                else None
+            ),
+            probe_concurrency=_worker_count(data, "probe_concurrency", 8),
+            prefetch=int(data.get("prefetch") or 0),
+            verify_concurrency=_worker_count(data, "verify_concurrency", 8),
+            skip_check_concurrency=_worker_count(data, "skip_check_concurrency", 16),
+            probe_timeout=float(data.get("probe_timeout", 30.0)),
+            file_timeout=_optional_seconds(data.get("file_timeout")),
+            encode_timeout=_optional_seconds(data.get("encode_timeout")),
+            keepalive_interval=_optional_seconds(data.get("keepalive_interval")),
+            skip_unstable_files=bool(data.get("skip_unstable_files", False)),
+            stability_window=float(data.get("stability_window", 2.0)),
+            dry_run=bool(data.get("dry_run", False)),
+            fail_fast=bool(data.get("fail_fast", False)),
+            in_place=in_place,
+            confirm_destructive=bool(data.get("confirm_destructive", False)),
+            extract_archives=bool(data.get("extract_archives", False)),
+            work_dir=Path(work_dir) if work_dir else None,
+            keep_work_artifacts=bool(data.get("keep_work_artifacts", False)),
+            keep_originals=bool(organization.get("keep_originals", False)),
+            originals_dir=Path(originals_dir) if originals_dir else None,
+            require_metadata_fields=list(metadata.get("require_fields") or []),
+            embed_artwork=bool(metadata.get("embed_artwork", False)),
+            metadata_defaults={
+                name: str(metadata[f"default_{name}"])
+                for name in DEFAULTABLE_FIELDS
+                if metadata.get(f"default_{name}")
+            },
+            unknown_tags=unknown_tags,
+            primary_artist_for_path=bool(
+                organization.get("primary_artist_for_path", False)
+            ),
+            naming_command=[str(arg) for arg in naming_command],
+            naming_timeout=float(organization.get("naming_timeout", 10.0)),
+            post_validate_command=[str(arg) for arg in post_validate_command],
+            post_validate_timeout=float(
+                organization.get("post_validate_timeout", 60.0)
+            ),
+            review_dir=Path(review_dir) if review_dir else None,
+            max_failures_before_quarantine=(
+                int(organization["max_failures_before_quarantine"])
+                if organization.get("max_failures_before_quarantine")
+                else None
+            ),
+            quarantine_dir=Path(quarantine_dir) if quarantine_dir else None,
+            manifest_path=Path(manifest_path) if manifest_path else None,
+            checksum_algorithm=str(data.get("checksum_algorithm", "sha256")).lower(),
+            checksum_sidecar=bool(data.get("checksum_sidecar", False)),
+            state_dir=Path(state["dir"]) if state.get("dir") else None,
+            state_backend=str(state.get("backend", "files")),
+            audit_log_path=Path(audit_log_path) if audit_log_path else None,
+            results_db_path=Path(results_db_path) if results_db_path else None,
+            beets_import_after_run=bool(beets.get("import_after_run", False)),
+            beets_import_batch_size=max(
+                1, int(beets.get("import_batch_size", BEETS_IMPORT_BATCH_SIZE))
+            ),
+            beets_skip_if_in_library=bool(beets.get("skip_if_in_library", False)),
+            pushgateway_url=str(metrics.get("pushgateway_url") or ""),
+            pushgateway_job=str(metrics.get("job") or "media_refinery"),
+        )
+
+    def get_originals_dir(self) -> Path:
+        """Get the originals tree root, defaulting to <output_dir>/originals."""
+        return self.originals_dir or self.output_dir / "originals"
+
+    def get_review_dir(self) -> Path:
+        """Get where incomplete files go, defaulting to <output_dir>/needs-review."""
+        return self.review_dir or self.output_dir / "needs-review"
+
+    def destructive_operations(self) -> List[str]:
+        """Describe each configured operation that replaces or moves inputs."""
+        operations = []
+        if self.in_place:
+            operations.append("in_place: every input is replaced by its output")
+        if self.max_failures_before_quarantine and self.state_dir:
+            operations.append(
+                "max_failures_before_quarantine: inputs failing "
+                f"{self.max_failures_before_quarantine} runs in a row are moved "
+                f"to {self.get_quarantine_dir()}"
+            )
+        return operations
+
+    def get_quarantine_dir(self) -> Path:
+        """Get where failing inputs are moved, defaulting to <output_dir>/quarantine."""
+        return self.quarantine_dir or self.output_dir / "quarantine"
+
+
+@dataclass
+class FileResult:
+    """Outcome of processing a single input file."""
+
+    input_path: Path
+    success: bool
+    output_path: Optional[Path] = None
+    checksum: str = ""
+    checksum_algorithm: str = ""
+    original_path: Optional[Path] = None
+    error_message: Optional[str] = None
+    duration_ms: float = 0.0
+    missing_metadata: List[str] = field(default_factory=list)
+    quarantine_path: Optional[Path] = None
+    # Set when the file was left alone once probed, e.g. "in_beets_library"
+    skipped_reason: Optional[str] = None
+    # In a dry run, what the conversion would produce
+    plan: Optional[AudioOutputPlan] = None
+    # Set when the output replaced one an earlier run recorded in the state
+    reprocessed: bool = False
+    media_type: MediaType = MediaType.AUDIO
+
+    @property
+    def needs_review(self) -> bool:
+        """Whether the file was routed to the review directory."""
+        return bool(self.missing_metadata)
+
+    def to_dict(self) -> Dict[str, Any]:
+        """Serialize the outcome as a manifest record."""
+        return {
+            "input": str(self.input_path),
+            "output": str(self.output_path) if self.output_path else None,
+            "success": self.success,
+            "checksum": self.checksum,
+            "checksum_algorithm": self.checksum_algorithm,
+            "original": str(self.original_path) if self.original_path else None,
+            "error": self.error_message,
+            "missing_metadata": self.missing_metadata,
+        }
+
+
+@dataclass
+class PreparedFile:
+    """A file whose metadata and output path are settled, ready to encode."""
+
+    input_path: Path
+    output_path: Path
+    meta: Metadata
+    missing_metadata: List[str] = field(default_factory=list)
+    artwork: Optional[bytes] = None
+
+
+@dataclass
+class BatchResult:
+    """Aggregate result of a batch run."""
+
+    total_files: int = 0
+    successful: int = 0
+    failed: int = 0
+    failed_files: List[Path] = field(default_factory=list)
+    review_files: List[Path] = field(default_factory=list)
+    skipped: Dict[str, int] = field(default_factory=dict)
+    files: List[FileResult] = field(default_factory=list)
+    duration_s: float = 0.0
+    # Successful files split by whether an earlier run had converted them
+    newly_processed: int = 0
+    reprocessed: int = 0
+    # Successful files split by media type
+    audio_successful: int = 0
+    video_successful: int = 0
+    errors_by_file: Dict[Path, str] = field(default_factory=dict)
+    # Whether the state held outputs of earlier runs when this one started
+    resumed: bool = False
+    # With fail_fast, the failure that stopped the run and how many files
+    # were left unprocessed (never started, or cancelled mid-encode)
+    aborted_by: Optional[FileResult] = None
+    not_processed: int = 0
+
+    def add(self, file_result: FileResult) -> None:
+        """Record a single file outcome."""
+        self.files.append(file_result)
+        if file_result.needs_review:
+            self.review_files.append(file_result.input_path)
+        if file_result.success:
+            self.successful += 1
+            if file_result.media_type == MediaType.VIDEO:
+                self.video_successful += 1
+            else:
+                self.audio_successful += 1
+            if file_result.reprocessed:
+                self.reprocessed += 1
+            else:
+                self.newly_processed += 1
+        else:
+            self.failed += 1
+            self.failed_files.append(file_result.input_path)
+            self.errors_by_file[file_result.input_path] = (
+                file_result.error_message or ""
+            )
+
+    @property
+    def skipped_count(self) -> int:
+        """Files skipped for any reason."""
+        return sum(self.skipped.values())
+
+    @property
+    def summary(self) -> str:
+        """Human-readable summary of the run."""
+        summary = (
+            f"Processed {self.total_files} files: {self.successful} successful, "
+            f"{self.failed} failed, {self.skipped_count} skipped, "
+            f"{len(self.review_files)} need review in {self.duration_s:.1f}s"
+        )
+        if self.video_successful:
+            summary += (
+                f"\nSuccessful by type: {self.audio_successful} audio, "
+                f"{self.video_successful} video"
+            )
+        if self.resumed:
+            summary += (
+                f"\nResuming from earlier runs: {self.newly_processed} new, "
+                f"{self.reprocessed} reprocessed"
+            )
+        if self.aborted_by:
+            summary += (
+                f"\nStopped at the first failure ({self.aborted_by.input_path}: "
+                f"{self.aborted_by.error_message}); "
+                f"{self.not_processed} files not processed"
+            )
+        if self.skipped:
+            summary += "\n" + self.skip_summary
+        return summary
+
+    @property
+    def skip_summary(self) -> str:
+        """Skip counts per reason, most frequent first."""
+        tally = sorted(self.skipped.items(), key=lambda item: (-item[1], item[0]))
+        return "Skipped: " + ", ".join(f"{count} ({reason})" for reason, count in tally)
+
+
+@dataclass
+class VerifyResult:
+    """Result of a verify-only integrity scan."""
+
+    total_files: int = 0
+    suspect_files: Dict[Path, str] = field(default_factory=dict)
+    duration_s: float = 0.0
+
+    @property
+    def summary(self) -> str:
+        """Human-readable summary of the scan."""
+        return (
+            f"Verified {self.total_files} files: {len(self.suspect_files)} "
+            f"corrupt or suspect in {self.duration_s:.1f}s"
+        )
+
+
+@dataclass
+class LibraryDiff:
+    """Planned outputs compared against an existing organized library.
+
+    Paths in matches, moves and new are relative to the library root.
+    """
+
+    matches: Dict[Path, Path] = field(default_factory=dict)
+    moves: Dict[Path, Tuple[Path, Path]] = field(default_factory=dict)
+    collisions: Dict[Path, List[Path]] = field(default_factory=dict)
+    new: Dict[Path, Path] = field(default_factory=dict)
+
+    @property
+    def summary(self) -> str:
+        """Human-readable summary of the comparison."""
+        return (
+            f"{len(self.matches)} match, {len(self.moves)} would move, "
+            f"{len(self.collisions)} collide, {len(self.new)} new"
+        )
+
+
+class BatchProcessor:
+    """
+    Converts every supported audio file in the input directory.
+
+    Files are processed concurrently through the worker pool; failures are
+    recorded per file and never abort the rest of the batch.
+    """
+
+    def __init__(
+        self,
+        config: BatchConfig,
+        converter: Optional[AudioConverter] = None,
+        storage: Optional[Storage] = None,
+        integrations: Optional[IntegrationManager] = None,
+        metadata_extractor: Optional[MetadataExtractor] = None,
+        telemetry: Optional[TelemetryProvider] = None,
+        notifiers: Optional[List[Notifier]] = None,
+    ):
+        """Initialize BatchProcessor.
+
+        Args:
+            config: Batch run configuration
+            converter: Default audio converter, used for files not matched by
+                a format rule (default: one for output_format)
+            storage: Storage helper for file operations
+            integrations: Integrations used by post-run hooks
+            metadata_extractor: Extractor for the metadata completeness gate
+            telemetry: Counters for processed, failed and skipped files
+            notifiers: Receivers of the run report once a run completes
+        """
+        self.config = config
+        self.converter = converter or AudioConverter(
+            output_format=config.output_format,
+            bitrate=config.quality,
+            compression_level=config.compression_level,
+            adaptive_compression=config.adaptive_compression,
+            verify_decodable=config.verify_decodable,
+            niceness=config.encode_niceness,
+            io_class=config.encode_io_class,
+            checksum_algorithm=config.checksum_algorithm,
+            checksum_sidecar=config.checksum_sidecar,
+            encode_timeout=config.encode_timeout,
+            keepalive_interval=config.keepalive_interval,
+            embed_sibling_artwork=config.embed_artwork,
+            audio_filters=config.audio_filters,
+            trim_silence=config.trim_silence,
+            silence_threshold=config.silence_threshold,
+            silence_keep=config.silence_keep,
+            log_ffmpeg_warnings=config.log_ffmpeg_warnings,
+            error_output_limit=config.ffmpeg_error_output_limit,
+            no_upscale_bitrate=config.no_upscale_bitrate,
+        )
+        self.storage = storage or Storage()
+        self.integrations = integrations or IntegrationManager()
+        self.artwork = ArtworkFetcher()
+        self.remote = RemoteFetcher(config.remote_headers, config.remote_timeout)
+        self.video_converter = (
+            VideoConverter(
+                config.video,
+                niceness=config.encode_niceness,
+                io_class=config.encode_io_class,
+                encode_timeout=config.encode_timeout,
+            )
+            if config.video
+            else None
+        )
+        self.validator = Validator(probe_timeout=config.probe_timeout)
+        self.metadata_extractor = metadata_extractor or MetadataExtractor(
+            defaults=config.metadata_defaults, probe_timeout=config.probe_timeout
+        )
+        self.telemetry = telemetry or TelemetryProvider()
+        self.notifiers = list(notifiers or [])
+        self.pushgateway = (
+            Pushgateway(config.pushgateway_url, job=config.pushgateway_job)
+            if config.pushgateway_url
+            else None
+        )
+        self.state = (
+            StateManager(config.state_dir, backend=config.state_backend)
+            if config.state_dir
+            else None
+        )
+        self._rule_converters: Dict[
+            Tuple[str, Optional[str], Optional[float], Tuple[str, ...]],
+            AudioConverter,
+        ] = {}
+        self._overrides: Dict[Path, Optional[FileOverride]] = {}
+        self._skip_counts: Counter = Counter()
+        self.audit_log = (
+            AuditLog(config.audit_log_path) if config.audit_log_path else None
+        )
+        self.results_db = (
+            ResultsDatabase(config.results_db_path) if config.results_db_path else None
+        )
+        self.logger = structlog.get_logger(__name__)
+
+    def list_input_files(self) -> List[Path]:
+        """List every file in the input directory, supported or not.
+
+        With recursive (the default), subdirectories are scanned too, except
+        the ones this tool writes to (output, originals, review, quarantine,
+        work and state directories). Symlinked directories are followed, but
+        each directory is scanned once, so a link loop cannot recurse forever.
+
+        When file_list is set, the listed files are returned instead, in list
+        order, and the input directory is not scanned; missing entries are
+        skipped. files works the same way with entries given directly, and
+        retry_failed with the failed inputs of a prior run's log, which take
+        precedence over both. Listed URLs are left to list_remote_inputs.
+
+        With shard_count above 1, only this node's shard of the files is
+        returned (see in_shard), so several nodes can split one library.
+
+        Returns:
+            File paths, sorted (or in list order for a file list)
+        """
+        if self.config.retry_failed or self.config.file_list or self.config.files:
+            files = self._listed_files()
+        else:
+            files = self._scanned_files()
+        if self.config.shard_count == 1:
+            return files
+        return [path for path in files if self.in_shard(path)]
+
+    def in_shard(self, path: Path) -> bool:
+        """Whether a file belongs to this node's shard.
+
+        The shard is a stable hash of the path relative to input_dir, so
+        every node assigns each file to the same shard regardless of where
+        it mounts the library, and a rerun picks the same files again.
+
+        Args:
+            path: Input file
+
+        Returns:
+            True if path hashes to shard_index modulo shard_count
+        """
+        try:
+            key = path.relative_to(self.config.input_dir).as_posix()
+        except ValueError:
+            key = path.as_posix()
+        digest = hashlib.sha256(key.encode()).digest()
+        shard = int.from_bytes(digest[:8], "big") % self.config.shard_count
+        return shard == self.config.shard_index
+
+    def _scanned_files(self) -> List[Path]:
+        """Files found by scanning input_dir, sorted."""
+        if not self.config.input_dir.is_dir():
+            self.logger.warning(
+                "input_dir_missing", input_dir=str(self.config.input_dir)
+            )
+            return []
+
+        if not self.config.recursive:
+            return sorted(
+                path for path in self.config.input_dir.iterdir() if path.is_file()
+            )
+
+        excluded = {os.path.realpath(path) for path in self._written_dirs()}
+        visited: Set[str] = set()
+        files = []
+        for root, dirs, names in os.walk(self.config.input_dir, followlinks=True):
+            real_root = os.path.realpath(root)
+            if real_root in visited or real_root in excluded:
+                dirs.clear()
+                continue
+            visited.add(real_root)
+            for name in names:
+                path = Path(root) / name
+                if path.is_file():
+                    files.append(path)
+        return sorted(files)
+
+    def _written_dirs(self) -> List[Path]:
+        """Directories a run writes to, never scanned for inputs."""
+        config = self.config
+        written = [
+            config.get_originals_dir(),
+            config.get_review_dir(),
+            config.get_quarantine_dir(),
+        ]
+        if config.output_dir != config.input_dir:
+            written.append(config.output_dir)
+        written.extend(path for path in (config.work_dir, config.state_dir) if path)
+        return written
+
+    def list_remote_inputs(self) -> List[str]:
+        """List the http(s) URLs named by the file list or files setting.
+
+        They are downloaded into the run's work directory by process_all.
+        With shard_count above 1, only this node's shard is returned.
+
+        Returns:
+            URLs, in list order
+        """
+        if self.config.retry_failed:
+            return []
+        try:
+            if self.config.file_list:
+                urls = read_remote_entries(self.config.file_list)
+            else:
+                urls = parse_entries(self.config.files, Path.cwd())[1]
+        except OSError:
+            # Reported when the local entries are listed
+            return []
+        if self.config.shard_count == 1:
+            return urls
+        return [url for url in urls if self.in_shard(remote_display_path(url))]
+
+    def _listed_files(self) -> List[Path]:
+        """Existing files named by the retry log, file list, playlist or files."""
+        source = self.config.retry_failed or self.config.file_list
+        try:
+            if self.config.retry_failed:
+                listed = read_failed_inputs(self.config.retry_failed)
+            elif self.config.file_list:
+                listed = read_file_list(self.config.file_list)
+            else:
+                listed = parse_entries(self.config.files, Path.cwd())[0]
+        except OSError as e:
+            self.logger.error(
+                "file_list_unreadable", file_list=str(source), error=str(e)
+            )
+            return []
+
+        files = []
+        for path in listed:
+            if path.is_file():
+                files.append(path)
+            else:
+                self._skip(path, "not_found")
+        return files
+
+    def find_audio_files(self) -> List[Path]:
+        """Find supported audio files in the input directory.
+
+        Returns:
+            Sorted list of audio file paths
+        """
+        return [path for path in self.list_input_files() if self._is_supported(path)]
+
+    def profile_for(self, input_path: Path) -> Optional[Profile]:
+        """Select the profile for a file by longest matching path prefix.
+
+        Args:
+            input_path: Path to the input audio file
+
+        Returns:
+            The most specific matching profile, or None if none matches
+        """
+        matching = [
+            profile
+            for profile in self.config.profiles
+            if profile.matches(input_path, self.config.input_dir)
+        ]
+        if not matching:
+            return None
+        return max(matching, key=lambda profile: len(profile.prefix_parts))
+
+    def content_type_for(
+        self, input_path: Path, meta: Optional[Metadata] = None
+    ) -> str:
+        """Content type of a file: its profile's, else guessed from genre and path.
+
+        Args:
+            input_path: Path to the input audio file
+            meta: The file's metadata, if already extracted
+
+        Returns:
+            Content type, e.g. "music", "podcast" or "audiobook"
+        """
+        profile = self.profile_for(input_path)
+        if profile and profile.content_type:
+            return profile.content_type
+        try:
+            relative = input_path.relative_to(self.config.input_dir)
+        except ValueError:
+            relative = Path(input_path.name)
+        return guess_content_type(relative, meta.genre if meta else "")
+
+    def loudness_target_for(
+        self, input_path: Path, meta: Optional[Metadata] = None
+    ) -> Optional[float]:
+        """Loudness target in LUFS for a file, or None without normalization."""
+        if not self.config.normalize:
+            return None
+        targets = self.config.loudness_targets
+        return targets.get(
+            self.content_type_for(input_path, meta), targets.get("music")
+        )
+
+    def override_for(self, input_path: Path) -> Optional[FileOverride]:
+        """The file's override sidecar, read once per run."""
+        if input_path not in self._overrides:
+            self._overrides[input_path] = FileOverride.load(input_path)
+        return self._overrides[input_path]
+
+    def converter_for(
+        self, input_path: Path, meta: Optional[Metadata] = None
+    ) -> AudioConverter:
+        """Select the converter for a file by its profile and format rules.
+
+        A matching profile's output format takes precedence. Otherwise the
+        first matching format rule wins; files matching no rule use the
+        default converter and its output format. With normalization enabled,
+        the converter also targets the loudness of the file's content type.
+        The file's override sidecar, if any, is applied over all of these.
+
+        Args:
+            input_path: Path to the input audio file
+            meta: The file's metadata, used to tell its content type
+
+        Returns:
+            AudioConverter producing the file's output format
+        """
+        target = self.loudness_target_for(input_path, meta)
+        output_format, quality = self.converter.output_format, self.converter.bitrate
+        profile = self.profile_for(input_path)
+        if profile and profile.output_format:
+            output_format, quality = profile.output_format, profile.quality
+        else:
+            for rule in self.config.format_rules:
+                if rule.matches(input_path):
+                    output_format, quality = rule.output_format, rule.quality
+                    break
+
+        extra_args: Tuple[str, ...] = ()
+        override = self.override_for(input_path)
+        if override:
+            if override.output_format:
+                output_format, quality = override.output_format, override.quality
+            elif override.quality:
+                quality = override.quality
+            extra_args = tuple(override.extra_args)
+
+        if (output_format, quality, target, extra_args) == (
+            self.converter.output_format,
+            self.converter.bitrate,
+            self.converter.loudness_target,
+            (),
+        ):
+            return self.converter
+        return self._converter_with(output_format, quality, target, extra_args)
+
+    def output_converters(self) -> Dict[str, AudioConverter]:
+        """One converter per configured output format.
+
+        Covers the default format and those of format rules and profiles;
+        where several set the same format, the first one's bitrate is used.
+
+        Returns:
+            Output format mapped to a converter producing it
+        """
+        converters = {self.converter.output_format: self.converter}
+        targets = [
+            (rule.output_format, rule.quality) for rule in self.config.format_rules
+        ] + [
+            (profile.output_format, profile.quality)
+            for profile in self.config.profiles
+            if profile.output_format
+        ]
+        for output_format, quality in targets:
+            if output_format not in converters:
+                converters[output_format] = self._converter_with(output_format, quality)
+        return converters
+
+    def output_tags(self, converter: AudioConverter, meta: Metadata) -> Dict[str, str]:
+        """Tags to set on a file's output beyond those copied from the source.
+
+        Vorbis comment outputs also get the source's extended ID3 frames
+        under their Vorbis names, its POPM rating, and its custom tags
+        handled per the unknown_tags setting.
+
+        Args:
+            converter: Converter producing the file's output
+            meta: The file's metadata
+
+        Returns:
+            Tag names mapped to values; an empty value removes the tag
+        """
+        tags = meta.numbering_tags()
+        if converter.output_format in VORBIS_COMMENT_FORMATS:
+            tags = {
+                **vorbis_tags(meta.tags, meta.rating, self.config.unknown_tags),
+                **tags,
+            }
+        return tags
+
+    def _converter_with(
+        self,
+        output_format: str,
+        quality: Optional[str],
+        loudness_target: Optional[float] = None,
+        extra_args: Tuple[str, ...] = (),
+    ) -> AudioConverter:
+        """A converter like the default one, for another format and bitrate."""
+        key = (output_format, quality, loudness_target, extra_args)
+        if key not in self._rule_converters:
+            self._rule_converters[key] = AudioConverter(
+                output_format=output_format,
+                sample_rate=self.converter.sample_rate,
+                bit_depth=self.converter.bit_depth,
+                force_bit_depth=self.converter.force_bit_depth,
+                compression_level=self.converter.compression_level,
+                adaptive_compression=self.converter.adaptive_compression,
+                bitrate=quality,
+                verify_decodable=self.converter.verify_decodable,
+                niceness=self.converter.niceness,
+                io_class=self.converter.io_class,
+                checksum_algorithm=self.converter.checksum_algorithm,
+                checksum_sidecar=self.converter.checksum_sidecar,
+                encode_timeout=self.converter.encode_timeout,
+                keepalive_interval=self.converter.keepalive_interval,
+                embed_sibling_artwork=self.converter.embed_sibling_artwork,
+                audio_filters=self.converter.audio_filters,
+                trim_silence=self.converter.trim_silence,
+                silence_threshold=self.converter.silence_threshold,
+                silence_keep=self.converter.silence_keep,
+                log_ffmpeg_warnings=self.converter.log_ffmpeg_warnings,
+                error_output_limit=self.converter.error_output_limit,
+                no_upscale_bitrate=self.converter.no_upscale_bitrate,
+                loudness_target=loudness_target,
+                work_dir=self.converter.work_dir,
+                keep_work_files=self.converter.keep_work_files,
+                extra_args=list(extra_args),
+            )
+        return self._rule_converters[key]
+
+    def _is_supported(self, path: Path, media_type: Optional[MediaType] = None) -> bool:
+        """Check whether the file is audio the converter accepts.
+
+        Containers that may hold audio or video (e.g. .mkv) are accepted
+        when a probe finds audio only.
+
+        Args:
+            path: File to check
+            media_type: The file's type from _classify, if known, so it is
+                not probed again
+        """
+        suffix = normalized_extension(path)
+        if suffix in self.converter.SUPPORTED_FORMATS:
+            return True
+        if suffix not in AMBIGUOUS_EXTENSIONS:
+            return False
+        return (media_type or self.validator.classify(path)) == MediaType.AUDIO
+
+    def _is_video(self, path: Path, media_type: Optional[MediaType] = None) -> bool:
+        """Check whether the file is video and video conversion is enabled.
+
+        Args:
+            path: File to check
+            media_type: The file's type from _classify, if known, so it is
+                not probed again
+        """
+        if not self.video_converter or self._is_supported(path, media_type):
+            return False
+        return (media_type or self.validator.classify(path)) == MediaType.VIDEO
+
+    async def _classify(self, paths: List[Path]) -> Dict[Path, MediaType]:
+        """Probe the inputs whose media type their extension leaves open.
+
+        Containers that may hold audio or video (e.g. .mkv, .ts) are probed
+        once each, off the event loop and probe_concurrency at a time; the
+        result is passed to _is_supported and _is_video so neither probes
+        again.
+
+        Args:
+            paths: Input files
+
+        Returns:
+            Media type of each probed file
+        """
+        media_types: Dict[Path, MediaType] = {}
+
+        def make_task(path: Path):
+            async def task():
+                media_types[path] = await asyncio.to_thread(
+                    self.validator.classify, path
+                )
+
+            return task
+
+        tasks = [
+            make_task(path)
+            for path in paths
+            if normalized_extension(path) in AMBIGUOUS_EXTENSIONS
+            and normalized_extension(path) not in self.converter.SUPPORTED_FORMATS
+        ]
+        if tasks:
+            pool = WorkerPool(num_workers=self.config.probe_concurrency)
+            await pool.run(tasks)
+        return media_types
+
+    async def process_video(self, input_path: Path) -> FileResult:
+        """Convert a single video file with the video converter.
+
+        The output mirrors the input's directory beneath output_dir, and is
+        validated by the converter before it replaces anything there. Sources
+        the video codec_actions skip are tallied as skipped ("video_codec").
+        Long encodes log a "video_encode_progress" line at every
+        VIDEO_PROGRESS_STEP percent.
+
+        Args:
+            input_path: Path to the input video file
+
+        Returns:
+            FileResult describing the outcome
+        """
+        log = self.logger.bind(input_file=str(input_path), media_type="video")
+        output_dir = self.config.output_dir
+        mirrored = self._mirrored_name(input_path)
+        if mirrored:
+            output_dir = output_dir / Path(mirrored).parent
+
+        try:
+            if not self.config.dry_run:
+                output_dir.mkdir(parents=True, exist_ok=True)
+            output_path = await self.video_converter.convert(
+                input_path, output_dir, self._video_progress_logger(log)
+            )
+        except Exception as e:
+            log.error("file_processing_failed", error=str(e))
+            return FileResult(
+                input_path=input_path,
+                success=False,
+                error_message=str(e),
+                media_type=MediaType.VIDEO,
+            )
+
+        if output_path is None:
+            self._skip(input_path, "video_codec")
+            return FileResult(
+                input_path=input_path,
+                success=True,
+                skipped_reason="video_codec",
+                media_type=MediaType.VIDEO,
+            )
+        log.info("video_converted", output_file=str(output_path))
+        return FileResult(
+            input_path=input_path,
+            success=True,
+            output_path=output_path,
+            media_type=MediaType.VIDEO,
+        )
+
+    @staticmethod
+    def _video_progress_logger(log: Any) -> Callable[[Optional[float], str], None]:
+        """A video progress callback logging each VIDEO_PROGRESS_STEP percent."""
+        logged = [-VIDEO_PROGRESS_STEP]
+
+        def report(percent: Optional[float], speed: str) -> None:
+            if percent is None or percent - logged[0] < VIDEO_PROGRESS_STEP:
+                return
+            logged[0] = percent - percent % VIDEO_PROGRESS_STEP
+            log.info("video_encode_progress", percent=round(percent, 1), speed=speed)
+
+        return report
+
+    async def process_file(
+        self, input_path: Path, output_dir: Optional[Path] = None
+    ) -> FileResult:
+        """Convert a single file and apply post-conversion steps.
+
+        Runs prepare_file and encode_file back to back; process_all runs them
+        as separate pipeline stages instead.
+
+        Args:
+            input_path: Path to the input audio file
+            output_dir: Directory for the output (default: config output_dir)
+
+        Returns:
+            FileResult describing the outcome
+        """
+        prepared = await self.prepare_file(input_path, output_dir)
+        if isinstance(prepared, FileResult):
+            return prepared
+        return await self.encode_file(prepared)
+
+    async def prepare_file(
+        self, input_path: Path, output_dir: Optional[Path] = None
+    ) -> Union[PreparedFile, FileResult]:
+        """Probe a file, enrich its metadata and settle its output path.
+
+        Files missing any of require_metadata_fields once enriched and
+        defaulted are routed beneath the review directory instead of
+        output_dir. Integration lookups (Sonarr, Radarr, naming command,
+        artwork) happen here, so they overlap other files' encodes.
+
+        Args:
+            input_path: Path to the input audio file
+            output_dir: Directory for the output (default: config output_dir)
+
+        Returns:
+            PreparedFile ready for encode_file, or the final FileResult when
+            there is nothing to encode (probe failure, dry run, skipped by
+            its override sidecar, already in the beets library)
+        """
+        keep_original = self.config.keep_originals and self._in_input_dir(input_path)
+        converter = self.converter_for(input_path)
+        log = self.logger.bind(
+            input_file=str(input_path), output_format=converter.output_format
+        )
+
+        override = self.override_for(input_path)
+        if override and override.error:
+            log.error("file_processing_failed", error=override.error)
+            return FileResult(
+                input_path=input_path, success=False, error_message=override.error
+            )
+        if override and override.skip:
+            self._skip(input_path, "override")
+            return FileResult(
+                input_path=input_path, success=True, skipped_reason="override"
+            )
+
+        try:
+            output_path, meta, missing_metadata = await self.determine_output_path(
+                input_path, output_dir
+            )
+        except ProbeTimeoutError as e:
+            log.error("file_processing_failed", error=str(e))
+            return FileResult(
+                input_path=input_path, success=False, error_message=str(e)
+            )
+        if missing_metadata:
+            log.warning("metadata_incomplete", missing=missing_metadata)
+
+        if self.config.beets_skip_if_in_library and await self._in_beets_library(
+            meta, log
+        ):
+            self._skip(input_path, "in_beets_library")
+            return FileResult(
+                input_path=input_path,
+                success=True,
+                skipped_reason="in_beets_library",
+            )
+
+        if self.config.dry_run:
+            original_path = None
+            if keep_original:
+                original_path = self._planned_original_path(input_path)
+            plan = await self._dry_run_plan(input_path, output_path, meta, log)
+            log.info(
+                "dry_run_would_convert",
+                output_file=str(output_path),
+                original_file=str(original_path) if original_path else None,
+                source_codec=plan.source_codec if plan else None,
+                codec=plan.codec if plan else None,
+                bitrate=plan.bitrate if plan else None,
+                estimated_size_bytes=plan.estimated_size_bytes if plan else None,
+            )
+            return FileResult(
+                input_path=input_path,
+                success=True,
+                output_path=output_path,
+                original_path=original_path,
+                missing_metadata=missing_metadata,
+                plan=plan,
+            )
+
+        artwork = None
+        if self.config.embed_artwork and meta.artwork_url:
+            artwork = await asyncio.to_thread(
+                self.artwork.fetch, meta.artwork_url, self._artwork_key(meta)
+            )
+
+        return PreparedFile(
+            input_path=input_path,
+            output_path=output_path,
+            meta=meta,
+            missing_metadata=missing_metadata,
+            artwork=artwork,
+        )
+
+    async def _dry_run_plan(
+        self, input_path: Path, output_path: Path, meta: Metadata, log: Any
+    ) -> Optional[AudioOutputPlan]:
+        """Plan a file's conversion for a dry run; probes only, writes nothing.
+
+        Returns:
+            The plan, or None if the source could not be probed
+        """
+        try:
+            return await self.converter_for(input_path, meta).plan_conversion(
+                input_path, output_path.parent, output_name=output_path.stem
+            )
+        except Exception as e:
+            log.warning("dry_run_plan_failed", error=str(e))
+            return None
+
+    async def encode_file(self, prepared: PreparedFile) -> FileResult:
+        """Convert a prepared file and apply post-conversion steps.
+
+        Originals are only preserved for files read directly from input_dir;
+        files extracted from an archive are covered by preserving the archive.
+
+        Args:
+            prepared: File settled by prepare_file
+
+        Returns:
+            FileResult describing the outcome
+        """
+        input_path = prepared.input_path
+        output_path = prepared.output_path
+        meta = prepared.meta
+        missing_metadata = prepared.missing_metadata
+        keep_original = self.config.keep_originals and self._in_input_dir(input_path)
+        converter = self.converter_for(input_path, meta)
+        log = self.logger.bind(
+            input_file=str(input_path), output_format=converter.output_format
+        )
+
+        # An output that replaces its input (in place) leaves nothing to
+        # preserve afterwards, so the original is copied first
+        original_path = None
+        if keep_original and converter.is_same_file(input_path, output_path):
+            keep_original = False
+            original_path = self.storage.preserve_original(
+                input_path, self.config.input_dir, self.config.get_originals_dir()
+            )
+            if original_path is None:
+                log.warning("original_not_preserved")
+
+        # Files with sparse metadata can map to the same output path; the
+        # lock keeps their encodes from interleaving in one file, and a
+        # sharded run also locks out the other nodes writing to output_dir
+        try:
+            async with self.storage.locked_async(
+                output_path, across_processes=self.config.shard_count > 1
+            ):
+                conversion = await converter.convert(
+                    input_path,
+                    output_path.parent,
+                    metadata_tags=self.output_tags(converter, meta),
+                    output_name=output_path.stem,
+                    artwork=prepared.artwork,
+                )
+        except Exception as e:
+            log.error("file_processing_failed", error=str(e))
+            return FileResult(
+                input_path=input_path, success=False, error_message=str(e)
+            )
+
+        file_result = FileResult(
+            input_path=input_path,
+            success=conversion.success,
+            output_path=conversion.output_path,
+            checksum=conversion.checksum,
+            checksum_algorithm=conversion.checksum_algorithm,
+            error_message=conversion.error_message,
+            missing_metadata=missing_metadata,
+            original_path=original_path,
+        )
+
+        if conversion.success and self.config.post_validate_command:
+            error = await self._post_validate(
+                input_path, conversion.output_path, meta, converter
+            )
+            if error:
+                log.error("post_validation_failed", error=error)
+                # An output that replaced its input is the only copy left
+                if conversion.output_path != input_path:
+                    self._discard_output(conversion.output_path, converter)
+                file_result.success = False
+                file_result.error_message = error
+                return file_result
+
+        if conversion.success and self.state:
+            file_result.reprocessed = conversion.reprocessed or (
+                self.state.get(conversion.output_path) is not None
+            )
+            self.state.record(
+                conversion.output_path,
+                input_path,
+                conversion.checksum,
+                conversion.checksum_algorithm,
+                compression_level=conversion.compression_level,
+            )
+
+        if conversion.success and keep_original:
+            file_result.original_path = self.storage.preserve_original(
+                input_path, self.config.input_dir, self.config.get_originals_dir()
+            )
+            if file_result.original_path is None:
+                log.warning("original_not_preserved")
+
+        # In place, an output in another format (song.mp3 -> song.flac) is
+        # written next to its input, which it replaces once verified. The
+        # input is kept if keep_originals could not preserve it.
+        if (
+            conversion.success
+            and self.config.in_place
+            and self._in_input_dir(input_path)
+            and not converter.is_same_file(input_path, conversion.output_path)
+            and not (keep_original and file_result.original_path is None)
+        ):
+            input_path.unlink(missing_ok=True)
+            log.info("input_replaced", output_file=str(conversion.output_path))
+
+        return file_result
+
+    async def _post_validate(
+        self,
+        input_path: Path,
+        output_path: Path,
+        meta: Metadata,
+        converter: AudioConverter,
+    ) -> Optional[str]:
+        """Run the post-validate command on an output; None if it passed."""
+        context = {
+            "input": str(input_path),
+            "output": str(output_path),
+            "output_format": converter.output_format,
+            "metadata": vars(meta),
+        }
+        return await asyncio.to_thread(
+            self.validator.run_validation_command,
+            self.config.post_validate_command,
+            output_path,
+            context,
+            self.config.post_validate_timeout,
+        )
+
+    @staticmethod
+    def _discard_output(output_path: Path, converter: AudioConverter) -> None:
+        """Remove an output that failed validation, with its checksum sidecar."""
+        output_path.unlink(missing_ok=True)
+        if converter.checksum_sidecar:
+            sidecar = output_path.with_name(
+                f"{output_path.name}.{converter.checksum_algorithm}"
+            )
+            sidecar.unlink(missing_ok=True)
+
+    @staticmethod
+    def _artwork_key(meta: Metadata) -> Optional[Tuple[str, str]]:
+        """Cache key sharing one artwork download across an album's tracks."""
+        if not meta.album:
+            return None
+        artist = meta.album_artist or meta.artist
+        return (artist.strip().lower(), meta.album.strip().lower())
+
+    async def determine_output_path(
+        self, input_path: Path, output_dir: Optional[Path] = None
+    ) -> Tuple[Path, Metadata, List[str]]:
+        """Work out where a file's output goes, exactly as process_file does.
+
+        Probed metadata is enriched from Sonarr or Radarr (see
+        enrich_metadata), then empty artist, album and genre fields get the
+        configured defaults (see metadata_defaults). Files
+        missing required metadata are routed to the review directory, and
+        the naming command, when configured, chooses the name.
+
+        Args:
+            input_path: Path to the input audio file
+            output_dir: Directory for the output (default: config output_dir)
+
+        Returns:
+            Tuple of (output path, extracted metadata, missing required fields)
+        """
+        output_dir = output_dir or self.config.output_dir
+        meta = await asyncio.to_thread(
+            self.metadata_extractor.extract_metadata, str(input_path)
+        )
+        await self.enrich_metadata(meta)
+        self.metadata_extractor.apply_defaults(meta)
+        missing_metadata = self._missing_metadata(meta)
+        if missing_metadata:
+            output_dir = self._review_output_dir(output_dir)
+
+        output_name = await self._output_name(meta, input_path)
+        output_path = self.converter_for(input_path).get_output_path(
+            input_path, output_dir, output_name
+        )
+        return output_path, meta, missing_metadata
+
+    async def enrich_metadata(self, meta: Metadata) -> None:
+        """Merge the file's Sonarr or Radarr record into its metadata.
+
+        Files with a show (tagged, or parsed from an SxxEyy name) are looked
+        up in Sonarr, files with a director and title in Radarr, when those
+        integrations are registered. The probed year, when there is one,
+        picks between results with similar titles (e.g. a remake). Lookups
+        are cached per run, so a show's episodes share one request. A failed
+        lookup leaves the probed metadata as it is.
+
+        Args:
+            meta: Probed metadata, updated in place (see merge_metadata)
+        """
+        if meta.show and self.integrations.get_integration("sonarr"):
+            lookup, title, series = self.integrations.lookup_series, meta.show, True
+        elif (
+            meta.director and meta.title and self.integrations.get_integration("radarr")
+        ):
+            lookup, title, series = self.integrations.lookup_movie, meta.title, False
+        else:
+            return
+
+        year_match = re.search(r"\b(\d{4})\b", meta.year or "")
+        year = int(year_match.group(1)) if year_match else None
+        try:
+            document = await asyncio.to_thread(lookup, title, year)
+        except Exception as e:
+            self.logger.warning(
+                "metadata_lookup_failed", input_file=meta.file_path, error=str(e)
+            )
+            return
+        if document:
+            merge_metadata(meta, lookup_values(document, series=series))
+
+    async def _guarded(
+        self, input_path: Path, step: Awaitable[Any], timeout: Optional[float]
+    ) -> Any:
+        """Run one pipeline stage of a file, turning errors into a FileResult.
+
+        The file timeout covers every step (metadata, naming, encode and
+        checks), split across the stages; the encode alone is bounded by
+        encode_timeout. Unexpected errors (bugs, malformed metadata) fail
+        only this file, with the stack trace logged, instead of escaping into
+        the worker pool.
+        """
+        try:
+            return await asyncio.wait_for(step, timeout=timeout)
+        except asyncio.TimeoutError:
+            return self._timed_out(input_path)
+        except Exception as e:
+            message = f"Unexpected error: {type(e).__name__}: {e}"
+            self.logger.exception(
+                "file_processing_crashed", input_file=str(input_path), error=message
+            )
+            return FileResult(
+                input_path=input_path, success=False, error_message=message
+            )
+
+    def _timed_out(self, input_path: Path) -> FileResult:
+        """The failed FileResult of a file that ran out of file_timeout."""
+        message = f"File processing timed out after {self.config.file_timeout}s"
+        self.logger.error(
+            "file_processing_failed", input_file=str(input_path), error=message
+        )
+        return FileResult(input_path=input_path, success=False, error_message=message)
+
+    async def process_all(self) -> BatchResult:
+        """Process every audio file in the input directory.
+
+        Each run works in its own temporary directory under work_dir, holding
+        extracted archives and the converters' temporary inputs (artwork,
+        chapters). It is removed afterwards unless keep_work_artifacts is
+        set. When extract_archives is enabled, zip archives are extracted
+        there and their audio files processed alongside the rest. Remote
+        inputs (see list_remote_inputs) are downloaded there by the probe
+        workers, each just before it is prepared (see prepare_remote).
+
+        With fail_fast, the first failed file stops the run: no further files
+        are started, encodes in flight are cancelled and their partial
+        outputs removed, and the failure is reported as aborted_by.
+
+        With state, inputs whose earlier output still matches its recorded
+        checksum are skipped as already_converted before any encode starts.
+
+        When video is configured, video files are converted too (see
+        process_video) once the audio files are done; otherwise they are
+        skipped as unsupported.
+
+        Returns:
+            BatchResult with per-file outcomes and aggregate counts
+        """
+        start = time.monotonic()
+        self._skip_counts.clear()
+        input_files = self.list_input_files()
+        archives = [
+            path
+            for path in input_files
+            if self.config.extract_archives and is_archive(path)
+        ]
+        media_types = await self._classify(input_files)
+        files = [
+            path
+            for path in input_files
+            if self._is_supported(path, media_types.get(path))
+        ]
+        videos = [
+            path for path in input_files if self._is_video(path, media_types.get(path))
+        ]
+
+        for path in input_files:
+            if path.name.endswith(OVERRIDE_SUFFIX):
+                continue
+            if path in archives or path in videos or path in files:
+                continue
+            self._skip(path, "unsupported_format")
+
+        resumed = False
+        if self.state:
+            states = await asyncio.to_thread(self.state.all)
+            resumed = bool(states)
+            converted = await self._already_converted(files, states)
+            for path, reason in converted.items():
+                self._skip(path, reason)
+            files = [path for path in files if path not in converted]
+
+        if self.config.skip_unstable_files:
+            unstable = await self._unstable_files(files + archives + videos)
+            for path in unstable:
+                self._skip(path, "still_being_written")
+            files = [path for path in files if path not in unstable]
+            archives = [path for path in archives if path not in unstable]
+            videos = [path for path in videos if path not in unstable]
+
+        # Each job is (file to convert, output directory, path to report)
+        jobs = [(path, self.config.output_dir, path) for path in files]
+        file_results: List[FileResult] = []
+        # Archives that could not be extracted, recorded as failed files
+        extraction_failures: List[FileResult] = []
+        run_dir = self._make_run_dir()
+        self._use_work_dir(run_dir)
+        for index, archive in enumerate(archives):
+            destination = run_dir / "archives" / str(index)
+            try:
+                jobs.extend(
+                    await self._archive_jobs(archive, destination, file_results)
+                )
+            except ArchiveError as e:
+                self.logger.error(
+                    "archive_extraction_failed", archive=str(archive), error=str(e)
+                )
+                extraction_failures.append(
+                    FileResult(input_path=archive, success=False, error_message=str(e))
+                )
+        # Each remote job is (URL, directory to download into)
+        remote_jobs = [
+            (url, run_dir / "remote" / str(index))
+            for index, url in enumerate(self.list_remote_inputs())
+        ]
+
+        result = BatchResult(
+            total_files=len(jobs)
+            + len(remote_jobs)
+            + len(videos)
+            + len(file_results)
+            + len(extraction_failures),
+            resumed=resumed,
+        )
+
+        self.logger.info(
+            "batch_started",
+            total_files=result.total_files,
+            archives=len(archives),
+            remote_inputs=len(remote_jobs),
+            videos=len(videos),
+            concurrency=self.config.concurrency,
+            probe_concurrency=self.config.probe_concurrency,
+            dry_run=self.config.dry_run,
+        )
+
+        # Two-stage pipeline: probe_concurrency workers probe and enrich
+        # files, handing them through a bounded channel to the (usually
+        # fewer) encode workers, so slow lookups overlap with encodes
+        ready: asyncio.Queue = asyncio.Queue(maxsize=self.config.probe_concurrency)
+        # Set by fail_fast on the first failure; later files are passed
+        # through both stages untouched so the pools still drain
+        stopped = asyncio.Event()
+        encodes: Set[asyncio.Future] = set()
+        # Warms the cache for the files after those being probed
+        readahead = None
+        readahead_task = None
+        if self.config.prefetch > 0 and jobs:
+            readahead = Readahead([job[0] for job in jobs], self.config.prefetch)
+
+        def make_prepare_task(path: Path, output_dir: Path, reported_path: Path):
+            async def task():
+                if readahead:
+                    await readahead.consume(path)
+                if stopped.is_set():
+                    await ready.put((path, reported_path, None, 0.0))
+                    return
+                prepare_start = time.monotonic()
+                prepared = await self._guarded(
+                    path,
+                    self.prepare_file(path, output_dir),
+                    self.config.file_timeout,
+                )
+                prepare_s = time.monotonic() - prepare_start
+                await ready.put((path, reported_path, prepared, prepare_s))
+
+            return task
+
+        # Downloads happen here too, so they overlap other files' encodes
+        def make_remote_task(url: str, destination: Path):
+            async def task():
+                reported_path = remote_display_path(url)
+                if stopped.is_set():
+                    await ready.put((reported_path, reported_path, None, 0.0))
+                    return
+                prepare_start = time.monotonic()
+                prepared = await self._guarded(
+                    reported_path,
+                    self.prepare_remote(url, destination),
+                    self.config.file_timeout,
+                )
+                prepare_s = time.monotonic() - prepare_start
+                # The download, when there is one, stands in for the input
+                path = prepared.input_path
+                await ready.put((path, reported_path, prepared, prepare_s))
+
+            return task
+
+        async def encode_task():
+            path, reported_path, prepared, prepare_s = await ready.get()
+            if stopped.is_set():
+                result.not_processed += 1
+                return
+            if isinstance(prepared, FileResult) and prepared.skipped_reason:
+                # Tallied as a skip, not as a processed file
+                result.total_files -= 1
+                return
+            encode_start = time.monotonic()
+            file_result = prepared
+            timeout = self.config.file_timeout
+            if isinstance(prepared, PreparedFile) and timeout and prepare_s >= timeout:
+                # Preparing used up the whole file_timeout
+                file_result = self._timed_out(path)
+            elif isinstance(prepared, PreparedFile):
+                # Time spent waiting in the channel does not count
+                if timeout:
+                    timeout -= prepare_s
+                encode = asyncio.ensure_future(
+                    self._guarded(path, self.encode_file(prepared), timeout)
+                )
+                encodes.add(encode)
+                try:
+                    file_result = await encode
+                except asyncio.CancelledError:
+                    if not encode.cancelled():
+                        raise
+                    result.not_processed += 1
+                    return
+                finally:
+                    encodes.discard(encode)
+            file_result.input_path = reported_path
+            encode_s = time.monotonic() - encode_start
+            file_result.duration_ms = (prepare_s + encode_s) * 1000
+            finish(path, file_result)
+
+        # Records an audio, video or archive file's outcome; with fail_fast,
+        # its failure stops the run
+        def finish(path: Path, file_result: FileResult) -> None:
+            if not self.config.dry_run:
+                if file_result.success:
+                    self.telemetry.record_file_processed(_file_type(path))
+                    self._record_sizes(path, file_result)
+                else:
+                    self.telemetry.record_file_failed(_file_type(path))
+                self._track_failures(path, file_result)
+                self._record_result(path, file_result)
+            self._audit(file_result)
+            file_results.append(file_result)
+
+            if self.config.fail_fast and not file_result.success:
+                if not stopped.is_set():
+                    stopped.set()
+                    result.aborted_by = file_result
+                    self.logger.error(
+                        "batch_stopped",
+                        input_file=str(file_result.input_path),
+                        error=file_result.error_message,
+                        cancelled_encodes=len(encodes),
+                    )
+                    for in_flight in encodes:
+                        in_flight.cancel()
+
+        for file_result in extraction_failures:
+            finish(file_result.input_path, file_result)
+
+        try:
+            # Ramping up lets spun-down network storage wake before every
+            # worker starts reading from it
+            ramp_interval = self.config.ramp_interval if self.config.ramp_up else None
+            governor = None
+            if self.config.max_load_average:
+                governor = LoadGovernor(self.config.max_load_average)
+            prepare_pool = WorkerPool(num_workers=self.config.probe_concurrency)
+            encode_pool = WorkerPool(num_workers=self.config.concurrency)
+            if readahead:
+                readahead_task = asyncio.create_task(readahead.run())
+            await asyncio.gather(
+                prepare_pool.run(
+                    [make_prepare_task(*job) for job in jobs]
+                    + [make_remote_task(*job) for job in remote_jobs],
+                    ramp_interval=ramp_interval,
+                ),
+                encode_pool.run(
+                    [encode_task] * (len(jobs) + len(remote_jobs)),
+                    ramp_interval=ramp_interval,
+                    governor=governor,
+                ),
+            )
+        finally:
+            if readahead_task:
+                readahead_task.cancel()
+                await asyncio.gather(readahead_task, return_exceptions=True)
+            self._use_work_dir(None)
+            if self.config.keep_work_artifacts:
+                failed = any(not r.success for r in file_results)
+                log = self.logger.warning if failed else self.logger.info
+                log("work_dir_kept", work_dir=str(run_dir), failures=failed)
+            else:
+                shutil.rmtree(run_dir, ignore_errors=True)
+
+        def make_video_task(path: Path):
+            async def task():
+                if stopped.is_set():
+                    result.not_processed += 1
+                    return
+                video_start = time.monotonic()
+                file_result = await self._guarded(
+                    path, self.process_video(path), self.config.file_timeout
+                )
+                file_result.media_type = MediaType.VIDEO
+                if file_result.skipped_reason:
+                    result.total_files -= 1
+                    return
+                file_result.duration_ms = (time.monotonic() - video_start) * 1000
+                finish(path, file_result)
+
+            return task
+
+        # Videos skip the probe and metadata stage, so they get a pool of
+        # their own once the audio pipeline has drained
+        if videos:
+            video_pool = WorkerPool(num_workers=self.config.concurrency)
+            await video_pool.run([make_video_task(path) for path in videos])
+
+        for file_result in sorted(file_results, key=lambda r: r.input_path):
+            result.add(file_result)
+
+        result.skipped = dict(self._skip_counts)
+        result.duration_s = time.monotonic() - start
+
+        if self.config.manifest_path and not self.config.dry_run:
+            self._write_manifest(result)
+
+        if self.config.retry_failed and not self.config.dry_run:
+            # Files that failed again stay in the log for the next retry
+            succeeded = [r.input_path for r in result.files if r.success]
+            remove_inputs(self.config.retry_failed, succeeded)
+
+        if self.config.beets_import_after_run and not self.config.dry_run:
+            await self._import_to_beets(result)
+
+        if self.audit_log:
+            self.audit_log.close()
+        if self.results_db:
+            self.results_db.close()
+        if self.state:
+            self.state.close()
+
+        self.logger.info("batch_complete", summary=result.summary)
+
+        if not self.config.dry_run:
+            for notifier in self.notifiers:
+                await asyncio.to_thread(notifier.notify, result)
+            if self.pushgateway:
+                await asyncio.to_thread(
+                    self.pushgateway.push, self.telemetry.snapshot(), result.duration_s
+                )
+
+        return result
+
+    def _track_failures(self, input_path: Path, file_result: FileResult) -> None:
+        """Count consecutive failures of an input and quarantine it at the limit.
+
+        Needs state (the counts live there). Only inputs read directly from
+        input_dir are tracked; files extracted from archives are not.
+        """
+        if not self.state or not self._in_input_dir(input_path):
+            return
+        if file_result.success:
+            self.state.clear_failures(input_path)
+            return
+
+        error = file_result.error_message or "Unknown error"
+        failures = self.state.record_failure(input_path, error)
+        limit = self.config.max_failures_before_quarantine
+        if not limit or failures < limit:
+            return
+
+        destination = self.storage.preserve_original(
+            input_path,
+            self.config.input_dir,
+            self.config.get_quarantine_dir(),
+            move=True,
+        )
+        if destination is None:
+            self.logger.warning("quarantine_failed", input_file=str(input_path))
+            return
+        destination.with_name(destination.name + ".error.txt").write_text(
+            f"Source: {input_path}\n"
+            f"Failed {failures} runs in a row; the last error was:\n{error}\n"
+        )
+        self.state.clear_failures(input_path)
+        file_result.quarantine_path = destination
+        self.logger.warning(
+            "file_quarantined",
+            input_file=str(input_path),
+            quarantine_file=str(destination),
+            failures=failures,
+        )
+
+    def _record_result(self, input_path: Path, file_result: FileResult) -> None:
+        """Add a converted or failed file to the results database."""
+        if not self.results_db:
+            return
+        output_path = file_result.output_path if file_result.success else None
+        self.results_db.record(
+            ConversionRecord(
+                input=str(file_result.input_path),
+                output=str(output_path) if output_path else None,
+                input_format=_file_type(input_path),
+                output_format=_file_type(output_path) if output_path else "",
+                input_bytes=_size(input_path),
+                output_bytes=_size(output_path) if output_path else None,
+                checksum=file_result.checksum,
+                checksum_algorithm=file_result.checksum_algorithm,
+                duration_ms=file_result.duration_ms,
+                status=STATUS_PROCESSED if file_result.success else STATUS_FAILED,
+                error=file_result.error_message,
+            )
+        )
+
+    def _record_sizes(self, input_path: Path, file_result: FileResult) -> None:
+        """Count the source and output sizes of a converted file."""
+        if not file_result.output_path:
+            return
+        try:
+            input_bytes = input_path.stat().st_size
+            output_bytes = file_result.output_path.stat().st_size
+        except OSError:
+            return
+        self.telemetry.record_bytes(_file_type(input_path), input_bytes, output_bytes)
+
+    def _already_optimal(self, input_path: Path) -> bool:
+        """Whether recompressing a FLAC input would gain nothing.
+
+        True when the input is itself a FLAC output of an earlier run, written
+        at or above the compression level this run would use and unchanged
+        since, as recorded in the state.
+        """
+        converter = self.converter_for(input_path)
+        if (
+            converter.output_format != "flac"
+            or normalized_extension(input_path) != ".flac"
+        ):
+            return False
+        recorded = self.state.get(input_path)
+        if recorded is None or recorded.compression_level is None:
+            return False
+        target = converter.compression_level_for("flac")
+        if recorded.compression_level < target:
+            return False
+        return self.state.verify(input_path)
+
+    async def _already_converted(
+        self, files: List[Path], states: List[FileState]
+    ) -> Dict[Path, str]:
+        """Find inputs an earlier run already took care of.
+
+        An input is "already_optimal" when recompressing it would gain nothing
+        (see _already_optimal), and "already_converted" when its output from
+        an earlier run is still good. Both are checksum checks, the slow part
+        of a run over an already converted library, so they are done here,
+        skip_check_concurrency files at a time, before any encode starts.
+
+        Returns:
+            The skip reason for each input found
+        """
+        latest: Dict[str, FileState] = {}
+        for state in states:
+            # In-place outputs are left to the already_optimal check
+            if state.output_path == state.input_path:
+                continue
+            current = latest.get(state.input_path)
+            if current is None or state.updated_at > current.updated_at:
+                latest[state.input_path] = state
+
+        converted: Dict[Path, str] = {}
+
+        def make_task(path: Path, state: Optional[FileState]):
+            async def task():
+                if await asyncio.to_thread(self._already_optimal, path):
+                    converted[path] = "already_optimal"
+                elif state and await asyncio.to_thread(
+                    self._output_current, path, state
+                ):
+                    converted[path] = "already_converted"
+
+            return task
+
+        tasks = [
+            make_task(path, latest.get(str(path)))
+            for path in files
+            if str(path) in latest or normalized_extension(path) == ".flac"
+        ]
+        if tasks:
+            pool = WorkerPool(num_workers=self.config.skip_check_concurrency)
+            await pool.run(tasks)
+        return converted
+
+    def _output_current(self, input_path: Path, state: FileState) -> bool:
+        """Whether a recorded output is what this run would produce again.
+
+        It must be in this run's output format and under output_dir, be at
+        least as new as its input, and still match its recorded checksum.
+        """
+        output_path = Path(state.output_path)
+        expected = self.converter_for(input_path).get_output_path(
+            input_path, self.config.output_dir
+        )
+        if output_path.suffix != expected.suffix:
+            return False
+        if not output_path.is_relative_to(self.config.output_dir):
+            return False
+        try:
+            if input_path.stat().st_mtime > output_path.stat().st_mtime:
+                return False
+        except OSError:
+            return False
+        return self.state.verify(output_path)
+
+    async def _unstable_files(self, files: List[Path]) -> List[Path]:
+        """Find files whose size changes over the stability window.
+
+        Every file is sized, then sized again after one shared wait, so the
+        check costs a single window however many files there are. A file
+        that changed, appeared or vanished is taken to be mid-write.
+        """
+
+        def sizes() -> Dict[Path, int]:
+            result = {}
+            for path in files:
+                try:
+                    result[path] = path.stat().st_size
+                except OSError:
+                    result[path] = -1
+            return result
+
+        before = await asyncio.to_thread(sizes)
+        await asyncio.sleep(self.config.stability_window)
+        after = await asyncio.to_thread(sizes)
+        return [path for path in files if before[path] != after[path]]
+
+    async def _output_name(
+        self, meta: Metadata, input_path: Path
+    ) -> Optional[str]:
+        """Output path from the naming command, or the default name.
+
+        A matching profile's music_pattern takes precedence over the naming
+        command. The default mirrors the input's place under input_dir (see
+        _mirrored_name) and is also used when the command fails or times out.
+        In place, outputs keep their input's name so they can replace it.
+        With primary_artist_for_path, both see the primary artist (see
+        primary_artist) in place of the artist tag; the tags written to the
+        output are unchanged.
+        """
+        if self.config.in_place:
+            return self._mirrored_name(input_path)
+        if self.config.primary_artist_for_path:
+            meta = copy.copy(meta)
+            meta.artist = primary_artist(meta.artist, meta.album_artist)
+        profile = self.profile_for(input_path)
+        if profile and profile.music_pattern:
+            return sanitize_relative_path(format_path(profile.music_pattern, meta))
+        if not self.config.naming_command:
+            return self._mirrored_name(input_path)
+        name = await asyncio.to_thread(
+            run_naming_command,
+            self.config.naming_command,
+            meta,
+            self.config.naming_timeout,
+        )
+        return name or self._mirrored_name(input_path)
+
+    def _mirrored_name(self, input_path: Path) -> Optional[str]:
+        """Default output name for a file in a subdirectory of input_dir.
+
+        The output mirrors the input's directories, so nested album folders
+        keep their layout. Returns None (the input's base name in output_dir)
+        for top-level files and files from elsewhere, e.g. archives.
+        """
+        try:
+            relative = input_path.relative_to(self.config.input_dir)
+        except ValueError:
+            return None
+        if len(relative.parts) < 2:
+            return None
+        return str(relative.parent / base_name(input_path))
+
+    def _missing_metadata(self, meta: Metadata) -> List[str]:
+        """List required metadata fields the file lacks (empty if none)."""
+        required = self.config.require_metadata_fields
+        if not required:
+            return []
+        return self.metadata_extractor.validate_metadata(meta, required)
+
+    def _review_output_dir(self, output_dir: Path) -> Path:
+        """Map an output directory to its counterpart in the review tree."""
+        try:
+            relative = output_dir.relative_to(self.config.output_dir)
+        except ValueError:
+            relative = Path()
+        return self.config.get_review_dir() / relative
+
+    def _make_run_dir(self) -> Path:
+        """Create this run's temporary directory under work_dir."""
+        work_dir = self.config.work_dir
+        if work_dir:
+            work_dir.mkdir(parents=True, exist_ok=True)
+        return Path(tempfile.mkdtemp(prefix="run-", dir=work_dir))
+
+    def _use_work_dir(self, run_dir: Optional[Path]) -> None:
+        """Point every converter's temporary files at a run directory."""
+        keep = self.config.keep_work_artifacts and run_dir is not None
+        for converter in [self.converter, *self._rule_converters.values()]:
+            converter.work_dir = run_dir
+            converter.keep_work_files = keep
+
+    async def _archive_jobs(
+        self, archive: Path, destination: Path, file_results: List[FileResult]
+    ) -> List[Tuple[Path, Path, Path]]:
+        """Extract an archive and plan a job for each audio file inside.
+
+        Members keep the archive's internal directory structure beneath
+        output_dir and are reported as <archive>/<member>. Extraction runs in
+        a worker thread. In a dry run the archive is only listed, and each
+        audio member is reported as a dry-run success without a job.
+
+        Raises:
+            ArchiveError: If the archive cannot be extracted
+        """
+        log = self.logger.bind(archive=str(archive))
+
+        if self.config.dry_run:
+            names = await asyncio.to_thread(list_archive, archive)
+            members = [destination / name for name in names]
+        else:
+            members = await asyncio.to_thread(extract_archive, archive, destination)
+
+        if self.config.keep_originals and not self.config.dry_run:
+            self.storage.preserve_original(
+                archive, self.config.input_dir, self.config.get_originals_dir()
+            )
+
+        media_types = await self._classify(members)
+        jobs = []
+        for member in members:
+            relative = member.relative_to(destination)
+            if not self._is_supported(member, media_types.get(member)):
+                self._skip(archive / relative, "unsupported_format")
+                continue
+            output_dir = self.config.output_dir / relative.parent
+            jobs.append((member, output_dir, archive / relative))
+
+        if self.config.dry_run:
+            log.info(
+                "dry_run_would_extract",
+                members=[str(reported.relative_to(archive)) for *_, reported in jobs],
+            )
+            file_results.extend(
+                FileResult(input_path=reported, success=True) for *_, reported in jobs
+            )
+            return []
+        log.info("archive_extracted", files=len(jobs))
+        return jobs
+
+    async def prepare_remote(
+        self, url: str, destination: Path
+    ) -> Union[PreparedFile, FileResult]:
+        """Download a remote input and prepare it like a local file.
+
+        The download lands in destination and its output in output_dir; the
+        file is reported as <host>/<path>. A failed download is a failed
+        file. In a dry run nothing is downloaded.
+
+        Args:
+            url: The input's http(s) URL
+            destination: Directory to download into
+
+        Returns:
+            PreparedFile for encode_file, or the final FileResult
+        """
+        reported_path = remote_display_path(url)
+        log = self.logger.bind(url=url)
+        if self.config.dry_run:
+            log.info("dry_run_would_download")
+            return FileResult(input_path=reported_path, success=True)
+
+        try:
+            local_path = await asyncio.to_thread(self.remote.fetch, url, destination)
+        except RemoteInputError as e:
+            log.error("remote_input_failed", error=str(e))
+            return FileResult(
+                input_path=reported_path, success=False, error_message=str(e)
+            )
+
+        if not await asyncio.to_thread(self._is_supported, local_path):
+            self._skip(reported_path, "unsupported_format")
+            return FileResult(
+                input_path=local_path,
+                success=True,
+                skipped_reason="unsupported_format",
+            )
+        log.info("remote_input_downloaded", path=str(local_path))
+        return await self.prepare_file(local_path, self.config.output_dir)
+
+    async def verify_all(self) -> VerifyResult:
+        """Scan the input directory for corrupt files without converting.
+
+        Each supported file gets an integrity check (header, declared size
+        and FFprobe; see Validator.validate_media_integrity) and, when
+        verify_decodable is enabled, a full decode. Nothing is written.
+
+        Returns:
+            VerifyResult listing the corrupt or suspect files
+        """
+        start = time.monotonic()
+        files = self.find_audio_files()
+        result = VerifyResult(total_files=len(files))
+
+        self.logger.info(
+            "verify_started",
+            total_files=len(files),
+            concurrency=self.config.verify_concurrency,
+            decode=self.config.verify_decodable,
+        )
+
+        def make_task(path: Path):
+            async def task():
+                problem = await self.verify_file(path)
+                if problem:
+                    self.logger.warning(
+                        "file_suspect", input_file=str(path), problem=problem
+                    )
+                    result.suspect_files[path] = problem
+
+            return task
+
+        # Integrity checks are I/O-light, so they get their own worker count
+        # rather than sharing the encode cap
+        pool = WorkerPool(num_workers=self.config.verify_concurrency)
+        await pool.run([make_task(path) for path in files])
+
+        result.suspect_files = dict(sorted(result.suspect_files.items()))
+        result.duration_s = time.monotonic() - start
+        self.logger.info("verify_complete", summary=result.summary)
+        return result
+
+    async def analyze_all(self) -> List[AudioOutputPlan]:
+        """Report what each input file would be converted to, without encoding.
+
+        Each supported file is probed and run through its converter's command
+        builder; the planned codec, bitrate and estimated size are returned.
+        Nothing is written.
+
+        Returns:
+            One AudioOutputPlan per file that could be probed, sorted by path
+        """
+        files = self.find_audio_files()
+        plans: List[AudioOutputPlan] = []
+
+        def make_task(path: Path):
+            async def task():
+                try:
+                    plan = await self.converter_for(path).plan_conversion(
+                        path, self.config.output_dir
+                    )
+                except Exception as e:
+                    self.logger.warning(
+                        "analyze_failed", input_file=str(path), error=str(e)
+                    )
+                    return
+                plans.append(plan)
+
+            return task
+
+        # Planning only probes files, so it shares the verify worker count
+        pool = WorkerPool(num_workers=self.config.verify_concurrency)
+        await pool.run([make_task(path) for path in files])
+
+        plans.sort(key=lambda plan: plan.input_path)
+        self.logger.info("analyze_complete", total_files=len(plans))
+        return plans
+
+    async def diff_against(self, library_root: Path) -> LibraryDiff:
+        """Compare planned output paths against an existing organized library.
+
+        Each input's output path is worked out as a dry run would, then
+        classified against the library:
+
+        - collision: more than one input plans the same output path
+        - match: the library already has a file at the planned path
+        - move: the library holds the input elsewhere, at its path relative
+          to input_dir (with any extension) or as a byte-identical copy, and
+          it would end up at the planned path instead
+        - new: nothing in the library corresponds to the output
+
+        Nothing is written.
+
+        Args:
+            library_root: Root of the existing organized library
+
+        Returns:
+            LibraryDiff classifying every input file
+        """
+        files = self.find_audio_files()
+        planned: Dict[Path, List[Path]] = {}
+
+        def make_task(path: Path):
+            async def task():
+                try:
+                    output_path, _, _ = await self.determine_output_path(path)
+                except ProbeTimeoutError as e:
+                    self.logger.warning(
+                        "diff_failed", input_file=str(path), error=str(e)
+                    )
+                    return
+                try:
+                    relative = output_path.relative_to(self.config.output_dir)
+                except ValueError:
+                    relative = Path(output_path.name)
+                planned.setdefault(relative, []).append(path)
+
+            return task
+
+        pool = WorkerPool(num_workers=self.config.verify_concurrency)
+        await pool.run([make_task(path) for path in files])
+
+        # Library files by path without extension, and by size for the
+        # checksum comparison
+        by_stem: Dict[str, Path] = {}
+        by_size: Dict[int, List[Path]] = {}
+        for path in sorted(library_root.rglob("*")):
+            if path.is_file():
+                relative = path.relative_to(library_root)
+                by_stem.setdefault(_stem_key(relative), relative)
+                by_size.setdefault(path.stat().st_size, []).append(relative)
+
+        diff = LibraryDiff()
+        for relative, inputs in sorted(planned.items()):
+            if len(inputs) > 1:
+                diff.collisions[relative] = sorted(inputs)
+                continue
+            (input_path,) = inputs
+            if (library_root / relative).is_file():
+                diff.matches[input_path] = relative
+                continue
+            current = await asyncio.to_thread(
+                self._library_copy, input_path, library_root, by_stem, by_size
+            )
+            if current:
+                diff.moves[input_path] = (current, relative)
+            else:
+                diff.new[input_path] = relative
+
+        self.logger.info("diff_complete", summary=diff.summary)
+        return diff
+
+    def _library_copy(
+        self,
+        input_path: Path,
+        library_root: Path,
+        by_stem: Dict[str, Path],
+        by_size: Dict[int, List[Path]],
+    ) -> Optional[Path]:
+        """Where a library already holds an input, relative to its root.
+
+        Looks for a file at the input's path relative to input_dir (any
+        extension), then for a byte-identical file anywhere in the library.
+        """
+        try:
+            key = _stem_key(input_path.relative_to(self.config.input_dir))
+        except ValueError:
+            key = None
+        if key in by_stem:
+            return by_stem[key]
+
+        candidates = by_size.get(input_path.stat().st_size, [])
+        if not candidates:
+            return None
+        checksum = compute_checksum(input_path)
+        for candidate in candidates:
+            if compute_checksum(library_root / candidate) == checksum:
+                return candidate
+        return None
+
+    async def verify_file(self, input_path: Path) -> Optional[str]:
+        """Check a single file's integrity.
+
+        Args:
+            input_path: Path to the audio file
+
+        Returns:
+            Description of the problem, or None if the file looks intact
+        """
+        problem = await self.validator.validate_media_integrity(input_path)
+        if problem or not self.config.verify_decodable:
+            return problem
+
+        try:
+            await self.converter.verify_output_decodes(input_path)
+        except OutputValidationError as e:
+            return str(e)
+        return None
+
+    async def _in_beets_library(self, meta: Metadata, log: Any) -> bool:
+        """Whether beets already has the track, by MBID or artist and title.
+
+        An unconfigured or unreachable beets counts as not found, so the file
+        is converted as usual.
+        """
+        beets = self.integrations.get_integration("beets")
+        if beets is None:
+            log.warning("beets_library_check_skipped", reason="not_configured")
+            return False
+        try:
+            items = await asyncio.to_thread(
+                beets.find_track,
+                artist=meta.artist,
+                title=meta.title,
+                mbid=meta.musicbrainz_trackid,
+            )
+        except Exception as e:
+            log.warning("beets_library_check_failed", error=str(e))
+            return False
+        if items:
+            log.info("already_in_beets_library", beets_id=items[0].get("id"))
+        return bool(items)
+
+    async def _import_to_beets(self, result: BatchResult) -> None:
+        """Import successful outputs into beets, in batches.
+
+        Outputs are collected over the whole run and sent in as few requests
+        as beets_import_batch_size allows, rather than one request per file.
+        Import failures are logged and never fail the batch run.
+        """
+        outputs = [f.output_path for f in result.files if f.success and f.output_path]
+        if not outputs:
+            return
+
+        if self.integrations.get_integration("beets") is None:
+            self.logger.warning("beets_import_skipped", reason="not_configured")
+            return
+
+        for batch in batch_paths(outputs, self.config.beets_import_batch_size):
+            try:
+                await asyncio.to_thread(
+                    self.integrations.import_to_beets,
+                    batch,
+                    copy=False,
+                    move=False,
+                    write=True,
+                )
+                self.logger.info("beets_import_complete", files=len(batch))
+            except Exception as e:
+                self.logger.error("beets_import_failed", files=len(batch), error=str(e))
+
+    def _audit(self, file_result: FileResult) -> None:
+        """Record the decision made about a processed file."""
+        if not self.audit_log:
+            return
+
+        if self.config.dry_run:
+            action, reason = ACTION_SKIPPED, "dry_run"
+        elif file_result.success:
+            action, reason = ACTION_PROCESSED, None
+            if file_result.needs_review:
+                reason = "missing_metadata: " + ", ".join(file_result.missing_metadata)
+        else:
+            action, reason = ACTION_FAILED, None
+
+        self.audit_log.record(
+            action,
+            file_result.input_path,
+            output_path=file_result.output_path,
+            checksum=file_result.checksum,
+            reason=reason,
+            error=file_result.error_message,
+            duration_ms=file_result.duration_ms,
+        )
+
+    def _skip(self, input_path: Path, reason: str) -> None:
+        """Record a file that was skipped before processing, tallied by reason."""
+        self._skip_counts[reason] += 1
+        self.telemetry.record_file_skipped(_file_type(input_path), reason)
+        self.logger.debug("file_skipped", input_file=str(input_path), reason=reason)
+        if self.audit_log:
+            self.audit_log.record(ACTION_SKIPPED, input_path, reason=reason)
+
+    def _in_input_dir(self, input_path: Path) -> bool:
+        """Check whether a file was read directly from the input directory."""
+        try:
+            input_path.relative_to(self.config.input_dir)
+        except ValueError:
+            return False
+        return True
+
+    def _planned_original_path(self, input_path: Path) -> Path:
+        """Get where an original would be preserved, without touching it."""
+        try:
+            relative = input_path.relative_to(self.config.input_dir)
+        except ValueError:
+            relative = Path(input_path.name)
+        return self.config.get_originals_dir() / relative
+
+    def _write_manifest(self, result: BatchResult) -> None:
+        """Append one JSON record per processed file to the manifest."""
+        manifest_path = self.config.manifest_path
+        assert manifest_path is not None
+
+        manifest_path.parent.mkdir(parents=True, exist_ok=True)
+        with open(manifest_path, "a") as f:
+            for file_result in result.files:
+                f.write(json.dumps(file_result.to_dict()) + "\n")
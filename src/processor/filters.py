@@ -0,0 +1,53 @@
+"""User-supplied FFmpeg filter chains.
+
+Lets advanced users add their own filters (e.g. yadif, hqdn3d, crop) to
+the encode. They are composed with any built-in filters into one -af/-vf
+chain: built-in filters always come first, so user filters see their
+output, followed by the user filters in the order given.
+"""
+
+from typing import List, Optional, Sequence
+
+# Filters are passed to FFmpeg as a single argument, never through a shell,
+# but anything that looks like shell syntax is almost certainly a mistake
+SHELL_METACHARACTERS = set(";|&`$<>\n\r")
+
+
+def validate_filters(filters: Sequence[str]) -> List[str]:
+    """Check user filter strings and strip surrounding whitespace.
+
+    Args:
+        filters: Filter strings, e.g. ["yadif", "crop=1920:800"]
+
+    Returns:
+        The stripped filters
+
+    Raises:
+        ValueError: If a filter is empty or contains shell metacharacters
+    """
+    validated = []
+    for entry in filters:
+        entry = str(entry).strip()
+        if not entry:
+            raise ValueError("Filters must not be empty")
+        bad = sorted(SHELL_METACHARACTERS.intersection(entry))
+        if bad:
+            raise ValueError(
+                f"Filter {entry!r} contains disallowed characters: {''.join(bad)!r}"
+            )
+        validated.append(entry)
+    return validated
+
+
+def compose_filters(builtin: Sequence[str], user: Sequence[str]) -> Optional[str]:
+    """Join built-in and user filters into one filter chain.
+
+    Args:
+        builtin: Filters the converter adds itself, applied first
+        user: Validated user filters, applied after the built-in ones
+
+    Returns:
+        The comma-separated chain, or None if there are no filters
+    """
+    chain = list(builtin) + list(user)
+    return ",".join(chain) if chain else None
@@ -0,0 +1,103 @@
+"""Load-aware concurrency governor.
+
+On a shared machine, encodes back off while the system load average is above
+a configured maximum: the governor lowers the worker pool's active limit one
+worker at a time, and raises it again once the load has dropped.
+"""
+
+import asyncio
+from pathlib import Path
+from typing import Callable, Optional
+
+import structlog
+
+LOADAVG_PATH = Path("/proc/loadavg")
+
+# Load must fall this far below the maximum before a worker is added back,
+# so the limit does not flap around the threshold
+RECOVERY_RATIO = 0.8
+
+
+def read_load_average(path: Path = LOADAVG_PATH) -> Optional[float]:
+    """Read the 1-minute load average.
+
+    Args:
+        path: The loadavg file (Linux only)
+
+    Returns:
+        The load average, or None where it cannot be read
+    """
+    try:
+        return float(path.read_text().split()[0])
+    except (OSError, ValueError, IndexError):
+        return None
+
+
+def governed_limit(
+    load: Optional[float], max_load: float, current: int, maximum: int
+) -> int:
+    """Decide the next active worker limit for a load reading.
+
+    Args:
+        load: Current load average (None if unknown)
+        max_load: Load average above which workers are taken away
+        current: Current active limit
+        maximum: Configured concurrency
+
+    Returns:
+        current - 1 while over max_load (never below one), current + 1 once
+        under RECOVERY_RATIO of it (never above maximum), otherwise current
+    """
+    if load is None:
+        return maximum
+    if load > max_load:
+        return max(1, current - 1)
+    if load < max_load * RECOVERY_RATIO:
+        return min(maximum, current + 1)
+    return current
+
+
+class LoadGovernor:
+    """Adjusts a worker pool's active limit to the system load."""
+
+    def __init__(
+        self,
+        max_load: float,
+        interval: float = 5.0,
+        read_load: Callable[[], Optional[float]] = read_load_average,
+    ):
+        """Initialize LoadGovernor.
+
+        Args:
+            max_load: Load average above which encodes back off
+            interval: Seconds between load readings
+            read_load: Source of load readings
+        """
+        self.max_load = max_load
+        self.interval = interval
+        self.read_load = read_load
+        self.logger = structlog.get_logger(__name__)
+
+    async def govern(self, pool) -> None:
+        """Adjust pool.active_limit every interval until cancelled.
+
+        Returns at once where the load average cannot be read (non-Linux).
+        """
+        if self.read_load() is None:
+            self.logger.info("load_governor_unavailable")
+            return
+
+        while True:
+            await asyncio.sleep(self.interval)
+            load = self.read_load()
+            limit = governed_limit(
+                load, self.max_load, pool.active_limit, pool.num_workers
+            )
+            if limit != pool.active_limit:
+                self.logger.info(
+                    "load_governor_adjusted",
+                    load_average=load,
+                    max_load_average=self.max_load,
+                    active_workers=limit,
+                )
+                pool.active_limit = limit
@@ -0,0 +1,78 @@
+"""Scheduling priority for encoder subprocesses.
+
+Lets long-running FFmpeg encodes run at low CPU and I/O priority on shared
+machines. Priorities are applied on Linux only and are a no-op elsewhere.
+"""
+
+import os
+import shutil
+import sys
+from typing import Callable, List, Optional
+
+NICENESS_MIN = -20
+NICENESS_MAX = 19
+
+# ionice scheduling classes
+IO_CLASSES = {"realtime": 1, "best-effort": 2, "idle": 3}
+
+
+def validate_priority(niceness: int, io_class: Optional[str]) -> None:
+    """Check that the requested priority settings are valid.
+
+    Args:
+        niceness: CPU niceness, from -20 (highest) to 19 (lowest)
+        io_class: One of IO_CLASSES, or None to leave I/O priority alone
+
+    Raises:
+        ValueError: If either setting is out of range
+    """
+    if not NICENESS_MIN <= niceness <= NICENESS_MAX:
+        raise ValueError(
+            f"Niceness must be between {NICENESS_MIN} and {NICENESS_MAX}, "
+            f"got {niceness}"
+        )
+    if io_class is not None and io_class not in IO_CLASSES:
+        raise ValueError(
+            f"I/O class must be one of {sorted(IO_CLASSES)}, got {io_class!r}"
+        )
+
+
+def priority_supported() -> bool:
+    """Whether subprocess priorities can be applied on this platform."""
+    return sys.platform.startswith("linux")
+
+
+def niceness_preexec(niceness: int) -> Optional[Callable[[], None]]:
+    """Build a preexec_fn that sets the child's niceness.
+
+    Args:
+        niceness: CPU niceness to apply
+
+    Returns:
+        Function to run in the child before exec, or None if nothing to do
+    """
+    if niceness == 0 or not priority_supported():
+        return None
+
+    def apply() -> None:
+        os.setpriority(os.PRIO_PROCESS, 0, niceness)
+
+    return apply
+
+
+def with_io_class(command: List[str], io_class: Optional[str]) -> List[str]:
+    """Prefix a command with ionice so it runs in the given I/O class.
+
+    The command is returned unchanged when no class is set, the platform is
+    not Linux, or ionice is not installed.
+
+    Args:
+        command: Command to run
+        io_class: One of IO_CLASSES, or None
+
+    Returns:
+        The command to execute
+    """
+    if io_class is None or not priority_supported() or not shutil.which("ionice"):
+        return command
+    return ["ionice", "-c", str(IO_CLASSES[io_class])] + command
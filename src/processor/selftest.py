@@ -0,0 +1,266 @@
+"""Startup self-test.
+
+Before a big run, checks that the environment can do the work: FFmpeg and
+FFprobe are installed and recent enough, a short generated tone encodes to
+every configured output format (and the outputs pass the converter's own
+validation), and every enabled integration answers its health check.
+"""
+
+import re
+import subprocess
+import tempfile
+from dataclasses import dataclass, field
+from pathlib import Path
+from typing import Callable, Dict, List, Optional, Tuple
+
+import structlog
+
+from src.audio.converter import AudioConverter
+from src.integrations.integration_manager import IntegrationManager
+
+# Oldest FFmpeg release the converters are known to work with
+MIN_FFMPEG_VERSION = "4.3"
+
+# Seconds a version or tone-generation command may run
+COMMAND_TIMEOUT = 30.0
+
+# Runs a command, returning its exit code and combined output
+Runner = Callable[[List[str]], Tuple[int, str]]
+
+# ANSI colors for a terminal summary
+GREEN = "\033[32m"
+RED = "\033[31m"
+RESET = "\033[0m"
+
+
+def run_command(command: List[str]) -> Tuple[int, str]:
+    """Run a command, capturing its output.
+
+    Args:
+        command: Program and arguments
+
+    Returns:
+        Tuple of (exit code, stdout and stderr); 127 if the program is not
+        installed
+    """
+    try:
+        completed = subprocess.run(
+            command,
+            stdout=subprocess.PIPE,
+            stderr=subprocess.STDOUT,
+            text=True,
+            timeout=COMMAND_TIMEOUT,
+        )
+    except FileNotFoundError:
+        return 127, f"{command[0]} is not installed"
+    except subprocess.TimeoutExpired:
+        return 124, f"{command[0]} timed out after {COMMAND_TIMEOUT:g}s"
+    return completed.returncode, completed.stdout
+
+
+def parse_version(text: str) -> Optional[Tuple[int, ...]]:
+    """Parse a release version such as "4.3" or "6.1.1-3ubuntu5".
+
+    Args:
+        text: The version, or `ffmpeg -version` output
+
+    Returns:
+        The numeric version parts, or None for unnumbered (git) builds
+    """
+    match = re.search(r"(?:version n?|^)(\d+(?:\.\d+)*)", text)
+    if not match:
+        return None
+    return tuple(int(part) for part in match.group(1).split("."))
+
+
+@dataclass
+class SelfTestCheck:
+    """Outcome of one self-test check."""
+
+    name: str
+    passed: bool
+    detail: str = ""
+
+
+@dataclass
+class SelfTestReport:
+    """Outcomes of every self-test check."""
+
+    checks: List[SelfTestCheck] = field(default_factory=list)
+
+    @property
+    def passed(self) -> int:
+        return sum(1 for check in self.checks if check.passed)
+
+    @property
+    def failed(self) -> int:
+        return len(self.checks) - self.passed
+
+    @property
+    def ok(self) -> bool:
+        """Whether every check passed."""
+        return not self.failed
+
+    def summary(self, color: bool = False) -> str:
+        """One line per check, then the totals.
+
+        Args:
+            color: Show passes green and failures red (for terminals)
+
+        Returns:
+            The multi-line summary
+        """
+
+        def mark(passed: bool, text: str) -> str:
+            if not color:
+                return text
+            return f"{GREEN if passed else RED}{text}{RESET}"
+
+        lines = []
+        for check in self.checks:
+            status = mark(check.passed, "PASS" if check.passed else "FAIL")
+            detail = f": {check.detail}" if check.detail else ""
+            lines.append(f"  [{status}] {check.name}{detail}")
+        verdict = mark(self.ok, "passed" if self.ok else "FAILED")
+        lines.append(
+            f"Self-test {verdict}: {self.passed} of {len(self.checks)} checks passed"
+        )
+        return "\n".join(lines)
+
+
+class SelfTest:
+    """Checks the tools, output formats and integrations a run depends on."""
+
+    TOOLS = ("ffmpeg", "ffprobe")
+
+    # Tone encoded to each output format
+    TONE_SECONDS = 1
+
+    def __init__(
+        self,
+        converters: Dict[str, AudioConverter],
+        integrations: Optional[IntegrationManager] = None,
+        min_version: str = MIN_FFMPEG_VERSION,
+        runner: Runner = run_command,
+    ):
+        """Initialize SelfTest.
+
+        Args:
+            converters: Converter per output format to test (see
+                BatchProcessor.output_converters)
+            integrations: Integrations whose health to check (None = none)
+            min_version: Oldest acceptable FFmpeg and FFprobe version
+            runner: Runs the version and tone-generation commands
+
+        Raises:
+            ValueError: If min_version is not a version number
+        """
+        self.min_version = parse_version(str(min_version))
+        if self.min_version is None:
+            raise ValueError(f"Invalid minimum FFmpeg version: {min_version!r}")
+        self.converters = converters
+        self.integrations = integrations
+        self.runner = runner
+        self.logger = structlog.get_logger(__name__)
+
+    async def run(self) -> SelfTestReport:
+        """Run every check.
+
+        Returns:
+            SelfTestReport with one check per tool, output format and
+            integration
+        """
+        report = SelfTestReport()
+        report.checks += [self.check_tool(tool) for tool in self.TOOLS]
+        with tempfile.TemporaryDirectory(prefix="refinery-selftest-") as work_dir:
+            report.checks += await self.check_formats(Path(work_dir))
+        report.checks += self.check_integrations()
+        for check in report.checks:
+            self.logger.info(
+                "selftest_check",
+                check=check.name,
+                passed=check.passed,
+                detail=check.detail,
+            )
+        return report
+
+    def check_tool(self, tool: str) -> SelfTestCheck:
+        """Check that a tool is installed and at least min_version.
+
+        Unnumbered (git) builds pass, as they are usually newer than any
+        release.
+        """
+        returncode, output = self.runner([tool, "-version"])
+        if returncode != 0:
+            return SelfTestCheck(tool, False, _first_line(output) or "not runnable")
+        version = parse_version(output)
+        if version is None:
+            return SelfTestCheck(tool, True, "unnumbered build, version not checked")
+        shown = ".".join(map(str, version))
+        if version < self.min_version:
+            minimum = ".".join(map(str, self.min_version))
+            return SelfTestCheck(tool, False, f"{shown} is older than {minimum}")
+        return SelfTestCheck(tool, True, shown)
+
+    async def check_formats(self, work_dir: Path) -> List[SelfTestCheck]:
+        """Encode a generated tone to each output format.
+
+        Args:
+            work_dir: Directory for the tone and the encoded outputs
+
+        Returns:
+            One check per output format
+        """
+        tone = work_dir / "tone.wav"
+        returncode, output = self.runner(
+            [
+                "ffmpeg",
+                "-v",
+                "error",
+                "-y",
+                "-f",
+                "lavfi",
+                "-i",
+                f"sine=frequency=440:duration={self.TONE_SECONDS}",
+                str(tone),
+            ]
+        )
+        if returncode != 0:
+            reason = f"could not generate test tone: {_first_line(output)}"
+            return [
+                SelfTestCheck(f"encode {output_format}", False, reason)
+                for output_format in self.converters
+            ]
+
+        checks = []
+        for output_format, converter in self.converters.items():
+            name = f"encode {output_format}"
+            try:
+                result = await converter.convert(tone, work_dir / output_format)
+            except Exception as e:
+                checks.append(SelfTestCheck(name, False, _first_line(str(e))))
+                continue
+            if not result.success:
+                checks.append(
+                    SelfTestCheck(name, False, result.error_message or "failed")
+                )
+                continue
+            checks.append(SelfTestCheck(name, True, f"{result.size_bytes} bytes"))
+        return checks
+
+    def check_integrations(self) -> List[SelfTestCheck]:
+        """Check the health of each enabled integration."""
+        if self.integrations is None:
+            return []
+        return [
+            SelfTestCheck(f"integration {name}", error is None, error or "healthy")
+            for name, error in self.integrations.check_health().items()
+        ]
+
+
+def _first_line(text: str) -> str:
+    """The first non-empty line of some output, stripped."""
+    for line in (text or "").splitlines():
+        if line.strip():
+            return line.strip()
+    return ""
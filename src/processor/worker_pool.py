@@ -1,25 +1,65 @@
 import asyncio
-from typing import Callable, Any, List
+from typing import Callable, Any, List, Optional
+
+from src.processor.load_governor import LoadGovernor
+
+# Most workers a pool may run, so a mistyped setting cannot start thousands
+MAX_WORKERS = 1024
 
 
 class WorkerPool:
     """
     A worker pool to manage concurrent tasks.
+
+    Only workers below active_limit take new tasks; lowering it (e.g. from a
+    LoadGovernor) pauses the others once their current task finishes. Errors
+    raised by tasks do not stop their worker; they are collected in errors.
     """
 
+    # Seconds a paused worker waits before checking active_limit again
+    PAUSE_POLL_INTERVAL = 0.5
+
     def __init__(self, num_workers: int):
+        """
+        Args:
+            num_workers (int): Workers to run, from 1 to MAX_WORKERS.
+
+        Raises:
+            ValueError: If num_workers is out of range.
+        """
+        if not 1 <= num_workers <= MAX_WORKERS:
+            raise ValueError(
+                f"num_workers must be between 1 and {MAX_WORKERS}, got {num_workers}"
+            )
         self.num_workers = num_workers
+        self.active_limit = num_workers
         self.queue = asyncio.Queue()
+        self.workers: List[asyncio.Task] = []
+        self.errors: List[BaseException] = []
 
-    async def worker(self):
+    async def worker(self, index: int = 0):
         """
         A single worker that processes tasks from the queue.
+
+        Args:
+            index (int): The worker's position; it pauses while index is at
+                or above active_limit.
         """
         while True:
+            if index >= self.active_limit:
+                await asyncio.sleep(self.PAUSE_POLL_INTERVAL)
+                continue
             task, args, kwargs = await self.queue.get()
             try:
                 await task(*args, **kwargs)
+            except asyncio.CancelledError as e:
+                # A task cancelled mid-run is reported like a failure; the
+                # worker itself only stops if it is the one being cancelled
+                self.errors.append(e)
+                if asyncio.current_task().cancelling():
+                    raise
             except Exception as e:
+                self.errors.append(e)
                 print(f"Task failed with error: {e}")
             finally:
                 self.queue.task_done()
@@ -35,26 +75,81 @@ class WorkerPool:
         """
         await self.queue.put((task, args, kwargs))
 
-    async def run(self, tasks: List[Callable[..., Any]]):
+    async def wait_with_errors(self) -> List[BaseException]:
+        """
+        Waits until every queued task has finished and returns the errors
+        they raised.
+
+        Call it once all tasks have been added. Tasks cancelled while running
+        (including by cancelling run) are reported with their CancelledError.
+
+        Returns:
+            List[BaseException]: The errors, in the order tasks raised them.
+        """
+        if any(not worker.done() for worker in self.workers):
+            await self.queue.join()
+        return list(self.errors)
+
+    def add_worker(self):
+        """
+        Starts one more worker on the queue.
+        """
+        self.workers.append(asyncio.create_task(self.worker(len(self.workers))))
+
+    async def _ramp_up(self, interval: float):
+        """
+        Adds a worker every interval seconds until num_workers are running.
+        """
+        while len(self.workers) < self.num_workers:
+            await asyncio.sleep(interval)
+            self.add_worker()
+
+    async def run(
+        self,
+        tasks: List[Callable[..., Any]],
+        ramp_interval: Optional[float] = None,
+        governor: Optional[LoadGovernor] = None,
+    ) -> List[BaseException]:
         """
         Runs the worker pool and processes the given tasks.
 
         Args:
             tasks (List[Callable[..., Any]]): A list of coroutine functions to execute.
+            ramp_interval (Optional[float]): Start with one worker and add one
+                every ramp_interval seconds up to num_workers, instead of
+                starting them all at once.
+            governor (Optional[LoadGovernor]): Adjusts active_limit to the load
+                while the tasks run.
+
+        Returns:
+            List[BaseException]: The errors the tasks raised (see
+                wait_with_errors).
         """
+        self.errors = []
         # Add tasks to the queue
         for task in tasks:
             await self.add_task(task)
 
         # Start workers
-        workers = [asyncio.create_task(self.worker()) for _ in range(self.num_workers)]
-
-        # Wait for all tasks to be processed
-        await self.queue.join()
+        self.workers = []
+        for _ in range(1 if ramp_interval else self.num_workers):
+            self.add_worker()
+        helpers = []
+        if ramp_interval:
+            helpers.append(asyncio.create_task(self._ramp_up(ramp_interval)))
+        if governor:
+            helpers.append(asyncio.create_task(governor.govern(self)))
 
-        # Cancel workers
-        for worker in workers:
-            worker.cancel()
+        try:
+            # Wait for all tasks to be processed
+            return await self.wait_with_errors()
+        finally:
+            # Cancel workers, including busy ones if run itself was cancelled
+            for helper in helpers:
+                helper.cancel()
+            await asyncio.gather(*helpers, return_exceptions=True)
+            for worker in self.workers:
+                worker.cancel()
 
-        # Wait for workers to exit
-        await asyncio.gather(*workers, return_exceptions=True)
+            # Wait for workers to exit
+            await asyncio.gather(*self.workers, return_exceptions=True)
@@ -0,0 +1,358 @@
+"""Processing state for converted files.
+
+Records the checksum of every output so later runs can verify outputs and
+tell finished work from new work. Two storage backends are available:
+
+- "files" (default): one small JSON document per output, named by a hash of
+  the output path, in the state directory.
+- "index": every record in a single JSON-lines log that is appended to and
+  periodically compacted, for libraries large enough that one file per
+  output hurts filesystem performance.
+
+Either way, consecutive conversion failures are counted per input in
+failures.json, so files that keep failing can be quarantined.
+"""
+
+import csv
+import hashlib
+import json
+import os
+import threading
+from dataclasses import asdict, dataclass, field
+from datetime import datetime, timezone
+from pathlib import Path
+from typing import Any, Dict, List, Optional
+
+from src.storage.checksum import compute_checksum
+from src.storage.storage import atomic_replace
+
+STATE_BACKENDS = {"files", "index"}
+
+INDEX_FILE_NAME = "state.jsonl"
+
+FAILURES_FILE_NAME = "failures.json"
+
+# Columns of a state CSV export, in order
+CSV_FIELDS = [
+    "input_path",
+    "output_path",
+    "checksum",
+    "checksum_algorithm",
+    "updated_at",
+]
+
+
+def _now() -> str:
+    return datetime.now(timezone.utc).isoformat()
+
+
+@dataclass
+class FileState:
+    """What is known about one converted output."""
+
+    output_path: str
+    input_path: str
+    checksum: str
+    checksum_algorithm: str = "sha256"
+    # FLAC compression level the output was encoded at, if it is FLAC
+    compression_level: Optional[int] = None
+    updated_at: str = field(default_factory=_now)
+
+    @classmethod
+    def from_dict(cls, data: Dict[str, str]) -> "FileState":
+        """Rebuild a FileState from its stored form."""
+        return cls(
+            output_path=data["output_path"],
+            input_path=data["input_path"],
+            checksum=data["checksum"],
+            # Records written before algorithms were configurable are SHA256
+            checksum_algorithm=data.get("checksum_algorithm", "sha256"),
+            compression_level=data.get("compression_level"),
+            updated_at=data.get("updated_at", ""),
+        )
+
+
+def _key(output_path: Path) -> str:
+    """Normalized lookup key for an output path."""
+    return os.path.normcase(os.path.abspath(output_path))
+
+
+class FileStateStore:
+    """Stores each FileState as its own JSON file in the state directory."""
+
+    def __init__(self, state_dir: Path):
+        """Initialize FileStateStore.
+
+        Args:
+            state_dir: Directory holding the state files
+        """
+        self.state_dir = state_dir
+        self.state_dir.mkdir(parents=True, exist_ok=True)
+
+    def _path(self, output_path: Path) -> Path:
+        digest = hashlib.sha256(_key(output_path).encode()).hexdigest()
+        return self.state_dir / f"{digest}.json"
+
+    def put(self, state: FileState) -> None:
+        """Save a record, replacing any earlier one for the same output."""
+        path = self._path(Path(state.output_path))
+        temp = path.with_name(path.name + ".tmp")
+        temp.write_text(json.dumps(asdict(state)))
+        atomic_replace(temp, path)
+
+    def get(self, output_path: Path) -> Optional[FileState]:
+        """Load the record for an output, or None if there is none."""
+        try:
+            data = json.loads(self._path(output_path).read_text())
+            return FileState.from_dict(data)
+        except (OSError, ValueError, KeyError):
+            return None
+
+    def all(self) -> List[FileState]:
+        """Load every record; unreadable files are skipped."""
+        states = []
+        for path in self.state_dir.glob("*.json"):
+            if path.name == FAILURES_FILE_NAME:
+                continue
+            try:
+                states.append(FileState.from_dict(json.loads(path.read_text())))
+            except (OSError, ValueError, KeyError):
+                continue
+        return states
+
+    def close(self) -> None:
+        """Nothing to release; files are written as records are saved."""
+
+
+class IndexStateStore:
+    """Stores every FileState in one append-only, compacted JSONL index.
+
+    Each put appends a line; the latest line for an output wins. Records are
+    kept in memory for lookups, and the log is rewritten without superseded
+    lines once they outnumber the live records by compact_ratio.
+    """
+
+    def __init__(self, state_dir: Path, compact_ratio: float = 1.0):
+        """Initialize IndexStateStore.
+
+        Args:
+            state_dir: Directory holding the index file
+            compact_ratio: Superseded lines allowed per live record before
+                the index is compacted
+        """
+        state_dir.mkdir(parents=True, exist_ok=True)
+        self.index_path = state_dir / INDEX_FILE_NAME
+        self.compact_ratio = compact_ratio
+        self._records: Dict[str, FileState] = {}
+        self._lines = 0
+        self._lock = threading.Lock()
+        self._load()
+        self._file = self.index_path.open("a")
+
+    def _load(self) -> None:
+        if not self.index_path.exists():
+            return
+        with self.index_path.open() as f:
+            for line in f:
+                try:
+                    state = FileState.from_dict(json.loads(line))
+                except (ValueError, KeyError):
+                    # A torn final line from an interrupted write
+                    continue
+                self._records[_key(Path(state.output_path))] = state
+                self._lines += 1
+
+    def put(self, state: FileState) -> None:
+        """Append a record, replacing any earlier one for the same output."""
+        with self._lock:
+            if self._file.closed:
+                self._file = self.index_path.open("a")
+            self._records[_key(Path(state.output_path))] = state
+            self._file.write(json.dumps(asdict(state)) + "\n")
+            self._file.flush()
+            self._lines += 1
+            superseded = self._lines - len(self._records)
+            if superseded > self.compact_ratio * len(self._records):
+                self._compact()
+
+    def get(self, output_path: Path) -> Optional[FileState]:
+        """Look up the record for an output, or None if there is none."""
+        with self._lock:
+            return self._records.get(_key(output_path))
+
+    def all(self) -> List[FileState]:
+        """Every live record."""
+        with self._lock:
+            return list(self._records.values())
+
+    def compact(self) -> None:
+        """Rewrite the index with only the latest record per output."""
+        with self._lock:
+            self._compact()
+
+    def _compact(self) -> None:
+        self._file.close()
+        temp = self.index_path.with_name(self.index_path.name + ".tmp")
+        with temp.open("w") as f:
+            for state in self._records.values():
+                f.write(json.dumps(asdict(state)) + "\n")
+        atomic_replace(temp, self.index_path)
+        self._lines = len(self._records)
+        self._file = self.index_path.open("a")
+
+    def close(self) -> None:
+        """Compact the index and close it; a later put reopens it."""
+        with self._lock:
+            self._compact()
+            self._file.close()
+
+
+class StateManager:
+    """Records and verifies the state of converted outputs."""
+
+    def __init__(self, state_dir: Path, backend: str = "files"):
+        """Initialize StateManager.
+
+        Args:
+            state_dir: Directory the state is stored in
+            backend: "files" for one JSON file per output, or "index" for a
+                single compacted JSONL index
+
+        Raises:
+            ValueError: If the backend is unknown
+        """
+        if backend not in STATE_BACKENDS:
+            raise ValueError(
+                f"State backend must be one of {sorted(STATE_BACKENDS)}, "
+                f"got {backend!r}"
+            )
+        self.backend = backend
+        if backend == "index":
+            self.store = IndexStateStore(state_dir)
+        else:
+            self.store = FileStateStore(state_dir)
+        self.failures_path = state_dir / FAILURES_FILE_NAME
+        self._failures: Dict[str, Dict[str, Any]] = {}
+        self._failures_lock = threading.Lock()
+        try:
+            self._failures = json.loads(self.failures_path.read_text())
+        except (OSError, ValueError):
+            pass
+
+    def record(
+        self,
+        output_path: Path,
+        input_path: Path,
+        checksum: str,
+        checksum_algorithm: str = "sha256",
+        compression_level: Optional[int] = None,
+    ) -> FileState:
+        """Save the state of a freshly converted output.
+
+        Args:
+            output_path: The converted file
+            input_path: The source it was converted from
+            checksum: Checksum of the output
+            checksum_algorithm: Algorithm the checksum was computed with
+            compression_level: FLAC compression level of the output, if FLAC
+
+        Returns:
+            The saved FileState
+        """
+        state = FileState(
+            output_path=str(output_path),
+            input_path=str(input_path),
+            checksum=checksum,
+            checksum_algorithm=checksum_algorithm,
+            compression_level=compression_level,
+        )
+        self.store.put(state)
+        return state
+
+    def get(self, output_path: Path) -> Optional[FileState]:
+        """The recorded state of an output, or None if it was never recorded."""
+        return self.store.get(output_path)
+
+    def all(self) -> List[FileState]:
+        """Every recorded state, sorted by output path."""
+        return sorted(self.store.all(), key=lambda state: state.output_path)
+
+    def export_csv(self, csv_path: Path) -> int:
+        """Write every recorded state to a CSV file with a header row.
+
+        Args:
+            csv_path: The CSV file to write (see CSV_FIELDS for the columns)
+
+        Returns:
+            The number of records written
+        """
+        states = self.all()
+        with csv_path.open("w", newline="") as f:
+            writer = csv.DictWriter(f, fieldnames=CSV_FIELDS, extrasaction="ignore")
+            writer.writeheader()
+            for state in states:
+                writer.writerow(asdict(state))
+        return len(states)
+
+    def verify(self, output_path: Path) -> bool:
+        """Check an output still matches its recorded checksum.
+
+        The checksum is recomputed with the algorithm it was recorded with.
+
+        Args:
+            output_path: The converted file
+
+        Returns:
+            True if the file exists and matches; False if it is missing,
+            changed or was never recorded
+        """
+        state = self.get(output_path)
+        if state is None:
+            return False
+        try:
+            checksum = compute_checksum(output_path, state.checksum_algorithm)
+        except FileNotFoundError:
+            return False
+        return checksum == state.checksum
+
+    def failure_count(self, input_path: Path) -> int:
+        """Consecutive runs an input has failed in (0 if its last run worked)."""
+        with self._failures_lock:
+            return self._failures.get(_key(input_path), {}).get("count", 0)
+
+    def record_failure(self, input_path: Path, error: str) -> int:
+        """Count one more consecutive failure of an input.
+
+        Args:
+            input_path: The source that failed to convert
+            error: Why it failed
+
+        Returns:
+            The input's consecutive failure count, including this one
+        """
+        with self._failures_lock:
+            entry = self._failures.get(_key(input_path), {})
+            entry = {
+                "input_path": str(input_path),
+                "count": entry.get("count", 0) + 1,
+                "error": error,
+                "updated_at": _now(),
+            }
+            self._failures[_key(input_path)] = entry
+            self._save_failures()
+            return entry["count"]
+
+    def clear_failures(self, input_path: Path) -> None:
+        """Reset an input's failure count, e.g. after it converts or moves."""
+        with self._failures_lock:
+            if self._failures.pop(_key(input_path), None) is not None:
+                self._save_failures()
+
+    def _save_failures(self) -> None:
+        temp = self.failures_path.with_name(self.failures_path.name + ".tmp")
+        temp.write_text(json.dumps(self._failures, indent=2))
+        atomic_replace(temp, self.failures_path)
+
+    def close(self) -> None:
+        """Flush and release the backend."""
+        self.store.close()
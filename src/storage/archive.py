@@ -0,0 +1,85 @@
+import zipfile
+from pathlib import Path
+from typing import List
+
+from src.storage.extensions import normalized_extension
+
+ARCHIVE_EXTENSIONS = {".zip"}
+
+
+class ArchiveError(Exception):
+    """
+    Raised when an archive cannot be extracted.
+    """
+
+
+def is_archive(file_path: Path) -> bool:
+    """
+    Checks whether a file is an archive that can be extracted.
+
+    Args:
+        file_path (Path): The path to check.
+
+    Returns:
+        bool: True if the file has a supported archive extension.
+    """
+    return normalized_extension(file_path) in ARCHIVE_EXTENSIONS
+
+
+def list_archive(archive_path: Path) -> List[Path]:
+    """
+    Lists the files in a zip archive without extracting them.
+
+    Args:
+        archive_path (Path): The archive to list.
+
+    Returns:
+        List[Path]: Every member file's path inside the archive, sorted.
+
+    Raises:
+        ArchiveError: If the archive is corrupt or password-protected.
+    """
+    try:
+        with zipfile.ZipFile(archive_path) as archive:
+            _check_not_encrypted(archive, archive_path)
+            return sorted(
+                Path(info.filename) for info in archive.infolist() if not info.is_dir()
+            )
+    except zipfile.BadZipFile as e:
+        raise ArchiveError(f"Archive is corrupt: {archive_path}: {e}") from e
+
+
+def _check_not_encrypted(archive: zipfile.ZipFile, archive_path: Path) -> None:
+    """
+    Raises ArchiveError if any member of the archive is encrypted.
+    """
+    if any(info.flag_bits & 0x1 for info in archive.infolist()):
+        raise ArchiveError(
+            f"Archive is password-protected and was skipped: {archive_path}"
+        )
+
+
+def extract_archive(archive_path: Path, destination: Path) -> List[Path]:
+    """
+    Extracts a zip archive, keeping its internal directory structure.
+
+    Args:
+        archive_path (Path): The archive to extract.
+        destination (Path): The directory to extract into.
+
+    Returns:
+        List[Path]: Every extracted file, sorted.
+
+    Raises:
+        ArchiveError: If the archive is corrupt or password-protected.
+    """
+    try:
+        with zipfile.ZipFile(archive_path) as archive:
+            _check_not_encrypted(archive, archive_path)
+            # extractall strips absolute paths and ".." components, so members
+            # cannot escape the destination
+            archive.extractall(destination)
+    except zipfile.BadZipFile as e:
+        raise ArchiveError(f"Archive is corrupt: {archive_path}: {e}") from e
+
+    return sorted(path for path in destination.rglob("*") if path.is_file())
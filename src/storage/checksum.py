@@ -0,0 +1,44 @@
+"""File checksums.
+
+SHA256 is the default; MD5 and CRC32 are offered for compatibility with
+external tools that validate against those sidecars.
+"""
+
+import hashlib
+import zlib
+from pathlib import Path
+
+CHECKSUM_ALGORITHMS = {"sha256", "md5", "crc32"}
+
+
+def compute_checksum(file_path: Path, algorithm: str = "sha256") -> str:
+    """Calculate the checksum of a file.
+
+    Args:
+        file_path: Path to file
+        algorithm: sha256, md5 or crc32
+
+    Returns:
+        Hexadecimal checksum (8 characters for crc32)
+
+    Raises:
+        FileNotFoundError: If file doesn't exist
+        ValueError: If the algorithm is not supported
+    """
+    if algorithm not in CHECKSUM_ALGORITHMS:
+        raise ValueError(f"Unsupported checksum algorithm: {algorithm}")
+    if not file_path.exists():
+        raise FileNotFoundError(f"File not found: {file_path}")
+
+    crc = 0
+    file_hash = None if algorithm == "crc32" else hashlib.new(algorithm)
+
+    with open(file_path, "rb") as f:
+        # Read in chunks to handle large files
+        for byte_block in iter(lambda: f.read(4096), b""):
+            if file_hash is None:
+                crc = zlib.crc32(byte_block, crc)
+            else:
+                file_hash.update(byte_block)
+
+    return f"{crc:08x}" if file_hash is None else file_hash.hexdigest()
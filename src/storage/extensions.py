@@ -0,0 +1,28 @@
+"""File extension normalization.
+
+Downloads and rips often carry upper- or mixed-case extensions (song.MP3,
+song.Mp3) or a doubled one (movie.mkv.mkv). Everything that looks at an
+extension goes through these helpers, so such files are detected like any
+other and their outputs get a single, lower-case extension.
+"""
+
+from pathlib import Path
+
+
+def normalized_extension(path: Path) -> str:
+    """Lower-cased extension including the dot, e.g. ".mp3"; "" if none."""
+    return Path(path).suffix.lower()
+
+
+def base_name(path: Path) -> str:
+    """File name without its extension, and without repeats of it.
+
+    "song.MP3" gives "song" and "movie.mkv.mkv" gives "movie"; a different
+    inner extension is part of the name ("Live.1999.flac" gives "Live.1999").
+    """
+    path = Path(path)
+    extension = normalized_extension(path)
+    name = path.stem
+    while extension and normalized_extension(Path(name)) == extension:
+        name = Path(name).stem
+    return name
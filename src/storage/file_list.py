@@ -0,0 +1,109 @@
+"""File list and playlist reading.
+
+Reads plain-text file lists (one path per line) and M3U/M3U8 playlists so a
+batch run can process exactly the listed files instead of scanning a
+directory. http(s):// entries are kept apart as URLs, to be downloaded.
+"""
+
+import os
+from pathlib import Path
+from typing import Iterable, List, Tuple
+from urllib.parse import unquote, urlparse
+
+# URL schemes of entries that are downloaded rather than read from disk
+REMOTE_SCHEMES = ("http", "https")
+
+
+def is_remote(entry: str) -> bool:
+    """
+    Checks whether a file list entry is an http(s):// URL.
+
+    Args:
+        entry (str): The entry as written in the list.
+
+    Returns:
+        bool: True for http:// and https:// URLs.
+    """
+    return urlparse(entry.strip()).scheme.lower() in REMOTE_SCHEMES
+
+
+def parse_entries(
+    entries: Iterable[str], base_dir: Path
+) -> Tuple[List[Path], List[str]]:
+    """
+    Splits file list entries into local paths and remote URLs.
+
+    Blank entries and entries starting with "#" (M3U directives and comments)
+    are ignored. Relative paths are resolved against base_dir; backslash
+    separators and file:// URLs are accepted. Duplicates are dropped, keeping
+    the first occurrence.
+
+    Args:
+        entries (Iterable[str]): The entries, e.g. a list's lines.
+        base_dir (Path): The directory relative paths are resolved against.
+
+    Returns:
+        Tuple[List[Path], List[str]]: The local paths and the http(s) URLs,
+            each in entry order.
+    """
+    paths: List[Path] = []
+    urls: List[str] = []
+    seen = set()
+    for line in entries:
+        entry = line.strip()
+        if not entry or entry.startswith("#"):
+            continue
+        if is_remote(entry):
+            if entry not in seen:
+                seen.add(entry)
+                urls.append(entry)
+            continue
+        if entry.startswith("file://"):
+            entry = unquote(urlparse(entry).path)
+        elif os.sep == "/":
+            # Playlists written on Windows use backslash separators
+            entry = entry.replace("\\", "/")
+
+        path = Path(entry).expanduser()
+        if not path.is_absolute():
+            path = base_dir / path
+        path = path.resolve()
+        if path not in seen:
+            seen.add(path)
+            paths.append(path)
+    return paths, urls
+
+
+def _read_entries(list_path: Path) -> Tuple[List[Path], List[str]]:
+    """Local paths and URLs listed in a file list or playlist."""
+    text = list_path.read_text(encoding="utf-8-sig", errors="replace")
+    return parse_entries(text.splitlines(), list_path.parent)
+
+
+def read_file_list(list_path: Path) -> List[Path]:
+    """
+    Reads the local file paths listed in a file list or M3U playlist.
+
+    Relative entries are resolved against the directory holding the list
+    (see parse_entries); http(s) URLs are left to read_remote_entries.
+
+    Args:
+        list_path (Path): The file list or playlist to read.
+
+    Returns:
+        List[Path]: The listed paths, in list order.
+    """
+    return _read_entries(list_path)[0]
+
+
+def read_remote_entries(list_path: Path) -> List[str]:
+    """
+    Reads the http(s) URLs listed in a file list or M3U playlist.
+
+    Args:
+        list_path (Path): The file list or playlist to read.
+
+    Returns:
+        List[str]: The listed URLs, in list order.
+    """
+    return _read_entries(list_path)[1]
@@ -0,0 +1,100 @@
+"""Readahead of upcoming source files.
+
+On high-latency storage (NAS, network mounts) the first read of each file
+stalls the probe and encode that need it. A Readahead reads the head of the
+next few files, in processing order, so they are in the page cache by the
+time they are opened for real. It is purely an optimization: read errors are
+ignored, and nothing waits for it.
+"""
+
+import asyncio
+from pathlib import Path
+from typing import Callable, Dict, List, Optional
+
+import structlog
+
+# Bytes read from the start of each file; enough for container headers,
+# tags and embedded artwork
+READAHEAD_BYTES = 4 * 1024 * 1024
+
+# Files read concurrently; a small pool, so readahead does not compete with
+# the encodes for I/O
+READAHEAD_WORKERS = 2
+
+CHUNK_SIZE = 1024 * 1024
+
+
+def read_head(path: Path, size: int = READAHEAD_BYTES) -> int:
+    """Read and discard the first size bytes of a file, warming the cache.
+
+    Returns:
+        Number of bytes read
+    """
+    read = 0
+    with open(path, "rb") as f:
+        while read < size:
+            chunk = f.read(min(CHUNK_SIZE, size - read))
+            if not chunk:
+                break
+            read += len(chunk)
+    return read
+
+
+class Readahead:
+    """Reads files ahead of the stage consuming them, at most depth ahead."""
+
+    def __init__(
+        self,
+        paths: List[Path],
+        depth: int,
+        workers: int = READAHEAD_WORKERS,
+        reader: Optional[Callable[[Path], object]] = None,
+    ):
+        """Initialize Readahead.
+
+        Args:
+            paths: Files in the order they will be processed
+            depth: Most files read ahead of the last one consumed
+            workers: Files read concurrently
+            reader: Reads one file (default: read_head)
+        """
+        self.paths = list(paths)
+        self.depth = depth
+        self.workers = workers
+        self.reader = reader or read_head
+        self._index: Dict[Path, int] = {}
+        for index, path in enumerate(self.paths):
+            self._index.setdefault(path, index)
+        self._consumed = 0  # Files before this index are being processed
+        self._next = 0
+        self._advanced = asyncio.Condition()
+        self.logger = structlog.get_logger(__name__)
+
+    async def consume(self, path: Path) -> None:
+        """Note that processing picked up a file, moving the window on."""
+        index = self._index.get(path)
+        if index is None:
+            return
+        async with self._advanced:
+            self._consumed = max(self._consumed, index + 1)
+            self._advanced.notify_all()
+
+    async def run(self) -> None:
+        """Read ahead until every file is read or consumed."""
+        await asyncio.gather(*(self._worker() for _ in range(self.workers)))
+
+    async def _worker(self) -> None:
+        while self._next < len(self.paths):
+            index = self._next
+            self._next += 1
+            async with self._advanced:
+                await self._advanced.wait_for(
+                    lambda: index < self._consumed + self.depth
+                )
+            if index < self._consumed:
+                continue  # Already being processed; too late to help
+            path = self.paths[index]
+            try:
+                await asyncio.to_thread(self.reader, path)
+            except OSError as e:
+                self.logger.debug("readahead_failed", file=str(path), error=str(e))
@@ -0,0 +1,134 @@
+"""Downloads of remote (http/https) inputs.
+
+Remote inputs are fetched into a local directory before conversion, so they
+can be checksummed and recorded in state like any local file.
+"""
+
+import http.client
+import shutil
+import urllib.error
+import urllib.request
+from pathlib import Path
+from typing import Dict, Optional
+from urllib.parse import unquote, urlparse
+
+
+class RemoteInputError(Exception):
+    """
+    Raised when a remote input cannot be downloaded.
+    """
+
+
+def remote_display_path(url: str) -> Path:
+    """
+    Returns the path a remote input is reported under.
+
+    Args:
+        url (str): The input's URL.
+
+    Returns:
+        Path: <host>/<path>, e.g. media.example.com/music/song.mp3.
+    """
+    parsed = urlparse(url)
+    return Path(parsed.netloc) / unquote(parsed.path).lstrip("/")
+
+
+def _host(url: str) -> str:
+    return (urlparse(url).hostname or "").lower()
+
+
+class _HostHeadersRedirectHandler(urllib.request.HTTPRedirectHandler):
+    """
+    Follows redirects, swapping in the configured headers of each new host.
+
+    urllib copies a request's headers onto the redirected request, so without
+    this a redirect to another host would carry the first host's credentials
+    there.
+    """
+
+    def __init__(self, headers: Dict[str, Dict[str, str]]):
+        self.headers = headers
+
+    def redirect_request(self, req, fp, code, msg, headers, newurl):
+        redirected = super().redirect_request(req, fp, code, msg, headers, newurl)
+        if redirected is None:
+            return None
+        old_host, new_host = _host(req.full_url), _host(redirected.full_url)
+        if old_host != new_host:
+            # urllib stores header names capitalized ("X-api-key")
+            for name in self.headers.get(old_host, {}):
+                redirected.remove_header(name.capitalize())
+            for name, value in self.headers.get(new_host, {}).items():
+                redirected.add_header(name, value)
+        return redirected
+
+
+class RemoteFetcher:
+    """
+    Downloads remote inputs, adding the configured headers for each host.
+
+    Headers are keyed by host name, so credentials for one server are never
+    sent to another, including when it redirects there.
+    """
+
+    def __init__(
+        self,
+        headers: Optional[Dict[str, Dict[str, str]]] = None,
+        timeout: float = 60.0,
+    ):
+        """
+        Args:
+            headers (Optional[Dict[str, Dict[str, str]]]): Extra request
+                headers (e.g. Authorization) per host name.
+            timeout (float): Seconds to wait for the server before giving up.
+        """
+        self.headers = {host.lower(): dict(h) for host, h in (headers or {}).items()}
+        self.timeout = timeout
+
+    def fetch(self, url: str, destination: Path) -> Path:
+        """
+        Downloads a URL into a directory.
+
+        Args:
+            url (str): The http(s) URL to download.
+            destination (Path): The directory to download into, created if
+                missing.
+
+        Returns:
+            Path: The downloaded file, named after the last part of the URL's
+                path.
+
+        Raises:
+            RemoteInputError: If the request fails or the download is cut off.
+        """
+        parsed = urlparse(url)
+        name = Path(unquote(parsed.path)).name or "download"
+        request = urllib.request.Request(url, headers=self.headers.get(_host(url), {}))
+        opener = urllib.request.build_opener(_HostHeadersRedirectHandler(self.headers))
+
+        destination.mkdir(parents=True, exist_ok=True)
+        target = destination / name
+        try:
+            with opener.open(request, timeout=self.timeout) as response:
+                expected = response.headers.get("Content-Length")
+                with open(target, "wb") as f:
+                    shutil.copyfileobj(response, f)
+        except urllib.error.HTTPError as e:
+            target.unlink(missing_ok=True)
+            raise RemoteInputError(f"Download of {url} returned HTTP {e.code}") from e
+        except (
+            urllib.error.URLError,
+            http.client.HTTPException,
+            OSError,
+            ValueError,
+        ) as e:
+            target.unlink(missing_ok=True)
+            raise RemoteInputError(f"Download of {url} failed: {e}") from e
+
+        size = target.stat().st_size
+        if expected and expected.isdigit() and size < int(expected):
+            target.unlink(missing_ok=True)
+            raise RemoteInputError(
+                f"Download of {url} was cut off after {size} of {expected} bytes"
+            )
+        return target
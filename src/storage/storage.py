@@ -1,12 +1,211 @@
+import asyncio
+import errno
+import fcntl
+import os
+import shutil
+import threading
+from contextlib import asynccontextmanager, contextmanager
 from pathlib import Path
-from typing import Union
+from typing import AsyncIterator, Dict, Iterator, Optional, Union
+
+# Number of locks destination paths are spread over. Paths sharing a shard
+# serialize needlessly, so this only needs to be large relative to the
+# number of concurrent writers.
+LOCK_SHARDS = 256
+
+# Seconds between attempts to take a lock file held by another process
+FILE_LOCK_POLL_INTERVAL = 0.1
+
+# Seconds between attempts to take a write lock held by a thread
+THREAD_LOCK_POLL_INTERVAL = 0.01
+
+
+def atomic_replace(source: Path, destination: Path) -> None:
+    """
+    Moves a finished temporary file over its final path.
+
+    A rename is tried first. When the two paths are on different filesystems
+    (EXDEV), the file is copied and fsynced next to the destination, renamed
+    over it, and the source is removed, so readers never see a partial file.
+
+    Args:
+        source (Path): The finished temporary file.
+        destination (Path): The final path, replaced if it exists.
+    """
+    try:
+        os.replace(source, destination)
+        return
+    except OSError as e:
+        if e.errno != errno.EXDEV:
+            raise
+
+    staging = destination.with_name(f".{destination.name}.partial")
+    try:
+        with open(source, "rb") as src, open(staging, "wb") as dst:
+            shutil.copyfileobj(src, dst)
+            dst.flush()
+            os.fsync(dst.fileno())
+        shutil.copystat(source, staging)
+        os.replace(staging, destination)
+    except BaseException:
+        staging.unlink(missing_ok=True)
+        raise
+    os.unlink(source)
+
+
+def fsync_file(path: Path) -> None:
+    """
+    Flushes a file's contents to disk.
+
+    A rename is only as durable as the data behind it: without this, a crash
+    shortly after replacing a file can leave the new name pointing at an
+    empty one.
+
+    Args:
+        path (Path): The file to flush.
+    """
+    with open(path, "rb") as f:
+        os.fsync(f.fileno())
+
+
+def lock_file_path(file_path: Path) -> Path:
+    """
+    Returns the hidden lock file guarding a destination path across processes.
+
+    Args:
+        file_path (Path): The destination path.
+
+    Returns:
+        Path: ".<name>.lock" next to the destination.
+    """
+    return file_path.with_name(f".{file_path.name}.lock")
+
+
+@asynccontextmanager
+async def file_lock(
+    lock_path: Path, poll_interval: float = FILE_LOCK_POLL_INTERVAL
+) -> AsyncIterator[None]:
+    """
+    Holds an exclusive advisory lock on a lock file, shared with every other
+    process (on other hosts too, where the filesystem supports flock) that
+    locks the same path.
+
+    The lock file is removed on release. A waiter that ends up holding a file
+    which was removed meanwhile retries on the new one, so two holders can
+    never each believe they have the lock.
+
+    Args:
+        lock_path (Path): The lock file, created if missing.
+        poll_interval (float): Seconds to wait between attempts.
+    """
+    lock_path.parent.mkdir(parents=True, exist_ok=True)
+    while True:
+        fd = os.open(lock_path, os.O_RDWR | os.O_CREAT, 0o644)
+        try:
+            fcntl.flock(fd, fcntl.LOCK_EX | fcntl.LOCK_NB)
+        except BlockingIOError:
+            os.close(fd)
+            await asyncio.sleep(poll_interval)
+            continue
+        try:
+            current = os.stat(lock_path)
+        except FileNotFoundError:
+            current = None
+        if current is not None and os.path.samestat(current, os.fstat(fd)):
+            break
+        os.close(fd)
+    try:
+        yield
+    finally:
+        lock_path.unlink(missing_ok=True)
+        os.close(fd)
 
 
 class Storage:
     """
     Handles file storage operations such as saving and deleting files.
+
+    Writes to the same destination are serialized through a sharded lock
+    map, so two workers that compute the same output path cannot interleave
+    their writes. Coroutines queue on a per-path asyncio lock first, so
+    waiting for a destination never ties up a thread.
     """
 
+    def __init__(self):
+        self._locks = [threading.Lock() for _ in range(LOCK_SHARDS)]
+        # Per-path asyncio locks and how many coroutines use each, so
+        # unused ones can be dropped
+        self._async_locks: Dict[str, asyncio.Lock] = {}
+        self._async_users: Dict[str, int] = {}
+
+    @staticmethod
+    def _lock_key(file_path: Path) -> str:
+        """The same key for every spelling of a path."""
+        return os.path.normcase(os.path.abspath(file_path))
+
+    def lock_for(self, file_path: Path) -> threading.Lock:
+        """
+        Returns the lock guarding writes to a destination path.
+
+        Args:
+            file_path (Path): The destination path.
+
+        Returns:
+            threading.Lock: The same lock for every spelling of the path.
+        """
+        return self._locks[hash(self._lock_key(file_path)) % LOCK_SHARDS]
+
+    @contextmanager
+    def locked(self, file_path: Path) -> Iterator[None]:
+        """
+        Holds the write lock for a destination path.
+
+        Args:
+            file_path (Path): The destination path.
+        """
+        with self.lock_for(file_path):
+            yield
+
+    @asynccontextmanager
+    async def locked_async(
+        self, file_path: Path, across_processes: bool = False
+    ) -> AsyncIterator[None]:
+        """
+        Holds the write lock for a destination path without blocking the
+        event loop, or a thread, while waiting for it.
+
+        Coroutines wait on a per-path asyncio lock; its holder then takes the
+        thread lock shared with locked(), polling while a thread holds it.
+
+        Args:
+            file_path (Path): The destination path.
+            across_processes (bool): Also hold its lock file (see file_lock),
+                for runs that share an output directory with other processes.
+        """
+        key = self._lock_key(file_path)
+        if key not in self._async_locks:
+            self._async_locks[key] = asyncio.Lock()
+            self._async_users[key] = 0
+        self._async_users[key] += 1
+        try:
+            async with self._async_locks[key]:
+                lock = self.lock_for(file_path)
+                while not lock.acquire(blocking=False):
+                    await asyncio.sleep(THREAD_LOCK_POLL_INTERVAL)
+                try:
+                    if across_processes:
+                        async with file_lock(lock_file_path(file_path)):
+                            yield
+                    else:
+                        yield
+                finally:
+                    lock.release()
+        finally:
+            self._async_users[key] -= 1
+            if not self._async_users[key]:
+                del self._async_users[key]
+                del self._async_locks[key]
+
     def save_file(self, file_path: Path, content: Union[str, bytes]) -> bool:
         """
         Saves content to a file.
@@ -19,8 +218,10 @@ class Storage:
             bool: True if the file was saved successfully, False otherwise.
         """
         try:
-            with file_path.open("wb" if isinstance(content, bytes) else "w") as f:
-                f.write(content)
+            with self.locked(file_path):
+                mode = "wb" if isinstance(content, bytes) else "w"
+                with file_path.open(mode) as f:
+                    f.write(content)
             return True
         except Exception as e:
             print(f"Failed to save file {file_path}: {e}")
@@ -46,3 +247,44 @@ class Storage:
         except Exception as e:
             print(f"Failed to delete file {file_path}: {e}")
             return False
+
+    def preserve_original(
+        self,
+        source_path: Path,
+        input_root: Path,
+        originals_dir: Path,
+        move: bool = False,
+    ) -> Optional[Path]:
+        """
+        Preserves a source file in the originals tree, mirroring its location
+        relative to the input root.
+
+        Args:
+            source_path (Path): The source file to preserve.
+            input_root (Path): The input directory the source was found in.
+            originals_dir (Path): The root of the originals tree.
+            move (bool): Move the source instead of copying it.
+
+        Returns:
+            Optional[Path]: The preserved file's path, or None on failure.
+        """
+        try:
+            relative = source_path.relative_to(input_root)
+        except ValueError:
+            relative = Path(source_path.name)
+
+        destination = originals_dir / relative
+        if destination.exists() and destination.samefile(source_path):
+            # Already in place; copying a file onto itself would truncate it
+            return destination
+        try:
+            destination.parent.mkdir(parents=True, exist_ok=True)
+            with self.locked(destination):
+                if move:
+                    shutil.move(str(source_path), str(destination))
+                else:
+                    shutil.copy2(source_path, destination)
+            return destination
+        except Exception as e:
+            print(f"Failed to preserve original {source_path}: {e}")
+            return None
@@ -0,0 +1,141 @@
+"""Prometheus Pushgateway export.
+
+Batch runs are short-lived cron jobs, so there is nothing for Prometheus to
+scrape; instead the final counters of a run are pushed to a Pushgateway once
+the run ends. A failed push is logged and never fails the run.
+"""
+
+import urllib.error
+import urllib.parse
+import urllib.request
+from collections import defaultdict
+from typing import Dict, List, Tuple
+
+import structlog
+
+from src.telemetry.telemetry import (
+    BYTES_INPUT,
+    BYTES_OUTPUT,
+    FILES_FAILED,
+    FILES_PROCESSED,
+    FILES_SKIPPED,
+    Attributes,
+)
+
+# Counters always exported, even when a run did not touch them
+EXPORTED_COUNTERS = (
+    FILES_PROCESSED,
+    FILES_FAILED,
+    FILES_SKIPPED,
+    BYTES_INPUT,
+    BYTES_OUTPUT,
+)
+
+BYTES_SAVED = "media.bytes.saved"
+RUN_DURATION = "media.run.duration.seconds"
+
+CONTENT_TYPE = "text/plain; version=0.0.4"
+
+
+def metric_name(name: str) -> str:
+    """Prometheus name for a dotted metric name, e.g. media_files_processed."""
+    return name.replace(".", "_")
+
+
+def _labels(attributes: Attributes) -> str:
+    """Exposition label set, e.g. {file_type="flac"}; "" for no labels."""
+    if not attributes:
+        return ""
+    pairs = []
+    for key, value in sorted(attributes):
+        escaped = (
+            str(value).replace("\\", "\\\\").replace('"', '\\"').replace("\n", "\\n")
+        )
+        pairs.append(f'{key}="{escaped}"')
+    return "{" + ",".join(pairs) + "}"
+
+
+def exposition(snapshot: Dict[Tuple[str, Attributes], int], duration_s: float) -> str:
+    """Render a run's final metrics in the Prometheus text format.
+
+    Args:
+        snapshot: Counter series from TelemetryProvider.snapshot()
+        duration_s: Run duration in seconds
+
+    Returns:
+        Counters as <name>_total series, plus media_bytes_saved (input minus
+        output bytes of converted files) and media_run_duration_seconds gauges
+    """
+    series: Dict[str, List[Tuple[Attributes, int]]] = defaultdict(list)
+    for (name, attributes), value in snapshot.items():
+        series[name].append((attributes, value))
+
+    lines = []
+    names = EXPORTED_COUNTERS + tuple(sorted(set(series) - set(EXPORTED_COUNTERS)))
+    for name in names:
+        prometheus_name = metric_name(name) + "_total"
+        lines.append(f"# TYPE {prometheus_name} counter")
+        samples = series.get(name) or [(frozenset(), 0)]
+        for attributes, value in sorted(samples, key=lambda s: sorted(s[0])):
+            lines.append(f"{prometheus_name}{_labels(attributes)} {value}")
+
+    saved = sum(value for _, value in series.get(BYTES_INPUT, [])) - sum(
+        value for _, value in series.get(BYTES_OUTPUT, [])
+    )
+    lines.append(f"# TYPE {metric_name(BYTES_SAVED)} gauge")
+    lines.append(f"{metric_name(BYTES_SAVED)} {saved}")
+    lines.append(f"# TYPE {metric_name(RUN_DURATION)} gauge")
+    lines.append(f"{metric_name(RUN_DURATION)} {duration_s:.3f}")
+    return "\n".join(lines) + "\n"
+
+
+class Pushgateway:
+    """Pushes run metrics to a Prometheus Pushgateway."""
+
+    def __init__(self, url: str, job: str = "media_refinery", timeout: float = 10.0):
+        """Initialize Pushgateway.
+
+        Args:
+            url: Base URL of the Pushgateway, e.g. http://pushgateway:9091
+            job: Job label the metrics are grouped under
+            timeout: Request timeout in seconds
+        """
+        self.url = url.rstrip("/")
+        self.job = job
+        self.timeout = timeout
+        self.logger = structlog.get_logger(__name__)
+
+    @property
+    def push_url(self) -> str:
+        """Grouping URL of this job's metrics."""
+        return f"{self.url}/metrics/job/{urllib.parse.quote(self.job, safe='')}"
+
+    def push(
+        self, snapshot: Dict[Tuple[str, Attributes], int], duration_s: float
+    ) -> bool:
+        """Replace the job's metrics with this run's, logging rather than raising.
+
+        Args:
+            snapshot: Counter series from TelemetryProvider.snapshot()
+            duration_s: Run duration in seconds
+
+        Returns:
+            True if the Pushgateway accepted the metrics
+        """
+        request = urllib.request.Request(
+            self.push_url,
+            data=exposition(snapshot, duration_s).encode(),
+            headers={"Content-Type": CONTENT_TYPE},
+            method="PUT",
+        )
+        try:
+            with urllib.request.urlopen(request, timeout=self.timeout):
+                pass
+        except urllib.error.HTTPError as e:
+            self.logger.error("pushgateway_push_failed", error=f"HTTP {e.code}")
+            return False
+        except (urllib.error.URLError, OSError, ValueError) as e:
+            self.logger.error("pushgateway_push_failed", error=str(e))
+            return False
+        self.logger.info("pushgateway_push_succeeded", job=self.job)
+        return True
@@ -0,0 +1,77 @@
+"""In-process telemetry counters.
+
+Counts per-file outcomes of a batch run under OpenTelemetry-style metric
+names, each broken down by attributes (e.g. file type and skip reason), so
+that dashboards can tell files that were processed apart from files that
+needed no work.
+"""
+
+import threading
+from collections import Counter
+from typing import Dict, FrozenSet, Tuple
+
+FILES_PROCESSED = "media.files.processed"
+FILES_FAILED = "media.files.failed"
+FILES_SKIPPED = "media.files.skipped"
+BYTES_INPUT = "media.bytes.input"
+BYTES_OUTPUT = "media.bytes.output"
+
+Attributes = FrozenSet[Tuple[str, str]]
+
+
+class TelemetryProvider:
+    """Thread-safe registry of monotonic counters."""
+
+    def __init__(self):
+        self._counters: Counter = Counter()
+        self._lock = threading.Lock()
+
+    def add(self, name: str, value: int = 1, **attributes: str) -> None:
+        """Increment a counter for one combination of attributes.
+
+        Args:
+            name: Metric name, e.g. FILES_SKIPPED
+            value: Amount to add
+            **attributes: Labels distinguishing this series
+        """
+        key = (name, frozenset(attributes.items()))
+        with self._lock:
+            self._counters[key] += value
+
+    def value(self, name: str, **attributes: str) -> int:
+        """Current value of one counter series (0 if never incremented)."""
+        with self._lock:
+            return self._counters[(name, frozenset(attributes.items()))]
+
+    def snapshot(self) -> Dict[Tuple[str, Attributes], int]:
+        """Copy of every counter series, keyed by (name, attributes)."""
+        with self._lock:
+            return dict(self._counters)
+
+    def record_file_processed(self, file_type: str) -> None:
+        """Count a file that was converted successfully."""
+        self.add(FILES_PROCESSED, file_type=file_type)
+
+    def record_file_failed(self, file_type: str) -> None:
+        """Count a file whose conversion failed."""
+        self.add(FILES_FAILED, file_type=file_type)
+
+    def record_file_skipped(self, file_type: str, reason: str) -> None:
+        """Count a file that was skipped without processing.
+
+        Args:
+            file_type: File extension without the dot, e.g. "mp3"
+            reason: Why the file was skipped, e.g. "already_converted"
+        """
+        self.add(FILES_SKIPPED, file_type=file_type, reason=reason)
+
+    def record_bytes(self, file_type: str, input_bytes: int, output_bytes: int) -> None:
+        """Count the sizes of a converted file's source and output.
+
+        Args:
+            file_type: File extension without the dot, e.g. "mp3"
+            input_bytes: Size of the source file
+            output_bytes: Size of the converted file
+        """
+        self.add(BYTES_INPUT, input_bytes, file_type=file_type)
+        self.add(BYTES_OUTPUT, output_bytes, file_type=file_type)
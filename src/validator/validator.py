@@ -1,5 +1,52 @@
+import json
+import subprocess
+from enum import Enum
 from pathlib import Path
-from typing import List
+from typing import Any, Dict, List, Optional
+
+from src.audio.format_detector import (
+    AudioFormatDetector,
+    CorruptedAudioFileError,
+    UnsupportedAudioFormatError,
+)
+from src.audio.format_validator import AudioFormatValidator
+from src.storage.extensions import normalized_extension
+
+
+class MediaType(str, Enum):
+    """Kind of media a file holds."""
+
+    AUDIO = "audio"
+    VIDEO = "video"
+    UNKNOWN = "unknown"
+
+
+# Extensions whose media type is settled by the extension alone
+EXTENSION_MEDIA_TYPES = {
+    ".mp3": MediaType.AUDIO,
+    ".flac": MediaType.AUDIO,
+    ".aac": MediaType.AUDIO,
+    ".m4a": MediaType.AUDIO,
+    ".opus": MediaType.AUDIO,
+    ".wav": MediaType.AUDIO,
+    ".aiff": MediaType.AUDIO,
+    ".aif": MediaType.AUDIO,
+    ".dsf": MediaType.AUDIO,
+    ".dff": MediaType.AUDIO,
+    ".mka": MediaType.AUDIO,
+    ".avi": MediaType.VIDEO,
+    ".mp4": MediaType.VIDEO,
+    ".mov": MediaType.VIDEO,
+    ".wmv": MediaType.VIDEO,
+    ".flv": MediaType.VIDEO,
+}
+
+# Containers that may hold audio only or video, so need a probe to classify
+AMBIGUOUS_EXTENSIONS = {".mkv", ".webm", ".ts", ".m2ts", ".ogg", ".ogm"}
+
+
+class MediaProbeError(Exception):
+    """Raised when ffprobe cannot read a file's streams."""
 
 
 class Validator:
@@ -7,7 +54,9 @@ class Validator:
     Validates files and directories based on predefined rules.
     """
 
-    def __init__(self, allowed_extensions: List[str] = None):
+    def __init__(
+        self, allowed_extensions: List[str] = None, probe_timeout: float = 30.0
+    ):
         self.allowed_extensions = allowed_extensions or [
             ".mp3",
             ".flac",
@@ -15,7 +64,13 @@ class Validator:
             ".m4a",
             ".ogg",
             ".wav",
+            ".aiff",
+            ".aif",
+            ".dsf",
+            ".dff",
         ]
+        self.probe_timeout = probe_timeout
+        self.format_detector = AudioFormatDetector()
 
     def validate_file(self, file_path: Path) -> bool:
         """
@@ -31,7 +86,7 @@ class Validator:
             print(f"File does not exist: {file_path}")
             return False
 
-        if file_path.suffix.lower() not in self.allowed_extensions:
+        if normalized_extension(file_path) not in self.allowed_extensions:
             print(f"Invalid file extension: {file_path.suffix}")
             return False
 
@@ -57,3 +112,156 @@ class Validator:
                 valid_files.append(file_path)
 
         return valid_files
+
+    def classify(self, file_path: Path) -> MediaType:
+        """
+        Determines whether a file holds audio or video.
+
+        The extension decides where it is unambiguous; containers that can
+        hold either (e.g. .mkv, .ts) are classified by probing their streams.
+
+        Args:
+            file_path (Path): The path to the file to classify.
+
+        Returns:
+            MediaType: The file's media type, UNKNOWN if it cannot be told.
+        """
+        suffix = normalized_extension(file_path)
+        if suffix in EXTENSION_MEDIA_TYPES:
+            return EXTENSION_MEDIA_TYPES[suffix]
+        if suffix not in AMBIGUOUS_EXTENSIONS:
+            return MediaType.UNKNOWN
+
+        try:
+            return self.classify_by_probe(file_path)
+        except MediaProbeError:
+            return MediaType.UNKNOWN
+
+    def classify_by_probe(self, file_path: Path) -> MediaType:
+        """
+        Classifies a file by the streams ffprobe finds in it.
+
+        Any video stream makes it video, except embedded cover art (attached
+        pictures), which audio files commonly carry. Audio streams alone make
+        it audio.
+
+        Args:
+            file_path (Path): The path to the file to classify.
+
+        Returns:
+            MediaType: VIDEO, AUDIO, or UNKNOWN if it has neither.
+
+        Raises:
+            MediaProbeError: If ffprobe is missing or cannot read the file.
+        """
+        streams = self.probe_streams(file_path)
+        has_audio = False
+        for stream in streams:
+            codec_type = stream.get("codec_type")
+            attached_pic = (stream.get("disposition") or {}).get("attached_pic")
+            if codec_type == "video" and not attached_pic:
+                return MediaType.VIDEO
+            if codec_type == "audio":
+                has_audio = True
+        return MediaType.AUDIO if has_audio else MediaType.UNKNOWN
+
+    def probe_streams(self, file_path: Path) -> List[Dict[str, Any]]:
+        """
+        Lists a file's streams using ffprobe.
+
+        Args:
+            file_path (Path): The path to the file to probe.
+
+        Returns:
+            List[Dict[str, Any]]: The "streams" entries of the ffprobe output.
+
+        Raises:
+            MediaProbeError: If ffprobe is missing, cannot read the file or
+                takes longer than probe_timeout.
+        """
+        command = [
+            "ffprobe",
+            "-v",
+            "quiet",
+            "-print_format",
+            "json",
+            "-show_streams",
+            str(file_path),
+        ]
+        try:
+            output = subprocess.check_output(
+                command, text=True, timeout=self.probe_timeout
+            )
+            return json.loads(output).get("streams") or []
+        except subprocess.TimeoutExpired as e:
+            raise MediaProbeError(
+                f"Timed out after {self.probe_timeout}s probing {file_path}"
+            ) from e
+        except (subprocess.CalledProcessError, FileNotFoundError, ValueError) as e:
+            raise MediaProbeError(f"Failed to probe {file_path}: {e}") from e
+
+    async def validate_media_integrity(self, file_path: Path) -> Optional[str]:
+        """
+        Checks that a media file is intact, using AudioFormatValidator.
+
+        Beyond a recognised header, the size its container declares must be
+        present on disk and, when FFprobe is available, it must probe with an
+        audio stream, so truncated files are caught too.
+
+        Args:
+            file_path (Path): The path to the file to check.
+
+        Returns:
+            Optional[str]: A description of the problem, or None if the file
+            looks intact.
+        """
+        try:
+            await AudioFormatValidator(self.format_detector).validate_file(file_path)
+        except (
+            FileNotFoundError, CorruptedAudioFileError, UnsupportedAudioFormatError
+        ) as e:
+            return str(e)
+
+        return None
+
+    def run_validation_command(
+        self,
+        command: List[str],
+        output_path: Path,
+        context: Dict[str, Any],
+        timeout: float = 60.0,
+    ) -> Optional[str]:
+        """
+        Runs an external quality check (e.g. a loudness script) on an output.
+
+        The output path is appended to the command as its last argument, and
+        the context is passed as a JSON object on stdin.
+
+        Args:
+            command (List[str]): The command and its arguments.
+            output_path (Path): The converted file to check.
+            context (Dict[str, Any]): Details of the conversion, such as the
+                input path and metadata.
+            timeout (float): Seconds the command may run before it fails.
+
+        Returns:
+            Optional[str]: Why the check failed, or None if it exited with 0.
+        """
+        try:
+            completed = subprocess.run(
+                [*command, str(output_path)],
+                input=json.dumps(context, default=str),
+                capture_output=True,
+                text=True,
+                timeout=timeout,
+            )
+        except subprocess.TimeoutExpired:
+            return f"Validation command timed out after {timeout}s"
+        except OSError as e:
+            return f"Validation command could not be run: {e}"
+
+        if completed.returncode == 0:
+            return None
+        message = f"Validation command failed with exit code {completed.returncode}"
+        lines = (completed.stderr or completed.stdout).strip().splitlines()
+        return f"{message}: {lines[-1]}" if lines else message
@@ -0,0 +1,47 @@
+"""Build information for the running Media Refinery.
+
+The git commit and build date are injected when the container image is
+built, through the MEDIA_REFINERY_GIT_COMMIT and MEDIA_REFINERY_BUILD_DATE
+environment variables (see the Dockerfile build args). Outside a built
+image they read "unknown".
+"""
+
+import os
+import platform
+from dataclasses import asdict, dataclass
+from typing import Dict
+
+VERSION = "0.1.0"
+
+GIT_COMMIT_ENV = "MEDIA_REFINERY_GIT_COMMIT"
+BUILD_DATE_ENV = "MEDIA_REFINERY_BUILD_DATE"
+
+
+@dataclass
+class BuildInfo:
+    """Version and provenance of this build."""
+
+    version: str
+    python_version: str
+    git_commit: str
+    build_date: str
+
+    def to_dict(self) -> Dict[str, str]:
+        """Machine-readable form, for `--version --json`."""
+        return asdict(self)
+
+    def __str__(self) -> str:
+        return (
+            f"media-refinery {self.version} (commit {self.git_commit}, "
+            f"built {self.build_date}, Python {self.python_version})"
+        )
+
+
+def build_info() -> BuildInfo:
+    """Collect the build information for the running process."""
+    return BuildInfo(
+        version=VERSION,
+        python_version=platform.python_version(),
+        git_commit=os.environ.get(GIT_COMMIT_ENV) or "unknown",
+        build_date=os.environ.get(BUILD_DATE_ENV) or "unknown",
+    )
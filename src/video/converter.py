@@ -1,5 +1,78 @@
+import asyncio
+import json
 import os
 import logging
+import re
+import shutil
+import subprocess
+import tempfile
+
+from src.processor.filters import compose_filters, validate_filters
+from src.processor.priority import niceness_preexec, with_io_class
+from src.storage.extensions import base_name, normalized_extension
+
+# FFmpeg encoder for each supported video codec
+VIDEO_ENCODERS = {
+    "h264": "libx264",
+    "h265": "libx265",
+    "vp9": "libvpx-vp9",
+    "av1": "libsvtav1",
+}
+
+# Constant-quality CRF per codec and quality level (lower is better)
+VIDEO_CRF = {
+    "h264": {"high": 18, "medium": 20, "low": 23},
+    "h265": {"high": 20, "medium": 22, "low": 26},
+    "vp9": {"high": 24, "medium": 31, "low": 36},
+    "av1": {"high": 24, "medium": 30, "low": 38},
+}
+
+# WebM only carries VP8/VP9/AV1 video and Vorbis/Opus audio
+WEBM_VIDEO_CODECS = {"vp9", "av1"}
+
+# FFprobe codec names that differ from the configured codec names
+PROBED_VIDEO_CODECS = {"hevc": "h265", "mpeg2video": "mpeg2"}
+
+# What codec_actions can do with a source besides encoding to a named codec:
+# stream copy it, leave it alone, or encode it to the configured video_codec
+CODEC_ACTIONS = ("remux", "skip", "transcode")
+
+# How a configured resolution is applied: "exact" scales to it (up or down),
+# "max" only scales sources larger than it, keeping their aspect ratio
+RESOLUTION_MODES = ("exact", "max")
+
+# Resolution values that mean "keep the source resolution"
+KEEP_RESOLUTION = ("", "keep", "source")
+
+# Segmented streaming outputs and the manifest each writes; segments are
+# fragmented MP4 (ISO BMFF) either way
+SEGMENT_MANIFESTS = {"hls": ".m3u8", "dash": ".mpd"}
+
+# Audio of segmented outputs is encoded to AAC, which every HLS and DASH
+# player decodes
+SEGMENT_AUDIO_ARGS = ["-c:a", "aac", "-b:a", "192k"]
+
+
+def parse_resolution(value):
+    """
+    Parse a configured resolution.
+
+    Args:
+        value (str): "WIDTHxHEIGHT" (e.g. "1920x1080"), or "keep"/empty.
+
+    Returns:
+        tuple: (width, height), or None to keep the source resolution.
+
+    Raises:
+        ValueError: If the value is not a valid resolution.
+    """
+    value = str(value or "").strip().lower()
+    if value in KEEP_RESOLUTION:
+        return None
+    match = re.fullmatch(r"(\d+)x(\d+)", value)
+    if not match or not all(int(side) > 0 for side in match.groups()):
+        raise ValueError(f"Invalid resolution: {value} (expected e.g. 1920x1080)")
+    return int(match.group(1)), int(match.group(2))
 
 
 class Config:
@@ -12,6 +85,17 @@ class Config:
         compression_level,
         dry_run,
         state_dir,
+        video_codec="h264",
+        quality="medium",
+        av1_encoder="libsvtav1",
+        remux_when_compatible=True,
+        video_filters=None,
+        resolution="keep",
+        resolution_mode="max",
+        preserve_stream_metadata=True,
+        segment_output=None,
+        segment_duration=6,
+        codec_actions=None,
     ):
         self.input_dir = input_dir
         self.output_dir = output_dir
@@ -20,6 +104,46 @@ class Config:
         self.compression_level = compression_level
         self.dry_run = dry_run
         self.state_dir = state_dir
+        self.video_codec = video_codec
+        self.quality = quality
+        self.av1_encoder = av1_encoder
+        self.remux_when_compatible = remux_when_compatible
+        self.video_filters = list(video_filters or [])
+        if resolution_mode not in RESOLUTION_MODES:
+            raise ValueError(
+                f"Invalid resolution_mode: {resolution_mode} (exact or max)"
+            )
+        self.resolution = parse_resolution(resolution)
+        self.resolution_mode = resolution_mode
+        self.preserve_stream_metadata = preserve_stream_metadata
+        segment_output = str(segment_output or "").lower() or None
+        if segment_output and segment_output not in SEGMENT_MANIFESTS:
+            raise ValueError(
+                f"Invalid segment_output: {segment_output} (hls, dash or empty)"
+            )
+        if float(segment_duration) <= 0:
+            raise ValueError(
+                f"segment_duration must be positive, got {segment_duration}"
+            )
+        self.segment_output = segment_output
+        self.segment_duration = float(segment_duration)
+        self.codec_actions = {}
+        for source, action in (codec_actions or {}).items():
+            source, action = str(source).lower(), str(action).lower()
+            if action not in CODEC_ACTIONS and action not in VIDEO_ENCODERS:
+                raise ValueError(
+                    f"Invalid codec action for {source}: {action} (remux, skip, "
+                    f"transcode or one of {', '.join(VIDEO_ENCODERS)})"
+                )
+            self.codec_actions[PROBED_VIDEO_CODECS.get(source, source)] = action
+
+
+class VideoConversionError(Exception):
+    """Raised when a video cannot be converted."""
+
+
+class VideoOutputError(VideoConversionError):
+    """Raised when FFmpeg reports success but the output is unusable."""
 
 
 class Result:
@@ -30,6 +154,72 @@ class Result:
         self.format = format
 
 
+class Plan:
+    """What converting one video would do, worked out without writing."""
+
+    def __init__(self, input_path, output_path, source_codecs, action, command):
+        self.input_path = input_path
+        self.output_path = output_path
+        # (video codec, audio codecs) as probed, or None if the probe failed
+        self.source_codecs = source_codecs
+        self.action = action  # "remux" (stream copy), "encode" or "skip"
+        self.command = command
+
+
+class ProgressParser:
+    """
+    Turns FFmpeg's -progress key=value output into percentage updates.
+
+    FFmpeg writes a block of keys (out_time_us, speed, total_size, ...) per
+    update, ending with a "progress" key that is "continue", or "end" once the
+    encode finishes.
+    """
+
+    def __init__(self, total_duration):
+        """
+        Args:
+            total_duration (float): The source's duration in seconds, or None
+                if unknown (updates then carry no percentage).
+        """
+        self.total_duration = total_duration
+        self.values = {}
+
+    def feed(self, line):
+        """
+        Read one line of -progress output.
+
+        Args:
+            line (str): A "key=value" line.
+
+        Returns:
+            tuple: (percent, speed) when the line completes a block, otherwise
+            None. percent is 0-100, or None without a total duration; speed is
+            as FFmpeg reports it, e.g. "1.5x".
+        """
+        key, sep, value = line.strip().partition("=")
+        if not sep:
+            return None
+        if key != "progress":
+            self.values[key] = value.strip()
+            return None
+        percent = self.percent()
+        if value.strip() == "end" and self.total_duration:
+            percent = 100.0
+        return percent, self.values.get("speed", "")
+
+    def percent(self):
+        """Progress through the source so far, 0-100, or None if unknown."""
+        if not self.total_duration:
+            return None
+        # out_time_ms is in microseconds too, despite its name
+        out_time = self.values.get("out_time_us") or self.values.get("out_time_ms")
+        try:
+            seconds = int(out_time) / 1_000_000
+        except (TypeError, ValueError):
+            return 0.0
+        return max(0.0, min(100.0, seconds * 100 / self.total_duration))
+
+
 class Converter:
     def __init__(self, config):
         self.logger = logging.getLogger(__name__)
@@ -87,9 +277,33 @@ class Converter:
 
 
 class VideoConverter:
-    def __init__(self, config):
+    def __init__(
+        self,
+        config,
+        progress_callback=None,
+        niceness=0,
+        io_class=None,
+        encode_timeout=None,
+    ):
+        """
+        Args:
+            config (Config): The video settings.
+            progress_callback (callable): Called as (percent, speed) while
+                a conversion encodes (see ProgressParser), e.g. to draw a
+                progress bar, unless convert is given one of its own; None
+                for no progress updates.
+            niceness (int): CPU niceness FFmpeg runs at (see
+                src.processor.priority).
+            io_class (str): ionice class FFmpeg runs in, or None.
+            encode_timeout (float): Seconds an encode may run before FFmpeg
+                is killed, or None for no limit.
+        """
         self.logger = logging.getLogger(__name__)
         self.config = config
+        self.progress_callback = progress_callback
+        self.niceness = niceness
+        self.io_class = io_class
+        self.encode_timeout = encode_timeout
 
     def convert_file(self, input_path):
         """
@@ -102,11 +316,618 @@ class VideoConverter:
             success=True, output_path=input_path, checksum="", format=self.config.format
         )
 
-    def convert(self, input_path, output_dir):
+    def probe_codecs(self, input_path):
+        """
+        Probe the codecs of a source's video and audio streams.
+
+        Args:
+            input_path (Path): The source video.
+
+        Returns:
+            tuple: (video codec, list of audio codecs) as FFprobe names them,
+            or None if the file could not be probed.
+        """
+        try:
+            output = subprocess.check_output(
+                [
+                    "ffprobe",
+                    "-v",
+                    "error",
+                    "-show_entries",
+                    "stream=codec_type,codec_name:stream_disposition=attached_pic",
+                    "-of",
+                    "json",
+                    str(input_path),
+                ],
+                text=True,
+            )
+            streams = json.loads(output).get("streams") or []
+        except (subprocess.CalledProcessError, ValueError, FileNotFoundError) as e:
+            self.logger.warning(f"Could not probe {input_path}: {e}")
+            return None
+
+        video = [
+            stream.get("codec_name")
+            for stream in streams
+            if stream.get("codec_type") == "video"
+            and not (stream.get("disposition") or {}).get("attached_pic")
+        ]
+        audio = [
+            stream.get("codec_name")
+            for stream in streams
+            if stream.get("codec_type") == "audio"
+        ]
+        if not video:
+            return None
+        return video[0], audio
+
+    def probe_duration(self, input_path):
+        """
+        Probe a source's duration.
+
+        Args:
+            input_path (Path): The source video.
+
+        Returns:
+            float: The duration in seconds, or None if it could not be probed.
+        """
+        try:
+            output = subprocess.check_output(
+                [
+                    "ffprobe",
+                    "-v",
+                    "error",
+                    "-show_entries",
+                    "format=duration",
+                    "-of",
+                    "default=noprint_wrappers=1:nokey=1",
+                    str(input_path),
+                ],
+                text=True,
+            )
+            duration = float(output.strip())
+        except (subprocess.CalledProcessError, ValueError, FileNotFoundError) as e:
+            self.logger.warning(f"Could not probe duration of {input_path}: {e}")
+            return None
+        return duration if duration > 0 else None
+
+    async def run_ffmpeg(self, command, input_path, progress_callback=None):
+        """
+        Run an FFmpeg command, reporting its progress.
+
+        The command gets -progress pipe:1, and each update is measured
+        against the probed duration of input_path. FFmpeg runs at the
+        converter's niceness and io_class, and is killed if the run is
+        cancelled (e.g. by a timeout) so it cannot keep writing afterwards.
+
+        Args:
+            command (list): The FFmpeg command, as from build_ffmpeg_args.
+            input_path (Path): The source, for its duration.
+            progress_callback (callable): Receives the (percent, speed)
+                updates; defaults to the converter's progress_callback.
+
+        Raises:
+            subprocess.CalledProcessError: If FFmpeg fails; its stderr is
+                attached.
+        """
+        progress_callback = progress_callback or self.progress_callback
+        command = [command[0], "-progress", "pipe:1", "-nostats"] + command[1:]
+        command = with_io_class(command, self.io_class)
+        duration = await asyncio.to_thread(self.probe_duration, input_path)
+        parser = ProgressParser(duration)
+        # stderr goes to a file so a chatty FFmpeg cannot block on a full pipe
+        with tempfile.TemporaryFile() as stderr:
+            process = await asyncio.create_subprocess_exec(
+                *command,
+                stdout=asyncio.subprocess.PIPE,
+                stderr=stderr,
+                preexec_fn=niceness_preexec(self.niceness),
+            )
+            try:
+                async for line in process.stdout:
+                    update = parser.feed(line.decode("utf-8", errors="replace"))
+                    if update and progress_callback:
+                        progress_callback(*update)
+                await process.wait()
+            except asyncio.CancelledError:
+                process.kill()
+                await process.wait()
+                raise
+            if process.returncode:
+                stderr.seek(0)
+                raise subprocess.CalledProcessError(
+                    process.returncode,
+                    command,
+                    stderr=stderr.read().decode("utf-8", errors="replace"),
+                )
+
+    def validate_output(self, output_path):
+        """
+        Validate a freshly written output.
+
+        FFmpeg can exit 0 yet leave an empty or truncated file (e.g. when the
+        disk fills near the end), so a single-file output must be non-empty
+        and, when FFprobe is available, hold a readable video stream. A
+        segmented output must have a non-empty manifest and segments.
+
+        Args:
+            output_path (Path): The output from get_output_path.
+
+        Raises:
+            VideoOutputError: If the output is missing, empty or fails to
+                probe.
+        """
+        if self.config.segment_output:
+            manifest = self.get_manifest_path(output_path)
+            if not manifest.is_file() or manifest.stat().st_size == 0:
+                raise VideoOutputError(f"Manifest is missing or empty: {manifest}")
+            if not any(
+                segment.stat().st_size for segment in output_path.glob("*.m4s")
+            ):
+                raise VideoOutputError(f"No segments written to {output_path}")
+            return
+
+        if not output_path.is_file() or output_path.stat().st_size == 0:
+            raise VideoOutputError(f"Output file is missing or empty: {output_path}")
+        try:
+            output = subprocess.check_output(
+                [
+                    "ffprobe",
+                    "-v",
+                    "error",
+                    "-show_entries",
+                    "stream=codec_type",
+                    "-of",
+                    "json",
+                    str(output_path),
+                ],
+                text=True,
+                stderr=subprocess.PIPE,
+            )
+        except FileNotFoundError:
+            self.logger.debug(f"ffprobe not found; not probing {output_path}")
+            return
+        except subprocess.CalledProcessError as e:
+            raise VideoOutputError(
+                f"Output file failed probe: {(e.stderr or '').strip()}"
+            )
+        try:
+            streams = json.loads(output or "{}").get("streams") or []
+        except ValueError:
+            streams = []
+        if not any(stream.get("codec_type") == "video" for stream in streams):
+            raise VideoOutputError(f"Output file has no video stream: {output_path}")
+
+    def can_remux(self, source_codecs, is_webm):
+        """
+        Check whether a source already has the target codecs, so a stream
+        copy into the new container gives the same result as an encode.
+
+        Args:
+            source_codecs (tuple): (video codec, audio codecs) from probe_codecs.
+            is_webm (bool): Whether the output container is WebM.
+
+        Returns:
+            bool: True if every stream can be copied as is.
+        """
+        if not self.config.remux_when_compatible or not source_codecs:
+            return False
+        video, _ = source_codecs
+        if PROBED_VIDEO_CODECS.get(video, video) != self.config.video_codec:
+            return False
+        return self._copyable(source_codecs, is_webm)
+
+    def _copyable(self, source_codecs, is_webm):
+        """
+        Check whether a source's streams can be copied into the output as is.
+
+        Args:
+            source_codecs (tuple): (video codec, audio codecs) from probe_codecs.
+            is_webm (bool): Whether the output container is WebM.
+
+        Returns:
+            bool: False if filters or scaling apply, or WebM cannot carry
+                the source's codecs.
+        """
+        if not source_codecs:
+            return False
+        if self.config.video_filters or self.config.resolution:
+            # Filtering and scaling need decoded frames, so the video must be
+            # re-encoded
+            return False
+        video, audio = source_codecs
+        if not is_webm:
+            return True
+        if PROBED_VIDEO_CODECS.get(video, video) not in WEBM_VIDEO_CODECS:
+            return False
+        # Other containers copy audio anyway; WebM re-encodes it to Opus
+        return all(codec == "opus" for codec in audio)
+
+    def choose_action(self, source_codecs, is_webm):
+        """
+        Decide what to do with a source from its probed video codec.
+
+        A codec_actions entry for the source codec wins: "skip" leaves the
+        file alone, "remux" copies its streams (encoding to video_codec
+        instead when filters, scaling or WebM rule a copy out), "transcode"
+        encodes to video_codec and a codec name encodes to that codec.
+        Sources without an entry are remuxed if can_remux allows, and
+        otherwise encoded to video_codec.
+
+        Args:
+            source_codecs (tuple): (video codec, audio codecs) from probe_codecs,
+                or None if unknown.
+            is_webm (bool): Whether the output container is WebM.
+
+        Returns:
+            tuple: (action, codec), action being "skip", "remux" or "encode"
+                and codec the video codec to encode to (None unless encoding).
+        """
+        rule = None
+        if source_codecs:
+            video = source_codecs[0]
+            rule = self.config.codec_actions.get(PROBED_VIDEO_CODECS.get(video, video))
+        if rule == "skip":
+            return "skip", None
+        if rule == "remux":
+            if self._copyable(source_codecs, is_webm):
+                return "remux", None
+            self.logger.info(
+                f"Cannot remux {source_codecs[0]}; "
+                f"encoding to {self.config.video_codec}"
+            )
+        elif rule and rule != "transcode":
+            return "encode", rule
+        elif not rule and self.can_remux(source_codecs, is_webm):
+            return "remux", None
+        return "encode", self.config.video_codec
+
+    def _builtin_video_filters(self):
+        """
+        Filters applied ahead of the user's video_filters.
+
+        Returns:
+            list: A downscale-only scale filter in "max" resolution mode,
+                otherwise nothing ("exact" mode scales with -s instead).
+        """
+        if not self.config.resolution or self.config.resolution_mode != "max":
+            return []
+        width, height = self.config.resolution
+        # Never upscale; shrink to fit inside the box, keeping the aspect ratio
+        return [
+            f"scale='min(iw,{width})':'min(ih,{height})'"
+            ":force_original_aspect_ratio=decrease"
+        ]
+
+    def _metadata_args(self, with_subtitles):
+        """
+        Explicit metadata mappings, so track titles and languages survive.
+
+        Args:
+            with_subtitles (bool): Whether subtitle streams are mapped (only
+                for single-file Matroska outputs).
+
+        Returns:
+            list: Container-level and per-stream -map_metadata options.
+        """
+        args = []
+        if self.config.preserve_metadata:
+            args += ["-map_metadata", "0"]
+        if self.config.preserve_stream_metadata:
+            stream_types = ("v", "a", "s") if with_subtitles else ("v", "a")
+            for stream_type in stream_types:
+                args += [f"-map_metadata:s:{stream_type}", f"0:s:{stream_type}"]
+        return args
+
+    def get_output_path(self, input_path, output_dir):
+        """
+        Get the output for a source: a file, or a directory of segments.
+
+        Args:
+            input_path (Path): The source video.
+            output_dir (Path): The directory outputs are written to.
+
+        Returns:
+            Path: <name>.<format>, or the <name> directory holding the
+                manifest and segments when segment_output is set.
+        """
+        if self.config.segment_output:
+            return output_dir / base_name(input_path)
+        return output_dir / f"{base_name(input_path)}.{self.config.format}"
+
+    def get_manifest_path(self, output_path):
+        """
+        Get the manifest inside a segmented output directory.
+
+        Args:
+            output_path (Path): The segment directory from get_output_path.
+
+        Returns:
+            Path: <dir>/<name>.m3u8 for HLS or <dir>/<name>.mpd for DASH.
+        """
+        suffix = SEGMENT_MANIFESTS[self.config.segment_output]
+        return output_path / f"{output_path.name}{suffix}"
+
+    def _segment_args(self, output_path):
+        """
+        Muxer options writing fragmented MP4 segments and their manifest.
+
+        Args:
+            output_path (Path): The segment directory from get_output_path.
+
+        Returns:
+            list: The muxer options, ending with the manifest path.
+        """
+        name = output_path.name
+        duration = f"{self.config.segment_duration:g}"
+        if self.config.segment_output == "hls":
+            args = [
+                "-f",
+                "hls",
+                "-hls_time",
+                duration,
+                "-hls_playlist_type",
+                "vod",
+                "-hls_segment_type",
+                "fmp4",
+                "-hls_fmp4_init_filename",
+                f"{name}_init.mp4",
+                "-hls_segment_filename",
+                str(output_path / f"{name}_%05d.m4s"),
+            ]
+        else:
+            args = [
+                "-f",
+                "dash",
+                "-seg_duration",
+                duration,
+                "-use_template",
+                "1",
+                "-use_timeline",
+                "1",
+                "-init_seg_name",
+                f"{name}_init_$RepresentationID$.m4s",
+                "-media_seg_name",
+                f"{name}_$RepresentationID$_$Number%05d$.m4s",
+            ]
+        return args + [str(self.get_manifest_path(output_path))]
+
+    def _is_webm(self, output_path):
+        """Whether the output is a single WebM file."""
+        return (
+            not self.config.segment_output
+            and normalized_extension(output_path) == ".webm"
+        )
+
+    def plan(self, input_path, output_dir):
+        """
+        Work out a conversion without writing anything.
+
+        The source is still probed, which only reads it, so the plan shows
+        its codecs and the real remux, encode or skip decision.
+
+        Args:
+            input_path (Path): The source video.
+            output_dir (Path): The directory outputs are written to.
+
+        Returns:
+            Plan: The output path, probed codecs, action and FFmpeg command
+                (None when skipped).
+        """
+        output_path = self.get_output_path(input_path, output_dir)
+        source_codecs = self.probe_codecs(input_path)
+        command = self.build_ffmpeg_args(input_path, output_path, source_codecs)
+        action, codec = self.choose_action(source_codecs, self._is_webm(output_path))
+        if codec == "copy":
+            action = "remux"
+        return Plan(input_path, output_path, source_codecs, action, command)
+
+    def build_ffmpeg_args(self, input_path, output_path, source_codecs=None):
+        """
+        Build the FFmpeg command for the configured codec and container.
+
+        VP9 and AV1 use constant-quality mode (CRF with no bitrate cap) and
+        encode far slower than H.264/H.265; expect hours per film on CPU.
+        When remux_when_compatible is set and the source already has the
+        target codecs, the streams are copied into the new container instead;
+        codec_actions can choose differently per source codec (see
+        choose_action).
+        A configured resolution is applied with -s in "exact" mode, or with a
+        scale filter that only ever downscales in "max" mode. With
+        segment_output, the first video track and the audio are written as
+        HLS or DASH segments with AAC audio; encodes force a keyframe at every
+        segment boundary so segments cut cleanly.
+
+        Args:
+            input_path (Path): The source video.
+            output_path (Path): The destination; its suffix selects the
+                container. With segment_output, the directory to segment into.
+            source_codecs (tuple): (video codec, audio codecs) from probe_codecs,
+                or None to always encode.
+
+        Returns:
+            list: The FFmpeg command, or None if codec_actions skips the source.
+
+        Raises:
+            ValueError: If the codec is unknown or not allowed in the container,
+                or a video filter is invalid (filters and scaling cannot be
+                combined with the copy codec).
+        """
+        video_filters = validate_filters(self.config.video_filters)
+        segmenting = bool(self.config.segment_output)
+        is_webm = self._is_webm(output_path)
+        # Only Matroska carries every subtitle format (SRT, ASS, PGS) and font
+        # attachments; MP4 rejects them, so it gets video and audio only
+        all_streams = not segmenting and normalized_extension(output_path) == ".mkv"
+        action, codec = self.choose_action(source_codecs, is_webm)
+        if action == "skip":
+            self.logger.info(f"Skipping {input_path}: its codec is set to skip")
+            return None
+        # A remux is still checked against the configured codec and container
+        codec = codec or self.config.video_codec
+
+        if codec != "copy" and codec not in VIDEO_ENCODERS:
+            raise ValueError(f"Unsupported video codec: {codec}")
+        if codec == "copy" and (video_filters or self.config.resolution):
+            raise ValueError(
+                "Video filters and scaling need re-encoding; not allowed with copy"
+            )
+        if is_webm and codec not in WEBM_VIDEO_CODECS:
+            raise ValueError(f"WebM output requires vp9 or av1, not {codec}")
+
+        args = ["ffmpeg", "-y", "-i", str(input_path)]
+        if segmenting:
+            # Players stream one video track; subtitles and attachments
+            # cannot be segmented
+            args += ["-map", "0:v:0", "-map", "0:a?"]
+        elif all_streams:
+            args += ["-map", "0"]
+        else:
+            args += ["-map", "0:v", "-map", "0:a?"]
+        args += self._metadata_args(all_streams)
+
+        if action == "remux":
+            self.logger.info(f"{input_path} already matches the target; remuxing")
+            if segmenting:
+                args += ["-c:v", "copy"] + SEGMENT_AUDIO_ARGS
+                return args + self._segment_args(output_path)
+            args += ["-c:v", "copy", "-c:a", "copy"]
+            if all_streams:
+                args += ["-c:s", "copy"]
+            args.append(str(output_path))
+            return args
+
+        if codec == "copy":
+            args += ["-c:v", "copy"]
+        else:
+            video_filter = compose_filters(self._builtin_video_filters(), video_filters)
+            if video_filter:
+                args += ["-vf", video_filter]
+            if self.config.resolution and self.config.resolution_mode == "exact":
+                width, height = self.config.resolution
+                args += ["-s", f"{width}x{height}"]
+            crf = str(VIDEO_CRF[codec][self.config.quality])
+            encoder = VIDEO_ENCODERS[codec]
+            if codec == "av1":
+                encoder = self.config.av1_encoder
+            args += ["-c:v", encoder, "-crf", crf]
+
+            if encoder in ("libvpx-vp9", "libaom-av1"):
+                # -b:v 0 selects pure constant-quality mode
+                args += ["-b:v", "0", "-row-mt", "1"]
+            if encoder == "libaom-av1":
+                args += ["-cpu-used", "6"]
+            elif encoder == "libsvtav1":
+                args += ["-preset", "8"]
+
+            if codec in WEBM_VIDEO_CODECS:
+                self.logger.info(
+                    f"{codec} encodes are slow; {input_path} may take a long time"
+                )
+            if segmenting:
+                duration = f"{self.config.segment_duration:g}"
+                args += ["-force_key_frames", f"expr:gte(t,n_forced*{duration})"]
+
+        if segmenting:
+            return args + SEGMENT_AUDIO_ARGS + self._segment_args(output_path)
+        if is_webm:
+            args += ["-c:a", "libopus", "-b:a", "128k"]
+        else:
+            args += ["-c:a", "copy"]
+        if all_streams:
+            args += ["-c:s", "copy"]
+
+        args.append(str(output_path))
+        return args
+
+    async def convert(self, input_path, output_dir, progress_callback=None):
         """
         Convert a video file to the desired format.
+
+        A single-file output is encoded beside its destination under a
+        temporary name and renamed into place once validate_output accepts
+        it, so a failed encode never leaves a partial file behind. With
+        segment_output, the output is a directory of segments named after
+        the source, replaced as a whole on each conversion and removed if
+        the conversion fails. An encode running past encode_timeout is
+        killed and fails the same way. In a dry run the conversion is only
+        planned (see plan) and nothing is written.
+
+        Args:
+            input_path (Path): The source video.
+            output_dir (Path): The directory outputs are written to.
+            progress_callback (callable): Receives the encode's (percent,
+                speed) updates; defaults to the converter's
+                progress_callback.
+
+        Returns:
+            Path: The output, or None if codec_actions skips the source.
+
+        Raises:
+            VideoConversionError: If FFmpeg fails, times out or the output
+                is unusable.
+            ValueError: If the settings rule out converting the source.
         """
-        output_file = output_dir / f"{input_path.stem}.mkv"
-        with open(output_file, "w") as f:
-            f.write("mock video content")
-        return output_file
+        if self.config.dry_run:
+            plan = await asyncio.to_thread(self.plan, input_path, output_dir)
+            self.logger.info(
+                f"Dry run: would {plan.action} {input_path} "
+                f"(source codecs {plan.source_codecs}) to {plan.output_path}"
+            )
+            return None if plan.action == "skip" else plan.output_path
+
+        output_path = self.get_output_path(input_path, output_dir)
+        source_codecs = await asyncio.to_thread(self.probe_codecs, input_path)
+        if self.config.segment_output:
+            target = output_path
+        else:
+            # Keeps the suffix, which selects the container
+            target = output_path.with_name(
+                f".{output_path.stem}.tmp{output_path.suffix}"
+            )
+        command = self.build_ffmpeg_args(input_path, target, source_codecs)
+        if command is None:
+            return None
+
+        if self.config.segment_output:
+            shutil.rmtree(output_path, ignore_errors=True)
+            output_path.mkdir(parents=True)
+        try:
+            await asyncio.wait_for(
+                self.run_ffmpeg(command, input_path, progress_callback),
+                timeout=self.encode_timeout,
+            )
+            await asyncio.to_thread(self.validate_output, target)
+        except subprocess.CalledProcessError as e:
+            self._discard(target)
+            raise VideoConversionError(
+                f"FFmpeg failed converting {input_path}: "
+                f"{_last_line(e.stderr) or f'exit code {e.returncode}'}"
+            ) from e
+        except asyncio.TimeoutError as e:
+            self._discard(target)
+            raise VideoConversionError(
+                f"Encode of {input_path} timed out after {self.encode_timeout}s"
+            ) from e
+        except BaseException:
+            self._discard(target)
+            raise
+        if target != output_path:
+            os.replace(target, output_path)
+        return output_path
+
+    def _discard(self, target):
+        """Remove a failed conversion's partial output."""
+        if self.config.segment_output:
+            shutil.rmtree(target, ignore_errors=True)
+        else:
+            try:
+                os.unlink(target)
+            except FileNotFoundError:
+                pass
+
+
+def _last_line(text):
+    """The last non-empty line of FFmpeg's output, where its error is."""
+    lines = [line.strip() for line in (text or "").splitlines() if line.strip()]
+    return lines[-1] if lines else ""
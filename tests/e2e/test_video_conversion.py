@@ -17,7 +17,8 @@ def video_converter():
 
 
 @pytest.mark.e2e
-def test_video_conversion_e2e(video_converter, tmp_path):
+@pytest.mark.asyncio
+async def test_video_conversion_e2e(video_converter, tmp_path):
     # Setup: Create a mock input video file
     input_file = tmp_path / "input.mp4"
     input_file.write_text("mock video content")
@@ -27,7 +28,7 @@ def test_video_conversion_e2e(video_converter, tmp_path):
     output_dir.mkdir()
 
     # Execute: Perform the video conversion
-    result = video_converter.convert(input_file, output_dir)
+    result = await video_converter.convert(input_file, output_dir)
 
     # Verify: Check if the output file exists and has the correct format
     assert result == output_dir / "input.mkv"
@@ -0,0 +1,78 @@
+from unittest.mock import MagicMock, patch
+
+import pytest
+
+from src.integrations.artwork import ArtworkError, ArtworkFetcher, artwork_url
+
+JPEG = b"\xff\xd8\xff\xe0" + b"\x00" * 32
+
+
+def _response(data: bytes, content_type: str = "image/jpeg") -> MagicMock:
+    response = MagicMock()
+    response.headers = {"Content-Type": content_type}
+    response.read.side_effect = lambda size=-1: data if size < 0 else data[:size]
+    response.__enter__.return_value = response
+    return response
+
+
+def test_artwork_url_prefers_cover_then_poster():
+    document = {
+        "images": [
+            {"coverType": "fanart", "remoteUrl": "http://img/fanart.jpg"},
+            {"coverType": "poster", "remoteUrl": "http://img/poster.jpg"},
+        ]
+    }
+
+    assert artwork_url(document) == "http://img/poster.jpg"
+    assert artwork_url({"images": []}) == ""
+    assert artwork_url(None) == ""
+
+
+def test_download_returns_image_bytes():
+    fetcher = ArtworkFetcher()
+
+    with patch("urllib.request.urlopen", return_value=_response(JPEG)):
+        assert fetcher.download("http://img/cover.jpg") == JPEG
+
+
+@pytest.mark.parametrize(
+    "data, content_type",
+    [
+        (b"<html>not found</html>", "text/html"),
+        (b"GIF89a" + b"\x00" * 16, "image/gif"),
+        (b"not an image", "image/jpeg"),
+    ],
+)
+def test_download_rejects_non_images(data: bytes, content_type: str):
+    fetcher = ArtworkFetcher()
+
+    with patch("urllib.request.urlopen", return_value=_response(data, content_type)):
+        with pytest.raises(ArtworkError):
+            fetcher.download("http://img/cover.jpg")
+
+
+def test_download_rejects_oversized_images():
+    fetcher = ArtworkFetcher(max_bytes=16)
+
+    with patch("urllib.request.urlopen", return_value=_response(JPEG)):
+        with pytest.raises(ArtworkError, match="larger than 16 bytes"):
+            fetcher.download("http://img/cover.jpg")
+
+
+def test_fetch_caches_per_key_including_failures():
+    fetcher = ArtworkFetcher()
+
+    with patch(
+        "urllib.request.urlopen", return_value=_response(JPEG)
+    ) as urlopen:
+        first = fetcher.fetch("http://img/1.jpg", key=("artist", "album"))
+        second = fetcher.fetch("http://img/2.jpg", key=("artist", "album"))
+
+    assert first == second == JPEG
+    assert urlopen.call_count == 1
+
+    with patch("urllib.request.urlopen", side_effect=OSError("down")) as urlopen:
+        assert fetcher.fetch("http://img/broken.jpg") is None
+        assert fetcher.fetch("http://img/broken.jpg") is None
+
+    assert urlopen.call_count == 1
@@ -4,10 +4,21 @@ Following TDD principles, these tests define the expected behavior
 of the AudioConverter before implementation.
 """
 
+import asyncio
+import os
 import pytest
+import time
 from pathlib import Path
 from unittest.mock import AsyncMock, patch
-from src.audio.converter import AudioConverter
+from src.audio.converter import (
+    AudioConverter,
+    AudioProperties,
+    StreamNotSeekableError,
+    find_sibling_artwork,
+    parse_ffmpeg_warnings,
+    tail_output,
+)
+from src.state.state import StateManager
 
 
 class TestAudioConverter:
@@ -69,6 +80,426 @@ class TestAudioConverter:
         comp_idx = command.index("-compression_level")
         assert command[comp_idx + 1] == "8"
 
+    def test_build_ffmpeg_command_with_bitrate(self):
+        """Test bitrate is applied to lossy outputs only."""
+        input_path = Path("/input/song.flac")
+
+        opus = AudioConverter(output_format="opus", bitrate="128k")
+        command = opus.build_ffmpeg_command(input_path, Path("/output/song.opus"))
+        assert command[command.index("-b:a") + 1] == "128k"
+
+        flac = AudioConverter(output_format="flac", bitrate="128k")
+        command = flac.build_ffmpeg_command(input_path, Path("/output/song.flac"))
+        assert "-b:a" not in command
+
+    @pytest.mark.parametrize(
+        "output_format,bitrate,expected",
+        [
+            ("flac", None, ["-c:a", "flac", "-compression_level", "5"]),
+            ("wav", "192k", ["-c:a", "pcm_s16le"]),
+            ("mp3", "192k", ["-c:a", "libmp3lame", "-b:a", "192k"]),
+            ("aac", "192k", ["-c:a", "aac", "-b:a", "192k"]),
+            ("ogg", "160k", ["-c:a", "libvorbis", "-b:a", "160k"]),
+            ("opus", "96k", ["-c:a", "libopus", "-b:a", "96k"]),
+        ],
+    )
+    def test_build_ffmpeg_command_encoder_for_each_format(
+        self, output_format: str, bitrate: str, expected: list
+    ):
+        """Test each output format gets its encoder and bitrate arguments."""
+        output_path = Path(f"/output/song.{output_format}")
+        converter = AudioConverter(output_format=output_format, bitrate=bitrate)
+
+        command = converter.build_ffmpeg_command(Path("/input/song.mp3"), output_path)
+
+        assert command[command.index("-c:a") :] == expected + [str(output_path)]
+
+    def test_build_ffmpeg_command_wav_bit_depth_selects_encoder(self):
+        """Test 24-bit WAV output uses the 24-bit PCM encoder."""
+        converter = AudioConverter(output_format="wav", bit_depth=24)
+
+        command = converter.build_ffmpeg_command(
+            Path("/input/song.flac"), Path("/output/song.wav")
+        )
+
+        assert command[command.index("-c:a") + 1] == "pcm_s24le"
+        assert "-sample_fmt" not in command
+
+    @pytest.mark.parametrize(
+        "sample_rate,expected", [(44100, "48000"), (24000, "24000")]
+    )
+    def test_build_ffmpeg_command_opus_sample_rate(
+        self, sample_rate: int, expected: str
+    ):
+        """Test opus output is only asked for sample rates libopus supports."""
+        converter = AudioConverter(output_format="opus", sample_rate=sample_rate)
+
+        command = converter.build_ffmpeg_command(
+            Path("/input/song.flac"), Path("/output/song.opus")
+        )
+
+        assert command[command.index("-ar") + 1] == expected
+
+    def test_build_ffmpeg_command_embeds_artwork(self):
+        """Test artwork is mapped as an attached picture where supported."""
+        input_path = Path("/input/song.mp3")
+        artwork = [(Path("/tmp/artwork.jpg"), "Cover (front)")]
+
+        command = AudioConverter(output_format="flac").build_ffmpeg_command(
+            input_path, Path("/output/song.flac"), artwork=artwork
+        )
+        assert command[command.index(str(input_path)) + 1 :][:2] == [
+            "-i",
+            "/tmp/artwork.jpg",
+        ]
+        assert command[command.index("-disposition:v") + 1] == "attached_pic"
+
+        command = AudioConverter(output_format="opus").build_ffmpeg_command(
+            input_path, Path("/output/song.opus"), artwork=artwork
+        )
+        assert "/tmp/artwork.jpg" not in command
+
+    def test_build_ffmpeg_command_maps_every_picture(self):
+        """Test several images are each mapped with their picture type."""
+        artwork = [
+            (Path("/album/cover.jpg"), "Cover (front)"),
+            (Path("/album/back.jpg"), "Cover (back)"),
+            (Path("/album/disc.png"), "Media"),
+        ]
+
+        command = AudioConverter(output_format="flac").build_ffmpeg_command(
+            Path("/album/song.flac"), Path("/output/song.flac"), artwork=artwork
+        )
+
+        maps = [command[i + 1] for i, arg in enumerate(command) if arg == "-map"]
+        assert maps == ["0:a", "1:v", "2:v", "3:v"]
+        assert command[command.index("-metadata:s:v:1") + 1] == "comment=Cover (back)"
+        assert command[command.index("-metadata:s:v:2") + 1] == "comment=Media"
+
+    def test_build_ffmpeg_command_keeps_all_source_pictures(self):
+        """Test every picture stream of the source is copied by default."""
+        command = AudioConverter(output_format="mp3").build_ffmpeg_command(
+            Path("/album/song.flac"), Path("/output/song.mp3")
+        )
+
+        maps = [command[i + 1] for i, arg in enumerate(command) if arg == "-map"]
+        assert maps == ["0:a", "0:v?"]
+        assert command[command.index("-c:v") + 1] == "copy"
+
+    def test_find_sibling_artwork(self, tmp_path: Path):
+        """Test sibling images are found with their picture types."""
+        for name in ("song.flac", "Back.JPG", "cover.jpg", "folder.jpg", "notes.txt"):
+            (tmp_path / name).write_bytes(b"\x00")
+
+        assert find_sibling_artwork(tmp_path / "song.flac") == [
+            (tmp_path / "cover.jpg", "Cover (front)"),
+            (tmp_path / "Back.JPG", "Cover (back)"),
+        ]
+
+    @pytest.mark.asyncio
+    async def test_convert_prefers_sibling_cover_over_fetched(self, tmp_path: Path):
+        """Test a sibling front cover wins over fetched artwork."""
+        converter = AudioConverter(output_format="flac", embed_sibling_artwork=True)
+        input_file = tmp_path / "song.mp3"
+        input_file.write_bytes(b"ID3" + b"\x00" * 100)
+        (tmp_path / "cover.jpg").write_bytes(b"\xff\xd8\xff" + b"\x00" * 16)
+        (tmp_path / "back.png").write_bytes(b"\x89PNG\r\n\x1a\n" + b"\x00" * 16)
+        commands = []
+
+        async def fake_ffmpeg(command):
+            commands.append(command)
+            Path(command[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+            return (0, "", "")
+
+        with patch.object(converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+            result = await converter.convert(
+                input_file, tmp_path / "out", artwork=b"\xff\xd8\xff" + b"\x01" * 16
+            )
+
+        assert result.success
+        inputs = [commands[0][i + 1] for i, a in enumerate(commands[0]) if a == "-i"]
+        assert inputs == [
+            str(input_file),
+            str(tmp_path / "cover.jpg"),
+            str(tmp_path / "back.png"),
+        ]
+
+    def test_build_ffmpeg_command_injects_chapters(self):
+        """Test a chapters file is input 1, ahead of pictures, and mapped."""
+        chapters = Path("/tmp/chapters.txt")
+        artwork = [(Path("/tmp/cover.jpg"), "Cover (front)")]
+
+        command = AudioConverter(output_format="mp3").build_ffmpeg_command(
+            Path("/input/talk.wav"),
+            Path("/output/talk.mp3"),
+            artwork=artwork,
+            chapters=chapters,
+        )
+        inputs = [command[i + 1] for i, arg in enumerate(command) if arg == "-i"]
+        assert inputs == ["/input/talk.wav", str(chapters), "/tmp/cover.jpg"]
+        assert command[command.index(str(chapters)) - 3 :][:2] == ["-f", "ffmetadata"]
+        maps = [command[i + 1] for i, arg in enumerate(command) if arg == "-map"]
+        assert maps == ["0:a", "2:v"]
+        assert command[command.index("-map_chapters") + 1] == "1"
+
+        command = AudioConverter(output_format="wav").build_ffmpeg_command(
+            Path("/input/talk.mp3"), Path("/output/talk.wav"), chapters=chapters
+        )
+        assert str(chapters) not in command
+        assert "-map_chapters" not in command
+
+    @pytest.mark.asyncio
+    async def test_convert_injects_sidecar_chapters(self, tmp_path: Path):
+        """Test a sibling <name>.chapters.json ends up in the encode."""
+        converter = AudioConverter(output_format="flac")
+        input_file = tmp_path / "episode.mp3"
+        input_file.write_bytes(b"ID3" + b"\x00" * 100)
+        (tmp_path / "episode.chapters.json").write_text(
+            '[{"start": 0, "title": "Intro"}, {"start": 90, "title": "News"}]'
+        )
+        chapter_files = []
+
+        async def fake_ffmpeg(command):
+            chapters = Path(command[command.index("ffmetadata") + 2])
+            chapter_files.append((chapters, chapters.read_text()))
+            Path(command[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+            return (0, "", "")
+
+        with patch.object(
+            converter, "_get_audio_duration", AsyncMock(return_value=300000.0)
+        ), patch.object(converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+            result = await converter.convert(input_file, tmp_path / "out")
+
+        assert result.success
+        ((chapters, text),) = chapter_files
+        assert "START=90000\nEND=300000\ntitle=News" in text
+        assert not chapters.exists()
+
+    @pytest.mark.asyncio
+    async def test_convert_ignores_chapters_beyond_duration(self, tmp_path: Path):
+        """Test chapters past the end of the audio are dropped, not encoded."""
+        converter = AudioConverter(output_format="flac")
+        input_file = tmp_path / "episode.mp3"
+        input_file.write_bytes(b"ID3" + b"\x00" * 100)
+        (tmp_path / "episode.chapters.json").write_text('[{"start": 400}]')
+        commands = []
+
+        async def fake_ffmpeg(command):
+            commands.append(command)
+            Path(command[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+            return (0, "", "")
+
+        with patch.object(
+            converter, "_get_audio_duration", AsyncMock(return_value=300000.0)
+        ), patch.object(converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+            result = await converter.convert(input_file, tmp_path / "out")
+
+        assert result.success
+        assert "-map_chapters" not in commands[0]
+
+    def test_build_ffmpeg_command_clamps_flac_bit_depth_to_source(self):
+        """Test a 16-bit source is not padded to a requested 24 bits."""
+        input_path = Path("/input/song.wav")
+        output_path = Path("/output/song.flac")
+
+        converter = AudioConverter(output_format="flac", bit_depth=24)
+        command = converter.build_ffmpeg_command(
+            input_path, output_path, source_bit_depth=16
+        )
+        assert command[command.index("-sample_fmt") + 1] == "s16"
+
+        forced = AudioConverter(
+            output_format="flac", bit_depth=24, force_bit_depth=True
+        )
+        command = forced.build_ffmpeg_command(
+            input_path, output_path, source_bit_depth=16
+        )
+        assert command[command.index("-sample_fmt") + 1] == "s24"
+
+        command = converter.build_ffmpeg_command(
+            input_path, output_path, source_bit_depth=24
+        )
+        assert command[command.index("-sample_fmt") + 1] == "s24"
+
+    def test_build_stream_command_uses_pipes(self):
+        """Test a streamed conversion names its muxers explicitly."""
+        converter = AudioConverter(output_format="aac")
+
+        command = converter.build_stream_command("opus")
+
+        assert command[2:6] == ["-f", "ogg", "-i", "pipe:0"]
+        assert command[-3:] == ["-f", "adts", "pipe:1"]
+
+    @staticmethod
+    def _fake_stream_ffmpeg(returncode: int = 0, stderr: bytes = b""):
+        """Stand-in for FFmpeg that "encodes" by copying stdin to stdout."""
+
+        async def create_subprocess_exec(*command, stdin, stdout, **kwargs):
+            assert command[command.index("-i") + 1] == "pipe:0"
+            assert command[-1] == "pipe:1"
+
+            class Process:
+                async def communicate(self):
+                    if returncode == 0:
+                        stdout.write(b"fLaC" + stdin.read())
+                    return (None, stderr)
+
+            Process.returncode = returncode
+            return Process()
+
+        return patch("asyncio.create_subprocess_exec", create_subprocess_exec)
+
+    @pytest.mark.asyncio
+    async def test_convert_stream_pipes_stdin_to_stdout(self, tmp_path: Path):
+        """Test stdin is fed to FFmpeg and its output reaches stdout."""
+        source = tmp_path / "in.wav"
+        source.write_bytes(b"RIFF" + b"\x00" * 64)
+        target = tmp_path / "out.flac"
+
+        with source.open("rb") as stdin, target.open("wb") as stdout:
+            with self._fake_stream_ffmpeg():
+                await AudioConverter(output_format="flac").convert_stream(
+                    stdin, stdout, "wav"
+                )
+
+        assert target.read_bytes() == b"fLaC" + source.read_bytes()
+
+    @pytest.mark.asyncio
+    async def test_convert_stream_reports_unseekable_input(self, tmp_path: Path):
+        """Test inputs needing seeks fail with a clear error."""
+        source = tmp_path / "in.bin"
+        source.write_bytes(b"\x00" * 64)
+        converter = AudioConverter(output_format="flac")
+
+        with source.open("rb") as stdin, (tmp_path / "out").open("wb") as stdout:
+            with self._fake_stream_ffmpeg(1, b"[mov,mp4] moov atom not found\n"):
+                with pytest.raises(StreamNotSeekableError, match="seekable"):
+                    await converter.convert_stream(stdin, stdout)
+            with pytest.raises(StreamNotSeekableError, match="m4a input"):
+                await converter.convert_stream(stdin, stdout, "m4a")
+
+    def test_build_ffmpeg_command_trims_silence_only_when_enabled(self):
+        """Test the silence trim chain runs ahead of user filters."""
+        input_path = Path("/input/song.flac")
+        output_path = Path("/output/song.flac")
+
+        command = AudioConverter(
+            audio_filters=["highpass=f=40"]
+        ).build_ffmpeg_command(input_path, output_path)
+        assert command[command.index("-af") + 1] == "highpass=f=40"
+        assert "-af" not in AudioConverter().build_ffmpeg_command(
+            input_path, output_path
+        )
+
+        command = AudioConverter(
+            trim_silence=True,
+            silence_threshold="-50dB",
+            silence_keep=1.0,
+            audio_filters=["highpass=f=40"],
+        ).build_ffmpeg_command(input_path, output_path)
+        trim = "silenceremove=start_periods=1:start_threshold=-50dB:start_silence=1.0"
+        assert command[command.index("-af") + 1] == ",".join(
+            [trim, "areverse", trim, "areverse", "highpass=f=40"]
+        )
+
+    def test_build_ffmpeg_command_normalizes_loudness_after_trim(self):
+        """Test loudnorm follows the trim chain and keeps the source rate."""
+        input_path = Path("/input/talk.mp3")
+        output_path = Path("/output/talk.flac")
+
+        command = AudioConverter(
+            trim_silence=True, loudness_target=-19, audio_filters=["highpass=f=40"]
+        ).build_ffmpeg_command(input_path, output_path, source_sample_rate=48000)
+        filters = command[command.index("-af") + 1].split(",")
+        assert filters[4:] == ["loudnorm=I=-19:TP=-1.5:LRA=11", "highpass=f=40"]
+        assert command[command.index("-ar") + 1] == "48000"
+
+        command = AudioConverter(
+            loudness_target=-23, sample_rate=44100
+        ).build_ffmpeg_command(input_path, output_path, source_sample_rate=48000)
+        assert command[command.index("-af") + 1] == "loudnorm=I=-23:TP=-1.5:LRA=11"
+        assert command[command.index("-ar") + 1] == "44100"
+
+    @pytest.mark.parametrize("target", [-80, 0, 3])
+    def test_out_of_range_loudness_target_rejected(self, target: float):
+        """Test loudness targets loudnorm would refuse fail at construction."""
+        with pytest.raises(ValueError, match="Loudness target"):
+            AudioConverter(loudness_target=target)
+
+    @pytest.mark.parametrize("threshold", ["loud", "-60dB;rm", ""])
+    def test_invalid_silence_threshold_rejected(self, threshold: str):
+        """Test malformed silence thresholds fail at construction."""
+        with pytest.raises(ValueError, match="Silence threshold"):
+            AudioConverter(trim_silence=True, silence_threshold=threshold)
+
+    def test_build_ffmpeg_command_caps_bitrate_at_lossy_source(self):
+        """Test a 128k source is not upscaled to a 320k target."""
+        input_path = Path("/input/song.mp3")
+        output_path = Path("/output/song.mp3")
+        capped = AudioConverter(
+            output_format="mp3", bitrate="320k", no_upscale_bitrate=True
+        )
+
+        command = capped.build_ffmpeg_command(
+            input_path, output_path, source_bitrate=128000
+        )
+        assert command[command.index("-b:a") + 1] == "128k"
+
+        command = capped.build_ffmpeg_command(
+            input_path, output_path, source_bitrate=384000
+        )
+        assert command[command.index("-b:a") + 1] == "320k"
+
+        uncapped = AudioConverter(output_format="mp3", bitrate="320k")
+        command = uncapped.build_ffmpeg_command(
+            input_path, output_path, source_bitrate=128000
+        )
+        assert command[command.index("-b:a") + 1] == "320k"
+
+    @pytest.mark.asyncio
+    async def test_convert_caps_bitrate_only_for_lossy_sources(self, tmp_path: Path):
+        """Test the probed source bitrate reaches the command for lossy input."""
+        converter = AudioConverter(
+            output_format="mp3", bitrate="320k", no_upscale_bitrate=True
+        )
+        commands = []
+
+        async def fake_ffmpeg(command):
+            commands.append(command)
+            Path(command[-1]).write_bytes(b"ID3" + b"\x00" * 64)
+            return (0, "", "")
+
+        for name, codec in (("lossy.mp3", "mp3"), ("lossless.flac", "flac")):
+            input_file = tmp_path / name
+            input_file.write_bytes(b"\x00" * 64)
+            probe = {
+                "streams": [
+                    {"codec_type": "audio", "codec_name": codec, "bit_rate": "128000"}
+                ]
+            }
+            with patch.object(
+                converter, "_execute_ffmpeg", side_effect=fake_ffmpeg
+            ), patch.object(converter, "_execute_ffprobe", return_value=probe):
+                await converter.convert(input_file, tmp_path / "out")
+
+        assert [c[c.index("-b:a") + 1] for c in commands] == ["128k", "320k"]
+
+    def test_build_ffmpeg_command_with_audio_filters(self):
+        """Test user audio filters are chained into one -af argument."""
+        converter = AudioConverter(audio_filters=["highpass=f=40", " volume=0.8 "])
+
+        command = converter.build_ffmpeg_command(
+            Path("/input/song.mp3"), Path("/output/song.flac")
+        )
+
+        assert command[command.index("-af") + 1] == "highpass=f=40,volume=0.8"
+        assert command.index("-af") < command.index("-c:a")
+
+    def test_invalid_audio_filter_rejected(self):
+        """Test filters with shell metacharacters are refused."""
+        with pytest.raises(ValueError):
+            AudioConverter(audio_filters=["volume=2; rm -rf /"])
+
     def test_build_ffmpeg_command_preserve_metadata(self, converter: AudioConverter):
         """Test FFmpeg command preserves metadata when requested."""
         input_path = Path("/input/song.mp3")
@@ -137,6 +568,45 @@ class TestAudioConverter:
         with pytest.raises(FileNotFoundError):
             converter.calculate_checksum(nonexistent)
 
+    @pytest.mark.parametrize(
+        "algorithm,expected",
+        [
+            (
+                "sha256",
+                "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+            ),
+            ("md5", "5eb63bbbe01eeed093cb22bb8f5acdc3"),
+            ("crc32", "0d4a1185"),
+        ],
+    )
+    def test_calculate_checksum_algorithms(
+        self, tmp_path: Path, algorithm: str, expected: str
+    ):
+        """Test each supported checksum algorithm."""
+        converter = AudioConverter(checksum_algorithm=algorithm)
+        file_path = tmp_path / "file.flac"
+        file_path.write_bytes(b"hello world")
+
+        assert converter.calculate_checksum(file_path) == expected
+
+    def test_unknown_checksum_algorithm_rejected(self):
+        """Test an unsupported checksum algorithm is rejected up front."""
+        with pytest.raises(ValueError, match="Checksum algorithm"):
+            AudioConverter(checksum_algorithm="sha1")
+
+    def test_write_checksum_sidecar(self, tmp_path: Path):
+        """Test the sidecar is named after the algorithm in md5sum layout."""
+        converter = AudioConverter(checksum_algorithm="md5", checksum_sidecar=True)
+        file_path = tmp_path / "song.flac"
+        file_path.write_bytes(b"hello world")
+
+        sidecar = converter.write_checksum_sidecar(
+            file_path, converter.calculate_checksum(file_path)
+        )
+
+        assert sidecar == tmp_path / "song.flac.md5"
+        assert sidecar.read_text() == "5eb63bbbe01eeed093cb22bb8f5acdc3  song.flac\n"
+
     # ============================================================================
     # Tests for atomic file operations
     # ============================================================================
@@ -240,31 +710,117 @@ class TestAudioConverter:
             assert result.error_message is not None
             assert "ffmpeg" in result.error_message.lower()
 
+    @pytest.mark.asyncio
+    async def test_convert_failure_keeps_tail_of_large_ffmpeg_output(
+        self, temp_audio_file: Path, tmp_path: Path
+    ):
+        """Test megabytes of FFmpeg output are cut to the tail in errors."""
+        converter = AudioConverter(error_output_limit=1024)
+        noise = "[mp3 @ 0x1] Header missing\n" * 100000
+        cause = "Error while opening encoder: invalid sample rate\n"
+
+        with patch.object(
+            converter, "_execute_ffmpeg", new_callable=AsyncMock
+        ) as mock_exec:
+            mock_exec.return_value = (1, "", noise + cause)
+            result = await converter.convert(temp_audio_file, tmp_path / "output")
+
+        assert result.success is False
+        assert "bytes truncated" in result.error_message
+        assert result.error_message.endswith(cause)
+        assert len(result.error_message) < 1200
+
+    def test_tail_output_without_limit_keeps_everything(self):
+        """Test a limit of None or 0 leaves the output untouched."""
+        output = "x" * 10000
+
+        assert tail_output(output, None) == output
+        assert tail_output(output, 0) == output
+        assert tail_output("short", 1024) == "short"
+
     @pytest.mark.asyncio
     async def test_convert_uses_atomic_operations(
         self, converter: AudioConverter, temp_audio_file: Path, tmp_path: Path
     ):
-        """Test conversion writes directly to output (atomic at filesystem level)."""
+        """Test FFmpeg writes a temp file that is renamed once validated."""
         output_dir = tmp_path / "output"
-        output_dir.mkdir()
+        output_file = converter.get_output_path(temp_audio_file, output_dir)
+        temp_file = converter.get_temp_path(output_file)
+        seen_during_encode = []
+
+        async def mock_execute(cmd):
+            seen_during_encode.append(output_file.exists())
+            Path(cmd[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+            return (0, "", "")
 
-        output_files_created = []
+        with patch.object(converter, "_execute_ffmpeg", side_effect=mock_execute):
+            result = await converter.convert(temp_audio_file, output_dir)
+
+        assert result.success is True
+        assert result.output_path == output_file
+        assert seen_during_encode == [False]
+        assert output_file.exists()
+        assert not temp_file.exists()
+
+    @pytest.mark.asyncio
+    async def test_convert_cancelled_leaves_no_partial_files(
+        self, converter: AudioConverter, temp_audio_file: Path, tmp_path: Path
+    ):
+        """Test a cancelled encode leaves neither the output nor its temp."""
+        output_dir = tmp_path / "output"
+        started = asyncio.Event()
+
+        async def mock_execute(cmd):
+            Path(cmd[-1]).write_bytes(b"fLaC")
+            started.set()
+            await asyncio.sleep(60)
+
+        with patch.object(converter, "_execute_ffmpeg", side_effect=mock_execute):
+            task = asyncio.create_task(converter.convert(temp_audio_file, output_dir))
+            await started.wait()
+            task.cancel()
+            with pytest.raises(asyncio.CancelledError):
+                await task
+
+        assert list(output_dir.iterdir()) == []
+
+    @pytest.mark.asyncio
+    async def test_convert_failed_validation_removes_temp(
+        self, converter: AudioConverter, temp_audio_file: Path, tmp_path: Path
+    ):
+        """Test an output failing validation is never renamed into place."""
+        output_dir = tmp_path / "output"
 
         async def mock_execute(cmd):
-            # Record which output file was used in command
-            # Current implementation writes directly to final output (not .tmp)
-            for i, arg in enumerate(cmd):
-                if str(output_dir) in str(arg) and not str(arg).endswith(".tmp"):
-                    output_files_created.append(arg)
+            Path(cmd[-1]).write_bytes(b"")
             return (0, "", "")
 
         with patch.object(converter, "_execute_ffmpeg", side_effect=mock_execute):
             result = await converter.convert(temp_audio_file, output_dir)
 
-            # Should have created output file directly
-            assert len(output_files_created) > 0 or result.success is False
-            # Final result should not be temp file
-            assert ".tmp" not in str(result.output_path)
+        assert result.success is False
+        assert list(output_dir.iterdir()) == []
+
+    @pytest.mark.asyncio
+    async def test_convert_missing_output_never_adopts_another_file(
+        self, converter: AudioConverter, temp_audio_file: Path, tmp_path: Path
+    ):
+        """Test a missing temp output fails rather than taking a newer file."""
+        output_dir = tmp_path / "output"
+        output_dir.mkdir()
+        other = output_dir / ".other.flac.tmp"
+
+        async def mock_execute(cmd):
+            # Another worker's encode lands while FFmpeg writes nothing
+            other.write_bytes(b"fLaC" + b"\x00" * 64)
+            return (0, "", "")
+
+        with patch.object(converter, "_execute_ffmpeg", side_effect=mock_execute):
+            result = await converter.convert(temp_audio_file, output_dir)
+
+        assert result.success is False
+        assert "output file not found" in result.error_message
+        assert list(output_dir.iterdir()) == [other]
 
     @pytest.mark.asyncio
     async def test_convert_calculates_checksum(
@@ -290,6 +846,60 @@ class TestAudioConverter:
             assert result.checksum is not None
             assert len(result.checksum) == 64
 
+    @pytest.mark.asyncio
+    async def test_convert_zero_byte_output_fails(
+        self, converter: AudioConverter, temp_audio_file: Path, tmp_path: Path
+    ):
+        """Test an empty output is a failed conversion even when FFmpeg exits 0."""
+        output_dir = tmp_path / "output"
+        output_file = converter.get_output_path(temp_audio_file, output_dir)
+
+        async def mock_execute(cmd):
+            Path(cmd[-1]).touch()
+            return (0, "", "")
+
+        with patch.object(converter, "_execute_ffmpeg", side_effect=mock_execute):
+            result = await converter.convert(temp_audio_file, output_dir)
+
+        assert result.success is False
+        assert "empty" in result.error_message.lower()
+        # The unusable output is cleaned up
+        assert list(output_dir.iterdir()) == []
+
+    @pytest.mark.asyncio
+    @pytest.mark.parametrize(
+        "verify_result,expected_success",
+        [((0, "", ""), True), ((0, "", "Invalid frame header"), False)],
+    )
+    async def test_convert_verify_decodable(
+        self,
+        temp_audio_file: Path,
+        tmp_path: Path,
+        verify_result: tuple,
+        expected_success: bool,
+    ):
+        """Test decode verification passes clean outputs and fails corrupt ones."""
+        converter = AudioConverter(output_format="flac", verify_decodable=True)
+        output_dir = tmp_path / "output"
+        output_file = converter.get_output_path(temp_audio_file, output_dir)
+        commands = []
+
+        async def mock_execute(cmd):
+            commands.append(cmd)
+            if cmd[-1] == "-":
+                return verify_result
+            Path(cmd[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+            return (0, "", "")
+
+        with patch.object(converter, "_execute_ffmpeg", side_effect=mock_execute):
+            result = await converter.convert(temp_audio_file, output_dir)
+
+        assert result.success is expected_success
+        temp_file = converter.get_temp_path(output_file)
+        assert commands[-1][-4:] == [str(temp_file), "-f", "null", "-"]
+        assert not temp_file.exists()
+        assert output_file.exists() is expected_success
+
     @pytest.mark.asyncio
     async def test_convert_preserves_quality(
         self, converter: AudioConverter, temp_audio_file: Path, tmp_path: Path
@@ -356,6 +966,27 @@ class TestAudioConverter:
 
         assert is_valid is True
 
+    @pytest.mark.parametrize(
+        "name, expected",
+        [
+            ("song.MP3", "song.flac"),
+            ("song.Mp3", "song.flac"),
+            ("song.mp3.mp3", "song.flac"),
+            ("Live.1999.mp3", "Live.1999.flac"),
+        ],
+    )
+    def test_mixed_case_and_doubled_extensions(
+        self, tmp_path: Path, name: str, expected: str
+    ):
+        """Test odd extensions are accepted and give a single-extension output."""
+        converter = AudioConverter(output_format="flac")
+        audio_file = tmp_path / name
+        audio_file.touch()
+
+        assert converter.validate_input_file(audio_file) is True
+        output = converter.get_output_path(audio_file, tmp_path / "output")
+        assert output.name == expected
+
     # ============================================================================
     # Tests for Story 1.3: Multi-Format Support
     # ============================================================================
@@ -414,6 +1045,60 @@ class TestAudioConverter:
             assert props.codec_name == "flac"
             assert props.is_lossless is True
 
+    @pytest.mark.asyncio
+    @pytest.mark.parametrize(
+        "codec_name, is_lossless, compression_level",
+        [("alac", True, 8), ("aac", False, 5)],
+    )
+    async def test_detect_audio_properties_m4a_codec(
+        self, tmp_path: Path, codec_name: str, is_lossless: bool, compression_level: int
+    ):
+        """Test ALAC and AAC in an m4a are told apart by the probed codec."""
+        converter = AudioConverter(compression_level=5)
+        audio_file = tmp_path / "test.m4a"
+        audio_file.write_bytes(b"\x00\x00\x00\x20ftypM4A " + b"\x00" * 100)
+        probe = {
+            "streams": [
+                {"codec_type": "audio", "codec_name": codec_name, "channels": 2}
+            ]
+        }
+
+        with patch.object(converter, "_execute_ffprobe", return_value=probe):
+            props = await converter.detect_audio_properties(audio_file)
+
+        assert props.is_lossless is is_lossless
+        assert converter._determine_optimal_compression(codec_name) == (
+            compression_level
+        )
+
+    @pytest.mark.asyncio
+    async def test_convert_aiff_to_flac_uses_max_compression(self, tmp_path: Path):
+        """Test AIFF input is accepted and compressed as a lossless source."""
+        converter = AudioConverter(output_format="flac", compression_level=5)
+        input_file = tmp_path / "song.aiff"
+        input_file.write_bytes(b"FORM\x00\x00\x10\x00AIFFCOMM" + b"\x00" * 64)
+        probe = {
+            "streams": [
+                {"codec_type": "audio", "codec_name": "pcm_s16be", "channels": 2}
+            ]
+        }
+        commands = []
+
+        async def fake_ffmpeg(command):
+            commands.append(command)
+            Path(command[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+            return (0, "", "")
+
+        assert converter.validate_input_file(input_file)
+        with patch.object(
+            converter, "_execute_ffmpeg", side_effect=fake_ffmpeg
+        ), patch.object(converter, "_execute_ffprobe", return_value=probe):
+            result = await converter.convert(input_file, tmp_path / "out")
+
+        assert result.success
+        assert result.output_path == tmp_path / "out" / "song.flac"
+        assert commands[0][commands[0].index("-compression_level") + 1] == "8"
+
     def test_determine_compression_level_lossy_source(self):
         """Test compression level selection for lossy source (MP3, AAC, OGG)."""
         converter = AudioConverter(compression_level=5)
@@ -436,6 +1121,15 @@ class TestAudioConverter:
         level = converter._determine_optimal_compression("wav")
         assert level == 8
 
+    def test_compression_level_for_follows_adaptive_setting(self):
+        """The public level lookup matches what conversions use."""
+        adaptive = AudioConverter(compression_level=5)
+        fixed = AudioConverter(compression_level=5, adaptive_compression=False)
+
+        assert adaptive.compression_level_for("flac") == 8
+        assert adaptive.compression_level_for("mp3") == 5
+        assert fixed.compression_level_for("flac") == 5
+
     def test_build_ffmpeg_command_preserves_sample_rate(self):
         """Test FFmpeg command preserves sample rate from source."""
         # When sample_rate is None, should preserve original
@@ -603,3 +1297,475 @@ class TestAudioConverter:
         level = converter._determine_optimal_compression(input_format)
 
         assert level == expected_compression
+
+    @pytest.mark.parametrize(
+        "codec_name,expected_compression",
+        [("alac", 8), ("pcm_s24le", 8), ("flac", 8), ("aac", 5), ("mp3", 5)],
+    )
+    def test_adaptive_compression_by_probed_codec(
+        self, tmp_path: Path, codec_name: str, expected_compression: int
+    ):
+        """Test the probed codec decides, e.g. ALAC vs AAC inside an M4A."""
+        converter = AudioConverter(compression_level=5)
+        props = AudioProperties(
+            sample_rate=44100,
+            codec_name=codec_name,
+            is_lossless=converter.is_lossless_codec(codec_name),
+        )
+
+        level = converter._source_compression_level(tmp_path / "song.m4a", props)
+
+        assert level == expected_compression
+
+    @pytest.mark.parametrize(
+        "header,expected_compression",
+        [
+            (b"RIFF\x00\x00\x00\x00WAVEfmt ", 8),
+            (b"fLaC\x00\x00\x00\x22", 8),
+            (b"FORM\x00\x00\x00\x00AIFFCOMM", 8),
+            (b"\x00\x00\x00\x20ftypM4A ", 5),  # ALAC or AAC: assume lossy
+            (b"ID3\x04\x00", 5),
+            (b"not audio at all", 5),
+        ],
+    )
+    def test_adaptive_compression_detects_unprobed_source(
+        self, tmp_path: Path, header: bytes, expected_compression: int
+    ):
+        """Test the container is detected from content when the probe fails."""
+        converter = AudioConverter(compression_level=5)
+        source = tmp_path / "source"
+        source.write_bytes(header + b"\x00" * 64)
+
+        assert converter._source_compression_level(source, None) == (
+            expected_compression
+        )
+
+    @pytest.mark.parametrize("codec_name", ["flac", "pcm_s16le", "mp3"])
+    def test_adaptive_compression_disabled(self, tmp_path: Path, codec_name: str):
+        """Test every source uses compression_level without adaptation."""
+        converter = AudioConverter(compression_level=3, adaptive_compression=False)
+        props = AudioProperties(
+            sample_rate=44100, codec_name=codec_name, is_lossless=True
+        )
+
+        assert converter._source_compression_level(tmp_path / "x", props) == 3
+
+    @pytest.mark.asyncio
+    async def test_convert_uses_adaptive_compression_level(self, tmp_path: Path):
+        """Test the chosen level reaches FFmpeg's -compression_level."""
+        converter = AudioConverter(output_format="flac", compression_level=5)
+        input_file = tmp_path / "take.wav"
+        input_file.write_bytes(b"RIFF\x00\x00\x00\x00WAVEfmt " + b"\x00" * 64)
+        commands = []
+
+        async def fake_ffmpeg(command):
+            commands.append(command)
+            Path(command[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+            return (0, "", "")
+
+        with patch.object(
+            converter, "detect_audio_properties", return_value=None
+        ), patch.object(converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+            result = await converter.convert(input_file, tmp_path / "out")
+
+        assert result.success is True
+        assert result.compression_level == 8
+        assert commands[0][commands[0].index("-compression_level") + 1] == "8"
+
+    # ============================================================================
+    # Tests for DSD (DSF/DFF) input
+    # ============================================================================
+
+    @pytest.mark.parametrize("extension", [".dsf", ".dff"])
+    def test_validate_dsd_input(self, tmp_path: Path, extension: str):
+        """Test DSD containers are accepted as input."""
+        converter = AudioConverter()
+        audio_file = tmp_path / f"audio{extension}"
+        audio_file.touch()
+
+        assert converter.validate_input_file(audio_file) is True
+
+    @pytest.mark.parametrize("output_format", ["dsf", "dff"])
+    def test_dsd_output_format_rejected(self, output_format: str):
+        """Test DSD containers cannot be used as an output format."""
+        with pytest.raises(ValueError):
+            AudioConverter(output_format=output_format)
+
+    @pytest.mark.parametrize(
+        "source_sample_rate,expected_rate",
+        [
+            (None, "88200"),  # Unknown rate: assume DSD64
+            (2822400, "88200"),  # DSD64 raw rate
+            (352800, "88200"),  # DSD64 as reported by FFmpeg's decoder
+            (5644800, "176400"),  # DSD128
+            (11289600, "176400"),  # DSD256 capped at 176.4kHz
+        ],
+    )
+    def test_build_ffmpeg_command_dsf_to_flac(
+        self, source_sample_rate, expected_rate: str
+    ):
+        """Test DSD input is decoded to high-res PCM FLAC."""
+        converter = AudioConverter(output_format="flac")
+        input_path = Path("/input/song.dsf")
+        output_path = Path("/output/song.flac")
+
+        command = converter.build_ffmpeg_command(
+            input_path, output_path, source_sample_rate=source_sample_rate
+        )
+
+        assert command[command.index("-c:a") + 1] == "flac"
+        assert command[command.index("-ar") + 1] == expected_rate
+        assert command[command.index("-sample_fmt") + 1] == "s32"
+
+    def test_build_ffmpeg_command_dsd_explicit_sample_rate(self):
+        """Test an explicit sample rate overrides the DSD default."""
+        converter = AudioConverter(output_format="flac", sample_rate=96000)
+
+        command = converter.build_ffmpeg_command(
+            Path("/input/song.dff"), Path("/output/song.flac")
+        )
+
+        assert command.count("-ar") == 1
+        assert command[command.index("-ar") + 1] == "96000"
+
+    def test_build_ffmpeg_command_non_dsd_has_no_resample(self):
+        """Test non-DSD input keeps its original sample rate."""
+        converter = AudioConverter(output_format="flac")
+
+        command = converter.build_ffmpeg_command(
+            Path("/input/song.mp3"), Path("/output/song.flac")
+        )
+
+        assert "-ar" not in command
+        assert "-sample_fmt" not in command
+
+    def test_dsd_source_uses_max_compression(self):
+        """Test DSD sources are treated as lossless for adaptive compression."""
+        converter = AudioConverter(compression_level=5)
+
+        assert converter._determine_optimal_compression("dsd_lsbf_planar") == 8
+
+    @pytest.mark.asyncio
+    async def test_plan_conversion_reports_target_spec(self, tmp_path: Path):
+        """Test a lossy plan uses the configured bitrate for its size estimate."""
+        converter = AudioConverter(output_format="opus", bitrate="128k")
+        audio_file = tmp_path / "song.mp3"
+        audio_file.write_bytes(b"ID3" + b"\x00" * 100)
+
+        with patch.object(converter, "_execute_ffprobe") as mock_ffprobe, patch.object(
+            converter, "_get_audio_duration", new_callable=AsyncMock
+        ) as mock_duration:
+            mock_ffprobe.return_value = {
+                "streams": [
+                    {
+                        "codec_type": "audio",
+                        "codec_name": "mp3",
+                        "sample_rate": "48000",
+                        "channels": 2,
+                    }
+                ]
+            }
+            mock_duration.return_value = 60000.0
+
+            plan = await converter.plan_conversion(audio_file, tmp_path / "out")
+
+        assert plan.codec == "libopus"
+        assert plan.bitrate == 128000
+        assert plan.sample_rate == 48000
+        assert plan.output_path == tmp_path / "out" / "song.opus"
+        assert plan.estimated_size_bytes == 960000
+        assert not (tmp_path / "out").exists()
+
+    @pytest.mark.asyncio
+    async def test_plan_conversion_estimates_flac_from_pcm_rate(self, tmp_path: Path):
+        """Test a FLAC plan estimates size as a fraction of the PCM bitrate."""
+        converter = AudioConverter(output_format="flac")
+        audio_file = tmp_path / "song.wav"
+
+        with patch.object(converter, "_execute_ffprobe") as mock_ffprobe, patch.object(
+            converter, "_get_audio_duration", new_callable=AsyncMock
+        ) as mock_duration:
+            mock_ffprobe.return_value = {
+                "streams": [
+                    {
+                        "codec_type": "audio",
+                        "codec_name": "pcm_s16le",
+                        "sample_rate": "44100",
+                        "channels": 2,
+                    }
+                ]
+            }
+            mock_duration.return_value = 10000.0
+
+            plan = await converter.plan_conversion(audio_file, tmp_path)
+
+        assert plan.codec == "flac"
+        assert plan.bitrate == int(44100 * 2 * 16 * AudioConverter.FLAC_SIZE_RATIO)
+        assert plan.estimated_size_bytes == int(plan.bitrate * 10 / 8)
+
+    def test_build_ffmpeg_command_emits_metadata_tags(self):
+        """Test combined track/disc tags are written to the output."""
+        converter = AudioConverter(output_format="flac")
+
+        command = converter.build_ffmpeg_command(
+            Path("/input/song.mp3"),
+            Path("/output/song.flac"),
+            metadata_tags={"track": "3/12", "disc": "1/2"},
+        )
+
+        assert command[command.index("-map_metadata") + 1] == "0"
+        assert "track=3/12" in command
+        assert command[command.index("track=3/12") - 1] == "-metadata"
+        assert "disc=1/2" in command
+
+    @pytest.mark.asyncio
+    async def test_encode_timeout_fails_conversion(self, tmp_path: Path):
+        """Test a hung encode is cut off with an encode timeout error."""
+        converter = AudioConverter(encode_timeout=0.05)
+        input_file = tmp_path / "song.mp3"
+        input_file.write_bytes(b"ID3" + b"\x00" * 100)
+
+        async def slow_ffmpeg(command):
+            Path(command[-1]).write_bytes(b"partial")
+            await asyncio.sleep(5)
+            return (0, "", "")
+
+        with patch.object(converter, "_execute_ffmpeg", side_effect=slow_ffmpeg):
+            result = await converter.convert(input_file, tmp_path / "out")
+
+        assert result.success is False
+        assert result.error_message == "Encode timed out after 0.05s"
+        assert not (tmp_path / "out" / "song.flac").exists()
+
+    @pytest.mark.asyncio
+    async def test_long_encode_logs_keepalive_lines(self):
+        """Test a long encode logs its elapsed time while it runs."""
+        converter = AudioConverter(keepalive_interval=0.02)
+
+        async def slow_ffmpeg(command):
+            await asyncio.sleep(0.15)
+            return (0, "", "")
+
+        with patch.object(
+            converter, "_execute_ffmpeg", side_effect=slow_ffmpeg
+        ), patch.object(converter, "logger") as logger:
+            await converter._execute_encode(["ffmpeg", "-i", "in", "out.flac"])
+            logged_during_encode = logger.info.call_count
+            await asyncio.sleep(0.05)
+
+        keepalives = [
+            c.kwargs
+            for c in logger.info.call_args_list
+            if c.args == ("encode_in_progress",)
+        ]
+        assert len(keepalives) >= 3
+        assert keepalives[0]["output_file"] == "out.flac"
+        elapsed = [k["elapsed_s"] for k in keepalives]
+        assert elapsed == sorted(elapsed)
+        # Keepalives stop with the encode
+        assert logger.info.call_count == logged_during_encode
+
+    @pytest.mark.asyncio
+    async def test_convert_onto_input_uses_temp_and_rename(self, tmp_path: Path):
+        """Test a same-path conversion never writes to the file being read."""
+        converter = AudioConverter(output_format="flac")
+        input_file = tmp_path / "song.flac"
+        input_file.write_bytes(b"fLaC" + b"original" * 16)
+        commands = []
+
+        async def fake_ffmpeg(command):
+            commands.append(command)
+            assert Path(command[-1]) != input_file
+            Path(command[-1]).write_bytes(b"fLaC" + b"reencoded" * 16)
+            return (0, "", "")
+
+        with patch.object(converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+            result = await converter.convert(input_file, tmp_path)
+
+        assert result.success is True
+        assert result.output_path == input_file
+        assert input_file.read_bytes() == b"fLaC" + b"reencoded" * 16
+        assert sorted(p.name for p in tmp_path.iterdir()) == ["song.flac"]
+
+    @pytest.mark.asyncio
+    async def test_failed_same_path_conversion_keeps_input(self, tmp_path: Path):
+        """Test a failed in-place encode leaves the source untouched."""
+        converter = AudioConverter(output_format="flac")
+        input_file = tmp_path / "song.flac"
+        original = b"fLaC" + b"original" * 16
+        input_file.write_bytes(original)
+
+        async def failing_ffmpeg(command):
+            Path(command[-1]).write_bytes(b"partial")
+            return (1, "", "encoder error")
+
+        with patch.object(converter, "_execute_ffmpeg", side_effect=failing_ffmpeg):
+            result = await converter.convert(input_file, tmp_path)
+
+        assert result.success is False
+        assert input_file.read_bytes() == original
+        assert sorted(p.name for p in tmp_path.iterdir()) == ["song.flac"]
+
+    @pytest.mark.asyncio
+    @pytest.mark.parametrize("decodes", [True, False])
+    async def test_same_path_conversion_replaces_only_verified_output(
+        self, tmp_path: Path, decodes: bool
+    ):
+        """Test an in-place encode replaces the input only once it decodes."""
+        converter = AudioConverter(output_format="flac", verify_decodable=True)
+        input_file = tmp_path / "song.flac"
+        original = b"fLaC" + b"original" * 16
+        reencoded = b"fLaC" + b"reencoded" * 16
+        input_file.write_bytes(original)
+        verified = []
+
+        async def fake_ffmpeg(command):
+            if command[-1] == "-":
+                verified.append(Path(command[-4]))
+                return (0, "", "") if decodes else (0, "", "Invalid frame header")
+            Path(command[-1]).write_bytes(reencoded)
+            return (0, "", "")
+
+        with patch.object(converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+            result = await converter.convert(input_file, tmp_path)
+
+        assert verified and verified[0] != input_file
+        assert result.success is decodes
+        assert input_file.read_bytes() == (reencoded if decodes else original)
+        assert sorted(p.name for p in tmp_path.iterdir()) == ["song.flac"]
+        if decodes:
+            assert result.checksum == converter.calculate_checksum(input_file)
+
+    @pytest.mark.asyncio
+    async def test_convert_skips_output_recorded_in_state(self, tmp_path: Path):
+        """Test an intact recorded output is skipped without running FFmpeg."""
+        state = StateManager(tmp_path / "state")
+        converter = AudioConverter(output_format="flac", state_manager=state)
+        input_file = tmp_path / "song.mp3"
+        input_file.write_bytes(b"ID3" + b"\x00" * 100)
+        output_dir = tmp_path / "out"
+        commands = []
+
+        async def fake_ffmpeg(command):
+            commands.append(command)
+            Path(command[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+            return (0, "", "")
+
+        with patch.object(converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+            first = await converter.convert(input_file, output_dir)
+            encodes = len(commands)
+            start = time.monotonic()
+            second = await converter.convert(input_file, output_dir)
+            elapsed = time.monotonic() - start
+
+        assert first.success and not first.skipped and not first.reprocessed
+        assert state.get(first.output_path).checksum == first.checksum
+        assert second.success is True
+        assert (second.skipped, second.skip_reason) == (True, "already_converted")
+        assert second.checksum == first.checksum
+        assert len(commands) == encodes
+        assert elapsed < 0.5
+
+    @pytest.mark.asyncio
+    @pytest.mark.parametrize("change", ["output_edited", "output_removed", "newer"])
+    async def test_convert_reprocesses_stale_recorded_output(
+        self, tmp_path: Path, change: str
+    ):
+        """Test a recorded output that no longer holds up is converted again."""
+        state = StateManager(tmp_path / "state")
+        converter = AudioConverter(output_format="flac", state_manager=state)
+        input_file = tmp_path / "song.mp3"
+        input_file.write_bytes(b"ID3" + b"\x00" * 100)
+        output_dir = tmp_path / "out"
+
+        async def fake_ffmpeg(command):
+            Path(command[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+            return (0, "", "")
+
+        with patch.object(converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+            first = await converter.convert(input_file, output_dir)
+            if change == "output_edited":
+                first.output_path.write_bytes(b"fLaC tampered")
+            elif change == "output_removed":
+                first.output_path.unlink()
+            else:
+                mtime = first.output_path.stat().st_mtime
+                os.utime(input_file, (mtime + 10, mtime + 10))
+            second = await converter.convert(input_file, output_dir)
+
+        assert second.success is True
+        assert (second.skipped, second.reprocessed) == (False, True)
+        assert state.verify(second.output_path)
+        backup = output_dir / "song.flac.bak"
+        assert backup.exists() is (change == "output_edited")
+
+    @pytest.mark.asyncio
+    async def test_convert_backs_up_mismatched_output(self, tmp_path: Path):
+        """Test an output edited since conversion is kept as .bak and redone."""
+        state = StateManager(tmp_path / "state")
+        converter = AudioConverter(output_format="flac", state_manager=state)
+        input_file = tmp_path / "song.mp3"
+        input_file.write_bytes(b"ID3" + b"\x00" * 100)
+        output_dir = tmp_path / "out"
+        encodes = []
+
+        async def fake_ffmpeg(command):
+            encodes.append(command)
+            Path(command[-1]).write_bytes(b"fLaC" + bytes([len(encodes)]) * 64)
+            return (0, "", "")
+
+        with patch.object(converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+            first = await converter.convert(input_file, output_dir)
+            first.output_path.write_bytes(b"fLaC edited by hand")
+            (output_dir / "song.flac.bak").write_bytes(b"older backup")
+            second = await converter.convert(input_file, output_dir)
+
+        assert (second.skipped, second.reprocessed) == (False, True)
+        assert (output_dir / "song.flac.bak").read_bytes() == b"fLaC edited by hand"
+        assert second.checksum != first.checksum
+        assert state.get(second.output_path).checksum == second.checksum
+        assert state.verify(second.output_path)
+
+    def test_parse_ffmpeg_warnings(self):
+        """Test notable warnings are picked out of successful FFmpeg output."""
+        stderr = (
+            "ffmpeg version 6.1 Copyright (c) 2000-2023 the FFmpeg developers\n"
+            "Input #0, mp3, from 'song.mp3':\n"
+            "  Duration: 00:03:20.00, start: 0.025057, bitrate: 320 kb/s\n"
+            "[mp3float @ 0x55d] Header missing\n"
+            "size=    1024kB time=00:00:10.00 bitrate= 838.9kbits/s speed=20x\r"
+            "[flac @ 0x55e] Application provided invalid, non monotonically "
+            "increasing dts to muxer in stream 0: 512 >= 512\n"
+            "[mp3float @ 0x55d] Header missing\n"
+            "1 frame duplicated\n"
+            "size=    4096kB time=00:03:20.00 bitrate= 167.8kbits/s speed=25x\n"
+        )
+
+        assert parse_ffmpeg_warnings(stderr) == [
+            "[mp3float @ 0x55d] Header missing",
+            "[flac @ 0x55e] Application provided invalid, non monotonically "
+            "increasing dts to muxer in stream 0: 512 >= 512",
+            "1 frame duplicated",
+        ]
+        assert parse_ffmpeg_warnings("") == []
+
+    @pytest.mark.asyncio
+    async def test_ffmpeg_warnings_logged_on_success(self, tmp_path: Path):
+        """Test warnings from a successful encode are logged when enabled."""
+        converter = AudioConverter(output_format="flac", log_ffmpeg_warnings=True)
+        input_file = tmp_path / "song.mp3"
+        input_file.write_bytes(b"ID3\x04" + b"\x00" * 100)
+
+        async def noisy_ffmpeg(command):
+            Path(command[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+            return (0, "", "Non-monotonic DTS in output stream 0:0\n")
+
+        with patch.object(
+            converter, "_execute_ffmpeg", side_effect=noisy_ffmpeg
+        ), patch.object(converter, "logger") as logger:
+            result = await converter.convert(input_file, tmp_path / "out")
+
+        assert result.success is True
+        logger.bind.return_value.warning.assert_any_call(
+            "ffmpeg_warnings", warnings=["Non-monotonic DTS in output stream 0:0"]
+        )
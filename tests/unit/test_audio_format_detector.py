@@ -36,6 +36,16 @@ class TestAudioFormatDetector:
 
         assert format_result == AudioFormat.MP3
 
+    @pytest.mark.parametrize("name", ["song.MP3", "song.Mp3", "song.mp3.mp3"])
+    def test_detect_ignores_extension_case_and_repeats(
+        self, detector: AudioFormatDetector, tmp_path: Path, name: str
+    ):
+        """Test detection by content is unaffected by odd extensions."""
+        mp3_file = tmp_path / name
+        mp3_file.write_bytes(b"ID3\x04\x00\x00\x00\x00\x00\x00")
+
+        assert detector.detect_from_content(mp3_file) == AudioFormat.MP3
+
     def test_detect_mp3_from_mpeg_sync(
         self, detector: AudioFormatDetector, tmp_path: Path
     ):
@@ -84,6 +94,28 @@ class TestAudioFormatDetector:
 
         assert format_result == AudioFormat.WAV
 
+    def test_avi_riff_not_detected_as_wav(
+        self, detector: AudioFormatDetector, tmp_path: Path
+    ):
+        """Test a RIFF AVI container is not mistaken for WAV."""
+        avi_file = tmp_path / "movie.wav"
+        avi_file.write_bytes(b"RIFF\x00\x10\x00\x00AVI LIST\x00\x00\x00\x00hdrlavih")
+
+        with pytest.raises(UnsupportedAudioFormatError):
+            detector.detect_from_content(avi_file)
+
+    @pytest.mark.parametrize("form_type", [b"AIFF", b"AIFC"])
+    def test_detect_aiff_from_magic_number(
+        self, detector: AudioFormatDetector, tmp_path: Path, form_type: bytes
+    ):
+        """Test AIFF (and compressed AIFC) detection from the IFF form type."""
+        aiff_file = tmp_path / "test.aiff"
+        aiff_file.write_bytes(b"FORM\x00\x00\x10\x00" + form_type + b"COMM")
+
+        format_result = detector.detect_from_content(aiff_file)
+
+        assert format_result == AudioFormat.AIFF
+
     def test_detect_m4a_from_magic_number(
         self, detector: AudioFormatDetector, tmp_path: Path
     ):
@@ -132,6 +164,30 @@ class TestAudioFormatDetector:
 
         assert "unsupported" in str(exc_info.value).lower()
 
+    def test_detect_dsf_from_magic_number(
+        self, detector: AudioFormatDetector, tmp_path: Path
+    ):
+        """Test DSF detection from DSD chunk header."""
+        dsf_file = tmp_path / "test.dsf"
+        dsf_file.write_bytes(b"DSD \x1c\x00\x00\x00\x00\x00\x00\x00" + b"\x00" * 16)
+
+        format_result = detector.detect_from_content(dsf_file)
+
+        assert format_result == AudioFormat.DSF
+
+    def test_detect_dff_from_magic_number(
+        self, detector: AudioFormatDetector, tmp_path: Path
+    ):
+        """Test DFF detection from FRM8 chunk with DSD form type."""
+        dff_file = tmp_path / "test.dff"
+        dff_file.write_bytes(
+            b"FRM8" + b"\x00\x00\x00\x00\x00\x00\x10\x00" + b"DSD " + b"\x00" * 16
+        )
+
+        format_result = detector.detect_from_content(dff_file)
+
+        assert format_result == AudioFormat.DFF
+
     def test_corrupted_file_error(self, detector: AudioFormatDetector, tmp_path: Path):
         """Test error raised for corrupted file."""
         corrupted_file = tmp_path / "test.mp3"
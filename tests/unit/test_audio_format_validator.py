@@ -0,0 +1,143 @@
+"""Unit tests for audio format validation module."""
+
+import struct
+import pytest
+from pathlib import Path
+from unittest.mock import AsyncMock, patch
+from src.audio.format_detector import AudioFormat
+from src.audio.format_validator import (
+    AudioFormatValidator,
+    IncompleteAudioFileError,
+    InvalidAudioFileError,
+)
+
+
+def _wav(data_size: int, declared_size: int) -> bytes:
+    """Build a WAV file with data_size bytes of PCM but any RIFF size."""
+    fmt = struct.pack("<HHIIHH", 1, 2, 44100, 176400, 4, 16)
+    return (
+        b"RIFF"
+        + struct.pack("<I", declared_size)
+        + b"WAVEfmt "
+        + struct.pack("<I", len(fmt))
+        + fmt
+        + b"data"
+        + struct.pack("<I", data_size)
+        + b"\x00" * data_size
+    )
+
+
+class TestAudioFormatValidator:
+    """Test suite for AudioFormatValidator class."""
+
+    @pytest.fixture
+    def validator(self):
+        """Create AudioFormatValidator instance."""
+        return AudioFormatValidator()
+
+    @pytest.fixture
+    def ffprobe(self, validator: AudioFormatValidator):
+        """Patch FFprobe to report an audio stream."""
+        with patch.object(
+            validator.detector,
+            "validate_with_ffprobe",
+            new=AsyncMock(return_value=True),
+        ) as mock_probe:
+            yield mock_probe
+
+    @pytest.mark.asyncio
+    async def test_valid_ogg(
+        self, validator: AudioFormatValidator, ffprobe: AsyncMock, tmp_path: Path
+    ):
+        """Test a valid OGG file passes."""
+        ogg_file = tmp_path / "test.ogg"
+        ogg_file.write_bytes(b"OggS\x00\x02" + b"\x00" * 64)
+
+        assert await validator.validate_file(ogg_file) == AudioFormat.OGG
+        ffprobe.assert_awaited_once_with(ogg_file)
+
+    @pytest.mark.asyncio
+    async def test_complete_wav(
+        self, validator: AudioFormatValidator, ffprobe: AsyncMock, tmp_path: Path
+    ):
+        """Test a WAV file whose RIFF size matches its length passes."""
+        wav_file = tmp_path / "test.wav"
+        wav_file.write_bytes(_wav(400, 36 + 400))
+
+        assert await validator.validate_file(wav_file) == AudioFormat.WAV
+
+    @pytest.mark.asyncio
+    async def test_garbage_mp3_is_invalid(
+        self, validator: AudioFormatValidator, ffprobe: AsyncMock, tmp_path: Path
+    ):
+        """Test a file with no recognizable audio header is invalid."""
+        mp3_file = tmp_path / "test.mp3"
+        mp3_file.write_bytes(b"this is not an mp3 file at all" * 4)
+
+        with pytest.raises(InvalidAudioFileError, match="Invalid"):
+            await validator.validate_file(mp3_file)
+        ffprobe.assert_not_awaited()
+
+    @pytest.mark.asyncio
+    async def test_truncated_wav_is_incomplete(
+        self, validator: AudioFormatValidator, ffprobe: AsyncMock, tmp_path: Path
+    ):
+        """Test a WAV shorter than its RIFF size is incomplete."""
+        wav_file = tmp_path / "test.wav"
+        wav_file.write_bytes(_wav(400, 36 + 400)[:100])
+
+        with pytest.raises(IncompleteAudioFileError, match="Incomplete WAV"):
+            await validator.validate_file(wav_file)
+        ffprobe.assert_not_awaited()
+
+    @pytest.mark.asyncio
+    async def test_truncated_id3_tag_is_incomplete(
+        self, validator: AudioFormatValidator, ffprobe: AsyncMock, tmp_path: Path
+    ):
+        """Test an MP3 cut off inside its ID3v2 tag is incomplete."""
+        mp3_file = tmp_path / "test.mp3"
+        # Syncsafe tag size 0x0100 << 7 = 32768 bytes
+        mp3_file.write_bytes(b"ID3\x04\x00\x00\x00\x00\x02\x00" + b"\x00" * 100)
+
+        with pytest.raises(IncompleteAudioFileError, match="Incomplete MP3"):
+            await validator.validate_file(mp3_file)
+
+    @pytest.mark.asyncio
+    async def test_empty_file_is_incomplete(
+        self, validator: AudioFormatValidator, ffprobe: AsyncMock, tmp_path: Path
+    ):
+        """Test an empty file is incomplete."""
+        empty_file = tmp_path / "test.flac"
+        empty_file.write_bytes(b"")
+
+        with pytest.raises(IncompleteAudioFileError, match="empty"):
+            await validator.validate_file(empty_file)
+
+    @pytest.mark.asyncio
+    async def test_no_audio_stream_is_invalid(
+        self, validator: AudioFormatValidator, ffprobe: AsyncMock, tmp_path: Path
+    ):
+        """Test a structurally sound file FFprobe cannot read is invalid."""
+        ffprobe.return_value = False
+        flac_file = tmp_path / "test.flac"
+        flac_file.write_bytes(b"fLaC" + b"\x00" * 64)
+
+        with pytest.raises(InvalidAudioFileError, match="no audio stream"):
+            await validator.validate_file(flac_file)
+
+    @pytest.mark.asyncio
+    async def test_without_ffprobe_uses_structural_checks(
+        self, validator: AudioFormatValidator, ffprobe: AsyncMock, tmp_path: Path
+    ):
+        """Test validation still passes when FFprobe is not installed."""
+        ffprobe.side_effect = FileNotFoundError("ffprobe is not installed")
+        flac_file = tmp_path / "test.flac"
+        flac_file.write_bytes(b"fLaC" + b"\x00" * 64)
+
+        assert await validator.validate_file(flac_file) == AudioFormat.FLAC
+
+    @pytest.mark.asyncio
+    async def test_missing_file(self, validator: AudioFormatValidator, tmp_path: Path):
+        """Test a missing file raises FileNotFoundError."""
+        with pytest.raises(FileNotFoundError):
+            await validator.validate_file(tmp_path / "missing.wav")
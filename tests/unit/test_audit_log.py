@@ -0,0 +1,70 @@
+"""Unit tests for the per-file audit log."""
+
+import json
+from pathlib import Path
+
+from src.audit.audit_log import AuditLog, read_failed_inputs, remove_inputs
+
+
+def _read(path: Path):
+    if not path.exists():
+        return []
+    return [json.loads(line) for line in path.read_text().splitlines()]
+
+
+def test_record_writes_structured_entry(tmp_path: Path):
+    audit = AuditLog(tmp_path / "audit.jsonl", flush_interval=0)
+
+    audit.record(
+        "processed",
+        Path("/in/song.mp3"),
+        output_path=Path("/out/song.flac"),
+        checksum="abc",
+        duration_ms=12.5,
+    )
+
+    [entry] = _read(tmp_path / "audit.jsonl")
+    assert entry["action"] == "processed"
+    assert entry["input"] == "/in/song.mp3"
+    assert entry["output"] == "/out/song.flac"
+    assert entry["checksum"] == "abc"
+    assert entry["duration_ms"] == 12.5
+
+
+def test_writes_are_buffered_until_flush(tmp_path: Path):
+    path = tmp_path / "audit.jsonl"
+    audit = AuditLog(path, flush_interval=3600, max_buffer=100)
+
+    audit.record("skipped", Path("/in/a.txt"), reason="unsupported_format")
+    audit.record("failed", Path("/in/b.mp3"), error="boom")
+
+    assert _read(path) == []
+
+    audit.close()
+
+    assert [e["action"] for e in _read(path)] == ["skipped", "failed"]
+
+
+def test_full_buffer_flushes(tmp_path: Path):
+    path = tmp_path / "audit.jsonl"
+    audit = AuditLog(path, flush_interval=3600, max_buffer=2)
+
+    audit.record("processed", Path("/in/a.mp3"))
+    audit.record("processed", Path("/in/b.mp3"))
+
+    assert len(_read(path)) == 2
+
+
+def test_read_failed_inputs_and_remove(tmp_path: Path):
+    audit = AuditLog(tmp_path / "audit.jsonl", flush_interval=0)
+    audit.record("failed", Path("/in/a.mp3"), error="boom")
+    audit.record("processed", Path("/in/b.mp3"))
+    audit.record("failed", Path("/in/c.mp3"), error="boom")
+    audit.record("failed", Path("/in/a.mp3"), error="boom again")
+    audit.close()
+
+    assert read_failed_inputs(audit.path) == [Path("/in/a.mp3"), Path("/in/c.mp3")]
+
+    remove_inputs(audit.path, [Path("/in/a.mp3")])
+
+    assert [entry["input"] for entry in _read(audit.path)] == ["/in/b.mp3", "/in/c.mp3"]
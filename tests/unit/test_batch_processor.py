@@ -0,0 +1,2329 @@
+"""Unit tests for the batch audio processor."""
+
+import asyncio
+import copy
+import json
+import os
+import sys
+import threading
+import time
+import zipfile
+import pytest
+from pathlib import Path
+from typing import Optional
+from unittest.mock import MagicMock, patch
+
+from src.audio.converter import AudioConverter, AudioProperties
+from src.integrations.integration_manager import IntegrationManager
+from src.integrations.sonarr import SonarrClient
+from src.processor.batch_processor import (
+    BatchConfig,
+    BatchProcessor,
+    BatchResult,
+    FormatRule,
+    PreparedFile,
+    guess_content_type,
+)
+from src.metadata.metadata import Metadata
+from src.state.state import StateManager
+from src.storage.remote import RemoteInputError
+from src.storage.checksum import compute_checksum
+from src.telemetry.telemetry import FILES_FAILED, FILES_PROCESSED, FILES_SKIPPED
+from src.validator.validator import MediaType
+
+
+def _fake_ffmpeg(cmd):
+    """Stand-in for FFmpeg that writes the output file named last in cmd."""
+    Path(cmd[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+    return (0, "", "")
+
+
+@pytest.fixture
+def input_dir(tmp_path: Path) -> Path:
+    """Create an input directory with a couple of audio files."""
+    directory = tmp_path / "input"
+    directory.mkdir()
+    (directory / "song.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    (directory / "other.ogg").write_bytes(b"OggS" + b"\x00" * 100)
+    (directory / "notes.txt").write_text("not audio")
+    return directory
+
+
+def _processor(config: BatchConfig) -> BatchProcessor:
+    converter = AudioConverter(output_format="flac")
+    return BatchProcessor(config, converter=converter)
+
+
+def test_find_audio_files_skips_unsupported(input_dir: Path, tmp_path: Path):
+    processor = _processor(BatchConfig(input_dir=input_dir, output_dir=tmp_path))
+
+    files = processor.find_audio_files()
+
+    assert [f.name for f in files] == ["other.ogg", "song.mp3"]
+
+
+@pytest.mark.asyncio
+async def test_process_all_scans_nested_folders(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    album = input_dir / "Artist" / "Album"
+    album.mkdir(parents=True)
+    (input_dir / "single.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    (input_dir / "Artist" / "loose.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    (album / "01.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    # A link back up the tree must not be followed forever
+    (album / "loop").symlink_to(input_dir, target_is_directory=True)
+    output_dir = tmp_path / "output"
+    processor = _processor(BatchConfig(input_dir=input_dir, output_dir=output_dir))
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_all()
+
+    assert result.successful == 3
+    assert sorted(
+        str(p.relative_to(output_dir)) for p in output_dir.rglob("*") if p.is_file()
+    ) == ["Artist/Album/01.flac", "Artist/loose.flac", "single.flac"]
+
+
+def test_list_input_files_skips_written_dirs_and_honors_recursive(tmp_path: Path):
+    input_dir = tmp_path / "library"
+    (input_dir / "Album").mkdir(parents=True)
+    (input_dir / "top.flac").touch()
+    (input_dir / "Album" / "track.flac").touch()
+    output_dir = input_dir / "converted"
+    output_dir.mkdir()
+    (output_dir / "track.flac").touch()
+    config = BatchConfig(input_dir=input_dir, output_dir=output_dir)
+
+    assert _processor(config).list_input_files() == [
+        input_dir / "Album" / "track.flac",
+        input_dir / "top.flac",
+    ]
+
+    config.recursive = False
+    assert _processor(config).list_input_files() == [input_dir / "top.flac"]
+
+
+@pytest.mark.asyncio
+async def test_remote_inputs_not_downloaded_in_dry_run(input_dir: Path, tmp_path: Path):
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        files=["https://media.example.com/a/live.ogg"],
+        dry_run=True,
+    )
+    processor = _processor(config)
+
+    with patch.object(processor.remote, "fetch") as fetch:
+        result = await processor.process_all()
+
+    fetch.assert_not_called()
+    assert [r.input_path for r in result.files] == [
+        Path("media.example.com/a/live.ogg")
+    ]
+
+
+@pytest.mark.asyncio
+async def test_failed_download_fails_only_its_file(input_dir: Path, tmp_path: Path):
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        files=[str(input_dir / "song.mp3"), "https://media.example.com/a/gone.ogg"],
+    )
+    processor = _processor(config)
+
+    with patch.object(
+        processor.remote, "fetch", side_effect=RemoteInputError("HTTP 404")
+    ), patch.object(processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg):
+        result = await processor.process_all()
+
+    assert (result.successful, result.failed) == (1, 1)
+    assert result.failed_files == [Path("media.example.com/a/gone.ogg")]
+
+
+@pytest.mark.asyncio
+async def test_remote_inputs_downloaded_into_run_dir(input_dir: Path, tmp_path: Path):
+    work_dir = tmp_path / "work"
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        files=[str(input_dir / "song.mp3"), "https://media.example.com/a/live.ogg"],
+        work_dir=work_dir,
+    )
+    processor = _processor(config)
+    downloads = []
+
+    def fetch(url, destination):
+        destination.mkdir(parents=True)
+        downloads.append(destination / "live.ogg")
+        downloads[-1].write_bytes(b"OggS" + b"\x00" * 100)
+        return downloads[-1]
+
+    with patch.object(processor.remote, "fetch", side_effect=fetch), patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_all()
+
+    assert result.successful == 2
+    assert {r.input_path for r in result.files} == {
+        Path("media.example.com/a/live.ogg"),
+        input_dir / "song.mp3",
+    }
+    assert (tmp_path / "output" / "live.flac").exists()
+    # The download went away with the run directory
+    assert downloads[0].is_relative_to(work_dir)
+    assert list(work_dir.iterdir()) == []
+
+
+def _fake_video_ffmpeg(command, input_path, progress_callback=None):
+    if progress_callback:
+        progress_callback(50.0, "2x")
+    Path(command[-1]).write_bytes(b"1")
+
+
+def test_video_progress_logged_every_step():
+    log = MagicMock()
+    report = BatchProcessor._video_progress_logger(log)
+
+    for percent in (None, 0.0, 4.0, 12.5, 15.0, 27.0, 100.0):
+        report(percent, "1.5x")
+
+    logged = [call.kwargs["percent"] for call in log.info.call_args_list]
+    assert logged == [0.0, 12.5, 27.0, 100.0]
+
+
+@pytest.mark.asyncio
+async def test_video_files_routed_to_video_converter(input_dir: Path, tmp_path: Path):
+    (input_dir / "Films").mkdir()
+    (input_dir / "Films" / "film.mp4").write_bytes(b"\x00" * 64)
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(input_dir),
+            "output_dir": str(tmp_path / "output"),
+            "video": {"enabled": True, "output_format": "mkv"},
+        }
+    )
+    processor = _processor(config)
+    video = processor.video_converter
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ), patch.object(video, "probe_codecs", return_value=None), patch.object(
+        video, "run_ffmpeg", side_effect=_fake_video_ffmpeg
+    ), patch.object(
+        video, "validate_output"
+    ) as validate:
+        result = await processor.process_all()
+
+    assert result.total_files == 3
+    assert (result.audio_successful, result.video_successful) == (2, 1)
+    assert (tmp_path / "output" / "Films" / "film.mkv").exists()
+    validate.assert_called_once()
+    assert "2 audio, 1 video" in result.summary
+    assert result.skipped == {"unsupported_format": 1}
+
+
+@pytest.mark.asyncio
+async def test_video_failures_get_audio_post_processing(
+    input_dir: Path, tmp_path: Path
+):
+    (input_dir / "film.mp4").write_bytes(b"\x00" * 64)
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(input_dir),
+            "output_dir": str(tmp_path / "output"),
+            "video": {"enabled": True, "output_format": "mkv"},
+        }
+    )
+    processor = _processor(config)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ), patch.object(
+        processor.video_converter, "convert", side_effect=RuntimeError("boom")
+    ), patch.object(
+        processor, "_track_failures"
+    ) as track, patch.object(
+        processor, "_record_result"
+    ) as record:
+        result = await processor.process_all()
+
+    failed = [r for r in result.files if not r.success]
+    assert [r.input_path for r in failed] == [input_dir / "film.mp4"]
+    assert failed[0].media_type == MediaType.VIDEO
+    assert failed[0].error_message == "boom"
+    assert input_dir / "film.mp4" in [c.args[0] for c in track.call_args_list]
+    assert input_dir / "film.mp4" in [c.args[0] for c in record.call_args_list]
+
+
+@pytest.mark.asyncio
+async def test_video_files_skipped_without_video_config(
+    input_dir: Path, tmp_path: Path
+):
+    (input_dir / "film.mp4").write_bytes(b"\x00" * 64)
+    config = BatchConfig.from_dict(
+        {"input_dir": str(input_dir), "output_dir": str(tmp_path / "output")}
+    )
+    processor = _processor(config)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_all()
+
+    assert config.video is None
+    assert (result.audio_successful, result.video_successful) == (2, 0)
+    assert result.skipped == {"unsupported_format": 2}
+    assert "video" not in result.summary
+
+
+def test_shards_partition_input_files(tmp_path: Path):
+    input_dir = tmp_path / "library"
+    for album in range(5):
+        (input_dir / f"Album {album}").mkdir(parents=True)
+        for track in range(8):
+            (input_dir / f"Album {album}" / f"{track:02d}.flac").touch()
+    config = BatchConfig(input_dir=input_dir, output_dir=tmp_path / "output")
+    all_files = _processor(config).list_input_files()
+
+    shards = []
+    for index in range(3):
+        shard_config = copy.copy(config)
+        shard_config.shard_index, shard_config.shard_count = index, 3
+        shards.append(set(_processor(shard_config).list_input_files()))
+        # The same shard is picked again on a rerun
+        assert set(_processor(shard_config).list_input_files()) == shards[-1]
+
+    assert set().union(*shards) == set(all_files)
+    assert sum(len(shard) for shard in shards) == len(all_files)
+    assert all(shards)
+
+
+@pytest.mark.parametrize("key", ["concurrency", "probe_concurrency"])
+@pytest.mark.parametrize("value", [0, 2000])
+def test_invalid_worker_count_rejected(key: str, value: int):
+    with pytest.raises(ValueError, match=key):
+        BatchConfig.from_dict({"input_dir": "/in", "output_dir": "/out", key: value})
+
+
+@pytest.mark.parametrize("index, count", [(3, 3), (-1, 2), (0, 0)])
+def test_invalid_shard_rejected(index: int, count: int):
+    with pytest.raises(ValueError, match="shard_index"):
+        BatchConfig.from_dict(
+            {
+                "input_dir": "/in",
+                "output_dir": "/out",
+                "shard_index": index,
+                "shard_count": count,
+            }
+        )
+
+
+def test_output_tags_map_id3_frames_for_vorbis_outputs(tmp_path: Path):
+    config = BatchConfig(input_dir=tmp_path, output_dir=tmp_path, unknown_tags="drop")
+    processor = _processor(config)
+    meta = Metadata()
+    meta.track, meta.track_total = "3", "12"
+    meta.tags = {"tbpm": "120", "label_code": "LC 0123"}
+    meta.rating = 128
+
+    flac_tags = processor.output_tags(processor.converter, meta)
+    mp3_tags = processor.output_tags(AudioConverter(output_format="mp3"), meta)
+
+    assert flac_tags == {
+        "tbpm": "",
+        "BPM": "120",
+        "label_code": "",
+        "RATING": "50",
+        "track": "3/12",
+    }
+    assert mp3_tags == {"track": "3/12"}
+
+
+def test_output_converters_cover_rules_and_profiles(tmp_path: Path):
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(tmp_path),
+            "output_dir": str(tmp_path),
+            "audio": {
+                "output_format": "flac",
+                "format_rules": [
+                    {
+                        "source_formats": ["wav"],
+                        "output_format": "opus",
+                        "quality": "96k",
+                    },
+                    {"source_formats": ["aiff"], "output_format": "flac"},
+                ],
+            },
+            "profiles": [{"path_prefix": "Car", "audio": {"output_format": "mp3"}}],
+        }
+    )
+    processor = _processor(config)
+
+    converters = processor.output_converters()
+
+    assert list(converters) == ["flac", "opus", "mp3"]
+    assert converters["flac"] is processor.converter
+    assert converters["opus"].bitrate == "96k"
+
+
+def test_invalid_unknown_tags_rejected():
+    with pytest.raises(ValueError, match="unknown_tags"):
+        BatchConfig.from_dict(
+            {
+                "input_dir": "/in",
+                "output_dir": "/out",
+                "metadata": {"unknown_tags": "keep"},
+            }
+        )
+
+
+@pytest.mark.asyncio
+async def test_process_all_converts_files(input_dir: Path, tmp_path: Path):
+    output_dir = tmp_path / "output"
+    processor = _processor(BatchConfig(input_dir=input_dir, output_dir=output_dir))
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_all()
+
+    assert result.total_files == 2
+    assert result.successful == 2
+    assert result.failed == 0
+    assert (result.newly_processed, result.reprocessed) == (2, 0)
+    assert result.skipped_count == 1
+    assert "Resuming" not in result.summary
+    assert (output_dir / "song.flac").exists()
+    assert (output_dir / "other.flac").exists()
+
+
+@pytest.mark.asyncio
+async def test_keep_originals_preserves_source(input_dir: Path, tmp_path: Path):
+    output_dir = tmp_path / "output"
+    manifest_path = tmp_path / "manifest.jsonl"
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=output_dir,
+        keep_originals=True,
+        manifest_path=manifest_path,
+    )
+    processor = _processor(config)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_all()
+
+    assert result.successful == 2
+    # Normalized output and preserved original both exist
+    assert (output_dir / "song.flac").exists()
+    assert (output_dir / "originals" / "song.mp3").exists()
+    # Source is left untouched
+    assert (input_dir / "song.mp3").exists()
+
+    records = [json.loads(line) for line in manifest_path.read_text().splitlines()]
+    by_input = {Path(r["input"]).name: r for r in records}
+    assert by_input["song.mp3"]["original"] == str(
+        output_dir / "originals" / "song.mp3"
+    )
+    assert by_input["song.mp3"]["output"] == str(output_dir / "song.flac")
+
+
+@pytest.mark.asyncio
+async def test_keep_originals_custom_dir(input_dir: Path, tmp_path: Path):
+    originals_dir = tmp_path / "archive"
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        keep_originals=True,
+        originals_dir=originals_dir,
+    )
+    processor = _processor(config)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        await processor.process_all()
+
+    assert (originals_dir / "song.mp3").exists()
+    assert (originals_dir / "other.ogg").exists()
+
+
+@pytest.mark.asyncio
+async def test_keep_originals_respects_dry_run(input_dir: Path, tmp_path: Path):
+    output_dir = tmp_path / "output"
+    manifest_path = tmp_path / "manifest.jsonl"
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=output_dir,
+        dry_run=True,
+        keep_originals=True,
+        manifest_path=manifest_path,
+    )
+    processor = _processor(config)
+
+    with patch.object(processor.converter, "_execute_ffmpeg") as mock_exec:
+        result = await processor.process_all()
+
+    mock_exec.assert_not_called()
+    assert result.successful == 2
+    song = next(f for f in result.files if f.input_path.name == "song.mp3")
+    assert song.original_path == output_dir / "originals" / "song.mp3"
+    assert not output_dir.exists()
+    assert not manifest_path.exists()
+
+
+def test_batch_config_from_dict(tmp_path: Path):
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(tmp_path / "in"),
+            "output_dir": str(tmp_path / "out"),
+            "concurrency": 2,
+            "audio": {"output_format": "opus", "verify_decodable": True},
+            "organization": {
+                "keep_originals": True,
+                "originals_dir": str(tmp_path / "orig"),
+            },
+        }
+    )
+
+    assert config.concurrency == 2
+    assert config.output_format == "opus"
+    assert config.verify_decodable is True
+    assert config.keep_originals is True
+    assert config.get_originals_dir() == tmp_path / "orig"
+
+
+@pytest.mark.asyncio
+async def test_audit_log_records_every_input(input_dir: Path, tmp_path: Path):
+    (input_dir / "broken.mp3").write_bytes(b"ID3\x04" + b"\x00" * 10)
+    audit_path = tmp_path / "audit.jsonl"
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        audit_log_path=audit_path,
+    )
+    processor = _processor(config)
+
+    async def fake_ffmpeg(cmd):
+        if "broken" in cmd[-1]:
+            return (1, "", "Invalid data found when processing input")
+        return _fake_ffmpeg(cmd)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=fake_ffmpeg
+    ):
+        await processor.process_all()
+
+    records = [json.loads(line) for line in audit_path.read_text().splitlines()]
+    by_input = {Path(r["input"]).name: r for r in records}
+
+    # One record per input file, including the unsupported one
+    assert len(records) == 4
+    assert by_input["song.mp3"]["action"] == "processed"
+    assert len(by_input["song.mp3"]["checksum"]) == 64
+    assert by_input["song.mp3"]["output"].endswith("song.flac")
+    assert by_input["broken.mp3"]["action"] == "failed"
+    assert "Invalid data" in by_input["broken.mp3"]["error"]
+    assert by_input["notes.txt"]["action"] == "skipped"
+    assert by_input["notes.txt"]["reason"] == "unsupported_format"
+    assert all("timestamp" in r and "duration_ms" in r for r in records)
+
+
+@pytest.mark.asyncio
+async def test_format_rules_route_by_source_quality(input_dir: Path, tmp_path: Path):
+    (input_dir / "master.wav").write_bytes(b"RIFF" + b"\x00" * 100)
+    output_dir = tmp_path / "output"
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=output_dir,
+        format_rules=[
+            FormatRule(source_formats=["wav", "flac"], output_format="flac"),
+            FormatRule(
+                source_formats=["mp3", "aac"], output_format="opus", quality="128k"
+            ),
+        ],
+    )
+    processor = _processor(config)
+
+    with patch.object(
+        AudioConverter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ) as mock_exec:
+        result = await processor.process_all()
+
+    assert result.successful == 3
+    # Lossless source stays lossless, lossy source goes to opus
+    assert (output_dir / "master.flac").exists()
+    assert (output_dir / "song.opus").exists()
+    # No rule matches ogg, so it falls back to the default output format
+    assert (output_dir / "other.flac").exists()
+
+    commands = [c.args[0] for c in mock_exec.call_args_list]
+    opus_cmd = next(cmd for cmd in commands if cmd[-1].endswith("song.opus.tmp"))
+    assert opus_cmd[opus_cmd.index("-b:a") + 1] == "128k"
+
+
+@pytest.mark.asyncio
+async def test_override_sidecar_forces_output_format(input_dir: Path, tmp_path: Path):
+    (input_dir / "song.mp3.refinery.yaml").write_text(
+        "audio:\n"
+        "  output_format: opus\n"
+        "  quality: 96k\n"
+        "  extra_args: -ac 1\n"
+    )
+    output_dir = tmp_path / "output"
+    processor = _processor(BatchConfig(input_dir=input_dir, output_dir=output_dir))
+
+    with patch.object(
+        AudioConverter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ) as mock_exec:
+        result = await processor.process_all()
+
+    assert result.successful == 2
+    assert sorted(p.name for p in output_dir.iterdir()) == ["other.flac", "song.opus"]
+    # The sidecar itself is not counted as an unsupported input
+    assert result.skipped == {"unsupported_format": 1}
+
+    commands = [c.args[0] for c in mock_exec.call_args_list]
+    opus_cmd = next(cmd for cmd in commands if cmd[-1].endswith("song.opus.tmp"))
+    assert opus_cmd[opus_cmd.index("-b:a") + 1] == "96k"
+    assert opus_cmd[-5:-3] == ["-ac", "1"]
+    flac_cmd = next(cmd for cmd in commands if cmd[-1].endswith("other.flac.tmp"))
+    assert "-ac" not in flac_cmd
+
+
+@pytest.mark.asyncio
+async def test_override_sidecar_skip_and_invalid(input_dir: Path, tmp_path: Path):
+    (input_dir / "other.ogg.refinery.yaml").write_text("skip: true\n")
+    (input_dir / "song.mp3.refinery.yaml").write_text("audio: [unclosed\n")
+    processor = _processor(
+        BatchConfig(input_dir=input_dir, output_dir=tmp_path / "output")
+    )
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ) as ffmpeg:
+        result = await processor.process_all()
+
+    assert ffmpeg.call_count == 0
+    assert result.skipped == {"override": 1, "unsupported_format": 1}
+    [failed] = result.files
+    assert failed.input_path == input_dir / "song.mp3"
+    assert failed.error_message.startswith("Invalid override song.mp3.refinery.yaml")
+
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("output_format", ["dsf", "wma9", "m4a", "aiff"])
+async def test_override_sidecar_rejects_unsupported_format(
+    input_dir: Path, tmp_path: Path, output_format: str
+):
+    (input_dir / "song.mp3.refinery.yaml").write_text(
+        f"audio:\n  output_format: {output_format}\n"
+    )
+    processor = _processor(
+        BatchConfig(input_dir=input_dir, output_dir=tmp_path / "output")
+    )
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_all()
+
+    [failed] = result.failed_files
+    song = next(f for f in result.files if f.input_path == failed)
+    assert song.error_message == (
+        f"Invalid override song.mp3.refinery.yaml: "
+        f"Unsupported output format: {output_format}"
+    )
+    assert result.successful == 1
+
+
+def test_format_rules_from_dict(tmp_path: Path):
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(tmp_path / "in"),
+            "output_dir": str(tmp_path / "out"),
+            "audio": {
+                "output_format": "flac",
+                "format_rules": [
+                    {
+                        "source_formats": ["mp3", "ogg"],
+                        "output_format": "opus",
+                        "quality": "96k",
+                    }
+                ],
+            },
+        }
+    )
+    processor = BatchProcessor(config)
+
+    assert config.format_rules[0].matches(Path("a/Track.MP3"))
+    assert processor.converter_for(Path("track.ogg")).output_format == "opus"
+    assert processor.converter_for(Path("track.ogg")).bitrate == "96k"
+    assert processor.converter_for(Path("track.wav")).output_format == "flac"
+
+
+@pytest.mark.asyncio
+async def test_zero_byte_output_counts_as_failure(input_dir: Path, tmp_path: Path):
+    output_dir = tmp_path / "output"
+    processor = _processor(BatchConfig(input_dir=input_dir, output_dir=output_dir))
+
+    async def empty_output(cmd):
+        Path(cmd[-1]).touch()
+        return (0, "", "")
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=empty_output
+    ):
+        result = await processor.process_all()
+
+    assert result.successful == 0
+    assert result.failed == 2
+    assert not (output_dir / "song.flac").exists()
+
+
+@pytest.mark.asyncio
+async def test_verify_all_reports_corrupt_files(input_dir: Path, tmp_path: Path):
+    (input_dir / "empty.flac").touch()
+    (input_dir / "garbage.mp3").write_bytes(b"\x00" * 64)
+    output_dir = tmp_path / "output"
+    processor = _processor(BatchConfig(input_dir=input_dir, output_dir=output_dir))
+
+    with patch.object(processor.converter, "_execute_ffmpeg") as mock_exec:
+        result = await processor.verify_all()
+
+    mock_exec.assert_not_called()
+    assert result.total_files == 4
+    assert sorted(p.name for p in result.suspect_files) == [
+        "empty.flac",
+        "garbage.mp3",
+    ]
+    assert not output_dir.exists()
+
+
+@pytest.mark.asyncio
+async def test_verify_all_decode_check(input_dir: Path, tmp_path: Path):
+    config = BatchConfig(
+        input_dir=input_dir, output_dir=tmp_path / "output", verify_decodable=True
+    )
+    processor = _processor(config)
+
+    async def fake_decode(cmd):
+        if "other.ogg" in cmd[cmd.index("-i") + 1]:
+            return (0, "", "Invalid page header")
+        return (0, "", "")
+
+    with patch.object(processor.converter, "_execute_ffmpeg", side_effect=fake_decode):
+        result = await processor.verify_all()
+
+    assert list(result.suspect_files) == [input_dir / "other.ogg"]
+    assert "Invalid page header" in result.suspect_files[input_dir / "other.ogg"]
+
+
+@pytest.mark.asyncio
+async def test_verify_all_uses_verify_concurrency(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    for i in range(10):
+        (input_dir / f"track{i}.flac").write_bytes(b"fLaC" + b"\x00" * 64)
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        concurrency=1,
+        verify_concurrency=3,
+    )
+    processor = _processor(config)
+    active = 0
+    peak = 0
+
+    async def slow_verify(path):
+        nonlocal active, peak
+        active += 1
+        peak = max(peak, active)
+        await asyncio.sleep(0.01)
+        active -= 1
+        return None
+
+    with patch.object(processor, "verify_file", side_effect=slow_verify):
+        result = await processor.verify_all()
+
+    assert result.total_files == 10
+    assert peak == 3
+
+
+def _write_zip(path: Path, members: dict) -> Path:
+    with zipfile.ZipFile(path, "w") as archive:
+        for name, data in members.items():
+            archive.writestr(name, data)
+    return path
+
+
+@pytest.mark.asyncio
+async def test_zip_archive_members_processed(input_dir: Path, tmp_path: Path):
+    mp3 = b"ID3\x04" + b"\x00" * 100
+    _write_zip(
+        input_dir / "album.zip",
+        {"Artist/Album/01.mp3": mp3, "Artist/Album/02.mp3": mp3, "cover.txt": "x"},
+    )
+    output_dir = tmp_path / "output"
+    work_dir = tmp_path / "work"
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=output_dir,
+        extract_archives=True,
+        work_dir=work_dir,
+    )
+    processor = _processor(config)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_all()
+
+    assert result.total_files == 4
+    assert result.successful == 4
+    # Internal directory structure is kept under output_dir
+    assert (output_dir / "Artist" / "Album" / "01.flac").exists()
+    assert (output_dir / "Artist" / "Album" / "02.flac").exists()
+    reported = {str(f.input_path) for f in result.files}
+    assert str(input_dir / "album.zip" / "Artist" / "Album" / "01.mp3") in reported
+    # Extracted files are cleaned up
+    assert list(work_dir.iterdir()) == []
+
+
+@pytest.mark.asyncio
+async def test_dry_run_lists_archive_without_extracting(
+    input_dir: Path, tmp_path: Path
+):
+    mp3 = b"ID3\x04" + b"\x00" * 100
+    archive = _write_zip(
+        input_dir / "album.zip", {"Album/01.mp3": mp3, "Album/notes.txt": "x"}
+    )
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        extract_archives=True,
+        work_dir=tmp_path / "work",
+        dry_run=True,
+    )
+    processor = _processor(config)
+
+    with patch(
+        "src.processor.batch_processor.extract_archive"
+    ) as extract, patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ) as ffmpeg:
+        result = await processor.process_all()
+
+    extract.assert_not_called()
+    ffmpeg.assert_not_called()
+    member = next(f for f in result.files if f.input_path.parent.name == "Album")
+    assert member.input_path == archive / "Album" / "01.mp3"
+    assert member.success
+    assert result.skipped["unsupported_format"] == 2
+    assert list((tmp_path / "work").iterdir()) == []
+
+
+def _write_locked_zip(path: Path) -> Path:
+    archive = _write_zip(path, {"01.mp3": b"ID3\x04"})
+    # zipfile cannot encrypt, so set the encryption flag in both headers
+    data = bytearray(archive.read_bytes())
+    for signature, offset in ((b"PK\x03\x04", 6), (b"PK\x01\x02", 8)):
+        data[data.index(signature) + offset] |= 0x1
+    archive.write_bytes(bytes(data))
+    return archive
+
+
+@pytest.mark.asyncio
+async def test_password_protected_zip_fails_clearly(input_dir: Path, tmp_path: Path):
+    archive = _write_locked_zip(input_dir / "locked.zip")
+    config = BatchConfig(
+        input_dir=input_dir, output_dir=tmp_path / "output", extract_archives=True
+    )
+    processor = _processor(config)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ), patch.object(processor, "_track_failures") as track, patch.object(
+        processor, "_record_result"
+    ) as record:
+        result = await processor.process_all()
+
+    assert result.failed_files == [archive]
+    locked = next(f for f in result.files if f.input_path == archive)
+    assert "password-protected" in locked.error_message
+    assert result.successful == 2
+    assert archive in [c.args[0] for c in track.call_args_list]
+    assert archive in [c.args[0] for c in record.call_args_list]
+    assert processor.telemetry.value(FILES_FAILED, file_type="zip") == 1
+
+
+@pytest.mark.asyncio
+async def test_failed_extraction_stops_fail_fast_run(input_dir: Path, tmp_path: Path):
+    archive = _write_locked_zip(input_dir / "locked.zip")
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        extract_archives=True,
+        fail_fast=True,
+    )
+    processor = _processor(config)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ) as ffmpeg:
+        result = await processor.process_all()
+
+    assert result.aborted_by.input_path == archive
+    assert result.not_processed == 2
+    ffmpeg.assert_not_called()
+
+
+@pytest.mark.asyncio
+async def test_tagless_file_routed_to_review(input_dir: Path, tmp_path: Path):
+    output_dir = tmp_path / "output"
+    audit_path = tmp_path / "audit.jsonl"
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=output_dir,
+        require_metadata_fields=["title", "artist"],
+        audit_log_path=audit_path,
+    )
+    processor = _processor(config)
+
+    def fake_ffprobe(command, **kwargs):
+        tags = {} if "song" in command[-1] else {"title": "T", "artist": "A"}
+        return json.dumps({"format": {"tags": tags}, "streams": []})
+
+    with patch("subprocess.check_output", side_effect=fake_ffprobe), patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_all()
+
+    assert result.successful == 2
+    assert result.review_files == [input_dir / "song.mp3"]
+    assert (output_dir / "needs-review" / "song.flac").exists()
+    assert (output_dir / "other.flac").exists()
+
+    song = next(f for f in result.files if f.input_path.name == "song.mp3")
+    assert song.missing_metadata == ["title", "artist"]
+    records = [json.loads(line) for line in audit_path.read_text().splitlines()]
+    by_input = {Path(r["input"]).name: r for r in records}
+    assert by_input["song.mp3"]["reason"] == "missing_metadata: title, artist"
+
+
+@pytest.mark.asyncio
+async def test_metadata_defaults_fill_output_path(input_dir: Path, tmp_path: Path):
+    output_dir = tmp_path / "output"
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(input_dir),
+            "output_dir": str(output_dir),
+            "metadata": {
+                "default_artist": "Unknown Artist",
+                "default_album": "Singles",
+            },
+            "profiles": [
+                {
+                    "path_prefix": "",
+                    "organization": {"music_pattern": "{artist}/{album}/{title}"},
+                }
+            ],
+        }
+    )
+    processor = _processor(config)
+
+    def fake_ffprobe(command, **kwargs):
+        if "song" in command[-1]:
+            tags = {"title": "Song", "album": ""}
+        else:
+            tags = {"title": "Other", "artist": "A", "album": "B"}
+        return json.dumps({"format": {"tags": tags}, "streams": []})
+
+    with patch("subprocess.check_output", side_effect=fake_ffprobe):
+        song_path, song, _ = await processor.determine_output_path(
+            input_dir / "song.mp3"
+        )
+        other_path, _, _ = await processor.determine_output_path(
+            input_dir / "other.ogg"
+        )
+
+    assert (song.artist, song.album) == ("Unknown Artist", "Singles")
+    assert song_path == output_dir / "Unknown Artist" / "Singles" / "Song.flac"
+    assert other_path == output_dir / "A" / "B" / "Other.flac"
+
+
+class _FakeSonarr:
+    def __init__(self, error=None):
+        self.calls = []
+        self.error = error
+
+    def lookup_series(self, title, year=None):
+        self.calls.append((title, year))
+        if self.error:
+            raise self.error
+        return {
+            "title": "Show Name",
+            "year": 2005,
+            "genres": ["Comedy"],
+            "images": [{"coverType": "poster", "remoteUrl": "http://img/cover.jpg"}],
+        }
+
+
+def _episode_processor(
+    tmp_path: Path, sonarr: object, metadata: Optional[dict] = None
+) -> BatchProcessor:
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    for episode in (1, 2, 3):
+        (input_dir / f"show.name.S01E0{episode}.mp3").write_bytes(b"ID3")
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(input_dir),
+            "output_dir": str(tmp_path / "output"),
+            "metadata": metadata or {},
+            "profiles": [
+                {
+                    "path_prefix": "",
+                    "organization": {"music_pattern": "{show}/{year}/{title}"},
+                }
+            ],
+        }
+    )
+    integrations = IntegrationManager()
+    integrations.register_integration("sonarr", sonarr)
+    return BatchProcessor(
+        config,
+        converter=AudioConverter(output_format="flac"),
+        integrations=integrations,
+    )
+
+
+def _episode_ffprobe(command, **kwargs):
+    """Episodes tagged with their own title only."""
+    episode = command[-1][-6:-4]
+    tags = {"title": f"Episode {int(episode)}"}
+    return json.dumps({"format": {"tags": tags}, "streams": []})
+
+
+@pytest.mark.asyncio
+async def test_episodes_share_one_series_lookup(tmp_path: Path):
+    sonarr = _FakeSonarr()
+    processor = _episode_processor(tmp_path, sonarr)
+
+    with patch("subprocess.check_output", side_effect=_episode_ffprobe), patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_all()
+
+    assert result.successful == 3
+    assert len(sonarr.calls) == 1
+    show_dir = tmp_path / "output" / "Show Name" / "2005"
+    assert sorted(p.name for p in show_dir.iterdir()) == [
+        "Episode 1.flac",
+        "Episode 2.flac",
+        "Episode 3.flac",
+    ]
+
+
+@pytest.mark.asyncio
+async def test_series_lookup_merged_over_probed_tags(tmp_path: Path):
+    processor = _episode_processor(tmp_path, _FakeSonarr())
+    path = processor.config.input_dir / "show.name.S01E01.mp3"
+
+    def fake_ffprobe(command, **kwargs):
+        tags = {"title": "Pilot", "genre": "Sitcom", "date": "2004"}
+        return json.dumps({"format": {"tags": tags}, "streams": []})
+
+    with patch("subprocess.check_output", side_effect=fake_ffprobe):
+        _, meta, _ = await processor.determine_output_path(path)
+
+    # The series name is generic for an episode, so the probed title stays
+    assert meta.title == "Pilot"
+    assert (meta.show, meta.year, meta.genre) == ("Show Name", "2005", "Comedy")
+
+
+@pytest.mark.asyncio
+async def test_series_lookup_prefers_probed_year(tmp_path: Path):
+    sonarr = SonarrClient("http://sonarr:8989")
+    processor = _episode_processor(tmp_path, sonarr)
+    path = processor.config.input_dir / "show.name.S01E01.mp3"
+    results = [
+        {"title": "Show Name", "year": 2021, "genres": ["Drama"]},
+        {"title": "Show Name", "year": 2005, "genres": ["Comedy"]},
+    ]
+
+    def fake_ffprobe(command, **kwargs):
+        tags = {"title": "Pilot", "date": "2005-03-24"}
+        return json.dumps({"format": {"tags": tags}, "streams": []})
+
+    with patch("subprocess.check_output", side_effect=fake_ffprobe), patch.object(
+        SonarrClient, "_request", return_value=results
+    ) as request:
+        _, meta, _ = await processor.determine_output_path(path)
+
+    assert request.call_args.kwargs["params"] == {"term": "show name"}
+    assert (meta.year, meta.genre) == ("2005", "Comedy")
+
+
+@pytest.mark.asyncio
+async def test_required_fields_filled_by_lookup_and_defaults(tmp_path: Path):
+    metadata = {
+        "require_fields": ["title", "artist", "genre", "year"],
+        "default_artist": "Various",
+    }
+    processor = _episode_processor(tmp_path, _FakeSonarr(), metadata)
+    path = processor.config.input_dir / "show.name.S01E01.mp3"
+
+    with patch("subprocess.check_output", side_effect=_episode_ffprobe):
+        output_path, meta, missing = await processor.determine_output_path(path)
+
+    assert missing == []
+    assert (meta.artist, meta.genre, meta.year) == ("Various", "Comedy", "2005")
+    assert output_path.parent == tmp_path / "output" / "Show Name" / "2005"
+
+
+@pytest.mark.asyncio
+async def test_failed_series_lookup_keeps_probed_metadata(tmp_path: Path):
+    sonarr = _FakeSonarr(error=ConnectionError("Sonarr is down"))
+    processor = _episode_processor(tmp_path, sonarr)
+    path = processor.config.input_dir / "show.name.S01E02.mp3"
+
+    with patch("subprocess.check_output", side_effect=_episode_ffprobe):
+        output_path, meta, _ = await processor.determine_output_path(path)
+
+    assert (meta.show, meta.title, meta.year) == ("show name", "Episode 2", "")
+    assert output_path == (
+        tmp_path / "output" / "show name" / "Unknown" / "Episode 2.flac"
+    )
+
+
+@pytest.mark.asyncio
+async def test_skip_reasons_tallied(input_dir: Path, tmp_path: Path):
+    (input_dir / "cover.jpg").write_bytes(b"\xff\xd8")
+    processor = _processor(BatchConfig(input_dir=input_dir, output_dir=tmp_path))
+    processor._skip(input_dir / "song.mp3", "already_converted")
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_all()
+
+    # Tallies are per run, so the skip recorded beforehand is not counted
+    assert result.skipped == {"unsupported_format": 2}
+    assert result.skip_summary == "Skipped: 2 (unsupported_format)"
+
+
+@pytest.mark.asyncio
+async def test_outcomes_recorded_in_telemetry(input_dir: Path, tmp_path: Path):
+    (input_dir / "cover.jpg").write_bytes(b"\xff\xd8")
+    processor = _processor(BatchConfig(input_dir=input_dir, output_dir=tmp_path))
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        await processor.process_all()
+
+    telemetry = processor.telemetry
+    assert telemetry.value(FILES_PROCESSED, file_type="mp3") == 1
+    assert telemetry.value(FILES_PROCESSED, file_type="ogg") == 1
+    assert (
+        telemetry.value(FILES_SKIPPED, file_type="jpg", reason="unsupported_format")
+        == 1
+    )
+    assert (
+        telemetry.value(FILES_SKIPPED, file_type="txt", reason="unsupported_format")
+        == 1
+    )
+
+
+def test_skip_summary_orders_by_count():
+    result = BatchResult(
+        skipped={"unsupported": 1, "already_converted": 12, "too_small": 3}
+    )
+
+    assert result.skip_summary == (
+        "Skipped: 12 (already_converted), 3 (too_small), 1 (unsupported)"
+    )
+    assert result.summary.endswith(result.skip_summary)
+
+
+@pytest.mark.asyncio
+async def test_naming_command_sets_output_path(input_dir: Path, tmp_path: Path):
+    script = tmp_path / "name.py"
+    script.write_text(
+        "import json, sys\n"
+        "meta = json.load(sys.stdin)\n"
+        "print('../Custom/' + meta['format'] + '/renamed')\n"
+    )
+    output_dir = tmp_path / "output"
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=output_dir,
+        naming_command=[sys.executable, str(script)],
+    )
+    processor = _processor(config)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_file(input_dir / "song.mp3")
+
+    assert result.output_path == output_dir / "Custom" / "mp3" / "renamed.flac"
+    assert result.output_path.exists()
+
+
+@pytest.mark.asyncio
+async def test_dry_run_plans_from_probed_source(input_dir: Path, tmp_path: Path):
+    processor = _processor(
+        BatchConfig(input_dir=input_dir, output_dir=tmp_path / "output", dry_run=True)
+    )
+    props = AudioProperties(
+        sample_rate=44100, codec_name="mp3", is_lossless=False, bit_rate=320000
+    )
+
+    with patch.object(
+        processor.converter, "detect_audio_properties", return_value=props
+    ), patch.object(
+        processor.converter, "_get_audio_duration", return_value=200000.0
+    ), patch.object(processor.converter, "_execute_ffmpeg") as ffmpeg:
+        result = await processor.process_file(input_dir / "song.mp3")
+
+    ffmpeg.assert_not_called()
+    assert result.success is True
+    assert result.plan.source_codec == "mp3"
+    assert result.plan.source_bitrate == 320000
+    assert result.plan.codec == "flac"
+    assert result.plan.output_path == result.output_path
+    assert result.plan.estimated_size_bytes > 0
+    assert not (tmp_path / "output").exists()
+
+
+@pytest.mark.asyncio
+async def test_naming_command_failure_keeps_default_name(
+    input_dir: Path, tmp_path: Path
+):
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        naming_command=[sys.executable, "-c", "import sys; sys.exit(1)"],
+        dry_run=True,
+    )
+    processor = _processor(config)
+
+    result = await processor.process_file(input_dir / "song.mp3")
+
+    assert result.output_path == tmp_path / "output" / "song.flac"
+
+
+@pytest.mark.parametrize(
+    "exit_code, success", [(0, True), (3, False)], ids=["passes", "fails"]
+)
+@pytest.mark.asyncio
+async def test_post_validate_command_decides_outcome(
+    input_dir: Path, tmp_path: Path, exit_code: int, success: bool
+):
+    script = tmp_path / "check.py"
+    record = tmp_path / "checked.json"
+    script.write_text(
+        "import json, sys\n"
+        "context = json.load(sys.stdin)\n"
+        f"json.dump({{'arg': sys.argv[1], **context}}, open({str(record)!r}, 'w'))\n"
+        "print('loudness out of range', file=sys.stderr)\n"
+        f"sys.exit({exit_code})\n"
+    )
+    output_dir = tmp_path / "output"
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=output_dir,
+        checksum_sidecar=True,
+        post_validate_command=[sys.executable, str(script)],
+    )
+    processor = BatchProcessor(config)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_file(input_dir / "song.mp3")
+
+    output = output_dir / "song.flac"
+    checked = json.loads(record.read_text())
+    assert checked["arg"] == checked["output"] == str(output)
+    assert checked["input"] == str(input_dir / "song.mp3")
+    assert result.success is success
+    assert output.exists() is success
+    assert (output_dir / "song.flac.sha256").exists() is success
+    if not success:
+        assert result.error_message == (
+            "Validation command failed with exit code 3: loudness out of range"
+        )
+
+
+@pytest.mark.asyncio
+async def test_post_validate_command_times_out(input_dir: Path, tmp_path: Path):
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        post_validate_command=[sys.executable, "-c", "import time; time.sleep(5)"],
+        post_validate_timeout=0.2,
+    )
+    processor = _processor(config)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_file(input_dir / "song.mp3")
+
+    assert result.success is False
+    assert "timed out" in result.error_message
+    assert not (tmp_path / "output" / "song.flac").exists()
+
+
+@pytest.mark.asyncio
+async def test_checksum_sidecar_written_with_algorithm(
+    input_dir: Path, tmp_path: Path
+):
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(input_dir),
+            "output_dir": str(tmp_path / "output"),
+            "checksum_algorithm": "MD5",
+            "checksum_sidecar": True,
+        }
+    )
+    processor = BatchProcessor(config)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_file(input_dir / "song.mp3")
+
+    assert result.checksum_algorithm == "md5"
+    assert len(result.checksum) == 32
+    sidecar = tmp_path / "output" / "song.flac.md5"
+    assert sidecar.read_text().split() == [result.checksum, "song.flac"]
+
+
+@pytest.mark.asyncio
+async def test_encode_timeout_independent_of_file_timeout(
+    input_dir: Path, tmp_path: Path
+):
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        file_timeout=30.0,
+        encode_timeout=0.05,
+    )
+    processor = BatchProcessor(config)
+
+    async def slow_ffmpeg(command):
+        await asyncio.sleep(5)
+        return (0, "", "")
+
+    with patch.object(AudioConverter, "_execute_ffmpeg", side_effect=slow_ffmpeg):
+        result = await processor.process_all()
+
+    assert result.failed == 2
+    assert {r.error_message for r in result.files} == {
+        "Encode timed out after 0.05s"
+    }
+
+
+@pytest.mark.asyncio
+async def test_file_timeout_covers_steps_before_encode(
+    input_dir: Path, tmp_path: Path
+):
+    config = BatchConfig(
+        input_dir=input_dir, output_dir=tmp_path / "output", file_timeout=0.05
+    )
+    processor = _processor(config)
+
+    def slow_extract(path):
+        time.sleep(0.5)
+        return Metadata()
+
+    with patch.object(
+        processor.metadata_extractor, "extract_metadata", side_effect=slow_extract
+    ), patch.object(processor.converter, "_execute_ffmpeg") as mock_exec:
+        result = await processor.process_all()
+
+    mock_exec.assert_not_called()
+    assert result.failed == 2
+    assert result.files[0].error_message == (
+        "File processing timed out after 0.05s"
+    )
+
+
+@pytest.mark.asyncio
+async def test_prepare_using_whole_file_timeout_skips_encode(
+    input_dir: Path, tmp_path: Path
+):
+    config = BatchConfig(
+        input_dir=input_dir, output_dir=tmp_path / "output", file_timeout=0.05
+    )
+    processor = _processor(config)
+
+    async def slow_prepare(path, output_dir=None):
+        # Blocks without yielding, so the prepare stage finishes late
+        time.sleep(0.1)
+        return PreparedFile(
+            input_path=path,
+            output_path=tmp_path / "output" / f"{path.stem}.flac",
+            meta=Metadata(),
+            missing_metadata=[],
+        )
+
+    with patch.object(
+        processor, "prepare_file", side_effect=slow_prepare
+    ), patch.object(processor, "encode_file") as encode:
+        result = await processor.process_all()
+
+    encode.assert_not_called()
+    assert result.failed == 2
+    assert {r.error_message for r in result.files} == {
+        "File processing timed out after 0.05s"
+    }
+
+
+@pytest.mark.asyncio
+async def test_notifiers_receive_run_report(input_dir: Path, tmp_path: Path):
+    notifier = MagicMock()
+    processor = BatchProcessor(
+        BatchConfig(input_dir=input_dir, output_dir=tmp_path / "output"),
+        notifiers=[notifier],
+    )
+
+    with patch.object(AudioConverter, "_execute_ffmpeg", side_effect=_fake_ffmpeg):
+        result = await processor.process_all()
+
+    notifier.notify.assert_called_once_with(result)
+
+
+@pytest.mark.asyncio
+async def test_file_list_processes_only_listed_files(input_dir: Path, tmp_path: Path):
+    elsewhere = tmp_path / "elsewhere"
+    elsewhere.mkdir()
+    (elsewhere / "extra.flac").write_bytes(b"fLaC" + b"\x00" * 100)
+    playlist = tmp_path / "lists" / "trip.m3u"
+    playlist.parent.mkdir()
+    playlist.write_text(
+        "#EXTM3U\n"
+        "#EXTINF:123,Artist - Song\n"
+        "../input/song.mp3\n"
+        f"{elsewhere / 'extra.flac'}\n"
+        "../input/missing.mp3\n"
+        "../input/song.mp3\n"
+    )
+    config = BatchConfig(
+        input_dir=input_dir, output_dir=tmp_path / "output", file_list=playlist
+    )
+    processor = _processor(config)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result = await processor.process_all()
+
+    assert [f.input_path.name for f in result.files] == ["extra.flac", "song.mp3"]
+    assert result.skipped == {"not_found": 1}
+    assert not (tmp_path / "output" / "other.flac").exists()
+
+
+@pytest.mark.asyncio
+async def test_overlapping_input_and_output_dirs_keep_data(tmp_path: Path):
+    library = tmp_path / "library"
+    library.mkdir()
+    original = b"fLaC" + b"original" * 16
+    (library / "song.flac").write_bytes(original)
+    processor = _processor(BatchConfig(input_dir=library, output_dir=library))
+
+    async def fake_ffmpeg(command):
+        # FFmpeg reads the whole source before writing the temporary output
+        data = Path(command[command.index("-i") + 1]).read_bytes()
+        Path(command[-1]).write_bytes(data + b"reencoded")
+        return (0, "", "")
+
+    with patch.object(processor.converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+        result = await processor.process_all()
+
+    assert result.successful == 1
+    assert (library / "song.flac").read_bytes() == original + b"reencoded"
+
+
+@pytest.mark.asyncio
+async def test_state_recorded_for_converted_files(input_dir: Path, tmp_path: Path):
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(input_dir),
+            "output_dir": str(tmp_path / "output"),
+            "state": {"dir": str(tmp_path / "state"), "backend": "index"},
+        }
+    )
+    processor = BatchProcessor(config)
+
+    with patch.object(AudioConverter, "_execute_ffmpeg", side_effect=_fake_ffmpeg):
+        await processor.process_all()
+
+    output = tmp_path / "output" / "song.flac"
+    assert processor.state.get(output).input_path == str(input_dir / "song.mp3")
+    assert processor.state.verify(output) is True
+
+
+def test_audio_only_mkv_is_supported(input_dir: Path, tmp_path: Path):
+    (input_dir / "concert.mkv").write_bytes(b"\x1a\x45\xdf\xa3")
+    (input_dir / "film.mkv").write_bytes(b"\x1a\x45\xdf\xa3")
+    processor = _processor(BatchConfig(input_dir=input_dir, output_dir=tmp_path))
+
+    def classify(path):
+        return MediaType.AUDIO if path.name == "concert.mkv" else MediaType.VIDEO
+
+    with patch.object(processor.validator, "classify", side_effect=classify):
+        files = processor.find_audio_files()
+
+    assert [f.name for f in files] == ["concert.mkv", "other.ogg", "song.mp3"]
+
+
+@pytest.mark.asyncio
+async def test_ambiguous_inputs_probed_once_off_the_event_loop(
+    input_dir: Path, tmp_path: Path
+):
+    (input_dir / "concert.mkv").write_bytes(b"\x1a\x45\xdf\xa3")
+    (input_dir / "film.mkv").write_bytes(b"\x1a\x45\xdf\xa3")
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(input_dir),
+            "output_dir": str(tmp_path / "output"),
+            "video": {"enabled": True, "output_format": "mkv"},
+        }
+    )
+    processor = _processor(config)
+    probed = []
+
+    def classify(path):
+        probed.append((path.name, threading.current_thread()))
+        kinds = {"concert.mkv": MediaType.AUDIO, "film.mkv": MediaType.VIDEO}
+        return kinds.get(path.name, MediaType.UNKNOWN)
+
+    with patch.object(
+        processor.validator, "classify", side_effect=classify
+    ), patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ), patch.object(
+        processor.video_converter, "convert", return_value=None
+    ) as convert:
+        result = await processor.process_all()
+
+    # Other files are classified by extension alone, without a probe
+    mkv = [(name, thread) for name, thread in probed if name.endswith(".mkv")]
+    assert sorted(name for name, _ in mkv) == ["concert.mkv", "film.mkv"]
+    assert threading.main_thread() not in [thread for _, thread in mkv]
+    assert convert.call_args.args[0] == input_dir / "film.mkv"
+    assert result.audio_successful == 3
+
+
+@pytest.mark.asyncio
+async def test_diff_against_classifies_planned_outputs(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    (input_dir / "Old").mkdir(parents=True)
+    for name in ("match", "Old/move", "twin1", "twin2", "fresh", "copy"):
+        (input_dir / f"{name}.mp3").write_bytes(b"ID3\x04" + name.encode())
+    script = tmp_path / "name.py"
+    script.write_text(
+        "import json, sys\n"
+        "title = json.load(sys.stdin)['title']\n"
+        "print('Artist/Album/' + title.rstrip('12'))\n"
+    )
+    library = tmp_path / "library"
+    (library / "Artist" / "Album").mkdir(parents=True)
+    (library / "Artist" / "Album" / "match.flac").write_bytes(b"fLaC")
+    (library / "Old").mkdir()
+    (library / "Old" / "move.flac").write_bytes(b"fLaC")
+    # Same name as an input, but a different track of another album
+    (library / "Other").mkdir()
+    (library / "Other" / "fresh.flac").write_bytes(b"fLaC")
+    # Byte-identical to an input, filed elsewhere
+    (library / "Other" / "renamed.mp3").write_bytes(b"ID3\x04copy")
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        naming_command=[sys.executable, str(script)],
+    )
+    processor = _processor(config)
+
+    def extract(path):
+        meta = Metadata()
+        meta.title = Path(path).stem
+        return meta
+
+    with patch.object(
+        processor.metadata_extractor, "extract_metadata", side_effect=extract
+    ):
+        diff = await processor.diff_against(library)
+
+    album = Path("Artist/Album")
+    assert diff.matches == {input_dir / "match.mp3": album / "match.flac"}
+    assert diff.moves == {
+        input_dir / "Old" / "move.mp3": (Path("Old/move.flac"), album / "move.flac"),
+        input_dir / "copy.mp3": (Path("Other/renamed.mp3"), album / "copy.flac"),
+    }
+    assert diff.collisions == {
+        album / "twin.flac": [input_dir / "twin1.mp3", input_dir / "twin2.mp3"]
+    }
+    assert diff.new == {input_dir / "fresh.mp3": album / "fresh.flac"}
+    assert diff.summary == "1 match, 2 would move, 1 collide, 1 new"
+    assert not (tmp_path / "output").exists()
+
+
+@pytest.mark.asyncio
+async def test_unstable_files_skipped(input_dir: Path, tmp_path: Path):
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        skip_unstable_files=True,
+        stability_window=0.5,
+    )
+    processor = _processor(config)
+
+    async def keep_downloading():
+        await asyncio.sleep(0.1)
+        with (input_dir / "other.ogg").open("ab") as f:
+            f.write(b"\x00" * 100)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ):
+        result, _ = await asyncio.gather(processor.process_all(), keep_downloading())
+
+    assert result.total_files == 1
+    assert result.successful == 1
+    assert result.skipped == {"unsupported_format": 1, "still_being_written": 1}
+    assert not (tmp_path / "output" / "other.flac").exists()
+
+
+@pytest.mark.asyncio
+async def test_hanging_probe_reported_as_failure(
+    input_dir: Path, tmp_path: Path, monkeypatch
+):
+    bin_dir = tmp_path / "bin"
+    bin_dir.mkdir()
+    ffprobe = bin_dir / "ffprobe"
+    ffprobe.write_text(f"#!{sys.executable}\nimport time\ntime.sleep(30)\n")
+    ffprobe.chmod(0o755)
+    monkeypatch.setenv("PATH", f"{bin_dir}{os.pathsep}{os.environ['PATH']}")
+    config = BatchConfig(
+        input_dir=input_dir, output_dir=tmp_path / "output", probe_timeout=0.2
+    )
+    processor = _processor(config)
+
+    start = time.monotonic()
+    result = await processor.process_file(input_dir / "song.mp3")
+
+    assert time.monotonic() - start < 5
+    assert result.success is False
+    assert "Timed out after 0.2s probing" in result.error_message
+
+
+@pytest.mark.asyncio
+async def test_retry_failed_processes_only_failed_files(
+    input_dir: Path, tmp_path: Path
+):
+    (input_dir / "broken.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    failed_log = tmp_path / "failed.jsonl"
+    failed_log.write_text(
+        json.dumps({"action": "processed", "input": str(input_dir / "other.ogg")})
+        + "\n"
+        + json.dumps({"action": "failed", "input": str(input_dir / "song.mp3")})
+        + "\n"
+        + json.dumps({"input": str(input_dir / "broken.mp3"), "error": "boom"})
+        + "\n"
+    )
+    config = BatchConfig(
+        input_dir=input_dir, output_dir=tmp_path / "output", retry_failed=failed_log
+    )
+    processor = _processor(config)
+
+    def ffmpeg(cmd):
+        if "broken" in cmd[-1]:
+            return (1, "", "still broken")
+        return _fake_ffmpeg(cmd)
+
+    with patch.object(processor.converter, "_execute_ffmpeg", side_effect=ffmpeg):
+        result = await processor.process_all()
+
+    assert sorted(r.input_path.name for r in result.files) == ["broken.mp3", "song.mp3"]
+    assert result.failed_files == [input_dir / "broken.mp3"]
+    assert not (tmp_path / "output" / "other.flac").exists()
+    lines = failed_log.read_text().splitlines()
+    remaining = [json.loads(line)["input"] for line in lines]
+    assert remaining == [str(input_dir / "other.ogg"), str(input_dir / "broken.mp3")]
+
+
+@pytest.mark.asyncio
+async def test_flac_already_at_target_level_skipped(tmp_path: Path):
+    library = tmp_path / "library"
+    library.mkdir()
+    for name in ("optimal.flac", "fast.flac"):
+        (library / name).write_bytes(b"fLaC" + name.encode() + b"\x00" * 64)
+    state_dir = tmp_path / "state"
+    state = StateManager(state_dir)
+    for name, level in (("optimal.flac", 8), ("fast.flac", 5)):
+        path = library / name
+        state.record(path, path, compute_checksum(path, "sha256"), "sha256", level)
+    state.close()
+    config = BatchConfig(input_dir=library, output_dir=library, state_dir=state_dir)
+    processor = _processor(config)
+
+    flac = AudioProperties(sample_rate=44100, codec_name="flac", is_lossless=True)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ) as ffmpeg, patch.object(
+        processor.converter, "detect_audio_properties", return_value=flac
+    ):
+        result = await processor.process_all()
+
+    assert [r.input_path.name for r in result.files] == ["fast.flac"]
+    assert result.skipped == {"already_optimal": 1}
+    assert ffmpeg.call_count == 1
+    assert processor.state.get(library / "fast.flac").compression_level == 8
+
+
+@pytest.mark.asyncio
+async def test_already_optimal_checks_run_in_parallel(tmp_path: Path):
+    library = tmp_path / "library"
+    library.mkdir()
+    state_dir = tmp_path / "state"
+    state = StateManager(state_dir)
+    for index in range(4):
+        path = library / f"track{index}.flac"
+        path.write_bytes(b"fLaC" + bytes([index]) * 64)
+        state.record(path, path, compute_checksum(path, "sha256"), "sha256", 8)
+    state.close()
+    config = BatchConfig(
+        input_dir=library,
+        output_dir=library,
+        state_dir=state_dir,
+        skip_check_concurrency=2,
+    )
+    processor = _processor(config)
+    verify = processor.state.verify
+    lock = threading.Lock()
+    in_flight, peak = [0], [0]
+
+    def slow_verify(path):
+        with lock:
+            in_flight[0] += 1
+            peak[0] = max(peak[0], in_flight[0])
+        time.sleep(0.1)
+        with lock:
+            in_flight[0] -= 1
+        return verify(path)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ) as ffmpeg, patch.object(processor.state, "verify", side_effect=slow_verify):
+        result = await processor.process_all()
+
+    assert result.skipped == {"already_optimal": 4}
+    ffmpeg.assert_not_called()
+    assert peak[0] == 2
+
+
+@pytest.mark.asyncio
+async def test_intact_outputs_skipped_before_encoding(input_dir: Path, tmp_path: Path):
+    output_dir = tmp_path / "output"
+    output_dir.mkdir()
+    state_dir = tmp_path / "state"
+    state = StateManager(state_dir)
+    for name in ("song", "other"):
+        output = output_dir / f"{name}.flac"
+        output.write_bytes(b"fLaC" + name.encode() + b"\x00" * 64)
+        source = next(input_dir.glob(f"{name}.*"))
+        state.record(output, source, compute_checksum(output, "sha256"))
+    state.close()
+    # Edited since it was recorded, so its source is converted again
+    (output_dir / "other.flac").write_bytes(b"fLaC edited")
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=output_dir,
+        state_dir=state_dir,
+        skip_check_concurrency=2,
+    )
+    processor = _processor(config)
+    encode_file = processor.encode_file
+    encoded = []
+
+    async def tracking_encode(prepared):
+        encoded.append(prepared.input_path.name)
+        return await encode_file(prepared)
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg
+    ), patch.object(processor, "encode_file", side_effect=tracking_encode):
+        result = await processor.process_all()
+
+    assert encoded == ["other.ogg"]
+    assert result.skipped == {"already_converted": 1, "unsupported_format": 1}
+    assert [r.input_path.name for r in result.files] == ["other.ogg"]
+    assert (result.newly_processed, result.reprocessed) == (0, 1)
+    assert "1 successful, 0 failed, 2 skipped" in result.summary
+    assert "Resuming from earlier runs: 0 new, 1 reprocessed" in result.summary
+
+
+@pytest.mark.asyncio
+async def test_process_all_embeds_fetched_artwork_once_per_album(
+    input_dir: Path, tmp_path: Path
+):
+    config = BatchConfig(
+        input_dir=input_dir, output_dir=tmp_path / "output", embed_artwork=True
+    )
+    integrations = IntegrationManager()
+    integrations.register_integration("sonarr", _FakeSonarr())
+    processor = BatchProcessor(
+        config,
+        converter=AudioConverter(output_format="flac"),
+        integrations=integrations,
+    )
+    artwork = b"\xff\xd8\xff\xe0" + b"\x00" * 32
+    embedded = []
+
+    def fake_ffprobe(command, **kwargs):
+        tags = {
+            "title": Path(command[-1]).stem,
+            "artist": "Artist",
+            "album": "Album",
+            "show": "Show Name",
+        }
+        return json.dumps({"format": {"tags": tags}, "streams": []})
+
+    def ffmpeg(cmd):
+        if "attached_pic" in cmd:
+            inputs = [cmd[i + 1] for i, arg in enumerate(cmd) if arg == "-i"]
+            embedded.append(Path(inputs[1]).read_bytes())
+        return _fake_ffmpeg(cmd)
+
+    with patch("subprocess.check_output", side_effect=fake_ffprobe), patch.object(
+        processor.artwork, "download", return_value=artwork
+    ) as download, patch.object(
+        processor.converter, "_execute_ffmpeg", side_effect=ffmpeg
+    ):
+        result = await processor.process_all()
+
+    assert result.successful == 2
+    assert embedded == [artwork, artwork]
+    download.assert_called_once_with("http://img/cover.jpg")
+
+
+@pytest.mark.asyncio
+async def test_process_all_isolates_unexpected_errors(input_dir: Path, tmp_path: Path):
+    processor = _processor(
+        BatchConfig(input_dir=input_dir, output_dir=tmp_path / "output")
+    )
+
+    def extract(path):
+        if path.endswith("song.mp3"):
+            raise AttributeError("'NoneType' object has no attribute 'title'")
+        meta = Metadata()
+        meta.title = Path(path).stem
+        return meta
+
+    with patch.object(
+        processor.metadata_extractor, "extract_metadata", side_effect=extract
+    ), patch.object(processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg):
+        result = await processor.process_all()
+
+    assert result.successful == 1
+    assert [path.name for path in result.failed_files] == ["song.mp3"]
+    [failed] = [r for r in result.files if not r.success]
+    assert failed.error_message.startswith("Unexpected error: AttributeError")
+
+
+@pytest.mark.asyncio
+async def test_repeatedly_failing_input_is_quarantined(input_dir: Path, tmp_path: Path):
+    config = BatchConfig(
+        input_dir=input_dir,
+        output_dir=tmp_path / "output",
+        state_dir=tmp_path / "state",
+        max_failures_before_quarantine=3,
+    )
+
+    async def failing_ffmpeg(cmd):
+        if "song.mp3" in cmd[cmd.index("-i") + 1]:
+            return (1, "", "Invalid data found when processing input")
+        return _fake_ffmpeg(cmd)
+
+    async def run():
+        processor = _processor(config)
+        with patch.object(
+            processor.converter, "_execute_ffmpeg", side_effect=failing_ffmpeg
+        ):
+            return await processor.process_all()
+
+    for _ in range(2):
+        result = await run()
+        assert (input_dir / "song.mp3").exists()
+        assert not any(r.quarantine_path for r in result.files)
+
+    result = await run()
+
+    quarantined = tmp_path / "output" / "quarantine" / "song.mp3"
+    [failed] = [r for r in result.files if not r.success]
+    assert failed.quarantine_path == quarantined
+    assert quarantined.exists()
+    assert not (input_dir / "song.mp3").exists()
+    error = (quarantined.parent / "song.mp3.error.txt").read_text()
+    assert "Failed 3 runs in a row" in error
+    assert "Invalid data found" in error
+    # The file that keeps converting is never counted
+    assert (input_dir / "other.ogg").exists()
+    assert StateManager(tmp_path / "state").failure_count(input_dir / "song.mp3") == 0
+
+
+@pytest.mark.asyncio
+async def test_probe_and_encode_stages_run_at_their_own_concurrency(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    for index in range(6):
+        (input_dir / f"track{index}.mp3").write_bytes(b"ID3" + b"\x00" * 100)
+    processor = _processor(
+        BatchConfig(
+            input_dir=input_dir,
+            output_dir=tmp_path / "output",
+            concurrency=1,
+            probe_concurrency=3,
+        )
+    )
+    lock = threading.Lock()
+    running = {"probe": 0, "encode": 0}
+    peak = {"probe": 0, "encode": 0}
+
+    def enter(stage):
+        with lock:
+            running[stage] += 1
+            peak[stage] = max(peak[stage], running[stage])
+
+    def leave(stage):
+        with lock:
+            running[stage] -= 1
+
+    def slow_extract(path):
+        enter("probe")
+        time.sleep(0.1)
+        leave("probe")
+        return Metadata()
+
+    async def slow_ffmpeg(cmd):
+        enter("encode")
+        await asyncio.sleep(0.05)
+        leave("encode")
+        return _fake_ffmpeg(cmd)
+
+    with patch.object(
+        processor.metadata_extractor, "extract_metadata", side_effect=slow_extract
+    ), patch.object(processor.converter, "_execute_ffmpeg", side_effect=slow_ffmpeg):
+        result = await processor.process_all()
+
+    assert result.successful == 6
+    assert peak == {"probe": 3, "encode": 1}
+
+
+@pytest.mark.parametrize(
+    "relative_path, genre, expected",
+    [
+        ("Albums/song.mp3", "Rock", "music"),
+        ("Albums/song.mp3", "Podcast", "podcast"),
+        ("My Podcasts/Show/ep1.mp3", "", "podcast"),
+        ("Books/novel.m4a", "Audiobook", "audiobook"),
+        ("Spoken Word/lecture.mp3", "", "audiobook"),
+        ("podcast.mp3", "", "music"),
+    ],
+)
+def test_guess_content_type(relative_path: str, genre: str, expected: str):
+    assert guess_content_type(Path(relative_path), genre) == expected
+
+
+def test_loudness_target_follows_content_type(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(input_dir),
+            "output_dir": str(tmp_path / "output"),
+            "audio": {"normalize": True, "loudness_targets": {"podcast": -18}},
+            "profiles": [
+                {"path_prefix": "Books", "audio": {"content_type": "audiobook"}},
+                {
+                    "path_prefix": "Shows",
+                    "audio": {"output_format": "opus", "content_type": "podcast"},
+                },
+            ],
+        }
+    )
+    processor = BatchProcessor(config)
+    podcast = Metadata()
+    podcast.genre = "Podcast"
+
+    song = processor.converter_for(input_dir / "Albums" / "song.mp3")
+    episode = processor.converter_for(input_dir / "episode.mp3", podcast)
+    book = processor.converter_for(input_dir / "Books" / "chapter1.mp3")
+    show = processor.converter_for(input_dir / "Shows" / "ep1.mp3")
+
+    assert song.loudness_target == -16
+    assert episode.loudness_target == -18
+    assert book.loudness_target == -23
+    assert (show.output_format, show.loudness_target) == ("opus", -18)
+    assert song is processor.converter_for(input_dir / "Albums" / "other.mp3")
+
+
+def test_loudness_targets_unused_without_normalize(tmp_path: Path):
+    processor = BatchProcessor(
+        BatchConfig(input_dir=tmp_path / "input", output_dir=tmp_path / "output")
+    )
+
+    assert processor.converter_for(tmp_path / "input" / "song.mp3") is (
+        processor.converter
+    )
+    assert processor.converter.loudness_target is None
+
+
+@pytest.mark.asyncio
+async def test_normalized_encode_uses_content_type_lufs(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    (input_dir / "Audiobooks").mkdir(parents=True)
+    (input_dir / "song.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    (input_dir / "Audiobooks" / "chapter1.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    processor = BatchProcessor(
+        BatchConfig(
+            input_dir=input_dir, output_dir=tmp_path / "output", normalize=True
+        )
+    )
+    filters = {}
+
+    def record_ffmpeg(cmd):
+        filters[Path(cmd[cmd.index("-i") + 1]).name] = cmd[cmd.index("-af") + 1]
+        return _fake_ffmpeg(cmd)
+
+    with patch.object(AudioConverter, "_execute_ffmpeg", side_effect=record_ffmpeg):
+        await processor.process_file(input_dir / "song.mp3")
+        await processor.process_file(input_dir / "Audiobooks" / "chapter1.mp3")
+
+    assert filters == {
+        "song.mp3": "loudnorm=I=-16:TP=-1.5:LRA=11",
+        "chapter1.mp3": "loudnorm=I=-23:TP=-1.5:LRA=11",
+    }
+
+
+@pytest.mark.asyncio
+async def test_profiles_select_format_and_pattern_by_longest_prefix(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    output_dir = tmp_path / "output"
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(input_dir),
+            "output_dir": str(output_dir),
+            "profiles": [
+                {
+                    "path_prefix": "Podcasts",
+                    "audio": {"output_format": "opus", "quality": "64k"},
+                    "organization": {"music_pattern": "{album}/{title}"},
+                },
+                {
+                    "path_prefix": "/Podcasts/Archive/",
+                    "audio": {"output_format": "mp3"},
+                },
+            ],
+        }
+    )
+    processor = _processor(config)
+
+    def extract(path):
+        meta = Metadata()
+        meta.title = "Episode 1"
+        meta.album = "Show"
+        return meta
+
+    paths = {
+        name: input_dir / name / "ep1.mp3"
+        for name in ("Music", "Podcasts", "Podcasts/Archive")
+    }
+    outputs = {}
+    with patch.object(
+        processor.metadata_extractor, "extract_metadata", side_effect=extract
+    ):
+        for name, path in paths.items():
+            outputs[name], _, _ = await processor.determine_output_path(path)
+
+    assert outputs["Music"] == output_dir / "Music" / "ep1.flac"
+    assert outputs["Podcasts"] == output_dir / "Show" / "Episode 1.opus"
+    assert outputs["Podcasts/Archive"] == output_dir / "Podcasts/Archive/ep1.mp3"
+    assert processor.converter_for(paths["Podcasts"]).bitrate == "64k"
+    assert processor.profile_for(tmp_path / "elsewhere.mp3") is None
+
+
+@pytest.mark.asyncio
+@pytest.mark.parametrize("enabled", [True, False])
+async def test_primary_artist_for_path_groups_album(tmp_path: Path, enabled: bool):
+    input_dir = tmp_path / "input"
+    output_dir = tmp_path / "output"
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(input_dir),
+            "output_dir": str(output_dir),
+            "organization": {"primary_artist_for_path": enabled},
+            "profiles": [
+                {
+                    "path_prefix": "",
+                    "organization": {"music_pattern": "{artist}/{album}/{title}"},
+                }
+            ],
+        }
+    )
+    processor = _processor(config)
+    artists = {"one.mp3": "Band", "two.mp3": "Band feat. Guest"}
+
+    def extract(path):
+        meta = Metadata()
+        meta.artist = artists[Path(path).name]
+        meta.album = "Record"
+        meta.title = Path(path).stem
+        return meta
+
+    with patch.object(
+        processor.metadata_extractor, "extract_metadata", side_effect=extract
+    ):
+        output, meta, _ = await processor.determine_output_path(input_dir / "two.mp3")
+
+    folder = "Band" if enabled else "Band feat. Guest"
+    assert output == output_dir / folder / "Record" / "two.flac"
+    assert meta.artist == "Band feat. Guest"
+
+
+@pytest.mark.asyncio
+async def test_fail_fast_stops_after_first_failure(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    for name in ("a.mp3", "b.mp3", "c.mp3"):
+        (input_dir / name).write_bytes(b"ID3\x04" + b"\x00" * 100)
+    processor = _processor(
+        BatchConfig(
+            input_dir=input_dir,
+            output_dir=tmp_path / "output",
+            concurrency=1,
+            probe_concurrency=1,
+            fail_fast=True,
+        )
+    )
+    encoded = []
+
+    def ffmpeg(cmd):
+        name = Path(cmd[-1]).name.split(".")[0]
+        encoded.append(name)
+        if name == "a":
+            return (1, "", "Invalid data found when processing input")
+        return _fake_ffmpeg(cmd)
+
+    with patch.object(processor.converter, "_execute_ffmpeg", side_effect=ffmpeg):
+        result = await processor.process_all()
+
+    assert encoded == ["a"]
+    assert (result.successful, result.failed, result.not_processed) == (0, 1, 2)
+    assert list(result.errors_by_file) == [input_dir / "a.mp3"]
+    assert "Invalid data" in result.errors_by_file[input_dir / "a.mp3"]
+    assert result.aborted_by.input_path == input_dir / "a.mp3"
+    assert "Invalid data" in result.aborted_by.error_message
+    assert "Stopped at the first failure" in result.summary
+
+
+@pytest.mark.asyncio
+async def test_fail_fast_cancels_encodes_in_flight(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    output_dir = tmp_path / "output"
+    input_dir.mkdir()
+    for name in ("bad.mp3", "slow.mp3"):
+        (input_dir / name).write_bytes(b"ID3\x04" + b"\x00" * 100)
+    processor = _processor(
+        BatchConfig(
+            input_dir=input_dir, output_dir=output_dir, concurrency=2, fail_fast=True
+        )
+    )
+
+    async def ffmpeg(cmd):
+        output = Path(cmd[-1])
+        if output.name.startswith("bad."):
+            await asyncio.sleep(0.1)
+            return (1, "", "Invalid data found when processing input")
+        output.write_bytes(b"fLaC")  # Partial output
+        await asyncio.sleep(30)
+        return _fake_ffmpeg(cmd)
+
+    start = time.monotonic()
+    with patch.object(processor.converter, "_execute_ffmpeg", side_effect=ffmpeg):
+        result = await processor.process_all()
+
+    assert time.monotonic() - start < 10
+    assert result.aborted_by.input_path == input_dir / "bad.mp3"
+    assert (result.failed, result.not_processed) == (1, 1)
+    assert not (output_dir / "slow.flac").exists()
+    assert not list(output_dir.glob("*.tmp"))
+
+
+@pytest.mark.asyncio
+async def test_without_fail_fast_failures_do_not_stop_run(
+    input_dir: Path, tmp_path: Path
+):
+    processor = _processor(
+        BatchConfig(input_dir=input_dir, output_dir=tmp_path / "output", concurrency=1)
+    )
+
+    with patch.object(
+        processor.converter, "_execute_ffmpeg", return_value=(1, "", "broken")
+    ):
+        result = await processor.process_all()
+
+    assert (result.failed, result.not_processed) == (2, 0)
+    assert result.aborted_by is None
+
+
+@pytest.mark.asyncio
+async def test_in_place_replaces_only_verified_outputs(tmp_path: Path):
+    library = tmp_path / "library"
+    library.mkdir()
+    for name in ("good.flac", "bad.flac"):
+        (library / name).write_bytes(b"fLaC" + name.encode() * 16)
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(library),
+            "output_dir": str(tmp_path / "ignored"),
+            "in_place": True,
+            "organization": {
+                "keep_originals": True,
+                "originals_dir": str(tmp_path / "originals"),
+            },
+        }
+    )
+    assert config.output_dir == library
+    assert config.verify_decodable is True
+    processor = BatchProcessor(config)
+
+    async def ffmpeg(cmd):
+        if cmd[-1] == "-":
+            if "bad" in cmd[-4]:
+                return (0, "", "Invalid frame header")
+            return (0, "", "")
+        return _fake_ffmpeg(cmd)
+
+    with patch.object(processor.converter, "_execute_ffmpeg", side_effect=ffmpeg):
+        result = await processor.process_all()
+
+    assert (result.successful, result.failed) == (1, 1)
+    assert (library / "good.flac").read_bytes() == b"fLaC" + b"\x00" * 64
+    assert (library / "bad.flac").read_bytes() == b"fLaC" + b"bad.flac" * 16
+    assert sorted(p.name for p in library.iterdir()) == ["bad.flac", "good.flac"]
+    originals = tmp_path / "originals"
+    assert (originals / "good.flac").read_bytes() == b"fLaC" + b"good.flac" * 16
+
+
+@pytest.mark.asyncio
+async def test_in_place_cross_format_output_replaces_input(tmp_path: Path):
+    library = tmp_path / "library"
+    (library / "Album").mkdir(parents=True)
+    (library / "Album" / "song.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(library),
+            "output_dir": str(tmp_path / "ignored"),
+            "in_place": True,
+            "audio": {"output_format": "flac"},
+            "organization": {
+                "keep_originals": True,
+                "originals_dir": str(tmp_path / "originals"),
+            },
+        }
+    )
+    processor = _processor(config)
+
+    async def ffmpeg(cmd):
+        if cmd[-1] == "-":
+            return (0, "", "")
+        return _fake_ffmpeg(cmd)
+
+    with patch.object(processor.converter, "_execute_ffmpeg", side_effect=ffmpeg):
+        result = await processor.process_all()
+
+    assert result.successful == 1
+    assert [p.name for p in (library / "Album").iterdir()] == ["song.flac"]
+    original = tmp_path / "originals" / "Album" / "song.mp3"
+    assert original.read_bytes() == b"ID3\x04" + b"\x00" * 100
+
+
+@pytest.mark.asyncio
+async def test_prefetch_reads_files_ahead_of_processing(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    names = [f"track{index}.mp3" for index in range(6)]
+    for name in names:
+        (input_dir / name).write_bytes(b"ID3\x04" + b"\x00" * 100)
+    processor = _processor(
+        BatchConfig(
+            input_dir=input_dir,
+            output_dir=tmp_path / "output",
+            concurrency=1,
+            probe_concurrency=1,
+            prefetch=2,
+        )
+    )
+    events = []
+
+    def reader(path):
+        events.append(("read", path.name))
+
+    def extract(path):
+        events.append(("probe", Path(path).name))
+        time.sleep(0.05)
+        return Metadata()
+
+    with patch("src.storage.readahead.read_head", side_effect=reader), patch.object(
+        processor.metadata_extractor, "extract_metadata", side_effect=extract
+    ), patch.object(processor.converter, "_execute_ffmpeg", side_effect=_fake_ffmpeg):
+        result = await processor.process_all()
+
+    assert result.successful == 6
+    # The first file may be probed straight away; every later one is read first
+    for name in names[1:]:
+        assert events.index(("read", name)) < events.index(("probe", name))
+
+
+@pytest.mark.parametrize("keep", [True, False])
+@pytest.mark.asyncio
+async def test_keep_work_artifacts_after_failed_encode(tmp_path: Path, keep: bool):
+    input_dir = tmp_path / "input"
+    work_dir = tmp_path / "work"
+    input_dir.mkdir()
+    (input_dir / "episode.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    (input_dir / "episode.chapters.json").write_text('[{"start": 0}]')
+    processor = BatchProcessor(
+        BatchConfig(
+            input_dir=input_dir,
+            output_dir=tmp_path / "output",
+            work_dir=work_dir,
+            keep_work_artifacts=keep,
+        )
+    )
+
+    with patch.object(
+        AudioConverter, "_get_audio_duration", return_value=60000.0
+    ), patch.object(
+        AudioConverter, "_execute_ffmpeg", return_value=(1, "", "Conversion failed")
+    ):
+        result = await processor.process_all()
+
+    assert result.failed == 1
+    artifacts = sorted(path.name for path in work_dir.glob("run-*/*"))
+    if keep:
+        assert len(artifacts) == 1
+        assert artifacts[0].startswith("episode.chapters-")
+    else:
+        assert list(work_dir.iterdir()) == []
+    assert processor.converter.work_dir is None
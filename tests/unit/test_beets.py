@@ -0,0 +1,269 @@
+"""Unit tests for the beets integration."""
+
+import json
+import threading
+import pytest
+from http.server import BaseHTTPRequestHandler, HTTPServer
+from pathlib import Path
+from unittest.mock import patch
+
+from src.audio.converter import AudioConverter
+from src.integrations.beets import BeetsClient, BeetsError, batch_paths
+from src.integrations.integration_manager import IntegrationManager
+from src.metadata.metadata import Metadata
+from src.processor.batch_processor import BatchConfig, BatchProcessor
+
+
+class _BeetsHandler(BaseHTTPRequestHandler):
+    """Records import requests and queries and answers like a beets server."""
+
+    def do_GET(self):
+        self.server.queries.append(self.path)
+        self.send_response(200)
+        self.send_header("Content-Type", "application/json")
+        self.end_headers()
+        self.wfile.write(json.dumps({"results": self.server.library}).encode())
+
+    def do_POST(self):
+        body = self.rfile.read(int(self.headers["Content-Length"]))
+        self.server.requests.append(
+            {
+                "path": self.path,
+                "auth": self.headers.get("Authorization"),
+                "body": json.loads(body),
+            }
+        )
+        status = self.server.status
+        self.send_response(status)
+        self.send_header("Content-Type", "application/json")
+        self.end_headers()
+        self.wfile.write(json.dumps({"imported": status == 200}).encode())
+
+    def log_message(self, format, *args):
+        pass
+
+
+@pytest.fixture
+def beets_server():
+    """Run a fake beets server on a random local port."""
+    server = HTTPServer(("127.0.0.1", 0), _BeetsHandler)
+    server.requests = []
+    server.queries = []
+    server.library = []
+    server.status = 200
+    thread = threading.Thread(target=server.serve_forever, daemon=True)
+    thread.start()
+    yield server
+    server.shutdown()
+    server.server_close()
+
+
+def _url(server: HTTPServer) -> str:
+    return f"http://127.0.0.1:{server.server_port}"
+
+
+def test_import_to_beets_posts_paths(beets_server):
+    client = BeetsClient(_url(beets_server), token="secret")
+
+    response = client.import_to_beets([Path("/music/a.flac")])
+
+    assert response == {"imported": True}
+    request = beets_server.requests[0]
+    assert request["path"] == "/api/import"
+    assert request["auth"] == "Bearer secret"
+    assert request["body"] == {
+        "paths": ["/music/a.flac"],
+        "copy": False,
+        "move": False,
+        "write": True,
+    }
+
+
+def test_import_to_beets_http_error(beets_server):
+    beets_server.status = 500
+    client = BeetsClient(_url(beets_server))
+
+    with pytest.raises(BeetsError):
+        client.import_to_beets([Path("/music/a.flac")])
+
+
+def test_find_track_matches_artist_and_title_exactly(beets_server):
+    beets_server.library = [
+        {"id": 1, "artist": "Nick Drake", "title": "Road"},
+        {"id": 2, "artist": "Nick Drake", "title": "Roadside"},
+    ]
+    client = BeetsClient(_url(beets_server))
+
+    items = client.find_track(artist="nick drake", title="Road/Live")
+
+    assert beets_server.queries == [
+        "/item/query/artist%3Anick%20drake/title%3ARoad%5C%2FLive"
+    ]
+    assert items == []
+    assert [item["id"] for item in client.find_track("Nick Drake", "road")] == [1]
+
+
+def test_find_track_prefers_mbid(beets_server):
+    beets_server.library = [{"id": 7, "artist": "Other", "title": "Tagged"}]
+    client = BeetsClient(_url(beets_server))
+
+    items = client.find_track(artist="Nick Drake", title="Road", mbid="abc-123")
+
+    assert beets_server.queries == ["/item/query/mb_trackid%3Aabc-123"]
+    assert [item["id"] for item in items] == [7]
+    assert client.find_track(artist="Nick Drake") == []
+
+
+def test_batch_paths():
+    paths = [Path(f"{i}.flac") for i in range(5)]
+
+    assert [len(b) for b in batch_paths(paths, 2)] == [2, 2, 1]
+
+
+@pytest.mark.asyncio
+async def test_import_after_run_sends_outputs(beets_server, tmp_path: Path):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    (input_dir / "song.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    (input_dir / "other.ogg").write_bytes(b"OggS" + b"\x00" * 100)
+    output_dir = tmp_path / "output"
+
+    integrations = IntegrationManager.from_config(
+        {"integrations": {"beets": {"enabled": True, "url": _url(beets_server)}}}
+    )
+    config = BatchConfig(
+        input_dir=input_dir, output_dir=output_dir, beets_import_after_run=True
+    )
+    processor = BatchProcessor(
+        config,
+        converter=AudioConverter(output_format="flac"),
+        integrations=integrations,
+    )
+
+    def fake_ffmpeg(cmd):
+        Path(cmd[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+        return (0, "", "")
+
+    with patch.object(processor.converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+        await processor.process_all()
+
+    assert len(beets_server.requests) == 1
+    body = beets_server.requests[0]["body"]
+    assert body["paths"] == [
+        str(output_dir / "other.flac"),
+        str(output_dir / "song.flac"),
+    ]
+    assert (body["copy"], body["move"], body["write"]) == (False, False, True)
+
+
+@pytest.mark.asyncio
+async def test_import_after_run_batches_by_configured_size(
+    beets_server, tmp_path: Path
+):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    for index in range(200):
+        (input_dir / f"track{index:03d}.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+
+    config = BatchConfig.from_dict(
+        {
+            "input_dir": str(input_dir),
+            "output_dir": str(tmp_path / "output"),
+            "concurrency": 16,
+            "integrations": {
+                "beets": {
+                    "enabled": True,
+                    "url": _url(beets_server),
+                    "import_after_run": True,
+                    "import_batch_size": 64,
+                }
+            },
+        }
+    )
+    integrations = IntegrationManager.from_config(
+        {"integrations": {"beets": {"enabled": True, "url": _url(beets_server)}}}
+    )
+    processor = BatchProcessor(
+        config,
+        converter=AudioConverter(output_format="flac"),
+        integrations=integrations,
+    )
+
+    def fake_ffmpeg(cmd):
+        Path(cmd[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+        return (0, "", "")
+
+    with patch.object(processor.converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+        result = await processor.process_all()
+
+    assert result.successful == 200
+    sizes = [len(request["body"]["paths"]) for request in beets_server.requests]
+    assert sizes == [64, 64, 64, 8]
+
+
+def _library_processor(input_dir: Path, output_dir: Path, url: str) -> BatchProcessor:
+    data = {
+        "input_dir": str(input_dir),
+        "output_dir": str(output_dir),
+        "integrations": {
+            "beets": {"enabled": True, "url": url, "skip_if_in_library": True}
+        },
+    }
+    return BatchProcessor(
+        BatchConfig.from_dict(data),
+        converter=AudioConverter(output_format="flac"),
+        integrations=IntegrationManager.from_config(data),
+    )
+
+
+def _tagged(path):
+    meta = Metadata()
+    meta.artist = "Nick Drake"
+    meta.title = Path(path).stem.title()
+    return meta
+
+
+@pytest.mark.asyncio
+async def test_skip_if_in_library(beets_server, tmp_path: Path):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    (input_dir / "road.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    (input_dir / "pink moon.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    processor = _library_processor(input_dir, tmp_path / "output", _url(beets_server))
+    encoded = []
+
+    def fake_ffmpeg(cmd):
+        encoded.append(Path(cmd[-1]).name)
+        Path(cmd[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+        return (0, "", "")
+
+    beets_server.library = [{"id": 3, "artist": "Nick Drake", "title": "Road"}]
+    with patch.object(
+        processor.metadata_extractor, "extract_metadata", side_effect=_tagged
+    ), patch.object(processor.converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+        result = await processor.process_all()
+
+    # The fake library answers every query with "Road"; only road.mp3 is it
+    assert encoded == ["pink moon.flac.tmp"]
+    assert (result.total_files, result.successful, result.failed) == (1, 1, 0)
+    assert result.skipped == {"in_beets_library": 1}
+
+
+@pytest.mark.asyncio
+async def test_unreachable_beets_does_not_block_conversion(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    (input_dir / "road.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    processor = _library_processor(input_dir, tmp_path / "output", "http://127.0.0.1:1")
+
+    def fake_ffmpeg(cmd):
+        Path(cmd[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+        return (0, "", "")
+
+    with patch.object(
+        processor.metadata_extractor, "extract_metadata", side_effect=_tagged
+    ), patch.object(processor.converter, "_execute_ffmpeg", side_effect=fake_ffmpeg):
+        result = await processor.process_all()
+
+    assert result.successful == 1
+    assert result.skipped == {}
@@ -0,0 +1,104 @@
+"""Unit tests for chapter sidecars."""
+
+from pathlib import Path
+
+import pytest
+
+from src.audio.chapters import (
+    Chapter,
+    ChapterError,
+    ffmetadata,
+    find_chapter_sidecar,
+    load_chapters,
+    validate_chapters,
+)
+
+
+def test_find_chapter_sidecar_prefers_json(tmp_path: Path):
+    audio = tmp_path / "episode.MP3"
+    assert find_chapter_sidecar(audio) is None
+
+    (tmp_path / "episode.ffmetadata").write_text(";FFMETADATA1\n")
+    assert find_chapter_sidecar(audio) == tmp_path / "episode.ffmetadata"
+
+    (tmp_path / "episode.chapters.json").write_text("[]")
+    assert find_chapter_sidecar(audio) == tmp_path / "episode.chapters.json"
+
+
+def test_load_json_chapters(tmp_path: Path):
+    sidecar = tmp_path / "episode.chapters.json"
+    sidecar.write_text(
+        '{"chapters": [{"start": 0, "title": "Intro"}, '
+        '{"start": 61.5, "end": 120, "title": "Interview"}]}'
+    )
+
+    assert load_chapters(sidecar) == [
+        Chapter(start=0.0, title="Intro"),
+        Chapter(start=61.5, end=120.0, title="Interview"),
+    ]
+
+
+def test_load_ffmetadata_chapters(tmp_path: Path):
+    sidecar = tmp_path / "episode.ffmetadata"
+    sidecar.write_text(
+        ";FFMETADATA1\n"
+        "title=Episode 12\n"
+        "[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=61500\ntitle=Intro\n"
+        "[CHAPTER]\nTIMEBASE=1/10\nSTART=615\nEND=1200\ntitle=Interview\n"
+    )
+
+    assert load_chapters(sidecar) == [
+        Chapter(start=0.0, end=61.5, title="Intro"),
+        Chapter(start=61.5, end=120.0, title="Interview"),
+    ]
+
+
+@pytest.mark.parametrize(
+    "name, content",
+    [
+        ("a.chapters.json", "not json"),
+        ("b.chapters.json", '{"title": "no chapters"}'),
+        ("c.chapters.json", '[{"title": "no start"}]'),
+        ("d.ffmetadata", "[CHAPTER]\nSTART=0\n"),
+        ("e.ffmetadata", ";FFMETADATA1\n[CHAPTER]\nEND=10\n"),
+    ],
+)
+def test_malformed_sidecars_rejected(tmp_path: Path, name: str, content: str):
+    sidecar = tmp_path / name
+    sidecar.write_text(content)
+
+    with pytest.raises(ChapterError):
+        load_chapters(sidecar)
+
+
+def test_validate_fills_in_missing_ends():
+    chapters = [Chapter(start=0, title="Intro"), Chapter(start=60, title="Outro")]
+
+    assert validate_chapters(chapters, duration_s=90) == [
+        Chapter(start=0, end=60, title="Intro"),
+        Chapter(start=60, end=90, title="Outro"),
+    ]
+
+
+@pytest.mark.parametrize(
+    "chapters, message",
+    [
+        ([Chapter(start=-1)], "outside"),
+        ([Chapter(start=90)], "outside"),
+        ([Chapter(start=0, end=120)], "after the 90s"),
+        ([Chapter(start=30, end=10)], "before it starts"),
+        ([Chapter(start=0, end=50), Chapter(start=40)], "previous chapter"),
+    ],
+)
+def test_validate_rejects_chapters_outside_duration(chapters, message: str):
+    with pytest.raises(ChapterError, match=message):
+        validate_chapters(chapters, duration_s=90)
+
+
+def test_ffmetadata_renders_milliseconds_and_escapes_titles():
+    text = ffmetadata([Chapter(start=1.25, end=2.5, title="Q&A; part=1")])
+
+    assert text == (
+        ";FFMETADATA1\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=1250\nEND=2500\n"
+        "title=Q&A\\; part\\=1\n"
+    )
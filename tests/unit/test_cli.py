@@ -0,0 +1,195 @@
+"""Unit tests for the batch command-line entry point."""
+
+import json
+import pytest
+import yaml
+from pathlib import Path
+from unittest.mock import AsyncMock, patch
+
+from src.audio.converter import AudioConverter, AudioOutputPlan
+from src.cli import exit_code, main
+from src.processor.batch_processor import BatchResult
+from src.processor.selftest import SelfTestCheck, SelfTestReport
+from src.state.state import StateManager
+
+
+def _write_config(tmp_path: Path, input_dir: Path) -> Path:
+    config_path = tmp_path / "config.yaml"
+    config_path.write_text(
+        yaml.safe_dump(
+            {"input_dir": str(input_dir), "output_dir": str(tmp_path / "output")}
+        )
+    )
+    return config_path
+
+
+def test_verify_mode_exit_code(tmp_path: Path, capsys):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    (input_dir / "good.flac").write_bytes(b"fLaC" + b"\x00" * 64)
+    config_path = _write_config(tmp_path, input_dir)
+
+    assert main(["--config", str(config_path), "--verify"]) == 0
+
+    (input_dir / "bad.flac").touch()
+    assert main(["--config", str(config_path), "--verify"]) == 2
+    assert "bad.flac" in capsys.readouterr().out
+    assert not (tmp_path / "output").exists()
+
+
+def test_config_dir_overrides_config_file(tmp_path: Path, capsys):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    (input_dir / "bad.flac").touch()
+    config_path = _write_config(tmp_path, tmp_path / "missing")
+    config_dir = tmp_path / "conf.d"
+    config_dir.mkdir()
+    (config_dir / "10-input.yaml").write_text(f"input_dir: {input_dir}\n")
+
+    exit_code = main(
+        ["--config", str(config_path), "--config-dir", str(config_dir), "--verify"]
+    )
+
+    # The only file is corrupt
+    assert exit_code == 3
+    assert "bad.flac" in capsys.readouterr().out
+
+
+def test_analyze_mode_prints_plan_without_encoding(tmp_path: Path, capsys):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    (input_dir / "song.mp3").write_bytes(b"ID3" + b"\x00" * 64)
+    config_path = _write_config(tmp_path, input_dir)
+    plan = AudioOutputPlan(
+        input_path=input_dir / "song.mp3",
+        output_path=tmp_path / "output" / "song.flac",
+        codec="flac",
+        sample_rate=44100,
+        channels=2,
+        bitrate=846720,
+        duration_ms=200000.0,
+        estimated_size_bytes=21168000,
+        command=[],
+    )
+
+    with patch.object(
+        AudioConverter, "plan_conversion", new_callable=AsyncMock, return_value=plan
+    ):
+        assert main(["--config", str(config_path), "--analyze"]) == 0
+
+    out = capsys.readouterr().out
+    assert "song.mp3 -> song.flac: flac, 846 kb/s, 44100 Hz, 3:20, ~21.2 MB" in out
+    assert not (tmp_path / "output").exists()
+
+
+def test_version_json_needs_no_config(capsys):
+    assert main(["--version", "--json"]) == 0
+
+    info = json.loads(capsys.readouterr().out)
+    assert set(info) == {"version", "python_version", "git_commit", "build_date"}
+
+
+def test_export_state_writes_csv(tmp_path: Path, capsys):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    config_path = tmp_path / "config.yaml"
+    config_path.write_text(
+        yaml.safe_dump(
+            {
+                "input_dir": str(input_dir),
+                "output_dir": str(tmp_path / "output"),
+                "state": {"dir": str(tmp_path / "state")},
+            }
+        )
+    )
+    StateManager(tmp_path / "state").record(
+        Path("/output/song.flac"), Path("/input/song.mp3"), "abc"
+    )
+    csv_path = tmp_path / "state.csv"
+
+    assert main(["--config", str(config_path), "--export-state", str(csv_path)]) == 0
+
+    assert "Exported 1 records" in capsys.readouterr().out
+    assert csv_path.read_text().splitlines()[1].startswith(
+        "/input/song.mp3,/output/song.flac,abc,sha256,"
+    )
+
+
+def test_destructive_config_needs_confirmation(tmp_path: Path, capsys):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    (input_dir / "song.flac").write_bytes(b"fLaC" + b"\x00" * 64)
+    config_path = _write_config(tmp_path, input_dir)
+
+    with patch(
+        "src.cli.BatchProcessor.process_all", new_callable=AsyncMock
+    ) as process_all:
+        assert main(["--config", str(config_path), "--in-place"]) == 1
+        process_all.assert_not_awaited()
+
+        err = capsys.readouterr().err
+        assert "Refusing to start" in err
+        assert "in_place" in err
+
+        process_all.return_value = BatchResult(total_files=0)
+        assert main(["--config", str(config_path), "--in-place", "--yes"]) == 0
+        process_all.assert_awaited_once()
+
+
+@pytest.mark.parametrize(
+    "succeeded,failed,expected", [(3, 0, 0), (0, 0, 0), (2, 1, 2), (0, 3, 3)]
+)
+def test_exit_code_maps_outcomes(succeeded: int, failed: int, expected: int):
+    assert exit_code(succeeded, failed) == expected
+
+
+def test_config_errors_and_interrupts_have_their_own_exit_codes(
+    tmp_path: Path, capsys
+):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    config_path = _write_config(tmp_path, input_dir)
+
+    with pytest.raises(SystemExit) as exited:
+        main(["--config", str(config_path), "--shard-index", "2"])
+    assert exited.value.code == 1
+    assert "shard_index" in capsys.readouterr().err
+
+    with patch(
+        "src.cli.BatchProcessor.process_all",
+        new_callable=AsyncMock,
+        side_effect=KeyboardInterrupt,
+    ):
+        assert main(["--config", str(config_path)]) == 130
+    assert "Interrupted" in capsys.readouterr().err
+
+
+def test_selftest_mode_and_startup_gate(tmp_path: Path, capsys):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    config_path = tmp_path / "config.yaml"
+    config_path.write_text(
+        yaml.safe_dump(
+            {
+                "input_dir": str(input_dir),
+                "output_dir": str(tmp_path / "output"),
+                "selftest": {"on_startup": True},
+            }
+        )
+    )
+    passing = SelfTestReport([SelfTestCheck("ffmpeg", True, "6.1")])
+    failing = SelfTestReport([SelfTestCheck("ffmpeg", False, "not installed")])
+
+    with patch(
+        "src.cli.SelfTest.run", new_callable=AsyncMock, return_value=passing
+    ), patch("src.cli.BatchProcessor.process_all", new_callable=AsyncMock) as run:
+        assert main(["--config", str(config_path), "--selftest"]) == 0
+        assert "Self-test passed" in capsys.readouterr().out
+        run.assert_not_awaited()
+
+    with patch(
+        "src.cli.SelfTest.run", new_callable=AsyncMock, return_value=failing
+    ), patch("src.cli.BatchProcessor.process_all", new_callable=AsyncMock) as run:
+        assert main(["--config", str(config_path)]) == 1
+        assert "Refusing to start" in capsys.readouterr().err
+        run.assert_not_awaited()
@@ -1,5 +1,5 @@
 import pytest
-from src.config.config import ConfigLoader
+from src.config.config import ConfigLoader, merge_configs
 import yaml
 
 
@@ -27,3 +27,38 @@ def test_load_config_invalid_file(tmp_path):
     loader = ConfigLoader(invalid_path)
     config = loader.load_config()
     assert config == {}
+
+
+def test_merge_configs_deep_merges_sections():
+    base = {"audio": {"output_format": "flac", "enabled": True}, "concurrency": 4}
+    override = {"audio": {"output_format": "opus"}, "concurrency": 8}
+
+    merged = merge_configs(base, override)
+
+    assert merged == {
+        "audio": {"output_format": "opus", "enabled": True},
+        "concurrency": 8,
+    }
+    assert base["audio"]["output_format"] == "flac"
+
+
+def test_load_directory_merges_fragments_in_lexical_order(tmp_path):
+    fragments = {
+        "10-base.yaml": {"input_dir": "/in", "integrations": {"beets": {"url": "a"}}},
+        "20-beets.yaml": {"integrations": {"beets": {"url": "b", "enabled": True}}},
+        "30-sonarr.yaml": {"integrations": {"sonarr": {"enabled": False}}},
+        "notes.txt": {"input_dir": "/ignored"},
+    }
+    for name, data in fragments.items():
+        with (tmp_path / name).open("w") as file:
+            yaml.dump(data, file)
+
+    config = ConfigLoader.load_directory(tmp_path)
+
+    assert config == {
+        "input_dir": "/in",
+        "integrations": {
+            "beets": {"url": "b", "enabled": True},
+            "sonarr": {"enabled": False},
+        },
+    }
@@ -0,0 +1,145 @@
+"""Unit tests for the email run report notifier."""
+
+import email
+import socketserver
+import threading
+import pytest
+from pathlib import Path
+from unittest.mock import patch
+
+from src.notifications.email_notifier import EmailNotifier
+from src.notifications.notifier import notifiers_from_config
+from src.processor.batch_processor import BatchResult
+
+
+class _SMTPHandler(socketserver.StreamRequestHandler):
+    """Speaks just enough SMTP to accept one plain-text message."""
+
+    def reply(self, line: str):
+        self.wfile.write(f"{line}\r\n".encode())
+
+    def handle(self):
+        self.reply("220 localhost ready")
+        while True:
+            line = self.rfile.readline().decode().strip()
+            verb = line.split(" ", 1)[0].upper()
+            if verb in ("EHLO", "HELO"):
+                self.reply("250 localhost")
+            elif verb in ("MAIL", "RCPT", "RSET", "NOOP"):
+                self.server.envelope.append(line)
+                self.reply("250 OK")
+            elif verb == "DATA":
+                self.reply("354 End data with <CR><LF>.<CR><LF>")
+                data = []
+                while True:
+                    data_line = self.rfile.readline().decode()
+                    if data_line in (".\r\n", ""):
+                        break
+                    data.append(data_line)
+                self.server.messages.append("".join(data))
+                self.reply("250 OK")
+            elif verb == "QUIT":
+                self.reply("221 Bye")
+                return
+            else:
+                self.reply("502 Not implemented")
+                if not line:
+                    return
+
+
+@pytest.fixture
+def smtp_server():
+    """Run a fake SMTP server on a random local port."""
+    server = socketserver.ThreadingTCPServer(("127.0.0.1", 0), _SMTPHandler)
+    server.daemon_threads = True
+    server.messages = []
+    server.envelope = []
+    thread = threading.Thread(target=server.serve_forever, daemon=True)
+    thread.start()
+    yield server
+    server.shutdown()
+    server.server_close()
+
+
+def _result() -> BatchResult:
+    return BatchResult(
+        total_files=3,
+        successful=2,
+        failed=1,
+        failed_files=[Path("/input/broken.mp3")],
+        duration_s=4.2,
+    )
+
+
+def test_send_delivers_report(smtp_server):
+    notifier = EmailNotifier(
+        host="127.0.0.1",
+        port=smtp_server.server_address[1],
+        sender="refinery@example.com",
+        recipients=["me@example.com"],
+        security="none",
+    )
+
+    assert notifier.notify(_result()) is True
+
+    assert "rcpt to:<me@example.com>" in [
+        line.lower() for line in smtp_server.envelope
+    ]
+    message = email.message_from_string(smtp_server.messages[0])
+    assert message["Subject"] == "Media Refinery: 2 processed, 1 failed"
+    body = message.get_payload()
+    assert "Processed 3 files: 2 successful, 1 failed" in body
+    assert "/input/broken.mp3" in body
+
+
+def test_notify_logs_instead_of_raising():
+    notifier = EmailNotifier(
+        host="127.0.0.1",
+        port=1,
+        sender="refinery@example.com",
+        recipients=["me@example.com"],
+        security="none",
+        timeout=1.0,
+    )
+
+    assert notifier.notify(_result()) is False
+
+
+def test_starttls_upgrades_connection():
+    notifier = EmailNotifier(
+        host="smtp.example.com",
+        sender="refinery@example.com",
+        recipients=["me@example.com"],
+        username="user",
+        password="secret",
+    )
+
+    with patch("smtplib.SMTP") as mock_smtp:
+        notifier.send(_result())
+
+    smtp = mock_smtp.return_value
+    smtp.starttls.assert_called_once()
+    smtp.login.assert_called_once_with("user", "secret")
+    smtp.send_message.assert_called_once()
+
+
+def test_notifiers_from_config():
+    config = {
+        "notifications": {
+            "email": {
+                "enabled": True,
+                "smtp_host": "smtp.example.com",
+                "smtp_port": 465,
+                "security": "TLS",
+                "from": "refinery@example.com",
+                "to": "me@example.com",
+            }
+        }
+    }
+
+    (notifier,) = notifiers_from_config(config)
+
+    assert notifier.port == 465
+    assert notifier.security == "tls"
+    assert notifier.recipients == ["me@example.com"]
+    assert notifiers_from_config({}) == []
@@ -0,0 +1,45 @@
+"""Unit tests for file list and playlist reading."""
+
+from pathlib import Path
+
+from src.storage.file_list import read_file_list, read_remote_entries
+
+
+def test_read_file_list_resolves_entries(tmp_path: Path):
+    list_path = tmp_path / "lists" / "tracks.txt"
+    list_path.parent.mkdir()
+    list_path.write_text(
+        "# comment\n"
+        "\n"
+        "a.flac\n"
+        "sub\\b.mp3\n"
+        "/abs/c.ogg\n"
+        "file:///abs/d%20e.flac\n"
+        "a.flac\n"
+    )
+
+    paths = read_file_list(list_path)
+
+    assert paths == [
+        (tmp_path / "lists" / "a.flac").resolve(),
+        (tmp_path / "lists" / "sub" / "b.mp3").resolve(),
+        Path("/abs/c.ogg"),
+        Path("/abs/d e.flac"),
+    ]
+
+
+def test_remote_entries_are_kept_as_urls(tmp_path: Path):
+    list_path = tmp_path / "mixed.m3u"
+    list_path.write_text(
+        "#EXTM3U\n"
+        "local.flac\n"
+        "https://media.example.com/a%20b.mp3\n"
+        "HTTP://media.example.com/c.ogg\n"
+        "https://media.example.com/a%20b.mp3\n"
+    )
+
+    assert read_file_list(list_path) == [(tmp_path / "local.flac").resolve()]
+    assert read_remote_entries(list_path) == [
+        "https://media.example.com/a%20b.mp3",
+        "HTTP://media.example.com/c.ogg",
+    ]
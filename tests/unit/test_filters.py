@@ -0,0 +1,22 @@
+"""Unit tests for user FFmpeg filter chains."""
+
+import pytest
+
+from src.processor.filters import compose_filters, validate_filters
+
+
+def test_compose_filters_puts_builtin_first():
+    chain = compose_filters(["loudnorm=I=-16"], ["highpass=f=40", "volume=0.8"])
+
+    assert chain == "loudnorm=I=-16,highpass=f=40,volume=0.8"
+    assert compose_filters([], []) is None
+
+
+def test_validate_filters_strips_entries():
+    assert validate_filters([" yadif ", "crop=1920:800"]) == ["yadif", "crop=1920:800"]
+
+
+@pytest.mark.parametrize("entry", ["", "yadif; rm -rf /", "crop=$(id)", "a|b"])
+def test_validate_filters_rejects_bad_entries(entry):
+    with pytest.raises(ValueError):
+        validate_filters([entry])
@@ -1,4 +1,9 @@
+import threading
+import time
 import pytest
+from concurrent.futures import ThreadPoolExecutor
+from unittest.mock import patch
+
 from src.integrations.integration_manager import IntegrationManager
 
 
@@ -25,3 +30,44 @@ def test_get_integration(integration_manager):
 
 def test_get_integration_not_found(integration_manager):
     assert integration_manager.get_integration("nonexistent") is None
+
+
+class _CountingSonarr:
+    def __init__(self):
+        self.calls = 0
+        self.lock = threading.Lock()
+
+    def lookup_series(self, title, year=None):
+        with self.lock:
+            self.calls += 1
+        time.sleep(0.02)
+        return {"title": title.strip(), "tvdbId": 1}
+
+
+def test_lookup_series_cached_across_episodes(integration_manager):
+    sonarr = _CountingSonarr()
+    integration_manager.register_integration("sonarr", sonarr)
+    titles = ["Show Name"] * 8 + ["show name "] * 4
+
+    with ThreadPoolExecutor(max_workers=6) as pool:
+        results = list(pool.map(integration_manager.lookup_series, titles))
+
+    assert sonarr.calls == 1
+    assert all(result == results[0] for result in results)
+
+
+def test_lookup_series_errors_not_cached(integration_manager):
+    sonarr = _CountingSonarr()
+    integration_manager.register_integration("sonarr", sonarr)
+
+    with patch.object(sonarr, "lookup_series", side_effect=OSError("down")):
+        with pytest.raises(OSError):
+            integration_manager.lookup_series("Show Name")
+
+    assert integration_manager.lookup_series("Show Name")["tvdbId"] == 1
+    assert sonarr.calls == 1
+
+
+def test_lookup_requires_registered_integration(integration_manager):
+    with pytest.raises(KeyError):
+        integration_manager.lookup_movie("Some Movie")
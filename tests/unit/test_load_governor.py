@@ -0,0 +1,56 @@
+import asyncio
+from pathlib import Path
+
+import pytest
+from src.processor.load_governor import (
+    LoadGovernor,
+    governed_limit,
+    read_load_average,
+)
+from src.processor.worker_pool import WorkerPool
+
+
+@pytest.mark.parametrize(
+    "load, current, expected",
+    [
+        (9.0, 4, 3),  # over the limit: drop a worker
+        (9.0, 1, 1),  # never below one worker
+        (5.0, 3, 3),  # between recovery point and limit: hold
+        (2.0, 3, 4),  # well under the limit: add a worker back
+        (2.0, 4, 4),  # never above the configured concurrency
+        (None, 2, 4),  # unknown load: no throttling
+    ],
+)
+def test_governed_limit(load, current, expected):
+    assert governed_limit(load, max_load=6.0, current=current, maximum=4) == expected
+
+
+def test_read_load_average(tmp_path: Path):
+    loadavg = tmp_path / "loadavg"
+    loadavg.write_text("3.25 2.10 1.05 2/345 6789\n")
+
+    assert read_load_average(loadavg) == 3.25
+    assert read_load_average(tmp_path / "missing") is None
+
+
+@pytest.mark.asyncio
+async def test_pool_runs_fewer_workers_under_load():
+    readings = iter([1.0] + [10.0] * 1000)
+    governor = LoadGovernor(6.0, interval=0.01, read_load=lambda: next(readings))
+    pool = WorkerPool(num_workers=3)
+    pool.PAUSE_POLL_INTERVAL = 0.01
+    running = 0
+    late_peaks = []
+
+    async def sample_task():
+        nonlocal running
+        running += 1
+        if pool.active_limit == 1:
+            late_peaks.append(running)
+        await asyncio.sleep(0.02)
+        running -= 1
+
+    await pool.run([sample_task for _ in range(20)], governor=governor)
+
+    assert pool.active_limit == 1
+    assert late_peaks and max(late_peaks[-5:]) == 1
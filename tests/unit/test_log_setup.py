@@ -0,0 +1,46 @@
+import io
+import logging
+import pytest
+from pathlib import Path
+
+from src.config.log_setup import LoggingConfig, build_handlers, configure_logging
+
+
+@pytest.fixture
+def restore_root_logger():
+    root = logging.getLogger()
+    saved_handlers, saved_level = list(root.handlers), root.level
+    yield
+    for handler in list(root.handlers):
+        root.removeHandler(handler)
+        handler.close()
+    for handler in saved_handlers:
+        root.addHandler(handler)
+    root.setLevel(saved_level)
+
+
+def test_console_is_default_destination():
+    handlers = build_handlers(LoggingConfig())
+
+    assert [type(h) for h in handlers] == [logging.StreamHandler]
+
+
+def test_output_file_replaces_console(tmp_path: Path):
+    handlers = build_handlers(LoggingConfig(output_file=tmp_path / "refinery.log"))
+
+    assert [type(h) for h in handlers] == [logging.FileHandler]
+    handlers[0].close()
+
+
+def test_message_written_to_console_and_file(tmp_path: Path, restore_root_logger):
+    log_file = tmp_path / "logs" / "refinery.log"
+    console = io.StringIO()
+    config = LoggingConfig.from_dict({"output_file": str(log_file), "console": True})
+
+    handlers = configure_logging(config, stream=console)
+    logging.getLogger("refinery.test").info("batch finished")
+    for handler in handlers:
+        handler.flush()
+
+    assert "batch finished" in console.getvalue()
+    assert "batch finished" in log_file.read_text()
@@ -0,0 +1,49 @@
+"""Unit tests for picking the best *arr lookup result."""
+
+from unittest.mock import patch
+
+from src.integrations.matching import best_match, title_similarity
+from src.integrations.radarr import RadarrClient
+from src.integrations.sonarr import SonarrClient
+
+REMAKES = [
+    {"title": "The Thing", "year": 2011, "tmdbId": 2},
+    {"title": "The Thing", "year": 1982, "tmdbId": 1},
+    {"title": "The Thing from Another World", "year": 1951, "tmdbId": 3},
+]
+
+
+def test_title_similarity_ignores_case_and_punctuation():
+    assert title_similarity("Spider-Man", "spider man") == 1.0
+    assert title_similarity("The Thing", "The Thing from Another World") < 1.0
+
+
+def test_best_match_prefers_year():
+    assert best_match(REMAKES, "The Thing", 1982)["tmdbId"] == 1
+    assert best_match(REMAKES, "The Thing from Another World", 1951)["tmdbId"] == 3
+
+
+def test_best_match_without_year_prefers_closest_title_then_order():
+    results = [
+        {"title": "Doctor Who Confidential", "year": 2005},
+        {"title": "Doctor Who", "year": 2005},
+        {"title": "Doctor Who", "year": 1963},
+    ]
+
+    assert best_match(results, "Doctor Who") is results[1]
+    assert best_match([], "Doctor Who") is None
+
+
+def test_clients_pick_by_year():
+    radarr = RadarrClient("http://radarr:7878")
+    sonarr = SonarrClient("http://sonarr:8989")
+    shows = [
+        {"title": "Battlestar Galactica", "year": 1978, "tvdbId": 1},
+        {"title": "Battlestar Galactica (2003)", "year": 2003, "tvdbId": 2},
+    ]
+
+    with patch.object(RadarrClient, "_request", return_value=REMAKES):
+        assert radarr.lookup_movie("The Thing", year=1982)["tmdbId"] == 1
+    with patch.object(SonarrClient, "_request", return_value=shows):
+        assert sonarr.lookup_series("Battlestar Galactica", year=2003)["tvdbId"] == 2
+        assert sonarr.lookup_series("Battlestar Galactica")["tvdbId"] == 1
@@ -1,6 +1,21 @@
+import json
 import unittest
 import subprocess
-from src.metadata.metadata import MetadataExtractor
+import sys
+import tempfile
+from pathlib import Path
+from src.metadata.metadata import (
+    Metadata,
+    MetadataExtractor,
+    decade,
+    format_path,
+    merge_metadata,
+    primary_artist,
+    read_popm_rating,
+    run_naming_command,
+    sanitize_relative_path,
+    vorbis_tags,
+)
 from unittest.mock import patch
 
 
@@ -37,6 +52,235 @@ class TestMetadataExtractor(unittest.TestCase):
         self.assertEqual(extractor.clean_tag("  Test Title  "), "Test Title")
         self.assertEqual(extractor.clean_tag(None), None)
 
+    def test_validate_metadata_reports_missing_fields(self):
+        extractor = MetadataExtractor()
+        metadata = Metadata()
+        metadata.title = "Test Title"
+        metadata.artist = "  "
+
+        missing = extractor.validate_metadata(metadata, ["title", "artist", "album"])
+
+        self.assertEqual(missing, ["artist", "album"])
+
+    @patch("subprocess.check_output")
+    def test_extract_metadata_with_stream_tags(self, mock_subprocess):
+        mock_subprocess.return_value = json.dumps(
+            {
+                "format": {"format_name": "matroska,webm", "duration": "N/A"},
+                "streams": [
+                    {
+                        "codec_type": "video",
+                        "tags": {"TITLE": "Pilot", "TAG:artist": "Director"},
+                    },
+                    {"codec_type": "audio", "sample_rate": "48000"},
+                ],
+            }
+        )
+
+        extractor = MetadataExtractor()
+        metadata = extractor.extract_metadata("Show.S01E01.mkv")
+
+        self.assertEqual(metadata.title, "Pilot")
+        self.assertEqual(metadata.artist, "Director")
+        self.assertEqual(metadata.duration, 0.0)
+        self.assertEqual(metadata.bitrate, 0)
+        self.assertEqual(metadata.sample_rate, 48000)
+        self.assertEqual(metadata.channels, 0)
+
+    def test_collect_tags_prefers_format_tags(self):
+        extractor = MetadataExtractor()
+        result = {
+            "format": {"tags": {"Title": "Format Title"}},
+            "streams": [{"tags": {"title": "Stream Title", "genre": "Drama"}}],
+        }
+
+        tags = extractor.collect_tags(result)
+
+        self.assertEqual(tags, {"title": "Format Title", "genre": "Drama"})
+
+    def test_defaults_flow_into_format_path(self):
+        extractor = MetadataExtractor(
+            defaults={"artist": "Various Artists", "genre": "Unsorted", "album": ""}
+        )
+        metadata = Metadata()
+        metadata.title = "Song"
+        metadata.album = "Mixtape"
+
+        extractor.apply_defaults(metadata)
+
+        self.assertEqual(
+            format_path("{genre}/{artist}/{album}/{title}", metadata),
+            "Unsorted/Various Artists/Mixtape/Song",
+        )
+
+    def test_format_path_uses_unknown_without_default(self):
+        metadata = Metadata()
+        metadata.title = "AC/DC Live"
+
+        path = format_path("{artist}/{album}/{title}", metadata)
+
+        self.assertEqual(path, "Unknown/Unknown/AC-DC Live")
+
+    def test_decade(self):
+        self.assertEqual(decade("2023"), "2020s")
+        self.assertEqual(decade("1999-12-31"), "1990s")
+        self.assertEqual(decade("2000"), "2000s")
+        for year in (None, "", "Unknown", "0000", "95"):
+            self.assertIsNone(decade(year))
+
+    def test_format_path_decade_token(self):
+        pattern = "Movies/{decade}/{year}/{title} ({year})"
+        metadata = Metadata()
+        metadata.title = "Film"
+        metadata.year = "2023"
+
+        self.assertEqual(
+            format_path(pattern, metadata), "Movies/2020s/2023/Film (2023)"
+        )
+
+        metadata.year = "not a year"
+        self.assertEqual(
+            format_path(pattern, metadata),
+            "Movies/not a year/Film (not a year)",
+        )
+
+        metadata.year = None
+        self.assertEqual(
+            format_path(pattern, metadata), "Movies/Unknown/Film (Unknown)"
+        )
+
+    @patch("subprocess.check_output")
+    def test_extract_metadata_parses_track_and_disc_totals(self, mock_subprocess):
+        mock_subprocess.return_value = json.dumps(
+            {"format": {"tags": {"track": "3/12", "disc": "1", "DISCTOTAL": "2"}}}
+        )
+
+        metadata = MetadataExtractor().extract_metadata("song.flac")
+
+        self.assertEqual((metadata.track, metadata.track_total), ("3", "12"))
+        self.assertEqual((metadata.disc, metadata.disc_total), ("1", "2"))
+        self.assertEqual(metadata.numbering_tags(), {"track": "3/12", "disc": "1/2"})
+
+    def test_merge_keeps_probed_episode_title_over_show_name(self):
+        metadata = Metadata()
+        metadata.show = "Show Name"
+        metadata.title = "Pilot"
+
+        merge_metadata(
+            metadata, {"show": "Show Name", "title": "Show Name", "year": "2005"}
+        )
+
+        self.assertEqual(metadata.title, "Pilot")
+        self.assertEqual(metadata.year, "2005")
+
+    def test_merge_prefers_specific_integration_values(self):
+        metadata = Metadata()
+        metadata.show = "Show Name"
+        metadata.title = "S01E01"
+
+        merge_metadata(metadata, {"title": "The Pilot", "genre": ""})
+
+        self.assertEqual(metadata.title, "The Pilot")
+
+        untitled = Metadata()
+        merge_metadata(untitled, {"show": "Show Name", "title": "Show Name"})
+
+        self.assertEqual(untitled.title, "Show Name")
+
+    def test_sanitize_relative_path(self):
+        self.assertEqual(
+            sanitize_relative_path("/../Artist/./Album\\01 Song\n"),
+            "Artist/Album/01 Song",
+        )
+        self.assertEqual(sanitize_relative_path("../.."), "")
+
+    def test_primary_artist_strips_featured_artists(self):
+        for artist in (
+            "Daft Punk feat. Pharrell Williams",
+            "Daft Punk Feat Pharrell Williams",
+            "Daft Punk ft. Pharrell Williams",
+            "Daft Punk ft Pharrell Williams",
+            "Daft Punk featuring Pharrell Williams",
+            "Daft Punk (feat. Pharrell Williams)",
+            "Daft Punk [ft. Pharrell Williams & Nile Rodgers]",
+            "Daft Punk with Pharrell Williams",
+            "Daft Punk; Pharrell Williams",
+            "Daft Punk / Pharrell Williams",
+            "Daft Punk\x00Pharrell Williams",
+        ):
+            with self.subTest(artist=artist):
+                self.assertEqual(primary_artist(artist), "Daft Punk")
+
+    def test_primary_artist_keeps_names_that_only_look_featured(self):
+        for artist in ("AC/DC", "With Confidence", "Feat Band", "Simon & Garfunkel"):
+            with self.subTest(artist=artist):
+                self.assertEqual(primary_artist(artist), artist)
+
+    def test_primary_artist_prefers_album_artist(self):
+        self.assertEqual(primary_artist("Guest ft. Host", "Host"), "Host")
+        self.assertEqual(primary_artist("A feat. B", "A feat. C"), "A")
+        self.assertEqual(primary_artist("A feat. B", ""), "A")
+        self.assertEqual(primary_artist("", ""), "")
+
+    def test_run_naming_command_times_out(self):
+        metadata = Metadata()
+        command = [sys.executable, "-c", "import time; time.sleep(5)"]
+
+        self.assertIsNone(run_naming_command(command, metadata, timeout=0.2))
+
+    def test_vorbis_tags_maps_extended_id3_frames(self):
+        tags = {
+            "title": "Song",
+            "tbpm": "128",
+            "tkey": "Am",
+            "compilation": "1",
+            "musicbrainz_trackid": "abc",
+            "label_code": "LC 0123",
+        }
+
+        mapped = vorbis_tags(tags, rating=255)
+
+        self.assertEqual(mapped["BPM"], "128")
+        self.assertEqual(mapped["tbpm"], "")
+        self.assertEqual(mapped["INITIALKEY"], "Am")
+        self.assertEqual(mapped["COMPILATION"], "1")
+        self.assertEqual(mapped["RATING"], "100")
+        self.assertEqual(mapped["LABEL_CODE"], "LC 0123")
+        self.assertNotIn("title", mapped)
+        self.assertNotIn("MUSICBRAINZ_TRACKID", mapped)
+
+    def test_vorbis_tags_folds_or_drops_unknown_tags(self):
+        tags = {"comment": "Ripped", "label_code": "LC 0123", "tmoo": "Calm"}
+
+        folded = vorbis_tags(tags, unknown_tags="comment")
+        dropped = vorbis_tags(tags, unknown_tags="drop")
+
+        self.assertEqual(folded["COMMENT"], "Ripped\nlabel_code: LC 0123")
+        self.assertEqual(folded["label_code"], "")
+        self.assertEqual(folded["MOOD"], "Calm")
+        self.assertEqual(dropped, {"label_code": "", "tmoo": "", "MOOD": "Calm"})
+
+    def test_read_popm_rating(self):
+        popm = b"user@example.com\x00\xc4\x00\x00\x00\x05"
+        title = b"TIT2\x00\x00\x00\x03\x00\x00\x03Hi"
+        # v2.3 frame sizes are plain integers, v2.4 ones syncsafe
+        for version in (3, 4):
+            frames = title + b"POPM" + bytes([0, 0, 0, len(popm), 0, 0]) + popm
+            header = b"ID3" + bytes([version, 0, 0, 0, 0, 0, len(frames)])
+            with tempfile.TemporaryDirectory() as tmp:
+                path = Path(tmp) / "song.mp3"
+                path.write_bytes(header + frames + b"\xff\xfb")
+
+                self.assertEqual(read_popm_rating(path), 196)
+
+    def test_read_popm_rating_without_id3_tag(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            path = Path(tmp) / "song.mp3"
+            path.write_bytes(b"\xff\xfb" + b"\x00" * 32)
+
+            self.assertIsNone(read_popm_rating(path))
+            self.assertIsNone(read_popm_rating(Path(tmp) / "missing.mp3"))
+
 
 if __name__ == "__main__":
     unittest.main()
@@ -0,0 +1,60 @@
+import asyncio
+import subprocess
+import sys
+import pytest
+
+from src.audio.converter import AudioConverter
+from src.processor.priority import niceness_preexec, validate_priority, with_io_class
+
+linux_only = pytest.mark.skipif(
+    not sys.platform.startswith("linux"), reason="process priority is Linux-only"
+)
+
+
+@pytest.mark.parametrize("niceness", [-21, 20])
+def test_validate_priority_rejects_out_of_range_niceness(niceness):
+    with pytest.raises(ValueError):
+        validate_priority(niceness, None)
+
+
+def test_validate_priority_rejects_unknown_io_class():
+    with pytest.raises(ValueError):
+        validate_priority(0, "lowest")
+
+
+def test_converter_validates_priority():
+    with pytest.raises(ValueError):
+        AudioConverter(niceness=42)
+
+
+def test_default_priority_is_noop():
+    assert niceness_preexec(0) is None
+    assert with_io_class(["ffmpeg"], None) == ["ffmpeg"]
+
+
+@linux_only
+@pytest.mark.asyncio
+async def test_converter_spawns_ffmpeg_with_priority(monkeypatch):
+    monkeypatch.setattr("shutil.which", lambda name: "/usr/bin/ionice")
+    converter = AudioConverter(niceness=10, io_class="idle")
+
+    # asyncio.create_subprocess_exec is mocked for unit tests (see conftest)
+    await converter._execute_ffmpeg(["ffmpeg", "-i", "in.wav", "out.flac"])
+
+    args, kwargs = asyncio.create_subprocess_exec.call_args
+    assert list(args) == ["ionice", "-c", "3", "ffmpeg", "-i", "in.wav", "out.flac"]
+    # The converter's preexec_fn, run in a real child, lowers its priority
+    output = subprocess.check_output(
+        [sys.executable, "-c", "import os; print(os.getpriority(os.PRIO_PROCESS, 0))"],
+        preexec_fn=kwargs["preexec_fn"],
+    )
+    assert int(output) >= 10
+
+
+@linux_only
+def test_io_class_prefixes_ionice(monkeypatch):
+    monkeypatch.setattr("shutil.which", lambda name: "/usr/bin/ionice")
+
+    command = with_io_class(["ffmpeg", "-i", "in.wav"], "idle")
+
+    assert command == ["ionice", "-c", "3", "ffmpeg", "-i", "in.wav"]
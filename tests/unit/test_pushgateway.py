@@ -0,0 +1,148 @@
+"""Unit tests for the Prometheus Pushgateway export."""
+
+import threading
+from http.server import BaseHTTPRequestHandler, HTTPServer
+from pathlib import Path
+from unittest.mock import patch
+
+import pytest
+
+from src.audio.converter import AudioConverter
+from src.processor.batch_processor import BatchConfig, BatchProcessor
+from src.telemetry.pushgateway import Pushgateway, exposition
+from src.telemetry.telemetry import TelemetryProvider
+
+
+class _PushgatewayHandler(BaseHTTPRequestHandler):
+    """Records pushes and answers like a Pushgateway."""
+
+    def do_PUT(self):
+        body = self.rfile.read(int(self.headers["Content-Length"]))
+        self.server.pushes.append(
+            {
+                "path": self.path,
+                "content_type": self.headers.get("Content-Type"),
+                "body": body.decode(),
+            }
+        )
+        self.send_response(self.server.status)
+        self.end_headers()
+
+    def log_message(self, format, *args):
+        pass
+
+
+@pytest.fixture
+def pushgateway_server():
+    """Run a fake Pushgateway on a random local port."""
+    server = HTTPServer(("127.0.0.1", 0), _PushgatewayHandler)
+    server.pushes = []
+    server.status = 200
+    thread = threading.Thread(target=server.serve_forever, daemon=True)
+    thread.start()
+    yield server
+    server.shutdown()
+    server.server_close()
+
+
+def _url(server: HTTPServer) -> str:
+    return f"http://127.0.0.1:{server.server_port}"
+
+
+def _telemetry() -> TelemetryProvider:
+    telemetry = TelemetryProvider()
+    telemetry.record_file_processed("flac")
+    telemetry.record_file_processed("flac")
+    telemetry.record_file_failed("mp3")
+    telemetry.record_file_skipped("ogg", "already_converted")
+    telemetry.record_bytes("flac", 5000, 3000)
+    return telemetry
+
+
+def test_exposition_renders_counters_and_gauges():
+    text = exposition(_telemetry().snapshot(), duration_s=12.5)
+
+    assert "# TYPE media_files_processed_total counter" in text
+    assert 'media_files_processed_total{file_type="flac"} 2' in text
+    assert 'media_files_failed_total{file_type="mp3"} 1' in text
+    assert (
+        'media_files_skipped_total{file_type="ogg",reason="already_converted"} 1'
+        in text
+    )
+    assert "media_bytes_saved 2000" in text
+    assert "media_run_duration_seconds 12.500" in text
+
+
+def test_exposition_reports_untouched_counters_as_zero():
+    text = exposition(TelemetryProvider().snapshot(), duration_s=0)
+
+    assert "media_files_failed_total 0" in text
+    assert "media_bytes_saved 0" in text
+
+
+def test_push_puts_exposition_under_job(pushgateway_server):
+    gateway = Pushgateway(_url(pushgateway_server), job="nightly refinery")
+    telemetry = _telemetry()
+
+    assert gateway.push(telemetry.snapshot(), 12.5)
+
+    (push,) = pushgateway_server.pushes
+    assert push["path"] == "/metrics/job/nightly%20refinery"
+    assert push["content_type"].startswith("text/plain")
+    assert push["body"] == exposition(telemetry.snapshot(), 12.5)
+
+
+def test_push_failure_is_reported_not_raised(pushgateway_server):
+    pushgateway_server.status = 500
+    gateway = Pushgateway(_url(pushgateway_server))
+
+    assert not gateway.push({}, 1.0)
+    assert not Pushgateway("http://127.0.0.1:1", timeout=1).push({}, 1.0)
+
+
+def _fake_ffmpeg(cmd):
+    Path(cmd[-1]).write_bytes(b"converted")
+    return 0, b"", b""
+
+
+@pytest.mark.asyncio
+async def test_batch_run_pushes_metrics(pushgateway_server, tmp_path: Path):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    (input_dir / "song.mp3").write_bytes(b"ID3" + b"\x00" * 100)
+    processor = BatchProcessor(
+        BatchConfig(
+            input_dir=input_dir,
+            output_dir=tmp_path / "output",
+            pushgateway_url=_url(pushgateway_server),
+        )
+    )
+
+    with patch.object(AudioConverter, "_execute_ffmpeg", side_effect=_fake_ffmpeg):
+        result = await processor.process_all()
+
+    assert result.successful == 1
+    (push,) = pushgateway_server.pushes
+    assert push["path"] == "/metrics/job/media_refinery"
+    assert 'media_files_processed_total{file_type="mp3"} 1' in push["body"]
+    # 103-byte source, 9-byte output
+    assert "media_bytes_saved 94" in push["body"]
+
+
+@pytest.mark.asyncio
+async def test_unreachable_pushgateway_does_not_fail_run(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    (input_dir / "song.mp3").write_bytes(b"ID3" + b"\x00" * 100)
+    processor = BatchProcessor(
+        BatchConfig(
+            input_dir=input_dir,
+            output_dir=tmp_path / "output",
+            pushgateway_url="http://127.0.0.1:1",
+        )
+    )
+
+    with patch.object(AudioConverter, "_execute_ffmpeg", side_effect=_fake_ffmpeg):
+        result = await processor.process_all()
+
+    assert result.successful == 1
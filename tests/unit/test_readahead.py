@@ -0,0 +1,59 @@
+"""Unit tests for source file readahead."""
+
+import asyncio
+from pathlib import Path
+
+import pytest
+
+from src.storage.readahead import Readahead, read_head
+
+
+def test_read_head_reads_at_most_size(tmp_path: Path):
+    path = tmp_path / "song.flac"
+    path.write_bytes(b"\x00" * 3000)
+
+    assert read_head(path, size=1000) == 1000
+    assert read_head(path, size=10000) == 3000
+
+
+@pytest.mark.asyncio
+async def test_readahead_stays_within_depth_of_consumer():
+    paths = [Path(f"/music/{index}.flac") for index in range(6)]
+    read = []
+    readahead = Readahead(paths, depth=2, reader=read.append)
+
+    task = asyncio.create_task(readahead.run())
+    await asyncio.sleep(0.05)
+    assert read == paths[:2]
+
+    await readahead.consume(paths[0])
+    await readahead.consume(paths[1])
+    await asyncio.sleep(0.05)
+    # 2 and 3 are next; 0 and 1 were already consumed when they were read
+    assert read == paths[:4]
+
+    for path in paths:
+        await readahead.consume(path)
+    await asyncio.wait_for(task, timeout=1)
+    assert read == paths[:4]
+
+
+@pytest.mark.asyncio
+async def test_readahead_skips_files_already_consumed():
+    paths = [Path(f"/music/{index}.flac") for index in range(4)]
+    read = []
+    readahead = Readahead(paths, depth=2, reader=read.append)
+
+    await readahead.consume(paths[1])
+    await asyncio.wait_for(readahead.run(), timeout=1)
+
+    assert sorted(read) == paths[2:]
+
+
+@pytest.mark.asyncio
+async def test_readahead_ignores_read_errors(tmp_path: Path):
+    paths = [tmp_path / "missing.flac", tmp_path / "song.flac"]
+    paths[1].write_bytes(b"fLaC")
+    readahead = Readahead(paths, depth=2, workers=1)
+
+    await asyncio.wait_for(readahead.run(), timeout=1)
@@ -0,0 +1,98 @@
+"""Unit tests for remote input downloads."""
+
+import threading
+from http.server import BaseHTTPRequestHandler, ThreadingHTTPServer
+from pathlib import Path
+
+import pytest
+from src.storage.remote import RemoteFetcher, RemoteInputError, remote_display_path
+
+FIXTURE = b"ID3\x04" + b"\x00" * 100
+
+
+class _Handler(BaseHTTPRequestHandler):
+    """Serves FIXTURE at /music/song.mp3 and records request headers.
+
+    /elsewhere redirects to it under the "localhost" host name, which urllib
+    treats as another host than 127.0.0.1.
+    """
+
+    requests = []
+
+    def do_GET(self):
+        self.requests.append(dict(self.headers))
+        if self.path == "/elsewhere":
+            self.send_response(302)
+            self.send_header(
+                "Location", f"http://localhost:{self.server.server_port}/music/song.mp3"
+            )
+            self.end_headers()
+            return
+        if self.path != "/music/song.mp3":
+            self.send_error(404)
+            return
+        self.send_response(200)
+        self.send_header("Content-Length", str(len(FIXTURE)))
+        self.end_headers()
+        self.wfile.write(FIXTURE)
+
+    def log_message(self, *args):
+        pass
+
+
+@pytest.fixture
+def server():
+    """An HTTP server on a free local port, as its base URL."""
+    _Handler.requests = []
+    httpd = ThreadingHTTPServer(("127.0.0.1", 0), _Handler)
+    thread = threading.Thread(target=httpd.serve_forever, daemon=True)
+    thread.start()
+    yield f"http://127.0.0.1:{httpd.server_port}"
+    httpd.shutdown()
+    httpd.server_close()
+
+
+def test_fetch_downloads_with_host_headers(server: str, tmp_path: Path):
+    fetcher = RemoteFetcher(
+        headers={
+            "127.0.0.1": {"Authorization": "Bearer secret"},
+            "other.example.com": {"X-Token": "not for this host"},
+        }
+    )
+
+    path = fetcher.fetch(f"{server}/music/song.mp3", tmp_path / "remote")
+
+    assert path == tmp_path / "remote" / "song.mp3"
+    assert path.read_bytes() == FIXTURE
+    assert _Handler.requests[0]["Authorization"] == "Bearer secret"
+    assert "X-Token" not in _Handler.requests[0]
+
+
+def test_fetch_redirect_to_other_host_drops_credentials(server: str, tmp_path: Path):
+    fetcher = RemoteFetcher(
+        headers={
+            "127.0.0.1": {"Authorization": "Bearer secret"},
+            "localhost": {"X-Token": "for localhost"},
+        }
+    )
+
+    path = fetcher.fetch(f"{server}/elsewhere", tmp_path)
+
+    assert path.read_bytes() == FIXTURE
+    first, redirected = _Handler.requests
+    assert first["Authorization"] == "Bearer secret"
+    assert "Authorization" not in redirected
+    assert redirected["X-Token"] == "for localhost"
+
+
+def test_fetch_error_leaves_no_file(server: str, tmp_path: Path):
+    with pytest.raises(RemoteInputError, match="HTTP 404"):
+        RemoteFetcher().fetch(f"{server}/missing.mp3", tmp_path)
+
+    assert list(tmp_path.iterdir()) == []
+
+
+def test_remote_display_path():
+    assert remote_display_path("https://media.example.com/a/b%20c.mp3") == Path(
+        "media.example.com/a/b c.mp3"
+    )
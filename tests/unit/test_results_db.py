@@ -0,0 +1,119 @@
+"""Unit tests for the SQLite conversion history."""
+
+import sqlite3
+import threading
+from pathlib import Path
+from unittest.mock import patch
+
+import pytest
+
+from src.audio.converter import AudioConverter
+from src.audit.results_db import ConversionRecord, ResultsDatabase
+from src.processor.batch_processor import BatchConfig, BatchProcessor
+
+
+def test_records_are_queryable(tmp_path: Path):
+    path = tmp_path / "history" / "results.db"
+    database = ResultsDatabase(path)
+
+    database.record(
+        ConversionRecord(
+            input="/in/a.mp3",
+            output="/out/a.flac",
+            input_format="mp3",
+            output_format="flac",
+            input_bytes=5000,
+            output_bytes=9000,
+            checksum="abc",
+            checksum_algorithm="sha256",
+            duration_ms=1500.0,
+            status="processed",
+            recorded_at="2024-05-01T12:00:00+00:00",
+        )
+    )
+    database.record(
+        ConversionRecord(input="/in/b.ogg", status="failed", error="Invalid data")
+    )
+    database.close()
+
+    with sqlite3.connect(path) as connection:
+        rows = connection.execute(
+            "SELECT input, output_format, output_bytes, status, error, recorded_at "
+            "FROM conversions ORDER BY id"
+        ).fetchall()
+    assert rows[0] == (
+        "/in/a.mp3",
+        "flac",
+        9000,
+        "processed",
+        None,
+        "2024-05-01T12:00:00+00:00",
+    )
+    assert rows[1][:5] == ("/in/b.ogg", "", None, "failed", "Invalid data")
+    assert rows[1][5]  # Defaults to the time of recording
+
+    # Reopens after close, keeping the earlier rows
+    failed = database.rows("status = ?", ("failed",))
+    assert [row["input"] for row in failed] == ["/in/b.ogg"]
+
+
+def test_concurrent_records(tmp_path: Path):
+    database = ResultsDatabase(tmp_path / "results.db")
+
+    def write(worker: int):
+        for index in range(25):
+            database.record(
+                ConversionRecord(input=f"/in/{worker}-{index}.mp3", status="processed")
+            )
+
+    threads = [threading.Thread(target=write, args=(worker,)) for worker in range(4)]
+    for thread in threads:
+        thread.start()
+    for thread in threads:
+        thread.join()
+
+    assert len(database.rows()) == 100
+
+
+def _fake_ffmpeg(cmd):
+    Path(cmd[-1]).write_bytes(b"fLaC" + b"\x00" * 64)
+    return (0, "", "")
+
+
+@pytest.mark.asyncio
+async def test_batch_run_records_each_file(tmp_path: Path):
+    input_dir = tmp_path / "input"
+    input_dir.mkdir()
+    (input_dir / "song.mp3").write_bytes(b"ID3\x04" + b"\x00" * 100)
+    (input_dir / "broken.ogg").write_bytes(b"OggS" + b"\x00" * 100)
+    processor = BatchProcessor(
+        BatchConfig(
+            input_dir=input_dir,
+            output_dir=tmp_path / "output",
+            results_db_path=tmp_path / "results.db",
+        )
+    )
+
+    def ffmpeg(cmd):
+        if "broken" in cmd[-1]:
+            return (1, "", "Invalid data found when processing input")
+        return _fake_ffmpeg(cmd)
+
+    with patch.object(AudioConverter, "_execute_ffmpeg", side_effect=ffmpeg):
+        await processor.process_all()
+
+    rows = {Path(row["input"]).name: row for row in processor.results_db.rows()}
+    assert rows["song.mp3"]["status"] == "processed"
+    assert rows["song.mp3"]["output"] == str(tmp_path / "output" / "song.flac")
+    assert (rows["song.mp3"]["input_format"], rows["song.mp3"]["output_format"]) == (
+        "mp3",
+        "flac",
+    )
+    assert (rows["song.mp3"]["input_bytes"], rows["song.mp3"]["output_bytes"]) == (
+        104,
+        68,
+    )
+    assert rows["song.mp3"]["checksum"]
+    assert rows["broken.ogg"]["status"] == "failed"
+    assert "Invalid data" in rows["broken.ogg"]["error"]
+    assert rows["broken.ogg"]["output"] is None
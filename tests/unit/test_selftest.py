@@ -0,0 +1,141 @@
+from pathlib import Path
+from typing import List, Tuple
+from unittest.mock import AsyncMock, MagicMock
+
+import pytest
+from src.audio.converter import AudioConversionResult, FFmpegError
+from src.integrations.integration_manager import IntegrationManager
+from src.processor.selftest import SelfTest, parse_version
+
+
+class FakeRunner:
+    """Answers version commands with canned output and fakes the tone."""
+
+    def __init__(self, versions, tone_fails=False):
+        self.versions = versions
+        self.tone_fails = tone_fails
+        self.commands: List[List[str]] = []
+
+    def __call__(self, command: List[str]) -> Tuple[int, str]:
+        self.commands.append(command)
+        if command[1:] == ["-version"]:
+            version = self.versions.get(command[0])
+            if version is None:
+                return 127, f"{command[0]} is not installed"
+            return 0, f"{command[0]} version {version} Copyright (c) 2000-2024\n"
+        if self.tone_fails:
+            return 1, "Unknown input format: 'lavfi'\n"
+        Path(command[-1]).write_bytes(b"RIFF")
+        return 0, ""
+
+
+class HealthyClient:
+    def check_health(self):
+        pass
+
+
+class DownClient:
+    def check_health(self):
+        raise ConnectionError("Sonarr request to /api/v3/system/status failed")
+
+
+def _converter(success=True, error=None):
+    converter = MagicMock()
+    converter.convert = AsyncMock(
+        side_effect=error,
+        return_value=AudioConversionResult(
+            success=success,
+            output_path=Path("tone.out"),
+            checksum="",
+            duration_ms=1.0,
+            size_bytes=2048,
+            error_message=None if success else "no audio stream in output",
+        ),
+    )
+    return converter
+
+
+@pytest.mark.parametrize(
+    "text, expected",
+    [
+        ("4.3", (4, 3)),
+        ("ffmpeg version 6.1.1-3ubuntu5 Copyright", (6, 1, 1)),
+        ("ffmpeg version n7.0 Copyright", (7, 0)),
+        ("ffmpeg version N-113296-g0ba4d6c Copyright", None),
+    ],
+)
+def test_parse_version(text, expected):
+    assert parse_version(text) == expected
+
+
+@pytest.mark.asyncio
+async def test_selftest_summary_aggregates_checks():
+    integrations = IntegrationManager()
+    integrations.register_integration("beets", HealthyClient())
+    integrations.register_integration("sonarr", DownClient())
+    failing = FFmpegError("FFmpeg conversion failed", command=[], stderr="")
+    runner = FakeRunner({"ffmpeg": "6.1.1", "ffprobe": "4.2.7"})
+    test = SelfTest(
+        {
+            "flac": _converter(),
+            "mp3": _converter(success=False),
+            "opus": _converter(error=failing),
+        },
+        integrations,
+        min_version="4.3",
+        runner=runner,
+    )
+
+    report = await test.run()
+
+    results = {check.name: check.passed for check in report.checks}
+    assert results == {
+        "ffmpeg": True,
+        "ffprobe": False,
+        "encode flac": True,
+        "encode mp3": False,
+        "encode opus": False,
+        "integration beets": True,
+        "integration sonarr": False,
+    }
+    assert (report.passed, report.failed, report.ok) == (3, 4, False)
+    summary = report.summary()
+    assert "  [FAIL] ffprobe: 4.2.7 is older than 4.3" in summary
+    assert "  [FAIL] encode mp3: no audio stream in output" in summary
+    assert "  [PASS] encode flac: 2048 bytes" in summary
+    assert summary.endswith("Self-test FAILED: 3 of 7 checks passed")
+
+
+@pytest.mark.asyncio
+async def test_selftest_passes_with_colored_summary():
+    test = SelfTest(
+        {"flac": _converter()},
+        runner=FakeRunner({"ffmpeg": "N-113296-g0ba4d6c", "ffprobe": "7.0"}),
+    )
+
+    report = await test.run()
+
+    assert report.ok
+    assert "\033[32mPASS\033[0m" in report.summary(color=True)
+    assert report.summary().endswith("Self-test passed: 3 of 3 checks passed")
+
+
+@pytest.mark.asyncio
+async def test_selftest_fails_every_format_without_tone():
+    converter = _converter()
+    test = SelfTest(
+        {"flac": converter, "mp3": converter},
+        runner=FakeRunner({"ffmpeg": "6.0", "ffprobe": "6.0"}, tone_fails=True),
+    )
+
+    report = await test.run()
+
+    encodes = [check for check in report.checks if check.name.startswith("encode")]
+    assert [check.passed for check in encodes] == [False, False]
+    assert "could not generate test tone" in encodes[0].detail
+    converter.convert.assert_not_awaited()
+
+
+def test_selftest_rejects_invalid_min_version():
+    with pytest.raises(ValueError, match="minimum FFmpeg version"):
+        SelfTest({}, min_version="latest")
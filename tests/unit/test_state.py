@@ -0,0 +1,133 @@
+"""Unit tests for the processing state manager and its backends."""
+
+import csv
+import pytest
+from pathlib import Path
+
+from src.state.state import INDEX_FILE_NAME, StateManager
+from src.storage.checksum import compute_checksum
+
+
+BACKENDS = pytest.mark.parametrize("backend", ["files", "index"])
+
+
+@pytest.fixture
+def output_file(tmp_path: Path) -> Path:
+    path = tmp_path / "output" / "song.flac"
+    path.parent.mkdir()
+    path.write_bytes(b"fLaC" + b"\x00" * 64)
+    return path
+
+
+@BACKENDS
+def test_record_and_get(tmp_path: Path, output_file: Path, backend: str):
+    manager = StateManager(tmp_path / "state", backend=backend)
+
+    manager.record(output_file, Path("/input/song.mp3"), "abc123", "md5")
+    state = manager.get(output_file)
+
+    assert state.input_path == "/input/song.mp3"
+    assert state.checksum == "abc123"
+    assert state.checksum_algorithm == "md5"
+    assert manager.get(tmp_path / "other.flac") is None
+
+
+@BACKENDS
+@pytest.mark.parametrize("algorithm", ["sha256", "md5", "crc32"])
+def test_verify_uses_recorded_algorithm(
+    tmp_path: Path, output_file: Path, backend: str, algorithm: str
+):
+    manager = StateManager(tmp_path / "state", backend=backend)
+    checksum = compute_checksum(output_file, algorithm)
+    manager.record(output_file, Path("/input/song.mp3"), checksum, algorithm)
+
+    assert manager.verify(output_file) is True
+
+    output_file.write_bytes(b"changed")
+    assert manager.verify(output_file) is False
+    output_file.unlink()
+    assert manager.verify(output_file) is False
+
+
+@BACKENDS
+def test_state_survives_reopen(tmp_path: Path, output_file: Path, backend: str):
+    manager = StateManager(tmp_path / "state", backend=backend)
+    manager.record(output_file, Path("/input/song.mp3"), "first")
+    manager.record(output_file, Path("/input/song.mp3"), "second")
+    manager.close()
+
+    reopened = StateManager(tmp_path / "state", backend=backend)
+
+    assert reopened.get(output_file).checksum == "second"
+
+
+def test_index_backend_uses_single_compacted_file(tmp_path: Path):
+    state_dir = tmp_path / "state"
+    manager = StateManager(state_dir, backend="index")
+
+    for index in range(10):
+        manager.record(tmp_path / f"{index}.flac", Path(f"/in/{index}.mp3"), "a")
+    for _ in range(30):
+        manager.record(tmp_path / "0.flac", Path("/in/0.mp3"), "b")
+
+    assert [p.name for p in state_dir.iterdir()] == [INDEX_FILE_NAME]
+    lines = (state_dir / INDEX_FILE_NAME).read_text().splitlines()
+    assert len(lines) <= 20
+
+    manager.close()
+    assert len((state_dir / INDEX_FILE_NAME).read_text().splitlines()) == 10
+    assert manager.get(tmp_path / "0.flac").checksum == "b"
+
+
+def test_index_backend_ignores_torn_line(tmp_path: Path, output_file: Path):
+    state_dir = tmp_path / "state"
+    manager = StateManager(state_dir, backend="index")
+    manager.record(output_file, Path("/input/song.mp3"), "abc123")
+    manager.store._file.write('{"output_path": "/trunc')
+    manager.store._file.flush()
+
+    reopened = StateManager(state_dir, backend="index")
+
+    assert reopened.get(output_file).checksum == "abc123"
+
+
+def test_unknown_backend_rejected(tmp_path: Path):
+    with pytest.raises(ValueError, match="State backend"):
+        StateManager(tmp_path, backend="bolt")
+
+
+@BACKENDS
+def test_export_csv_lists_every_record(tmp_path: Path, backend: str):
+    manager = StateManager(tmp_path / "state", backend=backend)
+    manager.record(Path("/output/b.flac"), Path("/input/b.mp3"), "bbb")
+    manager.record(Path("/output/a.flac"), Path("/input/a.wav"), "aaa", "md5")
+    manager.record(Path("/output/a.flac"), Path("/input/a.wav"), "aa2", "md5")
+    csv_path = tmp_path / "state.csv"
+
+    count = manager.export_csv(csv_path)
+
+    with csv_path.open(newline="") as f:
+        rows = list(csv.DictReader(f))
+    assert count == 2
+    assert [(r["input_path"], r["output_path"], r["checksum"]) for r in rows] == [
+        ("/input/a.wav", "/output/a.flac", "aa2"),
+        ("/input/b.mp3", "/output/b.flac", "bbb"),
+    ]
+    assert rows[0]["checksum_algorithm"] == "md5"
+    assert rows[0]["updated_at"] == manager.get(Path("/output/a.flac")).updated_at
+
+
+@BACKENDS
+def test_failure_counts_persist_and_reset(tmp_path: Path, backend: str):
+    manager = StateManager(tmp_path / "state", backend=backend)
+    song = Path("/input/song.mp3")
+
+    assert manager.record_failure(song, "first") == 1
+    assert manager.record_failure(song, "second") == 2
+    manager.close()
+
+    reopened = StateManager(tmp_path / "state", backend=backend)
+    assert reopened.failure_count(song) == 2
+    assert reopened.all() == []
+    reopened.clear_failures(song)
+    assert reopened.failure_count(song) == 0
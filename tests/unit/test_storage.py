@@ -1,5 +1,14 @@
+import asyncio
+import errno
+import os
+import threading
+import time
+from pathlib import Path
+from unittest.mock import patch
+
 import pytest
-from src.storage.storage import Storage
+from src.storage.extensions import base_name, normalized_extension
+from src.storage.storage import Storage, atomic_replace
 
 
 @pytest.fixture
@@ -25,3 +34,188 @@ def test_delete_file(storage, tmp_path):
 
     assert result is True
     assert not file_path.exists()
+
+
+def test_preserve_original_mirrors_input_tree(storage, tmp_path):
+    input_root = tmp_path / "input"
+    source = input_root / "Artist" / "song.mp3"
+    source.parent.mkdir(parents=True)
+    source.write_bytes(b"audio")
+    originals_dir = tmp_path / "originals"
+
+    preserved = storage.preserve_original(source, input_root, originals_dir)
+
+    assert preserved == originals_dir / "Artist" / "song.mp3"
+    assert preserved.read_bytes() == b"audio"
+    assert source.exists()
+
+
+def test_preserve_original_move(storage, tmp_path):
+    source = tmp_path / "song.mp3"
+    source.write_bytes(b"audio")
+
+    preserved = storage.preserve_original(
+        source, tmp_path, tmp_path / "originals", move=True
+    )
+
+    assert preserved.exists()
+    assert not source.exists()
+
+
+def test_lock_for_normalizes_path(storage, tmp_path):
+    direct = tmp_path / "out" / "song.flac"
+    indirect = tmp_path / "out" / "sub" / ".." / "song.flac"
+
+    assert storage.lock_for(direct) is storage.lock_for(indirect)
+
+
+def test_concurrent_writes_to_same_path_do_not_interleave(storage, tmp_path):
+    destination = tmp_path / "song.flac"
+    size = 1024 * 1024
+    contents = [bytes([value]) * size for value in range(16)]
+
+    threads = [
+        threading.Thread(target=storage.save_file, args=(destination, content))
+        for content in contents
+    ]
+    for thread in threads:
+        thread.start()
+    for thread in threads:
+        thread.join()
+
+    data = destination.read_bytes()
+    assert data in contents
+
+
+@pytest.mark.asyncio
+async def test_locked_async_serializes_writers(storage, tmp_path):
+    destination = tmp_path / "song.flac"
+    active = []
+    overlaps = []
+
+    async def writer():
+        async with storage.locked_async(destination):
+            active.append(1)
+            overlaps.append(len(active))
+            await asyncio.sleep(0.01)
+            active.pop()
+
+    await asyncio.gather(*(writer() for _ in range(5)))
+
+    assert overlaps == [1] * 5
+
+
+@pytest.mark.asyncio
+async def test_locked_async_waiters_use_no_threads(storage, tmp_path):
+    destination = tmp_path / "song.flac"
+    held = asyncio.Event()
+    release = asyncio.Event()
+
+    async def holder():
+        async with storage.locked_async(destination):
+            held.set()
+            await release.wait()
+
+    async def waiter():
+        async with storage.locked_async(destination):
+            pass
+
+    with patch("asyncio.to_thread", side_effect=AssertionError("thread used")):
+        holding = asyncio.create_task(holder())
+        await held.wait()
+        waiting = [asyncio.create_task(waiter()) for _ in range(50)]
+        await asyncio.sleep(0.01)
+        assert not any(task.done() for task in waiting)
+        release.set()
+        await asyncio.gather(holding, *waiting)
+
+    assert storage._async_locks == {}
+
+
+@pytest.mark.asyncio
+async def test_locked_async_waits_for_thread_holder(storage, tmp_path):
+    destination = tmp_path / "song.flac"
+    events = []
+    held = threading.Event()
+
+    def thread_writer():
+        with storage.locked(destination):
+            held.set()
+            time.sleep(0.05)
+            events.append("thread")
+
+    thread = threading.Thread(target=thread_writer)
+    thread.start()
+    held.wait()
+    async with storage.locked_async(destination):
+        events.append("async")
+    thread.join()
+
+    assert events == ["thread", "async"]
+
+
+def test_atomic_replace_falls_back_to_copy_across_devices(tmp_path):
+    work_dir = tmp_path / "work"
+    output_dir = tmp_path / "output"
+    work_dir.mkdir()
+    output_dir.mkdir()
+    source = work_dir / "song.flac"
+    source.write_bytes(b"new")
+    destination = output_dir / "song.flac"
+    destination.write_bytes(b"old")
+    real_replace = os.replace
+
+    def replace(src, dst):
+        # Renames only succeed within one directory, as within one mount
+        if os.path.dirname(src) != os.path.dirname(dst):
+            raise OSError(errno.EXDEV, "Invalid cross-device link")
+        real_replace(src, dst)
+
+    with patch("os.replace", side_effect=replace):
+        atomic_replace(source, destination)
+
+    assert destination.read_bytes() == b"new"
+    assert not source.exists()
+    assert list(output_dir.iterdir()) == [destination]
+
+
+def test_atomic_replace_propagates_other_errors(tmp_path):
+    with pytest.raises(FileNotFoundError):
+        atomic_replace(tmp_path / "missing", tmp_path / "dest")
+
+
+@pytest.mark.parametrize(
+    "name, extension, base",
+    [
+        ("song.MP3", ".mp3", "song"),
+        ("song.Mp3", ".mp3", "song"),
+        ("movie.mkv.mkv", ".mkv", "movie"),
+        ("movie.MKV.mkv", ".mkv", "movie"),
+        ("Live.1999.flac", ".flac", "Live.1999"),
+        ("README", "", "README"),
+    ],
+)
+def test_extension_normalization(name, extension, base):
+    assert normalized_extension(Path(name)) == extension
+    assert base_name(Path(name)) == base
+
+
+@pytest.mark.asyncio
+async def test_locked_async_across_processes_serializes_storages(tmp_path):
+    # Separate Storage instances stand in for separate processes
+    output = tmp_path / "song.flac"
+    events = []
+
+    async def write(storage, name):
+        async with storage.locked_async(output, across_processes=True):
+            events.append(f"{name} start")
+            await asyncio.sleep(0.05)
+            events.append(f"{name} end")
+
+    await asyncio.gather(write(Storage(), "a"), write(Storage(), "b"))
+
+    assert events in (
+        ["a start", "a end", "b start", "b end"],
+        ["b start", "b end", "a start", "a end"],
+    )
+    assert not (tmp_path / ".song.flac.lock").exists()
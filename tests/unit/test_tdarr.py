@@ -0,0 +1,54 @@
+"""Unit tests for the Tdarr integration."""
+
+import asyncio
+import time
+import pytest
+from unittest.mock import patch
+
+from src.integrations.tdarr import TdarrClient
+
+
+@pytest.fixture
+def client():
+    return TdarrClient("http://tdarr:8265", poll_interval=30.0)
+
+
+@pytest.mark.asyncio
+async def test_wait_for_job_returns_terminal_job(client):
+    statuses = iter([{"status": "running"}, {"status": "Completed"}])
+
+    with patch.object(client, "get_job_status", side_effect=lambda _: next(statuses)):
+        job = await client.wait_for_job("job-1", poll_interval=0.01)
+
+    assert job["status"] == "Completed"
+
+
+@pytest.mark.asyncio
+async def test_wait_for_job_times_out(client):
+    with patch.object(client, "get_job_status", return_value={"status": "running"}):
+        with pytest.raises(TimeoutError):
+            await client.wait_for_job("job-1", timeout=0.05, poll_interval=0.01)
+
+
+@pytest.mark.asyncio
+async def test_wait_for_job_cancellation_returns_promptly(client):
+    with patch.object(client, "get_job_status", return_value={"status": "running"}):
+        # Poll interval is 30s, so only cancellation can end this wait quickly
+        task = asyncio.create_task(client.wait_for_job("job-1"))
+        await asyncio.sleep(0.05)
+
+        start = time.monotonic()
+        task.cancel()
+        with pytest.raises(asyncio.CancelledError):
+            await task
+
+    assert time.monotonic() - start < 1.0
+
+
+def test_from_config_reads_poll_interval():
+    client = TdarrClient.from_config(
+        {"url": "http://tdarr:8265/", "api_key": "k", "poll_interval": 2}
+    )
+
+    assert client.url == "http://tdarr:8265"
+    assert client.poll_interval == 2.0
@@ -0,0 +1,39 @@
+"""Unit tests for the telemetry counters."""
+
+import threading
+
+from src.telemetry.telemetry import FILES_SKIPPED, TelemetryProvider
+
+
+def test_record_file_skipped_labels_by_reason():
+    telemetry = TelemetryProvider()
+
+    telemetry.record_file_skipped("flac", "already_converted")
+    telemetry.record_file_skipped("flac", "already_converted")
+    telemetry.record_file_skipped("mp3", "too_small")
+
+    assert (
+        telemetry.value(FILES_SKIPPED, file_type="flac", reason="already_converted")
+        == 2
+    )
+    assert telemetry.value(FILES_SKIPPED, file_type="mp3", reason="too_small") == 1
+    assert telemetry.value(FILES_SKIPPED, file_type="mp3", reason="other") == 0
+
+
+def test_counters_are_thread_safe():
+    telemetry = TelemetryProvider()
+
+    def record():
+        for _ in range(1000):
+            telemetry.record_file_skipped("flac", "already_converted")
+
+    threads = [threading.Thread(target=record) for _ in range(8)]
+    for thread in threads:
+        thread.start()
+    for thread in threads:
+        thread.join()
+
+    assert (
+        telemetry.value(FILES_SKIPPED, file_type="flac", reason="already_converted")
+        == 8000
+    )
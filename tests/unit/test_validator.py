@@ -1,5 +1,11 @@
+import json
+import os
+import subprocess
+import sys
+from unittest.mock import patch
+
 import pytest
-from src.validator.validator import Validator
+from src.validator.validator import MediaProbeError, MediaType, Validator
 
 
 @pytest.fixture
@@ -27,3 +33,125 @@ def test_validate_directory(validator, tmp_path):
 
     assert valid_file in valid_files
     assert invalid_file not in valid_files
+
+
+@pytest.mark.parametrize("extension", [".dsf", ".dff"])
+def test_validate_dsd_file(validator, tmp_path, extension):
+    dsd_file = tmp_path / f"test{extension}"
+    dsd_file.touch()
+
+    assert validator.validate_file(dsd_file) is True
+
+
+@pytest.mark.asyncio
+async def test_validate_media_integrity(validator, tmp_path):
+    intact = tmp_path / "intact.flac"
+    intact.write_bytes(b"fLaC" + b"\x00" * 64)
+    empty = tmp_path / "empty.flac"
+    empty.touch()
+    garbage = tmp_path / "garbage.mp3"
+    garbage.write_bytes(b"\x00" * 64)
+    truncated = tmp_path / "truncated.wav"
+    # RIFF header declaring 1000 bytes, with only 44 present
+    header = b"RIFF" + (992).to_bytes(4, "little") + b"WAVE"
+    truncated.write_bytes(header + b"\x00" * 32)
+
+    assert await validator.validate_media_integrity(intact) is None
+    assert "empty" in await validator.validate_media_integrity(empty)
+    assert await validator.validate_media_integrity(garbage) is not None
+    assert "Incomplete" in await validator.validate_media_integrity(truncated)
+
+
+AUDIO_ONLY_MKV = {
+    "streams": [
+        {"codec_type": "audio", "codec_name": "flac"},
+        {
+            "codec_type": "video",
+            "codec_name": "mjpeg",
+            "disposition": {"attached_pic": 1},
+        },
+    ]
+}
+
+VIDEO_MKV = {
+    "streams": [
+        {"codec_type": "video", "codec_name": "h264", "disposition": {}},
+        {"codec_type": "audio", "codec_name": "aac"},
+        {"codec_type": "subtitle", "codec_name": "subrip"},
+    ]
+}
+
+
+@pytest.mark.parametrize(
+    "probe,expected",
+    [(AUDIO_ONLY_MKV, MediaType.AUDIO), (VIDEO_MKV, MediaType.VIDEO)],
+)
+def test_classify_by_probe(validator, tmp_path, probe, expected):
+    mkv = tmp_path / "media.mkv"
+    mkv.touch()
+
+    with patch("subprocess.check_output", return_value=json.dumps(probe)):
+        assert validator.classify_by_probe(mkv) == expected
+        assert validator.classify(mkv) == expected
+
+
+def test_classify_uses_extension_when_unambiguous(validator, tmp_path):
+    with patch("subprocess.check_output") as mock_probe:
+        assert validator.classify(tmp_path / "song.flac") == MediaType.AUDIO
+        assert validator.classify(tmp_path / "film.mp4") == MediaType.VIDEO
+        assert validator.classify(tmp_path / "notes.txt") == MediaType.UNKNOWN
+
+    mock_probe.assert_not_called()
+
+
+@pytest.mark.parametrize("name", ["song.MP3", "song.Mp3", "song.mp3.mp3"])
+def test_mixed_case_and_doubled_extensions(validator, tmp_path, name):
+    path = tmp_path / name
+    path.touch()
+
+    assert validator.validate_file(path) is True
+    with patch("subprocess.check_output") as mock_probe:
+        assert validator.classify(path) == MediaType.AUDIO
+    mock_probe.assert_not_called()
+
+
+def test_classify_doubled_mkv_extension_by_probe(validator, tmp_path):
+    mkv = tmp_path / "movie.MKV.mkv"
+    mkv.touch()
+
+    with patch("subprocess.check_output", return_value=json.dumps(VIDEO_MKV)):
+        assert validator.classify(mkv) == MediaType.VIDEO
+
+
+def test_classify_unknown_when_probe_fails(validator, tmp_path):
+    stream = tmp_path / "capture.ts"
+    stream.touch()
+
+    with patch(
+        "subprocess.check_output",
+        side_effect=subprocess.CalledProcessError(1, "ffprobe"),
+    ):
+        assert validator.classify(stream) == MediaType.UNKNOWN
+        with pytest.raises(MediaProbeError):
+            validator.classify_by_probe(stream)
+
+
+@pytest.fixture
+def hanging_ffprobe(tmp_path, monkeypatch):
+    """Put an ffprobe on PATH that never answers."""
+    bin_dir = tmp_path / "bin"
+    bin_dir.mkdir()
+    ffprobe = bin_dir / "ffprobe"
+    ffprobe.write_text(f"#!{sys.executable}\nimport time\ntime.sleep(30)\n")
+    ffprobe.chmod(0o755)
+    monkeypatch.setenv("PATH", f"{bin_dir}{os.pathsep}{os.environ['PATH']}")
+    return ffprobe
+
+
+def test_probe_streams_times_out(hanging_ffprobe, tmp_path):
+    validator = Validator(probe_timeout=0.2)
+    file_path = tmp_path / "stuck.mkv"
+    file_path.touch()
+
+    with pytest.raises(MediaProbeError, match="Timed out after 0.2s"):
+        validator.probe_streams(file_path)
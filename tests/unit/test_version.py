@@ -0,0 +1,29 @@
+"""Unit tests for build information."""
+
+import platform
+
+from src.version import BUILD_DATE_ENV, GIT_COMMIT_ENV, VERSION, build_info
+
+
+def test_build_info_reads_injected_values(monkeypatch):
+    monkeypatch.setenv(GIT_COMMIT_ENV, "abc1234")
+    monkeypatch.setenv(BUILD_DATE_ENV, "2024-05-01T12:00:00Z")
+
+    info = build_info().to_dict()
+
+    assert info == {
+        "version": VERSION,
+        "python_version": platform.python_version(),
+        "git_commit": "abc1234",
+        "build_date": "2024-05-01T12:00:00Z",
+    }
+
+
+def test_build_info_defaults_to_unknown(monkeypatch):
+    monkeypatch.delenv(GIT_COMMIT_ENV, raising=False)
+    monkeypatch.delenv(BUILD_DATE_ENV, raising=False)
+
+    info = build_info()
+
+    assert (info.git_commit, info.build_date) == ("unknown", "unknown")
+    assert str(info).startswith(f"media-refinery {VERSION} (commit unknown")
@@ -0,0 +1,664 @@
+import asyncio
+import json
+import os
+import subprocess
+import sys
+import pytest
+from pathlib import Path
+from unittest.mock import patch
+
+from src.video.converter import (
+    Config,
+    ProgressParser,
+    VideoConversionError,
+    VideoConverter,
+    VideoOutputError,
+)
+
+
+def _converter(**kwargs):
+    config = Config(
+        input_dir="/input",
+        output_dir="/output",
+        format=kwargs.pop("format", "mkv"),
+        preserve_metadata=True,
+        compression_level=5,
+        dry_run=kwargs.pop("dry_run", False),
+        state_dir="/state",
+        **kwargs,
+    )
+    return VideoConverter(config=config)
+
+
+def test_build_args_vp9_webm():
+    converter = _converter(format="webm", video_codec="vp9", quality="high")
+
+    args = converter.build_ffmpeg_args(Path("/in/film.mkv"), Path("/out/film.webm"))
+
+    assert args[args.index("-c:v") + 1] == "libvpx-vp9"
+    assert args[args.index("-crf") + 1] == "24"
+    assert args[args.index("-b:v") + 1] == "0"
+    assert args[args.index("-c:a") + 1] == "libopus"
+    assert "-c:s" not in args
+    assert args[-1] == "/out/film.webm"
+
+
+@pytest.mark.parametrize(
+    "encoder,expected",
+    [("libsvtav1", ["-preset", "8"]), ("libaom-av1", ["-b:v", "0", "-row-mt", "1"])],
+)
+def test_build_args_av1(encoder, expected):
+    converter = _converter(format="webm", video_codec="av1", av1_encoder=encoder)
+
+    args = converter.build_ffmpeg_args(Path("/in/film.mkv"), Path("/out/film.webm"))
+
+    assert args[args.index("-c:v") + 1] == encoder
+    assert args[args.index("-crf") + 1] == "30"
+    start = args.index(expected[0])
+    assert args[start : start + len(expected)] == expected
+
+
+def test_build_args_h264_mkv_keeps_all_streams():
+    converter = _converter(video_codec="h264")
+
+    args = converter.build_ffmpeg_args(Path("/in/film.mkv"), Path("/out/film.mkv"))
+
+    assert args[args.index("-map") + 1] == "0"
+    assert args[args.index("-c:v") + 1] == "libx264"
+    assert args[args.index("-c:a") + 1] == "copy"
+
+
+@pytest.mark.parametrize("source_codecs", [None, ("h264", ["aac"])])
+def test_build_args_mkv_to_mp4_maps_video_and_audio_only(source_codecs):
+    converter = _converter(format="mp4", video_codec="h264")
+
+    args = converter.build_ffmpeg_args(
+        Path("/in/film.mkv"), Path("/out/.film.tmp.mp4"), source_codecs
+    )
+
+    maps = [args[i + 1] for i, arg in enumerate(args) if arg == "-map"]
+    assert maps == ["0:v", "0:a?"]
+    assert "-c:s" not in args
+    assert "-map_metadata:s:s" not in args
+    assert args[args.index("-c:a") + 1] == "copy"
+
+
+def test_build_args_rejects_h264_in_webm():
+    converter = _converter(format="webm", video_codec="h264")
+
+    with pytest.raises(ValueError):
+        converter.build_ffmpeg_args(Path("/in/film.mkv"), Path("/out/film.webm"))
+
+
+def test_build_args_remuxes_compatible_source():
+    converter = _converter(video_codec="h264")
+
+    args = converter.build_ffmpeg_args(
+        Path("/in/film.mp4"), Path("/out/film.mkv"), source_codecs=("h264", ["aac"])
+    )
+
+    assert args[args.index("-c:v") + 1] == "copy"
+    assert args[args.index("-c:a") + 1] == "copy"
+    assert "-crf" not in args
+
+
+def _pairs(args, option_prefix):
+    return [
+        (arg, args[index + 1])
+        for index, arg in enumerate(args)
+        if arg.startswith(option_prefix)
+    ]
+
+
+def test_build_args_remux_maps_per_stream_metadata():
+    converter = _converter(video_codec="h264")
+
+    args = converter.build_ffmpeg_args(
+        Path("/in/film.mp4"), Path("/out/film.mkv"), source_codecs=("h264", ["aac"])
+    )
+
+    assert _pairs(args, "-map_metadata") == [
+        ("-map_metadata", "0"),
+        ("-map_metadata:s:v", "0:s:v"),
+        ("-map_metadata:s:a", "0:s:a"),
+        ("-map_metadata:s:s", "0:s:s"),
+    ]
+    # Mappings are output options, so they must precede the output path
+    assert args.index("-map_metadata:s:s") < len(args) - 1
+
+
+def test_build_args_webm_maps_metadata_for_mapped_streams_only():
+    converter = _converter(video_codec="vp9")
+
+    args = converter.build_ffmpeg_args(Path("/in/film.mkv"), Path("/out/film.webm"))
+
+    assert ("-map_metadata:s:s", "0:s:s") not in _pairs(args, "-map_metadata")
+    assert ("-map_metadata:s:a", "0:s:a") in _pairs(args, "-map_metadata")
+
+
+def test_build_args_stream_metadata_mapping_can_be_disabled():
+    converter = _converter(video_codec="h264", preserve_stream_metadata=False)
+
+    args = converter.build_ffmpeg_args(Path("/in/film.mkv"), Path("/out/film.mkv"))
+
+    assert _pairs(args, "-map_metadata") == [("-map_metadata", "0")]
+
+
+@pytest.mark.parametrize(
+    "remux,source_codecs",
+    [(True, ("mpeg4", ["aac"])), (False, ("h264", ["aac"])), (True, None)],
+)
+def test_build_args_encodes_when_remux_not_possible(remux, source_codecs):
+    converter = _converter(video_codec="h264", remux_when_compatible=remux)
+
+    args = converter.build_ffmpeg_args(
+        Path("/in/film.mp4"), Path("/out/film.mkv"), source_codecs=source_codecs
+    )
+
+    assert args[args.index("-c:v") + 1] == "libx264"
+
+
+def test_can_remux_webm_requires_opus_audio():
+    converter = _converter(format="webm", video_codec="vp9")
+
+    assert converter.can_remux(("vp9", ["opus"]), is_webm=True)
+    assert not converter.can_remux(("vp9", ["aac"]), is_webm=True)
+
+
+def test_build_args_applies_user_video_filters():
+    converter = _converter(video_codec="h264", video_filters=["yadif", "hqdn3d"])
+
+    args = converter.build_ffmpeg_args(
+        Path("/in/film.mp4"), Path("/out/film.mkv"), source_codecs=("h264", ["aac"])
+    )
+
+    # Filtering rules out a remux even though the codecs match
+    assert args[args.index("-vf") + 1] == "yadif,hqdn3d"
+    assert args[args.index("-c:v") + 1] == "libx264"
+
+
+def test_build_args_rejects_filters_with_copy():
+    converter = _converter(video_codec="copy", video_filters=["yadif"])
+
+    with pytest.raises(ValueError):
+        converter.build_ffmpeg_args(Path("/in/film.mkv"), Path("/out/film.mkv"))
+
+
+def test_build_args_exact_resolution_uses_size_option():
+    converter = _converter(resolution="1280x720", resolution_mode="exact")
+
+    args = converter.build_ffmpeg_args(Path("/in/film.mp4"), Path("/out/film.mkv"))
+
+    assert args[args.index("-s") + 1] == "1280x720"
+    assert "-vf" not in args
+
+
+def test_build_args_max_resolution_only_downscales():
+    converter = _converter(
+        resolution="1920x1080", resolution_mode="max", video_filters=["yadif"]
+    )
+
+    args = converter.build_ffmpeg_args(
+        Path("/in/film.mp4"), Path("/out/film.mkv"), source_codecs=("h264", ["aac"])
+    )
+
+    # Scaling rules out a remux; the guard runs ahead of user filters
+    assert args[args.index("-vf") + 1] == (
+        "scale='min(iw,1920)':'min(ih,1080)':force_original_aspect_ratio=decrease"
+        ",yadif"
+    )
+    assert "-s" not in args
+
+
+@pytest.mark.parametrize("resolution", ["keep", "", None])
+def test_build_args_keep_resolution_does_not_scale(resolution):
+    converter = _converter(resolution=resolution, resolution_mode="max")
+
+    args = converter.build_ffmpeg_args(Path("/in/film.mp4"), Path("/out/film.mkv"))
+
+    assert "-s" not in args
+    assert "-vf" not in args
+
+
+@pytest.mark.parametrize(
+    "kwargs",
+    [
+        {"resolution": "1080p"},
+        {"resolution": "0x720"},
+        {"resolution": "1280x720", "resolution_mode": "min"},
+    ],
+)
+def test_config_rejects_invalid_resolution(kwargs):
+    with pytest.raises(ValueError):
+        _converter(**kwargs)
+
+
+def test_build_args_rejects_scaling_with_copy():
+    converter = _converter(video_codec="copy", resolution="1280x720")
+
+    with pytest.raises(ValueError):
+        converter.build_ffmpeg_args(Path("/in/film.mkv"), Path("/out/film.mkv"))
+
+
+def _fake_run_ffmpeg(content=b"\x1a\x45\xdf\xa3" + b"\x00" * 64):
+    """Stand-in for run_ffmpeg that writes the command's output."""
+
+    def run(command, input_path, progress_callback=None):
+        output = Path(command[-1])
+        if output.suffix in (".m3u8", ".mpd"):
+            output.write_text("manifest")
+            (output.parent / f"{output.parent.name}_00000.m4s").write_bytes(content)
+        else:
+            output.write_bytes(content)
+
+    return run
+
+
+@pytest.mark.asyncio
+async def test_convert_writes_single_extension_for_doubled_input(tmp_path):
+    converter = _converter(format="mkv")
+
+    with patch.object(converter, "probe_codecs", return_value=None), patch.object(
+        converter, "run_ffmpeg", side_effect=_fake_run_ffmpeg()
+    ), patch.object(converter, "validate_output"):
+        output = await converter.convert(Path("/in/movie.mkv.mkv"), tmp_path)
+
+    assert output.name == "movie.mkv"
+    assert [p.name for p in tmp_path.iterdir()] == ["movie.mkv"]
+
+
+@pytest.mark.asyncio
+async def test_convert_encodes_to_temp_file_and_renames(tmp_path):
+    converter = _converter(format="mkv")
+    commands = []
+
+    updates = []
+
+    def run(command, input_path, progress_callback=None):
+        commands.append(command)
+        progress_callback(50.0, "2x")
+        _fake_run_ffmpeg()(command, input_path)
+
+    with patch.object(converter, "probe_codecs", return_value=("h265", ["aac"])), patch(
+        "src.video.converter.subprocess.check_output",
+        return_value=_probe_output("h264", "aac"),
+    ), patch.object(converter, "run_ffmpeg", side_effect=run):
+        output = await converter.convert(
+            Path("/in/film.mp4"),
+            tmp_path,
+            progress_callback=lambda *update: updates.append(update),
+        )
+
+    assert output == tmp_path / "film.mkv"
+    assert output.read_bytes().startswith(b"\x1a\x45\xdf\xa3")
+    assert updates == [(50.0, "2x")]
+    assert commands[0][-1] == str(tmp_path / ".film.tmp.mkv")
+    assert commands[0][commands[0].index("-c:v") + 1] == "libx264"
+
+
+@pytest.mark.asyncio
+async def test_convert_failure_leaves_no_output(tmp_path):
+    converter = _converter(format="mkv")
+    failure = subprocess.CalledProcessError(
+        1, ["ffmpeg"], stderr="frame=1\nConversion failed!\n"
+    )
+
+    def run(command, input_path, progress_callback=None):
+        Path(command[-1]).write_bytes(b"partial")
+        raise failure
+
+    with patch.object(converter, "probe_codecs", return_value=None), patch.object(
+        converter, "run_ffmpeg", side_effect=run
+    ):
+        with pytest.raises(VideoConversionError, match="Conversion failed!"):
+            await converter.convert(Path("/in/film.mp4"), tmp_path)
+
+    assert list(tmp_path.iterdir()) == []
+
+
+@pytest.mark.asyncio
+async def test_convert_rejects_empty_output(tmp_path):
+    converter = _converter(format="mkv")
+
+    with patch.object(converter, "probe_codecs", return_value=None), patch.object(
+        converter, "run_ffmpeg", side_effect=_fake_run_ffmpeg(b"")
+    ):
+        with pytest.raises(VideoOutputError, match="empty"):
+            await converter.convert(Path("/in/film.mp4"), tmp_path)
+
+    assert list(tmp_path.iterdir()) == []
+
+
+def test_build_args_detects_webm_output_case_insensitively():
+    converter = _converter(video_codec="vp9")
+
+    args = converter.build_ffmpeg_args(Path("/in/film.MKV"), Path("/out/film.WEBM"))
+
+    assert args[args.index("-c:a") + 1] == "libopus"
+
+
+def test_build_args_hls_segments(tmp_path):
+    converter = _converter(segment_output="hls", segment_duration=4)
+    output = converter.get_output_path(Path("/in/film.mkv"), tmp_path)
+
+    args = converter.build_ffmpeg_args(Path("/in/film.mkv"), output)
+
+    assert output == tmp_path / "film"
+    maps = [args[index + 1] for index, arg in enumerate(args) if arg == "-map"]
+    assert maps == ["0:v:0", "0:a?"]
+    assert ("-map_metadata:s:s", "0:s:s") not in _pairs(args, "-map_metadata")
+    assert args[args.index("-c:v") + 1] == "libx264"
+    assert args[args.index("-force_key_frames") + 1] == "expr:gte(t,n_forced*4)"
+    assert args[args.index("-c:a") + 1] == "aac"
+    assert "-c:s" not in args
+    assert args[args.index("-f") + 1] == "hls"
+    assert args[args.index("-hls_time") + 1] == "4"
+    assert args[args.index("-hls_segment_type") + 1] == "fmp4"
+    assert args[args.index("-hls_segment_filename") + 1] == str(
+        tmp_path / "film" / "film_%05d.m4s"
+    )
+    assert args[-1] == str(tmp_path / "film" / "film.m3u8")
+
+
+def test_build_args_hls_remux_copies_video_only():
+    converter = _converter(segment_output="hls")
+
+    args = converter.build_ffmpeg_args(
+        Path("/in/film.mkv"), Path("/out/film"), source_codecs=("h264", ["dts"])
+    )
+
+    assert args[args.index("-c:v") + 1] == "copy"
+    assert args[args.index("-c:a") + 1] == "aac"
+    assert "-force_key_frames" not in args
+    assert args[-1] == "/out/film/film.m3u8"
+
+
+def test_build_args_dash_segments():
+    converter = _converter(segment_output="DASH", segment_duration=2.5)
+
+    args = converter.build_ffmpeg_args(Path("/in/film.mkv"), Path("/out/film"))
+
+    assert args[args.index("-f") + 1] == "dash"
+    assert args[args.index("-seg_duration") + 1] == "2.5"
+    assert args[-1] == "/out/film/film.mpd"
+
+
+@pytest.mark.parametrize(
+    "kwargs",
+    [{"segment_output": "smooth"}, {"segment_output": "hls", "segment_duration": 0}],
+)
+def test_config_rejects_invalid_segmenting(kwargs):
+    with pytest.raises(ValueError):
+        _converter(**kwargs)
+
+
+@pytest.mark.asyncio
+async def test_convert_segmented_output_is_a_directory(tmp_path):
+    converter = _converter(segment_output="hls")
+    (tmp_path / "film").mkdir()
+    (tmp_path / "film" / "film_00001.m4s").write_text("stale segment")
+
+    with patch.object(converter, "probe_codecs", return_value=None), patch.object(
+        converter, "run_ffmpeg", side_effect=_fake_run_ffmpeg()
+    ):
+        output = await converter.convert(Path("/in/film.mkv"), tmp_path)
+
+    assert output == tmp_path / "film"
+    assert sorted(p.name for p in output.iterdir()) == ["film.m3u8", "film_00000.m4s"]
+
+
+def _probe_output(video, *audio):
+    streams = [{"codec_type": "video", "codec_name": video}]
+    streams += [{"codec_type": "audio", "codec_name": codec} for codec in audio]
+    return json.dumps({"streams": streams})
+
+
+@pytest.mark.parametrize("video_codec,action", [("h264", "remux"), ("h265", "encode")])
+@pytest.mark.asyncio
+async def test_dry_run_plan_uses_probed_codecs(tmp_path, video_codec, action):
+    converter = _converter(dry_run=True, video_codec=video_codec)
+
+    with patch(
+        "src.video.converter.subprocess.check_output",
+        return_value=_probe_output("h264", "aac"),
+    ):
+        plan = converter.plan(Path("/in/film.mp4"), tmp_path)
+        output = await converter.convert(Path("/in/film.mp4"), tmp_path)
+
+    assert plan.source_codecs == ("h264", ["aac"])
+    assert plan.action == action
+    expected_codec = "copy" if action == "remux" else "libx265"
+    assert plan.command[plan.command.index("-c:v") + 1] == expected_codec
+    assert output == tmp_path / "film.mkv"
+    assert list(tmp_path.iterdir()) == []
+
+
+def test_dry_run_plan_encodes_unprobed_source(tmp_path):
+    converter = _converter(dry_run=True)
+
+    with patch(
+        "src.video.converter.subprocess.check_output",
+        side_effect=FileNotFoundError("ffprobe"),
+    ):
+        plan = converter.plan(Path("/in/film.mp4"), tmp_path)
+
+    assert plan.source_codecs is None
+    assert plan.action == "encode"
+
+
+CODEC_POLICY = {"h265": "remux", "h264": "h265", "mpeg2": "h265", "vc1": "transcode"}
+
+
+@pytest.mark.parametrize(
+    "source,action,encoder",
+    [
+        ("hevc", "remux", "copy"),
+        ("h264", "encode", "libx265"),
+        ("mpeg2video", "encode", "libx265"),
+        ("vc1", "encode", "libx264"),
+        ("mpeg4", "encode", "libx264"),
+    ],
+)
+def test_codec_actions_choose_per_source_codec(source, action, encoder):
+    converter = _converter(video_codec="h264", codec_actions=CODEC_POLICY)
+
+    args = converter.build_ffmpeg_args(
+        Path("/in/film.mp4"), Path("/out/film.mkv"), source_codecs=(source, ["aac"])
+    )
+
+    assert converter.choose_action((source, ["aac"]), is_webm=False)[0] == action
+    assert args[args.index("-c:v") + 1] == encoder
+
+
+def test_codec_actions_remux_encodes_when_filtering():
+    converter = _converter(
+        video_codec="h264", codec_actions={"h265": "remux"}, video_filters=["yadif"]
+    )
+
+    action = converter.choose_action(("hevc", ["aac"]), is_webm=False)
+
+    assert action == ("encode", "h264")
+
+
+@pytest.mark.asyncio
+async def test_codec_actions_skip_leaves_source_alone(tmp_path):
+    converter = _converter(codec_actions={"av1": "skip"})
+
+    with patch(
+        "src.video.converter.subprocess.check_output",
+        return_value=_probe_output("av1", "opus"),
+    ):
+        plan = converter.plan(Path("/in/film.mkv"), tmp_path)
+        output = await converter.convert(Path("/in/film.mkv"), tmp_path)
+
+    assert plan.action == "skip"
+    assert plan.command is None
+    assert output is None
+    assert list(tmp_path.iterdir()) == []
+
+
+def test_config_rejects_invalid_codec_action():
+    with pytest.raises(ValueError, match="Invalid codec action"):
+        _converter(codec_actions={"h264": "mpeg2"})
+
+
+def test_progress_parser_reports_percent_and_speed():
+    parser = ProgressParser(total_duration=200.0)
+    lines = [
+        "frame=120",
+        "total_size=1048576",
+        "out_time_us=50000000",
+        "out_time_ms=50000000",
+        "speed=2.5x",
+        "progress=continue",
+        "out_time_us=N/A",
+        "speed=N/A",
+        "progress=continue",
+        "out_time_us=199000000",
+        "speed=2.4x",
+        "progress=end",
+    ]
+
+    updates = [update for update in map(parser.feed, lines) if update]
+
+    assert updates == [(25.0, "2.5x"), (0.0, "N/A"), (100.0, "2.4x")]
+
+
+def test_progress_parser_without_duration():
+    parser = ProgressParser(total_duration=None)
+
+    assert parser.feed("out_time_us=1000000") is None
+    assert parser.feed("progress=continue") == (None, "")
+
+
+@pytest.fixture
+def real_subprocess():
+    """Undo conftest's subprocess mock so a fake FFmpeg script really runs."""
+    real = asyncio.subprocess.create_subprocess_exec
+    with patch("asyncio.create_subprocess_exec", real):
+        yield
+
+
+def _fake_ffmpeg_script(tmp_path, body):
+    fake_ffmpeg = tmp_path / "ffmpeg"
+    fake_ffmpeg.write_text(f"#!{sys.executable}\nimport os, sys, time\n{body}")
+    fake_ffmpeg.chmod(0o755)
+    return fake_ffmpeg
+
+
+@pytest.mark.asyncio
+async def test_run_ffmpeg_reports_progress(tmp_path, real_subprocess):
+    fake_ffmpeg = _fake_ffmpeg_script(
+        tmp_path,
+        "assert sys.argv[1:4] == ['-progress', 'pipe:1', '-nostats']\n"
+        "print('out_time_us=5000000\\nspeed=1x\\nprogress=continue')\n"
+        "print('out_time_us=10000000\\nspeed=1.1x\\nprogress=end')\n",
+    )
+    updates = []
+    converter = _converter()
+    converter.progress_callback = lambda percent, speed: updates.append(
+        (percent, speed)
+    )
+
+    with patch.object(converter, "probe_duration", return_value=10.0):
+        await converter.run_ffmpeg(
+            [str(fake_ffmpeg), "-i", "in.mkv", "out.mkv"], "in.mkv"
+        )
+
+    assert updates == [(50.0, "1x"), (100.0, "1.1x")]
+
+
+@pytest.mark.asyncio
+async def test_run_ffmpeg_failure_carries_stderr(tmp_path, real_subprocess):
+    fake_ffmpeg = _fake_ffmpeg_script(
+        tmp_path, "sys.stderr.write('Invalid data found\\n')\nsys.exit(1)\n"
+    )
+    converter = _converter()
+
+    with patch.object(converter, "probe_duration", return_value=None):
+        with pytest.raises(subprocess.CalledProcessError) as error:
+            await converter.run_ffmpeg([str(fake_ffmpeg), "-i", "in.mkv"], "in.mkv")
+
+    assert "Invalid data found" in error.value.stderr
+
+
+@pytest.mark.skipif(not sys.platform.startswith("linux"), reason="Linux only")
+@pytest.mark.asyncio
+async def test_run_ffmpeg_applies_niceness(tmp_path, real_subprocess):
+    fake_ffmpeg = _fake_ffmpeg_script(
+        tmp_path,
+        "sys.stderr.write(str(os.getpriority(os.PRIO_PROCESS, 0)))\nsys.exit(1)\n",
+    )
+    converter = _converter()
+    converter.niceness = 19
+
+    with patch.object(converter, "probe_duration", return_value=None):
+        with pytest.raises(subprocess.CalledProcessError) as error:
+            await converter.run_ffmpeg([str(fake_ffmpeg), "-i", "in.mkv"], "in.mkv")
+
+    assert error.value.stderr == "19"
+
+
+@pytest.mark.asyncio
+async def test_convert_timeout_kills_ffmpeg_and_leaves_no_output(
+    tmp_path, real_subprocess
+):
+    pid_file = tmp_path / "ffmpeg.pid"
+    fake_ffmpeg = _fake_ffmpeg_script(
+        tmp_path,
+        f"open({str(pid_file)!r}, 'w').write(str(os.getpid()))\n"
+        "open(sys.argv[-1], 'wb').write(b'partial')\n"
+        "time.sleep(30)\n",
+    )
+    output_dir = tmp_path / "out"
+    output_dir.mkdir()
+    converter = _converter()
+    converter.encode_timeout = 1
+
+    def build(input_path, target, source_codecs=None):
+        return [str(fake_ffmpeg), str(target)]
+
+    with patch.object(converter, "probe_codecs", return_value=None), patch.object(
+        converter, "probe_duration", return_value=None
+    ), patch.object(converter, "build_ffmpeg_args", side_effect=build):
+        with pytest.raises(VideoConversionError, match="timed out after 1s"):
+            await converter.convert(Path("/in/film.mkv"), output_dir)
+
+    assert list(output_dir.iterdir()) == []
+    with pytest.raises(ProcessLookupError):
+        os.kill(int(pid_file.read_text()), 0)
+
+
+def test_validate_output_checks_size_and_video_stream(tmp_path):
+    converter = _converter()
+    output = tmp_path / "film.mkv"
+    output.write_bytes(b"")
+
+    with pytest.raises(VideoOutputError, match="empty"):
+        converter.validate_output(output)
+
+    output.write_bytes(b"\x1a\x45\xdf\xa3" + b"\x00" * 64)
+    with patch(
+        "src.video.converter.subprocess.check_output",
+        return_value=json.dumps({"streams": [{"codec_type": "audio"}]}),
+    ):
+        with pytest.raises(VideoOutputError, match="no video stream"):
+            converter.validate_output(output)
+    with patch(
+        "src.video.converter.subprocess.check_output",
+        return_value=_probe_output("h264", "aac"),
+    ):
+        converter.validate_output(output)
+
+
+def test_validate_output_needs_manifest_and_segments(tmp_path):
+    converter = _converter(segment_output="hls")
+    output = tmp_path / "film"
+    output.mkdir()
+    (output / "film.m3u8").write_text("#EXTM3U\n")
+
+    with pytest.raises(VideoOutputError, match="No segments"):
+        converter.validate_output(output)
+
+    (output / "film_00000.m4s").write_bytes(b"\x00" * 16)
+    converter.validate_output(output)
@@ -1,5 +1,7 @@
+import asyncio
+
 import pytest
-from src.processor.worker_pool import WorkerPool
+from src.processor.worker_pool import MAX_WORKERS, WorkerPool
 
 
 @pytest.mark.asyncio
@@ -14,3 +16,72 @@ async def test_worker_pool():
     await pool.run(tasks)
 
     # Add assertions to verify task execution if needed
+
+
+@pytest.mark.asyncio
+async def test_worker_pool_ramps_up_to_cap():
+    pool = WorkerPool(num_workers=3)
+    worker_counts = []
+
+    async def sample_task():
+        worker_counts.append(len(pool.workers))
+        await asyncio.sleep(0.03)
+
+    await pool.run([sample_task for _ in range(15)], ramp_interval=0.05)
+
+    assert worker_counts[0] == 1
+    assert worker_counts == sorted(worker_counts)
+    assert max(worker_counts) == 3
+
+
+@pytest.mark.asyncio
+async def test_worker_pool_collects_task_errors():
+    pool = WorkerPool(num_workers=2)
+    completed = []
+
+    async def failing_task():
+        raise ValueError("bad input")
+
+    async def cancelled_task():
+        # Cancelled mid-task, e.g. by a deadline inside the task
+        inner = asyncio.ensure_future(asyncio.sleep(10))
+        asyncio.get_running_loop().call_soon(inner.cancel)
+        await inner
+
+    async def ok_task():
+        completed.append(True)
+
+    errors = await pool.run([failing_task, cancelled_task, ok_task, ok_task])
+
+    assert len(completed) == 2
+    assert sorted(type(error).__name__ for error in errors) == [
+        "CancelledError",
+        "ValueError",
+    ]
+    assert await pool.wait_with_errors() == errors
+
+
+@pytest.mark.asyncio
+async def test_worker_pool_reports_tasks_cancelled_with_run():
+    pool = WorkerPool(num_workers=2)
+    started = asyncio.Event()
+
+    async def slow_task():
+        started.set()
+        await asyncio.sleep(10)
+
+    run = asyncio.ensure_future(pool.run([slow_task, slow_task]))
+    await started.wait()
+    run.cancel()
+
+    with pytest.raises(asyncio.CancelledError):
+        await run
+    assert len(pool.errors) == 2
+    assert all(isinstance(e, asyncio.CancelledError) for e in pool.errors)
+    assert all(worker.done() for worker in pool.workers)
+
+
+@pytest.mark.parametrize("num_workers", [0, -1, MAX_WORKERS + 1])
+def test_worker_pool_rejects_invalid_sizes(num_workers):
+    with pytest.raises(ValueError, match="num_workers"):
+        WorkerPool(num_workers=num_workers)